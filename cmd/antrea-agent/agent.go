@@ -16,8 +16,10 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/client-go/informers"
 	"k8s.io/klog"
 
@@ -55,23 +57,40 @@ func run(o *Options) error {
 	}
 
 	// Create ovsdb and openflow clients.
-	ovsdbConnection, err := ovsconfig.NewOVSDBConnectionUDS("")
+	ovsdbConnection, err := ovsconfig.NewOVSDBConnectionUDS("", nil)
 	if err != nil {
 		// TODO: ovsconfig.NewOVSDBConnectionUDS might return timeout in the future, need to add retry
 		return fmt.Errorf("error connecting OVSDB: %v", err)
 	}
-	defer ovsdbConnection.Close()
+	defer ovsconfig.CloseOVSDBConnection(ovsdbConnection)
+	if o.config.MetricsBindAddress != "" {
+		ovsconfig.RegisterMetrics()
+	}
 
 	ovsBridgeClient := ovsconfig.NewOVSBridge(o.config.OVSBridge, o.config.OVSDatapathType, ovsdbConnection)
+	if o.config.EnableHardwareOffload {
+		if err := ovsBridgeClient.SetHardwareOffload(true); err != nil {
+			return fmt.Errorf("error enabling OVS hardware offload: %v", err)
+		}
+		klog.Info("Enabled OVS hardware offload, OVS must be restarted for it to take effect if it was not enabled before")
+	}
+
+	var externalBridgeClient ovsconfig.OVSBridgeClient
+	if o.config.ExternalOVSBridge != "" {
+		externalBridgeClient = ovsconfig.NewOVSBridge(o.config.ExternalOVSBridge, o.config.OVSDatapathType, ovsdbConnection)
+	}
 
-	ofClient := openflow.NewClient(o.config.OVSBridge)
+	ofClient := openflow.NewClient(o.config.OVSBridge, uint16(o.config.CTZone))
 
 	// Create an ifaceStore that caches network interfaces managed by this node.
 	ifaceStore := agent.NewInterfaceStore()
 
+	// The MAC address was checked by validate.
+	podGatewayMAC, _ := parsePodGatewayMAC(o.config.PodGatewayMAC)
 	// Initialize agent and node network.
 	agentInitializer := agent.NewInitializer(
 		ovsBridgeClient,
+		externalBridgeClient,
 		ofClient,
 		k8sClient,
 		ifaceStore,
@@ -80,7 +99,9 @@ func run(o *Options) error {
 		o.config.HostGateway,
 		o.config.TunnelType,
 		o.config.DefaultMTU,
-		o.config.EnableIPSecTunnel)
+		o.config.EnableIPSecTunnel,
+		uint16(o.config.CTZone),
+		podGatewayMAC)
 	err = agentInitializer.Initialize()
 	if err != nil {
 		return fmt.Errorf("error initializing agent: %v", err)
@@ -92,8 +113,11 @@ func run(o *Options) error {
 		ofClient,
 		nodeConfig)
 
-	networkPolicyController := networkpolicy.NewNetworkPolicyController(antreaClient, ofClient, ifaceStore, nodeConfig.Name, nodeConfig.IP.String())
+	networkPolicyController := networkpolicy.NewNetworkPolicyController(antreaClient, ofClient, ifaceStore, nodeConfig.Name, nodeConfig.Gateway.IPForFamily(nodeConfig.PodCIDR.IP).String())
 
+	// The mode was checked by validate.
+	cniSocketMode, _ := parseCNISocketMode(o.config.CNISocketMode)
+	// Pod interfaces are always attached to the integration bridge.
 	cniServer := cniserver.New(
 		o.config.CNISocket,
 		o.config.HostProcPathPrefix,
@@ -102,11 +126,26 @@ func run(o *Options) error {
 		ovsBridgeClient,
 		ofClient,
 		ifaceStore,
-		k8sClient)
+		k8sClient,
+		cniserver.Options{
+			SocketMode:                cniSocketMode,
+			VerifyPodFlows:            o.config.VerifyPodFlows,
+			ContainerIfacePrefix:      o.config.ContainerInterfacePrefix,
+			HashedContainerIfaceNames: o.config.HashedContainerInterfaceNames,
+			ValidatePodExistence:      o.config.ValidatePodExistence,
+			EnablePodRoutesAnnotation: o.config.EnablePodRoutesAnnotation,
+		})
 	err = cniServer.Initialize()
 	if err != nil {
 		return fmt.Errorf("error initializing CNI server: %v", err)
 	}
+	// All the flows have been installed at this point. If flow-restore-wait is still set (e.g.
+	// OVS was restarted and the flag was not cleared), OVS does not forward any traffic.
+	if flowRestoreWait, err := ovsBridgeClient.GetFlowRestoreWait(); err != nil {
+		klog.Errorf("Failed to check whether flow-restore-wait is set in OVS: %v", err)
+	} else if flowRestoreWait {
+		klog.Warning("flow-restore-wait is set in OVS after flows were installed, traffic will not be forwarded until it is cleared")
+	}
 
 	// set up signal capture: the first SIGTERM / SIGINT signal is handled gracefully and will
 	// cause the stopCh channel to be closed; if another signal is received before the program
@@ -125,7 +164,27 @@ func run(o *Options) error {
 
 	go agentMonitor.Run(stopCh)
 
+	if o.config.MetricsBindAddress != "" {
+		go runMetricsServer(o.config.MetricsBindAddress, stopCh)
+	}
+
 	<-stopCh
 	klog.Info("Stopping Antrea agent")
 	return nil
 }
+
+// runMetricsServer serves the metrics of the default Prometheus registry at /metrics on the
+// provided address, until stopCh is closed.
+func runMetricsServer(addr string, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	klog.Infof("Serving metrics on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("Failed to serve metrics on %s: %v", addr, err)
+	}
+}
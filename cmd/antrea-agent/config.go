@@ -20,6 +20,10 @@ import (
 
 type AgentConfig struct {
 	CNISocket string `yaml:"cniSocket,omitempty"`
+	// File mode of the CNI socket, as an octal string. The CNI plugin binary must be able to
+	// connect to the socket.
+	// Defaults to "0600".
+	CNISocketMode string `yaml:"cniSocketMode,omitempty"`
 	// clientConnection specifies the kubeconfig file and client connection settings for the agent
 	// to communicate with the apiserver.
 	ClientConnection componentbaseconfig.ClientConnectionConfiguration `yaml:"clientConnection"`
@@ -36,6 +40,17 @@ type AgentConfig struct {
 	// 'system' is the default value and corresponds to the kernel datapath. Use 'netdev' to run
 	// OVS in userspace mode. Userspace mode requires the tun device driver to be available.
 	OVSDatapathType string `yaml:"ovsDatapathType,omitempty"`
+	// Name of an additional OpenVSwitch bridge antrea-agent will create and connect to ovsBridge
+	// (the integration bridge) with a pair of patch ports, for topologies in which external
+	// traffic goes through a separate bridge. Pod interfaces are always attached to ovsBridge.
+	// It must be different from ovsBridge.
+	// Defaults to no external bridge.
+	ExternalOVSBridge string `yaml:"externalOVSBridge,omitempty"`
+	// Whether or not to enable hardware offload in OpenVSwitch (other_config:hw-offload), for
+	// Nodes with NICs supporting the offload of datapath flows (e.g. SmartNICs). It is set before
+	// the bridge is created, but OpenVSwitch must be restarted for it to take effect.
+	// Defaults to false.
+	EnableHardwareOffload bool `yaml:"enableHardwareOffload,omitempty"`
 	// Name of the interface antrea-agent will create and use for host <--> pod communication.
 	// Make sure it doesn't conflict with your existing interfaces.
 	// Defaults to gw0.
@@ -62,4 +77,45 @@ type AgentConfig struct {
 	// Antrea Agent through an environment variable: ANTREA_IPSEC_PSK.
 	// Defaults to false.
 	EnableIPSecTunnel bool `yaml:"enableIPSecTunnel,omitempty"`
+	// Whether or not to check, after the startup reconciliation of the CNI server, that the flows
+	// of all the local Pods are actually present in OVS. Pods with missing flows are logged. This
+	// requires dumping flows from OVS for every Pod, so it is disabled by default.
+	// Defaults to false.
+	VerifyPodFlows bool `yaml:"verifyPodFlows,omitempty"`
+	// Prefix to use for the name of the host interfaces created for Pods. Only Pod interfaces with
+	// this prefix are garbage-collected by antrea-agent, which makes it possible to share the
+	// OpenVSwitch bridge with other components without collisions. It cannot be longer than 8
+	// characters.
+	// Defaults to no prefix.
+	ContainerInterfacePrefix string `yaml:"containerInterfacePrefix,omitempty"`
+	// Whether or not to derive the name of the host interfaces created for Pods only from a hash of
+	// the Pod namespace, Pod name and container ID (e.g. "antrea-1a2b3c4d"), instead of including
+	// the first characters of the Pod name. If containerInterfacePrefix is set, it replaces the
+	// "antrea" prefix.
+	// Defaults to false.
+	HashedContainerInterfaceNames bool `yaml:"hashedContainerInterfaceNames,omitempty"`
+	// Whether or not to check that the Pod exists and is scheduled on this Node before configuring
+	// its network for a CNI ADD request, which protects against stale requests for deleted Pods.
+	// This requires a request to the K8s apiserver for each new Pod, so it is disabled by default.
+	// Defaults to false.
+	ValidatePodExistence bool `yaml:"validatePodExistence,omitempty"`
+	// Whether or not to configure the routes from the "antrea.io/pod-routes" annotation of the Pod
+	// in its network namespace for a CNI ADD request. When enabled, a CNI ADD request fails if the
+	// Pod cannot be retrieved from the K8s apiserver.
+	// Defaults to false.
+	EnablePodRoutesAnnotation bool `yaml:"enablePodRoutesAnnotation,omitempty"`
+	// Conntrack zone used by OVS for the connections of Pod traffic, which are subject to
+	// NetworkPolicy enforcement. It can be changed to avoid clashing with other consumers of
+	// conntrack zones on the Node. Valid values are in the range [1, 65535].
+	// Defaults to 65520.
+	CTZone int `yaml:"ctZone,omitempty"`
+	// MAC address to which local Pods resolve the gateway IP address, instead of the MAC address
+	// of the host gateway interface. This makes it possible to use the same gateway MAC address
+	// on all Nodes. It must be a unicast MAC address.
+	// Defaults to the MAC address of the host gateway interface.
+	PodGatewayMAC string `yaml:"podGatewayMAC,omitempty"`
+	// Address (host:port) on which antrea-agent serves its Prometheus metrics at /metrics, e.g.
+	// ":10351". The metrics are neither registered nor served if it is not set.
+	// Defaults to no metrics endpoint.
+	MetricsBindAddress string `yaml:"metricsBindAddress,omitempty"`
 }
@@ -19,7 +19,13 @@ import (
 	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
 	"io/ioutil"
 	"net"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/vmware-tanzu/antrea/pkg/agent/cniserver"
+	"github.com/vmware-tanzu/antrea/pkg/agent/openflow"
+	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 	"github.com/vmware-tanzu/antrea/pkg/cni"
 
 	"github.com/spf13/pflag"
@@ -82,6 +88,29 @@ func (o *Options) validate(args []string) error {
 	if o.config.OVSDatapathType != ovsconfig.OVSDatapathSystem && o.config.OVSDatapathType != ovsconfig.OVSDatapathNetdev {
 		return fmt.Errorf("OVS datapath type %s is not supported", o.config.OVSDatapathType)
 	}
+	if o.config.ExternalOVSBridge == o.config.OVSBridge {
+		return fmt.Errorf("external OVS bridge cannot be the same as the integration bridge %s", o.config.OVSBridge)
+	}
+	if len(o.config.ContainerInterfacePrefix) > util.MaxContainerInterfacePrefixLength {
+		return fmt.Errorf("container interface prefix %s is longer than %d characters", o.config.ContainerInterfacePrefix, util.MaxContainerInterfacePrefixLength)
+	}
+	if strings.ContainsAny(o.config.ContainerInterfacePrefix, "/ \t\n") {
+		return fmt.Errorf("container interface prefix %q is not a valid interface name", o.config.ContainerInterfacePrefix)
+	}
+	if _, err := parseCNISocketMode(o.config.CNISocketMode); err != nil {
+		return err
+	}
+	if err := openflow.ValidateCTZone(o.config.CTZone); err != nil {
+		return err
+	}
+	if _, err := parsePodGatewayMAC(o.config.PodGatewayMAC); err != nil {
+		return err
+	}
+	if o.config.MetricsBindAddress != "" {
+		if _, _, err := net.SplitHostPort(o.config.MetricsBindAddress); err != nil {
+			return fmt.Errorf("metrics bind address %s is invalid: %v", o.config.MetricsBindAddress, err)
+		}
+	}
 	return nil
 }
 
@@ -103,6 +132,9 @@ func (o *Options) setDefaults() {
 	if o.config.CNISocket == "" {
 		o.config.CNISocket = cni.AntreaCNISocketAddr
 	}
+	if o.config.CNISocketMode == "" {
+		o.config.CNISocketMode = fmt.Sprintf("%#o", cniserver.DefaultCNISocketMode)
+	}
 	if o.config.OVSBridge == "" {
 		o.config.OVSBridge = defaultOVSBridge
 	}
@@ -121,6 +153,9 @@ func (o *Options) setDefaults() {
 	if o.config.ServiceCIDR == "" {
 		o.config.ServiceCIDR = defaultServiceCIDR
 	}
+	if o.config.CTZone == 0 {
+		o.config.CTZone = int(openflow.DefaultCTZone)
+	}
 	if o.config.DefaultMTU == 0 {
 		if o.config.TunnelType == ovsconfig.VXLAN_TUNNEL {
 			o.config.DefaultMTU = defaultMTUVxlan
@@ -129,3 +164,26 @@ func (o *Options) setDefaults() {
 		}
 	}
 }
+
+// parseCNISocketMode parses the provided octal string as the file mode of the CNI socket. Only
+// permission bits are accepted.
+func parseCNISocketMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || os.FileMode(m)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("CNI socket mode %s is invalid", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// parsePodGatewayMAC parses the provided MAC address, which must be a unicast address. It returns
+// nil if mac is empty.
+func parsePodGatewayMAC(mac string) (net.HardwareAddr, error) {
+	if mac == "" {
+		return nil, nil
+	}
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil || len(hwAddr) != 6 || hwAddr[0]&0x01 != 0 {
+		return nil, fmt.Errorf("Pod gateway MAC %s is not a valid unicast MAC address", mac)
+	}
+	return hwAddr, nil
+}
@@ -21,7 +21,6 @@ import (
 	"os/exec"
 	"time"
 
-	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/vishvananda/netlink"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
@@ -29,16 +28,23 @@ import (
 
 	"github.com/vmware-tanzu/antrea/pkg/agent/iptables"
 	"github.com/vmware-tanzu/antrea/pkg/agent/openflow"
+	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
 )
 
 const (
-	TunPortName         = "tun0"
-	tunOFPort           = 1
-	hostGatewayOFPort   = 2
-	maxRetryForHostLink = 5
-	NodeNameEnvKey      = "NODE_NAME"
-	IPSecPSKEnvKey      = "ANTREA_IPSEC_PSK"
+	TunPortName       = "tun0"
+	tunOFPort         = 1
+	HostGatewayOFPort = 2
+	NodeNameEnvKey    = "NODE_NAME"
+	IPSecPSKEnvKey    = "ANTREA_IPSEC_PSK"
+	// IntegrationPatchPortName and ExternalPatchPortName are the names of the pair of patch ports
+	// connecting the integration bridge to the external bridge, when one is configured.
+	IntegrationPatchPortName = "patch-ext"
+	ExternalPatchPortName    = "patch-int"
+	// OVSPortsReadyTimeout is the maximum time to wait for OVS to assign an ofport to the tunnel
+	// and gateway ports.
+	OVSPortsReadyTimeout = 5 * time.Second
 )
 
 type NodeConfig struct {
@@ -46,14 +52,39 @@ type NodeConfig struct {
 	Name    string
 	PodCIDR *net.IPNet
 	*Gateway
+	// CTZone is the conntrack zone used by OVS for the connections of Pod traffic.
+	CTZone uint16
+	// PodGatewayMAC is the MAC address to which local Pods resolve the gateway IP address. If
+	// nil, the MAC address of the gateway interface is used.
+	PodGatewayMAC net.HardwareAddr
 }
 
+// GatewayMACForPods returns the MAC address of the gateway, as seen by local Pods.
+func (nc *NodeConfig) GatewayMACForPods() net.HardwareAddr {
+	if nc.PodGatewayMAC != nil {
+		return nc.PodGatewayMAC
+	}
+	return nc.Gateway.MAC
+}
+
+// Gateway describes the host gateway interface. The gateway has one IP address per IP family for
+// which the Node has a Pod subnet; the address for a family is nil if there is no such subnet. The
+// MAC address is shared by both families.
 type Gateway struct {
-	IP   net.IP
+	IPv4 net.IP
+	IPv6 net.IP
 	MAC  net.HardwareAddr
 	Name string
 }
 
+// IPForFamily returns the gateway IP address with the same IP family as ip.
+func (gw *Gateway) IPForFamily(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return gw.IPv4
+	}
+	return gw.IPv6
+}
+
 // Initializer knows how to setup host networking, OpenVSwitch, and Openflow.
 type Initializer struct {
 	ovsBridge         string
@@ -68,6 +99,13 @@ type Initializer struct {
 	serviceCIDR       *net.IPNet
 	ofClient          openflow.Client
 	ipsecPSK          string
+	ctZone            uint16
+	podGatewayMAC     net.HardwareAddr
+
+	// externalBridgeClient is the client for the external bridge, which is connected to the
+	// integration bridge (ovsBridgeClient) with patch ports. It is nil if no external bridge is
+	// configured.
+	externalBridgeClient ovsconfig.OVSBridgeClient
 }
 
 func disableICMPSendRedirects(intfName string) error {
@@ -82,26 +120,32 @@ func disableICMPSendRedirects(intfName string) error {
 
 func NewInitializer(
 	ovsBridgeClient ovsconfig.OVSBridgeClient,
+	externalBridgeClient ovsconfig.OVSBridgeClient,
 	ofClient openflow.Client,
 	k8sClient clientset.Interface,
 	ifaceStore InterfaceStore,
 	ovsBridge, serviceCIDR, hostGateway, tunnelType string,
 	MTU int,
-	enableIPSecTunnel bool) *Initializer {
+	enableIPSecTunnel bool,
+	ctZone uint16,
+	podGatewayMAC net.HardwareAddr) *Initializer {
 	// Parse service CIDR configuration. serviceCIDR is checked in option.validate, so
 	// it should be a valid configuration here.
 	_, serviceCIDRNet, _ := net.ParseCIDR(serviceCIDR)
 	return &Initializer{
-		ovsBridgeClient:   ovsBridgeClient,
-		ovsBridge:         ovsBridge,
-		hostGateway:       hostGateway,
-		tunnelType:        tunnelType,
-		MTU:               MTU,
-		enableIPSecTunnel: enableIPSecTunnel,
-		client:            k8sClient,
-		ifaceStore:        ifaceStore,
-		serviceCIDR:       serviceCIDRNet,
-		ofClient:          ofClient,
+		ovsBridgeClient:      ovsBridgeClient,
+		externalBridgeClient: externalBridgeClient,
+		ovsBridge:            ovsBridge,
+		hostGateway:          hostGateway,
+		tunnelType:           tunnelType,
+		MTU:                  MTU,
+		enableIPSecTunnel:    enableIPSecTunnel,
+		client:               k8sClient,
+		ifaceStore:           ifaceStore,
+		serviceCIDR:          serviceCIDRNet,
+		ofClient:             ofClient,
+		ctZone:               ctZone,
+		podGatewayMAC:        podGatewayMAC,
 	}
 }
 
@@ -121,6 +165,11 @@ func (i *Initializer) setupOVSBridge() error {
 		klog.Error("Failed to create OVS bridge: ", err)
 		return err
 	}
+	if i.externalBridgeClient != nil {
+		if err := i.setupExternalBridge(); err != nil {
+			return err
+		}
+	}
 
 	// Initialize interface cache
 	if err := i.ifaceStore.Initialize(i.ovsBridgeClient, i.hostGateway, TunPortName); err != nil {
@@ -131,6 +180,10 @@ func (i *Initializer) setupOVSBridge() error {
 	if err := i.setupTunnelInterface(TunPortName); err != nil {
 		return err
 	}
+	if err := i.ovsBridgeClient.WaitForPorts([]string{TunPortName}, OVSPortsReadyTimeout); err != nil {
+		klog.Errorf("Failed to wait for tunnel port %s: %v", TunPortName, err)
+		return err
+	}
 	// Setup host gateway interface
 	err := i.setupGatewayInterface()
 	if err != nil {
@@ -150,6 +203,38 @@ func (i *Initializer) setupOVSBridge() error {
 	return nil
 }
 
+// setupExternalBridge creates the external bridge and connects it to the integration bridge with a
+// pair of patch ports. Patch ports which already exist are left unchanged.
+func (i *Initializer) setupExternalBridge() error {
+	if err := i.externalBridgeClient.Create(); err != nil {
+		klog.Error("Failed to create external OVS bridge: ", err)
+		return err
+	}
+	if err := createPatchPortIfNotExists(i.ovsBridgeClient, IntegrationPatchPortName, ExternalPatchPortName); err != nil {
+		return err
+	}
+	return createPatchPortIfNotExists(i.externalBridgeClient, ExternalPatchPortName, IntegrationPatchPortName)
+}
+
+// createPatchPortIfNotExists creates a patch port named portName and connected to peerName on the
+// bridge, unless a port with this name already exists.
+func createPatchPortIfNotExists(bridgeClient ovsconfig.OVSBridgeClient, portName, peerName string) error {
+	if _, err := bridgeClient.GetPortUUID(portName); err == nil {
+		klog.V(2).Infof("Patch port %s already exists on OVS", portName)
+		return nil
+	} else if err != ovsconfig.ErrPortNotFound {
+		klog.Errorf("Failed to look up patch port %s on OVS: %v", portName, err)
+		return err
+	}
+	// The external IDs identify the port as a patch port created by the agent.
+	externalIDs := map[string]interface{}{OVSExternalIDInterfaceType: OVSInterfaceTypePatch}
+	if _, err := bridgeClient.CreatePatchPort(portName, peerName, 0, externalIDs); err != nil {
+		klog.Errorf("Failed to add patch port %s with peer %s on OVS: %v", portName, peerName, err)
+		return err
+	}
+	return nil
+}
+
 func (i *Initializer) Initialize() error {
 	klog.Info("Setting up node network")
 	if err := i.initNodeLocalConfig(); err != nil {
@@ -197,6 +282,12 @@ func (i *Initializer) initOpenFlowPipeline() error {
 		klog.Errorf("Failed to setup openflow entries for gateway: %v", err)
 		return err
 	}
+	if i.podGatewayMAC != nil {
+		if err := i.ofClient.InstallGatewayVirtualMACFlows(gateway.IP, gateway.MAC, i.podGatewayMAC, gatewayOFPort); err != nil {
+			klog.Errorf("Failed to setup openflow entries for gateway MAC %s: %v", i.podGatewayMAC, err)
+			return err
+		}
+	}
 
 	// Setup flow entries for tunnel port Interface, including classifier and L2 Forwarding
 	// (match vMAC as dst)
@@ -220,63 +311,83 @@ func (i *Initializer) initOpenFlowPipeline() error {
 // setupGatewayInterface creates the host gateway interface which is an internal port on OVS. The ofport for host
 // gateway interface is predefined, so invoke CreateInternalPort with a specific ofport_request
 func (i *Initializer) setupGatewayInterface() error {
+	gateway, err := SetupGatewayInterface(i.ovsBridgeClient, i.ifaceStore, i.hostGateway, i.MTU, i.nodeConfig.PodCIDR)
+	if err != nil {
+		return err
+	}
+	i.nodeConfig.Gateway = gateway
+	return nil
+}
+
+// SetupGatewayInterface ensures that the host gateway with the provided name is configured: the OVS
+// internal port is created if it is not in ifaceStore, its MTU is set, and its host link is set up
+// and assigned the gateway IP address of podCIDR. No IP address is assigned if podCIDR is nil. The
+// gateway interface is saved in ifaceStore, and the resulting Gateway is returned. It is used both
+// when the agent is initialized and when the CNIServer re-creates a missing gateway port.
+func SetupGatewayInterface(
+	ovsBridgeClient ovsconfig.OVSBridgeClient,
+	ifaceStore InterfaceStore,
+	gatewayName string,
+	mtu int,
+	podCIDR *net.IPNet,
+) (*Gateway, error) {
 	// Create host Gateway port if it does not exist
-	gatewayIface, portExists := i.ifaceStore.GetInterface(i.hostGateway)
+	gatewayIface, portExists := ifaceStore.GetInterface(gatewayName)
 	if !portExists {
-		klog.V(2).Infof("Creating gateway port %s on OVS bridge", i.hostGateway)
-		gwPortUUID, err := i.ovsBridgeClient.CreateInternalPort(i.hostGateway, hostGatewayOFPort, nil)
+		klog.V(2).Infof("Creating gateway port %s on OVS bridge", gatewayName)
+		gwPortUUID, err := ovsBridgeClient.CreateInternalPort(gatewayName, HostGatewayOFPort, nil)
 		if err != nil {
-			klog.Errorf("Failed to add host interface %s on OVS: %v", i.hostGateway, err)
-			return err
+			klog.Errorf("Failed to add host interface %s on OVS: %v", gatewayName, err)
+			return nil, err
 		}
-		gatewayIface = NewGatewayInterface(i.hostGateway)
-		gatewayIface.OVSPortConfig = &OVSPortConfig{i.hostGateway, gwPortUUID, hostGatewayOFPort}
-		i.ifaceStore.AddInterface(i.hostGateway, gatewayIface)
+		gatewayIface = NewGatewayInterface(gatewayName)
+		gatewayIface.OVSPortConfig = &OVSPortConfig{gatewayName, gwPortUUID, HostGatewayOFPort}
+		ifaceStore.AddInterface(gatewayName, gatewayIface)
 	} else {
-		klog.V(2).Infof("Gateway port %s already exists on OVS bridge", i.hostGateway)
+		klog.V(2).Infof("Gateway port %s already exists on OVS bridge", gatewayName)
 	}
 	// Idempotent operation to set the gateway's MTU: we perform this operation regardless of
 	// whether or not the gateway interface already exists, as the desired MTU may change across
 	// restarts.
-	klog.V(4).Infof("Setting gateway interface %s MTU to %d", i.hostGateway, i.MTU)
-	i.ovsBridgeClient.SetInterfaceMTU(i.hostGateway, i.MTU)
-	// host link might not be queried at once after create OVS internal port, retry max 5 times with 1s
-	// delay each time to ensure the link is ready. If still failed after max retry return error.
-	link, err := func() (netlink.Link, error) {
-		for retry := 0; retry < maxRetryForHostLink; retry++ {
-			if link, err := netlink.LinkByName(i.hostGateway); err != nil {
-				klog.V(2).Infof("Not found host link for gateway %s, retry after 1s", i.hostGateway)
-				if _, ok := err.(netlink.LinkNotFoundError); ok {
-					time.Sleep(1 * time.Second)
-				} else {
-					return link, err
-				}
-			} else {
-				return link, nil
-			}
-		}
-		return nil, fmt.Errorf("link %s not found", i.hostGateway)
-	}()
+	klog.V(4).Infof("Setting gateway interface %s MTU to %d", gatewayName, mtu)
+	if err := ovsBridgeClient.SetInterfaceMTU(gatewayName, mtu); err != nil {
+		klog.Errorf("Failed to set gateway interface %s MTU to %d: %v", gatewayName, mtu, err)
+	}
+	// The host link of an OVS internal port is created before OVS assigns an ofport to the port,
+	// so the link can be queried once the port is ready.
+	if err := ovsBridgeClient.WaitForPorts([]string{gatewayName}, OVSPortsReadyTimeout); err != nil {
+		klog.Errorf("Failed to wait for gateway port %s: %v", gatewayName, err)
+		return nil, err
+	}
+	link, err := netlink.LinkByName(gatewayName)
 	if err != nil {
-		klog.Errorf("Failed to find host link for gateway %s: %v", i.hostGateway, err)
-		return err
+		klog.Errorf("Failed to find host link for gateway %s: %v", gatewayName, err)
+		return nil, err
 	}
 
 	// Set host gateway interface up
 	if err := netlink.LinkSetUp(link); err != nil {
-		klog.Errorf("Failed to set host link for %s up: %v", i.hostGateway, err)
-		return err
+		klog.Errorf("Failed to set host link for %s up: %v", gatewayName, err)
+		return nil, err
+	}
+
+	gwMAC := link.Attrs().HardwareAddr
+	gateway := &Gateway{Name: gatewayName, MAC: gwMAC}
+	gatewayIface.MAC = gwMAC
+	if podCIDR == nil {
+		klog.Warningf("No PodCIDR is assigned to the Node, not configuring an IP address for gateway %s", gatewayName)
+		return gateway, nil
 	}
 
 	// Configure host gateway IP using the first address of node localSubnet
-	localSubnet := i.nodeConfig.PodCIDR
-	subnetID := localSubnet.IP.Mask(localSubnet.Mask)
-	gwIP := &net.IPNet{IP: ip.NextIP(subnetID), Mask: localSubnet.Mask}
+	gwIP := &net.IPNet{IP: util.GetGatewayIPForPodCIDR(podCIDR), Mask: podCIDR.Mask}
 	gwAddr := &netlink.Addr{IPNet: gwIP, Label: ""}
-	gwMAC := link.Attrs().HardwareAddr
-	i.nodeConfig.Gateway = &Gateway{Name: i.hostGateway, IP: gwIP.IP, MAC: gwMAC}
+	if gwIP.IP.To4() != nil {
+		gateway.IPv4 = gwIP.IP
+	} else {
+		gateway.IPv6 = gwIP.IP
+	}
 	gatewayIface.IP = gwIP.IP
-	gatewayIface.MAC = gwMAC
 
 	// Check IP address configuration on existing interface, return if already has target
 	// address
@@ -284,26 +395,26 @@ func (i *Initializer) setupGatewayInterface() error {
 	// function was called (i.e. portExists is false). Indeed, it may be possible for the Linux
 	// interface to exist even if the OVS bridge does not exist.
 	if addrs, err := netlink.AddrList(link, netlink.FAMILY_V4); err != nil {
-		klog.Errorf("Failed to query IPv4 address list for interface %s: %v", i.hostGateway, err)
-		return err
+		klog.Errorf("Failed to query IPv4 address list for interface %s: %v", gatewayName, err)
+		return nil, err
 	} else if addrs != nil {
 		for _, addr := range addrs {
-			klog.V(4).Infof("Found IPv4 address %s for interface %s", addr.IP.String(), i.hostGateway)
+			klog.V(4).Infof("Found IPv4 address %s for interface %s", addr.IP.String(), gatewayName)
 			if addr.IP.Equal(gwAddr.IPNet.IP) {
-				klog.V(2).Infof("IPv4 address %s already assigned to interface %s", addr.IP.String(), i.hostGateway)
-				return nil
+				klog.V(2).Infof("IPv4 address %s already assigned to interface %s", addr.IP.String(), gatewayName)
+				return gateway, nil
 			}
 		}
 	} else {
-		klog.V(2).Infof("Link %s has no configured IPv4 address", i.hostGateway)
+		klog.V(2).Infof("Link %s has no configured IPv4 address", gatewayName)
 	}
 
-	klog.V(2).Infof("Adding address %v to gateway interface %s", gwAddr, i.hostGateway)
+	klog.V(2).Infof("Adding address %v to gateway interface %s", gwAddr, gatewayName)
 	if err := netlink.AddrAdd(link, gwAddr); err != nil {
-		klog.Errorf("Failed to set gateway interface %s with address %v: %v", i.hostGateway, gwAddr, err)
-		return err
+		klog.Errorf("Failed to set gateway interface %s with address %v: %v", gatewayName, gwAddr, err)
+		return nil, err
 	}
-	return nil
+	return gateway, nil
 }
 
 func (i *Initializer) setupTunnelInterface(tunnelPortName string) error {
@@ -314,11 +425,13 @@ func (i *Initializer) setupTunnelInterface(tunnelPortName string) error {
 	}
 	var err error
 	var tunnelPortUUID string
+	// The external IDs identify the port as a tunnel port during reconciliation.
+	externalIDs := map[string]interface{}{OVSExternalIDInterfaceType: OVSInterfaceTypeTunnel}
 	switch i.tunnelType {
 	case ovsconfig.GENEVE_TUNNEL:
-		tunnelPortUUID, err = i.ovsBridgeClient.CreateGenevePort(tunnelPortName, tunOFPort, "")
+		tunnelPortUUID, err = i.ovsBridgeClient.CreateGenevePort(tunnelPortName, tunOFPort, "", externalIDs)
 	case ovsconfig.VXLAN_TUNNEL:
-		tunnelPortUUID, err = i.ovsBridgeClient.CreateVXLANPort(tunnelPortName, tunOFPort, "")
+		tunnelPortUUID, err = i.ovsBridgeClient.CreateVXLANPort(tunnelPortName, tunOFPort, "", externalIDs)
 	default:
 		err = fmt.Errorf("unsupported tunnel type %s", i.tunnelType)
 	}
@@ -356,7 +469,7 @@ func (i *Initializer) initNodeLocalConfig() error {
 		return err
 	}
 
-	i.nodeConfig = &NodeConfig{Name: nodeName, PodCIDR: localSubnet}
+	i.nodeConfig = &NodeConfig{Name: nodeName, PodCIDR: localSubnet, CTZone: i.ctZone, PodGatewayMAC: i.podGatewayMAC}
 	return nil
 }
 
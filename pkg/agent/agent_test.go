@@ -15,8 +15,15 @@
 package agent
 
 import (
+	"fmt"
 	"os"
 	"testing"
+
+	mock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
+	ovsconfigtest "github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig/testing"
 )
 
 func TestGetNodeName(t *testing.T) {
@@ -50,3 +57,31 @@ func compareNodeName(k, v string, t *testing.T) {
 		t.Errorf("Failed to retrieve nodename, want: %s, get: %s", v, nodeName)
 	}
 }
+
+func TestSetupExternalBridge(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	intBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	extBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	initializer := &Initializer{ovsBridgeClient: intBridgeClient, externalBridgeClient: extBridgeClient}
+	patchExternalIDs := map[string]interface{}{OVSExternalIDInterfaceType: OVSInterfaceTypePatch}
+
+	// Both the external bridge and the patch ports are created.
+	extBridgeClient.EXPECT().Create().Return(nil)
+	intBridgeClient.EXPECT().GetPortUUID(IntegrationPatchPortName).Return("", ovsconfig.ErrPortNotFound)
+	intBridgeClient.EXPECT().CreatePatchPort(IntegrationPatchPortName, ExternalPatchPortName, int32(0), patchExternalIDs).Return("uuid1", nil)
+	extBridgeClient.EXPECT().GetPortUUID(ExternalPatchPortName).Return("", ovsconfig.ErrPortNotFound)
+	extBridgeClient.EXPECT().CreatePatchPort(ExternalPatchPortName, IntegrationPatchPortName, int32(0), patchExternalIDs).Return("uuid2", nil)
+	assert.Nil(t, initializer.setupExternalBridge())
+
+	// After a restart, the existing patch ports are not created again.
+	extBridgeClient.EXPECT().Create().Return(nil)
+	intBridgeClient.EXPECT().GetPortUUID(IntegrationPatchPortName).Return("uuid1", nil)
+	extBridgeClient.EXPECT().GetPortUUID(ExternalPatchPortName).Return("uuid2", nil)
+	assert.Nil(t, initializer.setupExternalBridge())
+
+	// Errors other than a missing port are returned.
+	extBridgeClient.EXPECT().Create().Return(nil)
+	intBridgeClient.EXPECT().GetPortUUID(IntegrationPatchPortName).Return("", ovsconfig.NewTransactionError(fmt.Errorf("connection reset"), true))
+	assert.NotNil(t, initializer.setupExternalBridge())
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/current"
+)
+
+type ipamResultCacheEntry struct {
+	result     *current.Result
+	expiration time.Time
+}
+
+// ipamResultCache stores the last successful IPAM result for each container interface, indexed by
+// the key returned by ipamResultCacheKey. Entries expire after ttl. Expired entries are removed when
+// they are looked up, and every time a new entry is added.
+type ipamResultCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]*ipamResultCacheEntry
+}
+
+// ipamResultCacheKey returns the key of the cached result for the interface ifName of the container
+// with the provided ID, as the same container may request addresses for several interfaces.
+func ipamResultCacheKey(containerID, ifName string) string {
+	return containerID + "/" + ifName
+}
+
+func newIPAMResultCache(ttl time.Duration) *ipamResultCache {
+	return &ipamResultCache{
+		ttl:     ttl,
+		entries: make(map[string]*ipamResultCacheEntry),
+	}
+}
+
+// get returns a copy of the cached result for key, if it exists and has not expired. A copy is
+// returned because the caller may update the result (e.g. to set the gateway or the interface index
+// of each IP configuration).
+func (c *ipamResultCache) get(key string) (*current.Result, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiration) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return copyResult(entry.result), true
+}
+
+// add caches result for key. The expired entries are removed at the same time, so that the results
+// of containers for which no request is received anymore do not accumulate.
+func (c *ipamResultCache) add(key string, result *current.Result) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiration) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = &ipamResultCacheEntry{
+		result:     copyResult(result),
+		expiration: now.Add(c.ttl),
+	}
+}
+
+func (c *ipamResultCache) delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, key)
+}
+
+// copyResult copies the IP configurations and routes of result, which are the only fields of an
+// IPAM result which may be modified by the CNI server.
+func copyResult(result *current.Result) *current.Result {
+	newResult := *result
+	newResult.IPs = make([]*current.IPConfig, len(result.IPs))
+	for i, ipc := range result.IPs {
+		newIPC := *ipc
+		newResult.IPs[i] = &newIPC
+	}
+	if result.Routes != nil {
+		newResult.Routes = make([]*types.Route, len(result.Routes))
+		for i, route := range result.Routes {
+			newRoute := *route
+			newResult.Routes[i] = &newRoute
+		}
+	}
+	return &newResult
+}
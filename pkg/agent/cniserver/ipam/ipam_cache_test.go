@@ -0,0 +1,40 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPAMResultCacheRemovesExpiredEntriesOnAdd(t *testing.T) {
+	cache := newIPAMResultCache(time.Minute)
+	result := &current.Result{CNIVersion: "0.4.0"}
+	cache.add(ipamResultCacheKey("c1", "eth0"), result)
+	cache.add(ipamResultCacheKey("c2", "eth0"), result)
+	// Expire the first entry.
+	cache.entries[ipamResultCacheKey("c1", "eth0")].expiration = time.Now().Add(-time.Second)
+
+	cache.add(ipamResultCacheKey("c3", "eth0"), result)
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, ipamResultCacheKey("c1", "eth0"))
+	_, ok := cache.get(ipamResultCacheKey("c2", "eth0"))
+	assert.True(t, ok)
+	_, ok = cache.get(ipamResultCacheKey("c2", "eth1"))
+	assert.False(t, ok, "Results should be cached per interface")
+}
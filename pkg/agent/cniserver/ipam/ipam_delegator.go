@@ -33,19 +33,20 @@ type IPAMDelegator struct {
 	pluginType string
 }
 
-func (d *IPAMDelegator) Add(args *invoke.Args, networkConfig []byte) (*current.Result, error) {
+func (d *IPAMDelegator) Add(ctx context.Context, args *invoke.Args, networkConfig []byte) (*current.Result, error) {
 	var success = false
 	defer func() {
 		if !success {
-			// Rollback to delete assigned network configuration for failed to execute Add operation
+			// Rollback to delete assigned network configuration for failed to execute Add operation.
+			// The request context may have been cancelled, so it is not used for the rollback.
 			args.Command = "DEL"
-			if err := delegateNoResult(d.pluginType, networkConfig, args); err != nil {
+			if err := delegateNoResult(context.Background(), d.pluginType, networkConfig, args); err != nil {
 				klog.Errorf("Failed to roll back to delete configuration %s, %v", string(networkConfig), err)
 			}
 		}
 	}()
 	args.Command = "ADD"
-	r, err := delegateWithResult(d.pluginType, networkConfig, args)
+	r, err := delegateWithResult(ctx, d.pluginType, networkConfig, args)
 	if err != nil {
 		return nil, err
 	}
@@ -58,18 +59,18 @@ func (d *IPAMDelegator) Add(args *invoke.Args, networkConfig []byte) (*current.R
 	return ipamResult, nil
 }
 
-func (d *IPAMDelegator) Del(args *invoke.Args, networkConfig []byte) error {
+func (d *IPAMDelegator) Del(ctx context.Context, args *invoke.Args, networkConfig []byte) error {
 	args.Command = "DEL"
-	if err := delegateNoResult(d.pluginType, networkConfig, args); err != nil {
+	if err := delegateNoResult(ctx, d.pluginType, networkConfig, args); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (d *IPAMDelegator) Check(args *invoke.Args, networkConfig []byte) error {
+func (d *IPAMDelegator) Check(ctx context.Context, args *invoke.Args, networkConfig []byte) error {
 	args.Command = "CHECK"
-	if err := delegateNoResult(d.pluginType, networkConfig, args); err != nil {
+	if err := delegateNoResult(ctx, d.pluginType, networkConfig, args); err != nil {
 		return err
 	}
 	return nil
@@ -89,8 +90,9 @@ func delegateCommon(delegatePlugin string, exec invoke.Exec, cniPath string) (st
 	return pluginPath, exec, nil
 }
 
-func delegateWithResult(delegatePlugin string, networkConfig []byte, args *invoke.Args) (types.Result, error) {
-	ctx := context.TODO()
+// delegateWithResult executes the IPAM plugin and returns its result. The plugin process is killed
+// if ctx is cancelled before it completes.
+func delegateWithResult(ctx context.Context, delegatePlugin string, networkConfig []byte, args *invoke.Args) (types.Result, error) {
 	pluginPath, realExec, err := delegateCommon(delegatePlugin, defaultExec, args.Path)
 	if err != nil {
 		return nil, err
@@ -99,8 +101,7 @@ func delegateWithResult(delegatePlugin string, networkConfig []byte, args *invok
 	return invoke.ExecPluginWithResult(ctx, pluginPath, networkConfig, args, realExec)
 }
 
-func delegateNoResult(delegatePlugin string, networkConfig []byte, args *invoke.Args) error {
-	ctx := context.TODO()
+func delegateNoResult(ctx context.Context, delegatePlugin string, networkConfig []byte, args *invoke.Args) error {
 	pluginPath, realExec, err := delegateCommon(delegatePlugin, defaultExec, args.Path)
 	if err != nil {
 		return err
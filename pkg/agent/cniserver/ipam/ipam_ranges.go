@@ -0,0 +1,123 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+)
+
+// RangeConfig is an address range in the format of the host-local IPAM plugin. Addresses are
+// allocated from RangeStart to RangeEnd (both inclusive), which default to the first and last
+// usable addresses of Subnet.
+type RangeConfig struct {
+	Subnet     string `json:"subnet"`
+	RangeStart string `json:"rangeStart,omitempty"`
+	RangeEnd   string `json:"rangeEnd,omitempty"`
+	Gateway    string `json:"gateway,omitempty"`
+}
+
+// ipRange is a range of IP addresses, from start to end (both inclusive).
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+// parseExcludedRange parses an excluded IP address or CIDR, which must be within subnet.
+func parseExcludedRange(subnet *net.IPNet, excluded string) (ipRange, error) {
+	var r ipRange
+	if strings.Contains(excluded, "/") {
+		_, ipNet, err := net.ParseCIDR(excluded)
+		if err != nil {
+			return r, fmt.Errorf("invalid excluded CIDR %s: %v", excluded, err)
+		}
+		r = ipRange{start: ipNet.IP, end: lastIP(ipNet)}
+	} else {
+		addr := net.ParseIP(excluded)
+		if addr == nil {
+			return r, fmt.Errorf("invalid excluded IP address %s", excluded)
+		}
+		r = ipRange{start: addr, end: addr}
+	}
+	if !subnet.Contains(r.start) || !subnet.Contains(r.end) {
+		return r, fmt.Errorf("excluded addresses %s are not within subnet %s", excluded, subnet)
+	}
+	return r, nil
+}
+
+// lastIP returns the last address of ipNet.
+func lastIP(ipNet *net.IPNet) net.IP {
+	last := make(net.IP, len(ipNet.IP))
+	for i := range ipNet.IP {
+		last[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+	}
+	return last
+}
+
+// RangesExcluding returns the host-local ranges, which form a single range set, covering all the
+// addresses of subnet which can be allocated, except the ones in excluded. Each entry of excluded
+// is an IP address or a CIDR, and must be within subnet. As with host-local, the network address
+// and, for IPv4, the broadcast address cannot be allocated. An error is returned if an entry is
+// invalid, or if no address is left.
+func RangesExcluding(subnet *net.IPNet, gateway net.IP, excluded []string) ([]RangeConfig, error) {
+	excludedRanges := make([]ipRange, 0, len(excluded))
+	for _, entry := range excluded {
+		r, err := parseExcludedRange(subnet, entry)
+		if err != nil {
+			return nil, err
+		}
+		excludedRanges = append(excludedRanges, r)
+	}
+	sort.Slice(excludedRanges, func(i, j int) bool {
+		return ip.Cmp(excludedRanges[i].start, excludedRanges[j].start) < 0
+	})
+
+	networkIP := subnet.IP.Mask(subnet.Mask)
+	start := ip.NextIP(networkIP)
+	end := lastIP(&net.IPNet{IP: networkIP, Mask: subnet.Mask})
+	if networkIP.To4() != nil {
+		end = ip.PrevIP(end)
+	}
+	var ranges []RangeConfig
+	addRange := func(rangeStart, rangeEnd net.IP) {
+		if ip.Cmp(rangeStart, rangeEnd) > 0 {
+			return
+		}
+		r := RangeConfig{Subnet: subnet.String(), RangeStart: rangeStart.String(), RangeEnd: rangeEnd.String()}
+		if gateway != nil {
+			r.Gateway = gateway.String()
+		}
+		ranges = append(ranges, r)
+	}
+	// Excluded ranges are sorted by start address and may overlap. start is the first address
+	// after all the excluded ranges processed so far.
+	for _, r := range excludedRanges {
+		if ip.Cmp(r.start, start) > 0 {
+			addRange(start, ip.PrevIP(r.start))
+		}
+		if ip.Cmp(r.end, start) >= 0 {
+			start = ip.NextIP(r.end)
+		}
+	}
+	addRange(start, end)
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("all the addresses of subnet %s are excluded", subnet)
+	}
+	return ranges, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+	fakestore "github.com/containernetworking/plugins/plugins/ipam/host-local/backend/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangesExcluding(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.10.1.0/24")
+	gateway := net.ParseIP("10.10.1.1")
+	rangeConfig := func(start, end string) RangeConfig {
+		return RangeConfig{Subnet: "10.10.1.0/24", RangeStart: start, RangeEnd: end, Gateway: "10.10.1.1"}
+	}
+	tests := []struct {
+		name           string
+		excluded       []string
+		expectedRanges []RangeConfig
+		expectedErr    bool
+	}{
+		{
+			name:           "single address",
+			excluded:       []string{"10.10.1.10"},
+			expectedRanges: []RangeConfig{rangeConfig("10.10.1.1", "10.10.1.9"), rangeConfig("10.10.1.11", "10.10.1.254")},
+		},
+		{
+			name:           "unsorted and overlapping",
+			excluded:       []string{"10.10.1.128/25", "10.10.1.10", "10.10.1.8/30"},
+			expectedRanges: []RangeConfig{rangeConfig("10.10.1.1", "10.10.1.7"), rangeConfig("10.10.1.12", "10.10.1.127")},
+		},
+		{
+			name:           "first and last addresses",
+			excluded:       []string{"10.10.1.0/31", "10.10.1.254"},
+			expectedRanges: []RangeConfig{rangeConfig("10.10.1.2", "10.10.1.253")},
+		},
+		{
+			name:        "address outside subnet",
+			excluded:    []string{"10.10.2.10"},
+			expectedErr: true,
+		},
+		{
+			name:        "CIDR larger than subnet",
+			excluded:    []string{"10.10.0.0/16"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid address",
+			excluded:    []string{"10.10.1"},
+			expectedErr: true,
+		},
+		{
+			name:        "all addresses",
+			excluded:    []string{"10.10.1.0/24"},
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := RangesExcluding(subnet, gateway, tt.excluded)
+			if tt.expectedErr {
+				assert.NotNil(t, err)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, tt.expectedRanges, ranges)
+			}
+		})
+	}
+}
+
+// TestRangesExcludingAllocation checks that the host-local allocator never returns an excluded
+// address when configured with the ranges returned by RangesExcluding, and that all the other
+// addresses can be allocated.
+func TestRangesExcludingAllocation(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.10.1.0/24")
+	excluded := []string{"10.10.1.2", "10.10.1.100/30", "10.10.1.200"}
+	ranges, err := RangesExcluding(subnet, net.ParseIP("10.10.1.1"), excluded)
+	require.Nil(t, err)
+
+	// The ranges are converted to the host-local configuration through JSON, as for the IPAM
+	// plugin.
+	rangesJSON, err := json.Marshal(ranges)
+	require.Nil(t, err)
+	var rangeSet allocator.RangeSet
+	require.Nil(t, json.Unmarshal(rangesJSON, &rangeSet))
+	require.Nil(t, rangeSet.Canonicalize())
+
+	excludedIPs := map[string]bool{"10.10.1.2": true, "10.10.1.100": true, "10.10.1.101": true, "10.10.1.102": true, "10.10.1.103": true, "10.10.1.200": true}
+	store := fakestore.NewFakeStore(map[string]string{}, map[string]net.IP{})
+	alloc := allocator.NewIPAllocator(&rangeSet, store, 0)
+	// 253 addresses can be allocated in the subnet: all except the network, broadcast and
+	// gateway addresses.
+	numAllocatable := 253 - len(excludedIPs)
+	allocatedIPs := make(map[string]bool)
+	for i := 0; i < numAllocatable; i++ {
+		ipConfig, err := alloc.Get(fmt.Sprintf("container-%d", i), "eth0", nil)
+		require.Nil(t, err)
+		ip := ipConfig.Address.IP.String()
+		assert.False(t, excludedIPs[ip], "Excluded address %s was allocated", ip)
+		assert.False(t, allocatedIPs[ip], "Address %s was allocated twice", ip)
+		allocatedIPs[ip] = true
+	}
+	assert.Len(t, allocatedIPs, numAllocatable)
+}
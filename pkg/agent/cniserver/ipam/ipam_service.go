@@ -15,27 +15,48 @@
 package ipam
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/types/current"
+	"k8s.io/klog"
+
 	cnipb "github.com/vmware-tanzu/antrea/pkg/apis/cni/v1beta1"
 )
 
+// ipamResultCacheTTL is the duration for which the result of a successful IPAM ADD operation is
+// kept for a given container interface. If the ADD request is retried (e.g. by kubelet) for the
+// same container interface within that window, the cached result is returned instead of invoking
+// the IPAM driver again.
+const ipamResultCacheTTL = 2 * time.Minute
+
 var ipamDrivers map[string]IPAMDriver
 
+var ipamResults = newIPAMResultCache(ipamResultCacheTTL)
+
 type IPAMConfig struct {
 	Type    string `json:"type,omitempty"`
 	Subnet  string `json:"subnet,omitempty"`
 	Gateway string `json:"gateway,omitempty"`
+	// Ranges are the address ranges to allocate from. They are used instead of Subnet when
+	// some addresses of the subnet are excluded from allocation.
+	Ranges [][]RangeConfig `json:"ranges,omitempty"`
+	// Exclude is the list of IP addresses and CIDRs of the subnet which must never be
+	// allocated to Pods.
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 //go:generate mockgen -copyright_file ../../../../hack/boilerplate/license_header.raw.txt -destination testing/mock_ipam.go -package=testing github.com/vmware-tanzu/antrea/pkg/agent/cniserver/ipam IPAMDriver
 
+// IPAMDriver is the interface implemented by IPAM drivers. The provided context is the context of
+// the CNI request: drivers should abort the operation and return an error when it is cancelled.
 type IPAMDriver interface {
-	Add(args *invoke.Args, networkConfig []byte) (*current.Result, error)
-	Del(args *invoke.Args, networkConfig []byte) error
-	Check(args *invoke.Args, networkConfig []byte) error
+	Add(ctx context.Context, args *invoke.Args, networkConfig []byte) (*current.Result, error)
+	Del(ctx context.Context, args *invoke.Args, networkConfig []byte) error
+	Check(ctx context.Context, args *invoke.Args, networkConfig []byte) error
 }
 
 func RegisterIPAMDriver(ipamType string, ipamDriver IPAMDriver) error {
@@ -58,25 +79,52 @@ func argsFromEnv(cniArgs *cnipb.CniCmdArgs) *invoke.Args {
 	}
 }
 
-func ExecIPAMAdd(cniArgs *cnipb.CniCmdArgs, ipamType string) (*current.Result, error) {
+// ExecIPAMAdd allocates IP addresses for the container using the IPAM driver of type ipamType. If
+// a previous ADD for the same container and interface succeeded less than ipamResultCacheTTL ago,
+// the cached result is returned and the IPAM driver is not invoked.
+func ExecIPAMAdd(ctx context.Context, cniArgs *cnipb.CniCmdArgs, ipamType string) (*current.Result, error) {
+	cacheKey := ipamResultCacheKey(cniArgs.ContainerId, cniArgs.Ifname)
+	if result, ok := ipamResults.get(cacheKey); ok {
+		klog.V(2).Infof("Using cached IPAM result for container %s", cniArgs.ContainerId)
+		return result, nil
+	}
 	args := argsFromEnv(cniArgs)
 	driver := ipamDrivers[ipamType]
-	return driver.Add(args, cniArgs.NetworkConfiguration)
+	result, err := driver.Add(ctx, args, cniArgs.NetworkConfiguration)
+	if err != nil {
+		return nil, err
+	}
+	ipamResults.add(cacheKey, result)
+	return result, nil
 }
 
-func ExecIPAMDelete(cniArgs *cnipb.CniCmdArgs, ipamType string) error {
+// ExecIPAMDelete releases the IP addresses allocated to the container by the IPAM driver of type
+// ipamType. The cached ADD result for the container interface is invalidated even if the IPAM
+// driver fails, as the interface is removed anyway and a later ADD must not reuse the result.
+func ExecIPAMDelete(ctx context.Context, cniArgs *cnipb.CniCmdArgs, ipamType string) error {
+	ipamResults.delete(ipamResultCacheKey(cniArgs.ContainerId, cniArgs.Ifname))
 	args := argsFromEnv(cniArgs)
 	driver := ipamDrivers[ipamType]
-	return driver.Del(args, cniArgs.NetworkConfiguration)
+	return driver.Del(ctx, args, cniArgs.NetworkConfiguration)
 }
 
-func ExecIPAMCheck(cniArgs *cnipb.CniCmdArgs, ipamType string) error {
+func ExecIPAMCheck(ctx context.Context, cniArgs *cnipb.CniCmdArgs, ipamType string) error {
 	args := argsFromEnv(cniArgs)
 	driver := ipamDrivers[ipamType]
-	return driver.Check(args, cniArgs.NetworkConfiguration)
+	return driver.Check(ctx, args, cniArgs.NetworkConfiguration)
 }
 
 func IsIPAMTypeValid(ipamType string) bool {
 	_, valid := ipamDrivers[ipamType]
 	return valid
 }
+
+// ListIPAMTypes returns the sorted list of the IPAM types for which a driver is registered.
+func ListIPAMTypes() []string {
+	ipamTypes := make([]string, 0, len(ipamDrivers))
+	for ipamType := range ipamDrivers {
+		ipamTypes = append(ipamTypes, ipamType)
+	}
+	sort.Strings(ipamTypes)
+	return ipamTypes
+}
@@ -15,9 +15,11 @@
 package cniserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
@@ -31,7 +33,6 @@ import (
 
 	"github.com/vmware-tanzu/antrea/pkg/agent"
 	"github.com/vmware-tanzu/antrea/pkg/agent/openflow"
-	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
 )
 
@@ -41,17 +42,31 @@ type vethPair struct {
 	peerIndex int
 }
 
+// k8sArgs are the CNI args set by the container runtime for Kubernetes Pods. K8S_POD_UID is only
+// provided by recent runtimes, and is empty otherwise.
 type k8sArgs struct {
 	types.CommonArgs
 	K8S_POD_NAME               types.UnmarshallableString
 	K8S_POD_NAMESPACE          types.UnmarshallableString
 	K8S_POD_INFRA_CONTAINER_ID types.UnmarshallableString
+	K8S_POD_UID                types.UnmarshallableString
+}
+
+// parseK8sArgs parses the CNI args of a request. Args which are not known are ignored, unless the
+// runtime explicitly requests otherwise with "IgnoreUnknown=0", so that new args introduced by
+// runtimes do not cause requests to fail.
+func parseK8sArgs(args string) (*k8sArgs, error) {
+	parsedArgs := &k8sArgs{}
+	parsedArgs.IgnoreUnknown = true
+	if err := types.LoadArgs(args, parsedArgs); err != nil {
+		return nil, err
+	}
+	return parsedArgs, nil
 }
 
 // setupInterface creates a veth pair: containerIface is in the container namespace and hostIface is
 // in the host namespace.
-func setupInterface(podName string, podNamespace string, ifname string, netns ns.NetNS, MTU int) (hostIface *current.Interface, containerIface *current.Interface, err error) {
-	hostVethName := util.GenerateContainerInterfaceName(podName, podNamespace)
+func setupInterface(hostVethName string, ifname string, netns ns.NetNS, MTU int) (hostIface *current.Interface, containerIface *current.Interface, err error) {
 	hostIface = &current.Interface{}
 	containerIface = &current.Interface{}
 
@@ -74,6 +89,99 @@ func setupInterface(podName string, podNamespace string, ifname string, netns ns
 	return hostIface, containerIface, nil
 }
 
+// supportedQdiscs maps the name of each queueing discipline which can be set on the container
+// interface to a function creating it with default parameters.
+var supportedQdiscs = map[string]func(attrs netlink.QdiscAttrs) netlink.Qdisc{
+	"fq_codel": func(attrs netlink.QdiscAttrs) netlink.Qdisc { return netlink.NewFqCodel(attrs) },
+	"fq":       func(attrs netlink.QdiscAttrs) netlink.Qdisc { return netlink.NewFq(attrs) },
+}
+
+// validateQdisc returns an error if qdisc is neither empty nor a supported queueing discipline.
+func validateQdisc(qdisc string) error {
+	if qdisc == "" {
+		return nil
+	}
+	if _, ok := supportedQdiscs[qdisc]; !ok {
+		supported := make([]string, 0, len(supportedQdiscs))
+		for name := range supportedQdiscs {
+			supported = append(supported, name)
+		}
+		sort.Strings(supported)
+		return fmt.Errorf("unsupported qdisc %s, supported qdiscs are %v", qdisc, supported)
+	}
+	return nil
+}
+
+// setInterfaceQdisc sets qdisc as the root queueing discipline of the interface ifname in netns.
+// qdisc must have been validated with validateQdisc.
+func setInterfaceQdisc(netns ns.NetNS, ifname string, qdisc string) error {
+	return netns.Do(func(containerNs ns.NetNS) error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return err
+		}
+		attrs := netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		}
+		return netlink.QdiscReplace(supportedQdiscs[qdisc](attrs))
+	})
+}
+
+// maxTxQueueLen is the maximum transmit queue length which can be set on the container interface.
+// It is only meant to catch configuration mistakes.
+const maxTxQueueLen = 1000000
+
+// validateTxQueueLen returns an error if txQueueLen is neither zero (no transmit queue length is
+// set) nor in the range [1, maxTxQueueLen].
+func validateTxQueueLen(txQueueLen int) error {
+	if txQueueLen < 0 || txQueueLen > maxTxQueueLen {
+		return fmt.Errorf("invalid txQueueLen %d, it must be between 1 and %d", txQueueLen, maxTxQueueLen)
+	}
+	return nil
+}
+
+// setInterfaceTxQueueLen sets the transmit queue length of the container interface containerIfname
+// in netns, and of the host interface hostIfname if setOnHost is true.
+func setInterfaceTxQueueLen(netns ns.NetNS, containerIfname string, hostIfname string, txQueueLen int, setOnHost bool) error {
+	setTxQueueLen := func(ifname string) error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return err
+		}
+		return netlink.LinkSetTxQLen(link, txQueueLen)
+	}
+	if err := netns.Do(func(containerNs ns.NetNS) error {
+		return setTxQueueLen(containerIfname)
+	}); err != nil {
+		return err
+	}
+	if setOnHost {
+		return setTxQueueLen(hostIfname)
+	}
+	return nil
+}
+
+// applyInterfaceSettings sets the queueing discipline and transmit queue length from ifaceSettings on
+// the veth pair of a container. The MTU is set when the veth pair is created.
+func applyInterfaceSettings(netns ns.NetNS, containerID string, containerIface, hostIface *current.Interface, ifaceSettings InterfaceSettings) error {
+	if ifaceSettings.Qdisc != "" {
+		klog.V(2).Infof("Setting qdisc %s on interface of container %s", ifaceSettings.Qdisc, containerID)
+		if err := setInterfaceQdisc(netns, containerIface.Name, ifaceSettings.Qdisc); err != nil {
+			klog.Errorf("Failed to set qdisc %s on interface of container %s: %v", ifaceSettings.Qdisc, containerID, err)
+			return err
+		}
+	}
+	if ifaceSettings.TxQueueLen != 0 {
+		if err := setInterfaceTxQueueLen(netns, containerIface.Name, hostIface.Name, ifaceSettings.TxQueueLen, ifaceSettings.HostTxQueueLen); err != nil {
+			klog.Errorf("Failed to set txQueueLen %d on interface of container %s: %v", ifaceSettings.TxQueueLen, containerID, err)
+			return err
+		}
+	}
+	return nil
+}
+
 // configureContainerAddr takes the result of the IPAM plugin, and adds the appropriate IP
 // addresses and routes to the interface. It then sends a gratuitous ARP to the network.
 func configureContainerAddr(netns ns.NetNS, containerInterface *current.Interface, result *current.Result) error {
@@ -180,12 +288,20 @@ func validateContainerPeerInterface(hostIntf *current.Interface, containerVeth *
 	return hostVeth, nil
 }
 
+// parseContainerIP returns the IP address to record for the container. The IPv4 address is
+// preferred; the IPv6 address is only used for IPv6-only containers.
 func parseContainerIP(ips []*current.IPConfig) (net.IP, error) {
+	var ipv6 net.IP
 	for _, ipc := range ips {
 		if ipc.Version == "4" {
 			return ipc.Address.IP, nil
+		} else if ipc.Version == "6" && ipv6 == nil {
+			ipv6 = ipc.Address.IP
 		}
 	}
+	if ipv6 != nil {
+		return ipv6, nil
+	}
 	return nil, fmt.Errorf("failed to find a valid IP address")
 }
 
@@ -199,19 +315,37 @@ func buildContainerConfig(containerID string, podName string, podNamespace strin
 	return agent.NewContainerInterface(containerID, podName, podNamespace, containerIface.Sandbox, containerMAC, containerIP)
 }
 
+// checkRequestContext returns an error if the context of the CNI request has been cancelled or its
+// deadline has been exceeded, in which case the request should be aborted.
+func checkRequestContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("CNI request aborted: %v", err)
+	}
+	return nil
+}
+
+// configureInterface creates the container interface and connects it to the OVS bridge. The OVSDB
+// transactions cannot be interrupted, so ctx is checked between the different steps: if it is
+// cancelled, the configuration is aborted and rolled back.
 func configureInterface(
+	ctx context.Context,
 	ovsBridge ovsconfig.OVSBridgeClient,
 	ofClient openflow.Client,
-	gateway *agent.Gateway,
+	gatewayMAC net.HardwareAddr,
 	ifaceStore agent.InterfaceStore,
 	podName string,
 	podNameSpace string,
+	hostVethName string,
 	containerID string,
 	containerNetNS string,
 	ifname string,
-	MTU int,
+	ifaceSettings InterfaceSettings,
 	result *current.Result,
+	ipamArgs *agent.IPAMArgs,
 ) error {
+	if err := checkRequestContext(ctx); err != nil {
+		return err
+	}
 	netns, err := ns.GetNS(containerNetNS)
 	if err != nil {
 		klog.Errorf("Failed to open netns with %s: %v", containerNetNS, err)
@@ -219,7 +353,7 @@ func configureInterface(
 	}
 	defer netns.Close()
 	// Create veth pair and link up
-	hostIface, containerIface, err := setupInterface(podName, podNameSpace, ifname, netns, MTU)
+	hostIface, containerIface, err := setupInterface(hostVethName, ifname, netns, ifaceSettings.MTU)
 	if err != nil {
 		return err
 	}
@@ -233,9 +367,18 @@ func configureInterface(
 
 	result.Interfaces = []*current.Interface{hostIface, containerIface}
 
+	if err := applyInterfaceSettings(netns, containerID, containerIface, hostIface, ifaceSettings); err != nil {
+		return err
+	}
+
 	// build container configuration
 	containerConfig := buildContainerConfig(containerID, podName, podNameSpace, containerIface, result.IPs)
+	containerConfig.IPAMArgs = ipamArgs
+	containerConfig.CNIResult = marshalCNIResult(containerID, result)
 
+	if err := checkRequestContext(ctx); err != nil {
+		return err
+	}
 	// create OVS Port and add attach container configuration into external_ids
 	ovsPortName := hostIface.Name
 	klog.V(2).Infof("Adding OVS port %s for container %s", ovsPortName, containerID)
@@ -264,9 +407,12 @@ func configureInterface(
 		klog.Errorf("Failed to get of_port of OVS interface %s: %v", ovsPortName, err)
 		return err
 	}
+	if err := checkRequestContext(ctx); err != nil {
+		return err
+	}
 	// Setup openflow entries for OVS interface
 	klog.V(2).Infof("Setting up openflow entries for container %s", containerID)
-	err = ofClient.InstallPodFlows(ovsPortName, containerConfig.IP, containerConfig.MAC, gateway.MAC, uint32(ofPort))
+	err = ofClient.InstallPodFlows(ovsPortName, containerConfig.IP, containerConfig.MAC, gatewayMAC, uint32(ofPort))
 	if err != nil {
 		klog.Errorf("Failed to add openflow entries for container %s: %v", containerID, err)
 		return err
@@ -280,6 +426,332 @@ func configureInterface(
 	return nil
 }
 
+// reconfigureInterfaceIP applies the IP configuration provided in result to an existing container
+// interface: the addresses and routes of the interface in the container network namespace are
+// replaced, the OVS port external IDs are updated with ipamArgs and the Pod flows are reinstalled
+// for the new IP address. If a step fails, the addresses from oldResult, the OVS port external IDs
+// and the Pod flows of containerConfig are restored. The updated configuration is saved in the
+// InterfaceStore and returned.
+func reconfigureInterfaceIP(
+	ovsBridge ovsconfig.OVSBridgeClient,
+	ofClient openflow.Client,
+	gatewayMAC net.HardwareAddr,
+	ifaceStore agent.InterfaceStore,
+	containerConfig *agent.InterfaceConfig,
+	ipamArgs *agent.IPAMArgs,
+	oldResult *current.Result,
+	result *current.Result,
+) (*agent.InterfaceConfig, error) {
+	containerID := containerConfig.ID
+	newIP, err := parseContainerIP(result.IPs)
+	if err != nil {
+		return nil, err
+	}
+	netns, err := ns.GetNS(containerConfig.NetNS)
+	if err != nil {
+		klog.Errorf("Failed to open netns with %s: %v", containerConfig.NetNS, err)
+		return nil, err
+	}
+	defer netns.Close()
+
+	containerIface := &current.Interface{Name: containerConfig.IPAMArgs.IfName, Sandbox: containerConfig.NetNS}
+	result.Interfaces = []*current.Interface{{Name: containerConfig.IfaceName}, containerIface}
+	success := false
+	externalIDsUpdated := false
+	flowsUninstalled := false
+	defer func() {
+		if !success {
+			restoreInterfaceIP(ovsBridge, ofClient, gatewayMAC, netns, containerIface, containerConfig, oldResult, externalIDsUpdated, flowsUninstalled)
+		}
+	}()
+	klog.V(2).Infof("Replacing IP address of container %s", containerID)
+	if err := replaceContainerAddrs(netns, containerIface, result); err != nil {
+		return nil, fmt.Errorf("failed to configure IP addresses of container %s: %v", containerID, err)
+	}
+
+	newConfig := *containerConfig
+	newConfig.IP = newIP
+	newConfig.IPAMArgs = ipamArgs
+	// The interfaces and DNS configuration are unchanged, so they are taken from the saved result.
+	if storedResult, err := parseStoredCNIResult(containerConfig); err != nil {
+		klog.Warningf("Failed to parse CNI result saved for container %s: %v", containerID, err)
+		newConfig.CNIResult = nil
+	} else if storedResult != nil {
+		newResult := *result
+		newResult.Interfaces = storedResult.Interfaces
+		newResult.DNS = storedResult.DNS
+		newConfig.CNIResult = marshalCNIResult(containerID, &newResult)
+	}
+	ovsPortName := containerConfig.IfaceName
+	if err := ovsBridge.SetPortExternalIDs(ovsPortName, agent.BuildOVSPortExternalIDs(&newConfig)); err != nil {
+		klog.Errorf("Failed to update external IDs of OVS port %s: %v", ovsPortName, err)
+		return nil, err
+	}
+	externalIDsUpdated = true
+
+	ofPort := uint32(containerConfig.OFPort)
+	// The old flows must be restored even if they are only partially uninstalled.
+	flowsUninstalled = true
+	if err := ofClient.UninstallPodFlows(ovsPortName, ofPort); err != nil {
+		klog.Errorf("Failed to delete Openflow entries for container %s: %v", containerID, err)
+		return nil, err
+	}
+	if err := ofClient.InstallPodFlows(ovsPortName, newConfig.IP, newConfig.MAC, gatewayMAC, ofPort); err != nil {
+		klog.Errorf("Failed to add Openflow entries for container %s: %v", containerID, err)
+		return nil, err
+	}
+	ifaceStore.AddInterface(ovsPortName, &newConfig)
+	success = true
+	return &newConfig, nil
+}
+
+// replaceContainerAddrs replaces the IP addresses and routes of the container interface with the
+// ones provided in result.
+func replaceContainerAddrs(netns ns.NetNS, containerIface *current.Interface, result *current.Result) error {
+	if err := netns.Do(func(ns.NetNS) error {
+		return flushInterfaceAddrs(containerIface.Name)
+	}); err != nil {
+		return err
+	}
+	return configureContainerAddr(netns, containerIface, result)
+}
+
+// restoreInterfaceIP restores the IP configuration of a container interface after a failed
+// reconfiguration: the addresses and routes from oldResult are configured again, and the OVS port
+// external IDs and the Pod flows of oldConfig are restored if they were modified. Errors are only
+// logged, as the reconfiguration has already failed.
+func restoreInterfaceIP(
+	ovsBridge ovsconfig.OVSBridgeClient,
+	ofClient openflow.Client,
+	gatewayMAC net.HardwareAddr,
+	netns ns.NetNS,
+	containerIface *current.Interface,
+	oldConfig *agent.InterfaceConfig,
+	oldResult *current.Result,
+	externalIDsUpdated bool,
+	flowsUninstalled bool,
+) {
+	containerID := oldConfig.ID
+	ovsPortName := oldConfig.IfaceName
+	restoredResult := *oldResult
+	restoredResult.Interfaces = []*current.Interface{{Name: ovsPortName}, containerIface}
+	if err := replaceContainerAddrs(netns, containerIface, &restoredResult); err != nil {
+		klog.Errorf("Failed to restore IP addresses of container %s: %v", containerID, err)
+	}
+	if externalIDsUpdated {
+		if err := ovsBridge.SetPortExternalIDs(ovsPortName, agent.BuildOVSPortExternalIDs(oldConfig)); err != nil {
+			klog.Errorf("Failed to restore external IDs of OVS port %s: %v", ovsPortName, err)
+		}
+	}
+	if flowsUninstalled {
+		ofPort := uint32(oldConfig.OFPort)
+		// The new flows may have been partially installed.
+		if err := ofClient.UninstallPodFlows(ovsPortName, ofPort); err != nil {
+			klog.Errorf("Failed to delete Openflow entries for container %s: %v", containerID, err)
+		}
+		if err := ofClient.InstallPodFlows(ovsPortName, oldConfig.IP, oldConfig.MAC, gatewayMAC, ofPort); err != nil {
+			klog.Errorf("Failed to restore Openflow entries for container %s: %v", containerID, err)
+		}
+	}
+}
+
+// repairInterface re-creates the interface of an existing container in the network namespace
+// containerNetNS, with the IP configuration provided in result. It is used when the network namespace
+// of the container has been replaced, in which case the old veth pair is gone along with the old
+// network namespace. A new veth pair is created first, then the old OVS port is replaced in a single
+// transaction by a new port, which requests the ofport of the old port and has the same external IDs
+// except for the container MAC address. If a later step fails, the old OVS port, Pod flows and
+// InterfaceStore entry are restored. The updated configuration is saved in the InterfaceStore and
+// returned.
+func repairInterface(
+	ovsBridge ovsconfig.OVSBridgeClient,
+	ofClient openflow.Client,
+	gatewayMAC net.HardwareAddr,
+	ifaceStore agent.InterfaceStore,
+	containerConfig *agent.InterfaceConfig,
+	containerNetNS string,
+	ifaceSettings InterfaceSettings,
+	result *current.Result,
+) (*agent.InterfaceConfig, error) {
+	containerID := containerConfig.ID
+	netns, err := ns.GetNS(containerNetNS)
+	if err != nil {
+		klog.Errorf("Failed to open netns with %s: %v", containerNetNS, err)
+		return nil, err
+	}
+	defer netns.Close()
+
+	ovsPortName := containerConfig.IfaceName
+	ofPortRequest := containerConfig.OFPort
+	// The host veth is normally deleted along with the old network namespace, but it must be
+	// removed if it still exists, as the new one reuses its name. Its peer is not in the new
+	// network namespace, so it does not carry any traffic for the container anymore.
+	if err := ip.DelLinkByName(ovsPortName); err != nil && err != ip.ErrLinkNotFound {
+		klog.Errorf("Failed to delete host interface %s of container %s: %v", ovsPortName, containerID, err)
+		return nil, err
+	}
+
+	ifname := containerConfig.IPAMArgs.IfName
+	hostIface, containerIface, err := setupInterface(ovsPortName, ifname, netns, ifaceSettings.MTU)
+	if err != nil {
+		return nil, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			removeContainerLink(containerID, containerNetNS, ifname)
+		}
+	}()
+	result.Interfaces = []*current.Interface{hostIface, containerIface}
+	if err := applyInterfaceSettings(netns, containerID, containerIface, hostIface, ifaceSettings); err != nil {
+		return nil, err
+	}
+	if err := configureContainerAddr(netns, containerIface, result); err != nil {
+		return nil, fmt.Errorf("failed to configure IP addresses of container %s: %v", containerID, err)
+	}
+
+	newConfig := buildContainerConfig(containerID, containerConfig.PodName, containerConfig.PodNamespace, containerIface, result.IPs)
+	newConfig.IPAMArgs = containerConfig.IPAMArgs
+	newConfig.CNIResult = marshalCNIResult(containerID, result)
+	klog.V(2).Infof("Replacing OVS port %s for container %s with ofport request %d", ovsPortName, containerID, ofPortRequest)
+	portUUID, err := ovsBridge.ReplacePort(containerConfig.PortUUID, ovsconfig.PortSpec{
+		Name:          ovsPortName,
+		IFName:        ovsPortName,
+		OFPortRequest: ofPortRequest,
+		ExternalIDs:   agent.BuildOVSPortExternalIDs(newConfig),
+	})
+	if err != nil {
+		klog.Errorf("Failed to replace OVS port %s for container %s: %v", ovsPortName, containerID, err)
+		return nil, err
+	}
+	flowsUninstalled := false
+	defer func() {
+		if !success {
+			restoreInterface(ovsBridge, ofClient, gatewayMAC, ifaceStore, containerConfig, portUUID, flowsUninstalled)
+		}
+	}()
+	ofPort, err := ovsBridge.GetOFPort(ovsPortName)
+	if err != nil {
+		klog.Errorf("Failed to get of_port of OVS interface %s: %v", ovsPortName, err)
+		return nil, err
+	}
+	if ofPort != ofPortRequest {
+		klog.Warningf("OVS port %s of container %s was assigned ofport %d instead of %d", ovsPortName, containerID, ofPort, ofPortRequest)
+	}
+	if err := ofClient.UninstallPodFlows(ovsPortName, uint32(ofPortRequest)); err != nil {
+		klog.Errorf("Failed to delete Openflow entries for container %s: %v", containerID, err)
+		return nil, err
+	}
+	flowsUninstalled = true
+	if err := ofClient.InstallPodFlows(ovsPortName, newConfig.IP, newConfig.MAC, gatewayMAC, uint32(ofPort)); err != nil {
+		klog.Errorf("Failed to add Openflow entries for container %s: %v", containerID, err)
+		return nil, err
+	}
+	newConfig.OVSPortConfig = &agent.OVSPortConfig{PortUUID: portUUID, IfaceName: ovsPortName, OFPort: ofPort}
+	// The new configuration replaces the old one, which is stored under the same name.
+	ifaceStore.AddInterface(ovsPortName, newConfig)
+	success = true
+	return newConfig, nil
+}
+
+// restoreInterface restores the OVS port and the Pod flows of a container after a failed repair:
+// the new port with UUID newPortUUID is replaced by a port with the configuration of oldConfig, and
+// the Pod flows of oldConfig are reinstalled if they were uninstalled. The InterfaceStore entry is
+// updated with the UUID of the restored port. Errors are only logged, as the repair has already
+// failed.
+func restoreInterface(
+	ovsBridge ovsconfig.OVSBridgeClient,
+	ofClient openflow.Client,
+	gatewayMAC net.HardwareAddr,
+	ifaceStore agent.InterfaceStore,
+	oldConfig *agent.InterfaceConfig,
+	newPortUUID string,
+	flowsUninstalled bool,
+) {
+	containerID := oldConfig.ID
+	ovsPortName := oldConfig.IfaceName
+	portUUID, err := ovsBridge.ReplacePort(newPortUUID, ovsconfig.PortSpec{
+		Name:          ovsPortName,
+		IFName:        ovsPortName,
+		OFPortRequest: oldConfig.OFPort,
+		ExternalIDs:   agent.BuildOVSPortExternalIDs(oldConfig),
+	})
+	if err != nil {
+		klog.Errorf("Failed to restore OVS port %s for container %s: %v", ovsPortName, containerID, err)
+		return
+	}
+	if flowsUninstalled {
+		if err := ofClient.InstallPodFlows(ovsPortName, oldConfig.IP, oldConfig.MAC, gatewayMAC, uint32(oldConfig.OFPort)); err != nil {
+			klog.Errorf("Failed to restore Openflow entries for container %s: %v", containerID, err)
+		}
+	}
+	restoredConfig := *oldConfig
+	restoredConfig.OVSPortConfig = &agent.OVSPortConfig{PortUUID: portUUID, IfaceName: ovsPortName, OFPort: oldConfig.OFPort}
+	ifaceStore.AddInterface(ovsPortName, &restoredConfig)
+}
+
+// marshalCNIResult serializes the CNI result of a container interface, so that it can be saved with
+// the interface configuration. nil is returned if the result cannot be serialized, in which case the
+// interface is only partially validated by CHECK requests.
+func marshalCNIResult(containerID string, result *current.Result) json.RawMessage {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		klog.Errorf("Failed to marshal CNI result for container %s: %v", containerID, err)
+		return nil
+	}
+	return resultBytes
+}
+
+// parseStoredCNIResult parses the CNI result saved with the configuration of a container interface.
+// nil is returned if no result was saved, e.g. for interfaces created by older versions.
+func parseStoredCNIResult(containerConfig *agent.InterfaceConfig) (*current.Result, error) {
+	if len(containerConfig.CNIResult) == 0 {
+		return nil, nil
+	}
+	result := &current.Result{}
+	if err := json.Unmarshal(containerConfig.CNIResult, result); err != nil {
+		return nil, fmt.Errorf("invalid CNI result: %v", err)
+	}
+	return result, nil
+}
+
+// flushInterfaceAddrs removes the global unicast IP addresses of the interface with the provided
+// name, as well as the routes through the interface. It must be called in the network namespace of
+// the interface.
+func flushInterfaceAddrs(ifname string) error {
+	link, err := netlink.LinkByName(ifname)
+	if err != nil {
+		return err
+	}
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+	for i := range addrs {
+		if !addrs[i].IP.IsGlobalUnicast() {
+			continue
+		}
+		if err := netlink.AddrDel(link, &addrs[i]); err != nil {
+			return err
+		}
+	}
+	// Most routes are removed by the kernel along with the addresses, but routes through a
+	// gateway may remain.
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+	for i := range routes {
+		if routes[i].Gw == nil {
+			continue
+		}
+		if err := netlink.RouteDel(&routes[i]); err != nil {
+			klog.Warningf("Failed to delete route %v: %v", routes[i], err)
+		}
+	}
+	return nil
+}
+
 func setupContainerOVSPort(ovsBridge ovsconfig.OVSBridgeClient, containerConfig *agent.InterfaceConfig, ovsPortName string) (string, error) {
 	ovsAttchInfo := agent.BuildOVSPortExternalIDs(containerConfig)
 	if portUUID, err := ovsBridge.CreatePort(ovsPortName, ovsPortName, ovsAttchInfo); err != nil {
@@ -307,6 +779,18 @@ func removeContainerLink(containerID string, containerNetns string, ifname strin
 	return nil
 }
 
+// getPodContainerInterface returns the interface of the Pod which belongs to the container with
+// the provided ID. This is not necessarily the one returned by GetContainerInterface, if the Pod
+// sandbox has been restarted.
+func getPodContainerInterface(ifaceStore agent.InterfaceStore, podName, podNamespace, containerID string) (*agent.InterfaceConfig, bool) {
+	for _, iface := range ifaceStore.GetContainerInterfaces(podName, podNamespace) {
+		if iface.ID == containerID {
+			return iface, true
+		}
+	}
+	return nil, false
+}
+
 func removeInterfaces(
 	ovsBridgeClient ovsconfig.OVSBridgeClient,
 	ofClient openflow.Client,
@@ -330,7 +814,9 @@ func removeInterfaces(
 		klog.V(2).Infof("Target netns not specified, not removing veth pair")
 	}
 
-	containerConfig, found := ifaceStore.GetContainerInterface(podName, podNamespace)
+	// The interface is looked up by container ID as well, as the Pod may already have the
+	// interface of a new sandbox, which must not be removed.
+	containerConfig, found := getPodContainerInterface(ifaceStore, podName, podNamespace, containerID)
 	if !found {
 		klog.V(2).Infof("Did not find the port for container %s in local cache", containerID)
 		return nil
@@ -339,8 +825,13 @@ func removeInterfaces(
 	portUUID := containerConfig.PortUUID
 	ovsPortName := containerConfig.IfaceName
 	klog.V(2).Infof("Deleting OVS port with UUID %s peer container %s", portUUID, containerID)
-	// Remove openflow entries of target container
-	if err := ofClient.UninstallPodFlows(ovsPortName); err != nil {
+	// Remove openflow entries of target container. The current ofport is provided in case it
+	// changed since the flows were installed, to make sure that no stale flow is left behind.
+	var ofPort uint32
+	if containerConfig.OFPort > 0 {
+		ofPort = uint32(containerConfig.OFPort)
+	}
+	if err := ofClient.UninstallPodFlows(ovsPortName, ofPort); err != nil {
 		klog.Errorf("Failed to delete Openflow entries for container %s: %v", containerID, err)
 		return err
 	}
@@ -21,15 +21,20 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"google.golang.org/grpc"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 
@@ -87,6 +92,7 @@ func (arbitrator *containerAccessArbitrator) unlockContainer(containerID string)
 
 type CNIServer struct {
 	cniSocket            string
+	cniSocketMode        os.FileMode
 	supportedCNIVersions map[string]bool
 	serverVersion        string
 	nodeConfig           *agent.NodeConfig
@@ -97,21 +103,74 @@ type CNIServer struct {
 	defaultMTU           int
 	kubeClient           clientset.Interface
 	containerAccess      *containerAccessArbitrator
+	// verifyPodFlows indicates whether the Pod flows should be checked against OVS after the
+	// startup reconciliation.
+	verifyPodFlows bool
+	// containerIfacePrefix is the prefix of the name of all the host interfaces created for
+	// Pods. Only container interfaces with this prefix are garbage-collected during startup
+	// reconciliation.
+	containerIfacePrefix string
+	// hashedContainerIfaceNames indicates whether the names of the host interfaces created for
+	// Pods are only derived from a hash of the Pod namespace, Pod name and container ID, instead
+	// of including the first characters of the Pod name.
+	hashedContainerIfaceNames bool
+	// validatePodExistence indicates whether ADD requests should be rejected if the Pod they
+	// refer to does not exist or is not scheduled on this Node, e.g. if a stale request is
+	// received for a deleted Pod. It requires a request to the K8s apiserver for each ADD.
+	validatePodExistence bool
+	// enablePodRoutesAnnotation indicates whether the routes from the PodRoutesAnnotationKey
+	// annotation of the Pod should be configured on ADD. It requires a request to the K8s
+	// apiserver for each ADD.
+	enablePodRoutesAnnotation bool
+	// reconcilePaused indicates whether the deletion of orphaned interfaces is skipped during
+	// reconciliation, e.g. while a migration is in progress. It is protected by
+	// reconcilePausedMutex.
+	reconcilePausedMutex sync.RWMutex
+	reconcilePaused      bool
 }
 
+// DefaultSupportedCNIVersions are the CNI versions supported by the CNIServer when no version is
+// provided in Options.
+var DefaultSupportedCNIVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0"}
+
 const (
-	supportedCNIVersions = "0.1.0,0.2.0,0.3.0,0.3.1,0.4.0"
+	// DefaultCNISocketMode is the default file mode of the CNI socket. Only the owner of the
+	// socket, i.e. the user running antrea-agent (root), can connect to it, which is enough for
+	// the CNI plugin binary, which is invoked by the container runtime as root.
+	DefaultCNISocketMode os.FileMode = 0600
+
+	// PodRoutesAnnotationKey is the annotation which can be set on a Pod to configure routes in
+	// the Pod's network namespace, in addition to the routes provided by IPAM. Its value is a
+	// JSON list of routes, e.g. `[{"dst": "10.10.0.0/16", "gw": "10.1.2.1"}]`. The routes are
+	// added on CNI ADD only; they are removed along with the Pod's network namespace. The
+	// annotation is ignored unless Options.EnablePodRoutesAnnotation is set.
+	PodRoutesAnnotationKey = "antrea.io/pod-routes"
 )
 
-var supportedCNIVersionSet map[string]bool
+// podGetTimeout is the maximum time spent retrieving a Pod from the K8s apiserver while processing
+// a CNI request.
+const podGetTimeout = 5 * time.Second
+
+// InterfaceSettings are the link settings applied to the veth pair created for a container.
+type InterfaceSettings struct {
+	MTU int `json:"mtu,omitempty"`
+	// Qdisc is the queueing discipline to set on the container interface, if not empty. It must
+	// be one of the names in supportedQdiscs.
+	Qdisc string `json:"qdisc,omitempty"`
+	// TxQueueLen is the transmit queue length to set on the container interface, if not zero. It
+	// must be between 0 and maxTxQueueLen.
+	TxQueueLen int `json:"txQueueLen,omitempty"`
+	// HostTxQueueLen indicates whether TxQueueLen should also be set on the host interface.
+	HostTxQueueLen bool `json:"hostTxQueueLen,omitempty"`
+}
 
 type NetworkConfig struct {
 	CNIVersion string          `json:"cniVersion,omitempty"`
 	Name       string          `json:"name,omitempty"`
 	Type       string          `json:"type,omitempty"`
-	MTU        int             `json:"mtu,omitempty"`
 	DNS        types.DNS       `json:"dns"`
 	IPAM       ipam.IPAMConfig `json:"ipam,omitempty"`
+	InterfaceSettings
 
 	RawPrevResult map[string]interface{} `json:"prevResult,omitempty"`
 	PrevResult    types.Result           `json:"-"`
@@ -126,35 +185,184 @@ type CNIConfig struct {
 // updateResultIfaceConfig processes the result from the IPAM plugin and does the following:
 //   * updates the IP configuration for each assigned IP address: this includes computing the
 //     gateway (if missing) based on the subnet and setting the interface pointer to the container
-//     interface
-//   * if there is no default route, add one using the provided default gateway
-func updateResultIfaceConfig(result *current.Result, defaultV4Gateway net.IP) {
+//     interface; for a single-host address (/32 or /128), the subnet does not include a gateway and
+//     the provided default gateway for the IP family is used instead
+//   * for each IP family with an assigned IP address, if there is no default route, add one using
+//     the provided default gateway for that family (if not nil)
+func updateResultIfaceConfig(result *current.Result, defaultV4Gateway net.IP, defaultV6Gateway net.IP) {
+	hasIPv4, hasIPv6 := false, false
 	for _, ipc := range result.IPs {
 		// result.Interfaces[0] is host interface, and result.Interfaces[1] is container interface
 		ipc.Interface = current.Int(1)
+		isIPv4 := ipc.Address.IP.To4() != nil
 		if ipc.Gateway == nil {
 			ipn := ipc.Address
-			netID := ipn.IP.Mask(ipn.Mask)
-			ipc.Gateway = ip.NextIP(netID)
+			if ones, bits := ipn.Mask.Size(); ones == bits {
+				if isIPv4 {
+					ipc.Gateway = defaultV4Gateway
+				} else {
+					ipc.Gateway = defaultV6Gateway
+				}
+			} else {
+				netID := ipn.IP.Mask(ipn.Mask)
+				ipc.Gateway = ip.NextIP(netID)
+			}
+		}
+		if isIPv4 {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
 		}
 	}
 
-	foundDefaultRoute := false
-	defaultRouteDst := "0.0.0.0/0"
-	if result.Routes != nil {
-		for _, route := range result.Routes {
-			if route.Dst.String() == defaultRouteDst {
-				foundDefaultRoute = true
-				break
+	if result.Routes == nil {
+		result.Routes = []*types.Route{}
+	}
+	if hasIPv4 && defaultV4Gateway != nil {
+		addDefaultRouteIfMissing(result, "0.0.0.0/0", defaultV4Gateway)
+	}
+	if hasIPv6 && defaultV6Gateway != nil {
+		addDefaultRouteIfMissing(result, "::/0", defaultV6Gateway)
+	}
+}
+
+// parsePodRoutes parses the value of the PodRoutesAnnotationKey annotation and returns the routes it
+// describes. A route without gateway uses the gateway of the Node for the IP family of the
+// destination. The gateway of each route must belong to the subnet of one of the Pod's IP addresses
+// (ipConfigs) or be the Node gateway, so that it is reachable from the Pod's interface.
+func parsePodRoutes(annotation string, ipConfigs []*current.IPConfig, nodeGateway *agent.Gateway) ([]*types.Route, error) {
+	var routes []*types.Route
+	if err := json.Unmarshal([]byte(annotation), &routes); err != nil {
+		return nil, fmt.Errorf("invalid value for annotation %s: %v", PodRoutesAnnotationKey, err)
+	}
+	for _, route := range routes {
+		if route.Dst.IP == nil {
+			return nil, fmt.Errorf("missing destination in route from annotation %s", PodRoutesAnnotationKey)
+		}
+		route.Dst.IP = route.Dst.IP.Mask(route.Dst.Mask)
+		if route.GW == nil {
+			route.GW = nodeGateway.IPForFamily(route.Dst.IP)
+			if route.GW == nil {
+				return nil, fmt.Errorf("no Node gateway for route to %s", route.Dst.String())
 			}
+			continue
 		}
-	} else {
-		result.Routes = []*types.Route{}
+		if (route.GW.To4() != nil) != (route.Dst.IP.To4() != nil) {
+			return nil, fmt.Errorf("gateway %s and destination %s of route have different IP families", route.GW, route.Dst.String())
+		}
+		if !isGatewayReachable(route.GW, ipConfigs, nodeGateway) {
+			return nil, fmt.Errorf("gateway %s of route to %s is not reachable from the Pod", route.GW, route.Dst.String())
+		}
+	}
+	return routes, nil
+}
+
+func isGatewayReachable(gw net.IP, ipConfigs []*current.IPConfig, nodeGateway *agent.Gateway) bool {
+	if gw.Equal(nodeGateway.IPForFamily(gw)) {
+		return true
 	}
-	if !foundDefaultRoute {
-		_, defaultRouteDstNet, _ := net.ParseCIDR(defaultRouteDst)
-		result.Routes = append(result.Routes, &types.Route{Dst: *defaultRouteDstNet, GW: defaultV4Gateway})
+	for _, ipc := range ipConfigs {
+		subnet := net.IPNet{IP: ipc.Address.IP.Mask(ipc.Address.Mask), Mask: ipc.Address.Mask}
+		if subnet.Contains(gw) {
+			return true
+		}
 	}
+	return false
+}
+
+// maxDNSSearchDomains is the maximum number of DNS search domains returned to the container runtime,
+// which is the limit supported by the glibc resolver.
+const maxDNSSearchDomains = 6
+
+// normalizeDNS validates the DNS configuration of the network configuration and returns the one to
+// set in the CNI result. The nameservers must be valid IP addresses: they are converted to their
+// canonical form and duplicates are removed. The search domains must not be empty or contain
+// whitespace: duplicates are removed, and only the first maxDNSSearchDomains are kept.
+func normalizeDNS(dns types.DNS) (types.DNS, error) {
+	if strings.ContainsAny(dns.Domain, " \t\n") {
+		return types.DNS{}, fmt.Errorf("invalid DNS domain %q", dns.Domain)
+	}
+	normalized := types.DNS{Domain: dns.Domain, Options: dns.Options}
+	nameservers := sets.NewString()
+	for _, nameserver := range dns.Nameservers {
+		nameserverIP := net.ParseIP(strings.TrimSpace(nameserver))
+		if nameserverIP == nil {
+			return types.DNS{}, fmt.Errorf("invalid DNS nameserver %q, it must be an IP address", nameserver)
+		}
+		if nameservers.Has(nameserverIP.String()) {
+			continue
+		}
+		nameservers.Insert(nameserverIP.String())
+		normalized.Nameservers = append(normalized.Nameservers, nameserverIP.String())
+	}
+	searchDomains := sets.NewString()
+	for _, domain := range dns.Search {
+		if domain == "" || strings.ContainsAny(domain, " \t\n") {
+			return types.DNS{}, fmt.Errorf("invalid DNS search domain %q", domain)
+		}
+		if searchDomains.Has(domain) {
+			continue
+		}
+		if len(normalized.Search) == maxDNSSearchDomains {
+			klog.Warningf("More than %d DNS search domains are configured, ignoring %s", maxDNSSearchDomains, domain)
+			continue
+		}
+		searchDomains.Insert(domain)
+		normalized.Search = append(normalized.Search, domain)
+	}
+	return normalized, nil
+}
+
+// getPod retrieves the Pod with the provided name and namespace from the K8s apiserver. It gives up
+// after podGetTimeout or when ctx is cancelled, so that an unresponsive apiserver cannot block the
+// processing of a CNI request.
+func (s *CNIServer) getPod(ctx context.Context, podName, podNamespace string) (*v1.Pod, error) {
+	type getResult struct {
+		pod *v1.Pod
+		err error
+	}
+	resultCh := make(chan getResult, 1)
+	go func() {
+		pod, err := s.kubeClient.CoreV1().Pods(podNamespace).Get(podName, metav1.GetOptions{})
+		resultCh <- getResult{pod: pod, err: err}
+	}()
+	timer := time.NewTimer(podGetTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-resultCh:
+		return r.pod, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out after %v", podGetTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// validatePod checks that the Pod with the provided name and namespace exists and is scheduled on
+// this Node. pod and getErr are the values returned by getPod. Only an error returned by the K8s
+// apiserver for a missing Pod causes the validation to fail: for other errors, the Pod is assumed
+// to be valid so that the availability of the apiserver does not impact Pod creation.
+func (s *CNIServer) validatePod(podName, podNamespace string, pod *v1.Pod, getErr error) error {
+	if errors.IsNotFound(getErr) {
+		return fmt.Errorf("Pod %s/%s does not exist", podNamespace, podName)
+	} else if getErr != nil {
+		klog.Warningf("Failed to get Pod %s/%s, assuming it exists: %v", podNamespace, podName, getErr)
+		return nil
+	}
+	if pod.Spec.NodeName != s.nodeConfig.Name {
+		return fmt.Errorf("Pod %s/%s is scheduled on Node '%s' instead of %s", podNamespace, podName, pod.Spec.NodeName, s.nodeConfig.Name)
+	}
+	return nil
+}
+
+func addDefaultRouteIfMissing(result *current.Result, defaultRouteDst string, gateway net.IP) {
+	for _, route := range result.Routes {
+		if route.Dst.String() == defaultRouteDst {
+			return
+		}
+	}
+	_, defaultRouteDstNet, _ := net.ParseCIDR(defaultRouteDst)
+	result.Routes = append(result.Routes, &types.Route{Dst: *defaultRouteDstNet, GW: gateway})
 }
 
 func (s *CNIServer) loadNetworkConfig(request *cnipb.CniCmdRequest) (*CNIConfig, error) {
@@ -163,11 +371,14 @@ func (s *CNIServer) loadNetworkConfig(request *cnipb.CniCmdRequest) (*CNIConfig,
 	if err := json.Unmarshal(request.CniArgs.NetworkConfiguration, cniConfig); err != nil {
 		return cniConfig, err
 	}
-	cniConfig.k8sArgs = &k8sArgs{}
-	if err := types.LoadArgs(request.CniArgs.Args, cniConfig.k8sArgs); err != nil {
+	k8sCNIArgs, err := parseK8sArgs(request.CniArgs.Args)
+	if err != nil {
+		return cniConfig, err
+	}
+	cniConfig.k8sArgs = k8sCNIArgs
+	if err := s.updateLocalIPAMSubnet(cniConfig); err != nil {
 		return cniConfig, err
 	}
-	s.updateLocalIPAMSubnet(cniConfig)
 	if cniConfig.MTU == 0 {
 		cniConfig.MTU = s.defaultMTU
 	}
@@ -180,6 +391,17 @@ func (s *CNIServer) isCNIVersionSupported(reqVersion string) bool {
 	return exist
 }
 
+// supportedCNIVersionList returns the sorted, comma-separated list of the CNI versions supported by
+// the server.
+func (s *CNIServer) supportedCNIVersionList() string {
+	versions := make([]string, 0, len(s.supportedCNIVersions))
+	for version := range s.supportedCNIVersions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ",")
+}
+
 func (s *CNIServer) checkRequestMessage(request *cnipb.CniCmdRequest) (*CNIConfig, *cnipb.CniCmdResponse) {
 	cniConfig, err := s.loadNetworkConfig(request)
 	if err != nil {
@@ -189,23 +411,59 @@ func (s *CNIServer) checkRequestMessage(request *cnipb.CniCmdRequest) (*CNIConfi
 	cniVersion := cniConfig.CNIVersion
 	// Check if CNI version in the request is supported
 	if !s.isCNIVersionSupported(cniVersion) {
-		klog.Errorf(fmt.Sprintf("Unsupported CNI version [%s], supported CNI versions [%s]", cniVersion, supportedCNIVersions))
+		klog.Errorf("Unsupported CNI version [%s], supported CNI versions [%s]", cniVersion, s.supportedCNIVersionList())
 		return cniConfig, s.incompatibleCniVersionResponse(cniVersion)
 	}
 	// Find IPAM Service according configuration
 	ipamType := cniConfig.IPAM.Type
 	isValid := ipam.IsIPAMTypeValid(ipamType)
 	if !isValid {
-		klog.Errorf("Unsupported IPAM type %s", ipamType)
-		return cniConfig, s.unsupportedFieldResponse("ipam/type", ipamType)
+		klog.Errorf("Unsupported IPAM type %s, supported IPAM types [%s]", ipamType, strings.Join(ipam.ListIPAMTypes(), ","))
+		return cniConfig, s.unsupportedIPAMTypeResponse(ipamType)
 	}
 	return cniConfig, nil
 }
 
-func (s *CNIServer) updateLocalIPAMSubnet(cniConfig *CNIConfig) {
-	cniConfig.NetworkConfig.IPAM.Gateway = s.nodeConfig.Gateway.IP.String()
-	cniConfig.NetworkConfig.IPAM.Subnet = s.nodeConfig.PodCIDR.String()
+// checkK8sArgs returns an error response if the Pod name or Namespace is missing from the CNI args
+// of an ADD request. They are required to name the host interface and to identify the Pod in the
+// interface store. DEL requests are processed without them on a best-effort basis.
+func (s *CNIServer) checkK8sArgs(cniConfig *CNIConfig) *cnipb.CniCmdResponse {
+	if cniConfig.K8S_POD_NAME == "" {
+		klog.Errorf("Missing K8S_POD_NAME in CNI args")
+		return s.missingFieldResponse("K8S_POD_NAME")
+	}
+	if cniConfig.K8S_POD_NAMESPACE == "" {
+		klog.Errorf("Missing K8S_POD_NAMESPACE in CNI args")
+		return s.missingFieldResponse("K8S_POD_NAMESPACE")
+	}
+	return nil
+}
+
+// updateLocalIPAMSubnet sets the subnet and gateway of the IPAM configuration to the PodCIDR of the
+// Node and to the IP address of the host gateway. The IPAM configuration is left unchanged if no
+// PodCIDR has been assigned to the Node yet. If some addresses are excluded, the PodCIDR is instead
+// split into ranges which do not include them, and an error is returned if an excluded address is
+// not within the PodCIDR.
+func (s *CNIServer) updateLocalIPAMSubnet(cniConfig *CNIConfig) error {
+	if s.nodeConfig.PodCIDR == nil {
+		return nil
+	}
+	gateway := s.nodeConfig.Gateway.IPForFamily(s.nodeConfig.PodCIDR.IP)
+	if len(cniConfig.NetworkConfig.IPAM.Exclude) > 0 {
+		ranges, err := ipam.RangesExcluding(s.nodeConfig.PodCIDR, gateway, cniConfig.NetworkConfig.IPAM.Exclude)
+		if err != nil {
+			return fmt.Errorf("invalid IPAM exclusions: %v", err)
+		}
+		// host-local does not accept a subnet which overlaps with the ranges.
+		cniConfig.NetworkConfig.IPAM.Gateway = ""
+		cniConfig.NetworkConfig.IPAM.Subnet = ""
+		cniConfig.NetworkConfig.IPAM.Ranges = [][]ipam.RangeConfig{ranges}
+	} else {
+		cniConfig.NetworkConfig.IPAM.Gateway = gateway.String()
+		cniConfig.NetworkConfig.IPAM.Subnet = s.nodeConfig.PodCIDR.String()
+	}
 	cniConfig.NetworkConfiguration, _ = json.Marshal(cniConfig.NetworkConfig)
+	return nil
 }
 
 func (s *CNIServer) generateCNIErrorResponse(cniErrorCode cnipb.ErrorCode, cniErrorMsg string) *cnipb.CniCmdResponse {
@@ -226,7 +484,7 @@ func (s *CNIServer) decodingFailureResponse(what string) *cnipb.CniCmdResponse {
 
 func (s *CNIServer) incompatibleCniVersionResponse(cniVersion string) *cnipb.CniCmdResponse {
 	cniErrorCode := cnipb.ErrorCode_INCOMPATIBLE_CNI_VERSION
-	cniErrorMsg := fmt.Sprintf("Unsupported CNI version [%s], supported versions [%s]", cniVersion, supportedCNIVersions)
+	cniErrorMsg := fmt.Sprintf("Unsupported CNI version [%s], supported versions [%s]", cniVersion, s.supportedCNIVersionList())
 	return s.generateCNIErrorResponse(cniErrorCode, cniErrorMsg)
 }
 
@@ -236,6 +494,18 @@ func (s *CNIServer) unsupportedFieldResponse(key string, value interface{}) *cni
 	return s.generateCNIErrorResponse(cniErrorCode, cniErrorMsg)
 }
 
+func (s *CNIServer) missingFieldResponse(key string) *cnipb.CniCmdResponse {
+	cniErrorCode := cnipb.ErrorCode_UNSUPPORTED_FIELD
+	cniErrorMsg := fmt.Sprintf("Required field %s is missing", key)
+	return s.generateCNIErrorResponse(cniErrorCode, cniErrorMsg)
+}
+
+func (s *CNIServer) unsupportedIPAMTypeResponse(ipamType string) *cnipb.CniCmdResponse {
+	cniErrorCode := cnipb.ErrorCode_UNSUPPORTED_FIELD
+	cniErrorMsg := fmt.Sprintf("Network configuration does not support key ipam/type and value %s, supported IPAM types [%s]", ipamType, strings.Join(ipam.ListIPAMTypes(), ","))
+	return s.generateCNIErrorResponse(cniErrorCode, cniErrorMsg)
+}
+
 func (s *CNIServer) unknownContainerResponse(containerID string) *cnipb.CniCmdResponse {
 	cniErrorCode := cnipb.ErrorCode_UNKNOWN_CONTAINER
 	cniErrorMsg := fmt.Sprintf("Container id  %s is unknown or non-existent", containerID)
@@ -273,9 +543,9 @@ func (s *CNIServer) invalidNetworkConfigResponse(msg string) *cnipb.CniCmdRespon
 	)
 }
 
-func buildVersionSet(versions string) map[string]bool {
+func buildVersionSet(versions []string) map[string]bool {
 	versionSet := make(map[string]bool)
-	for _, ver := range strings.Split(versions, ",") {
+	for _, ver := range versions {
 		versionSet[strings.Trim(ver, " ")] = true
 	}
 	return versionSet
@@ -301,6 +571,14 @@ func (s *CNIServer) parsePrevResultFromRequest(networkConfig *NetworkConfig) (*c
 	return prevResult, nil
 }
 
+// containerIfaceName returns the name of the host interface for the provided Pod and container.
+func (s *CNIServer) containerIfaceName(podName string, podNamespace string, containerID string) string {
+	if s.hashedContainerIfaceNames {
+		return util.GenerateHashedContainerInterfaceName(s.containerIfacePrefix, podName, podNamespace, containerID)
+	}
+	return util.GenerateContainerInterfaceNameWithPrefix(s.containerIfacePrefix, podName, podNamespace)
+}
+
 // When running in a container, the host's /proc directory is mounted under s.hostProcPathPrefix, so
 // we need to prepend s.hostProcPathPrefix to the network namespace path provided by the cni. When
 // running as a simple process, s.hostProcPathPrefix will be empty.
@@ -311,9 +589,44 @@ func (s *CNIServer) hostNetNsPath(netNS string) string {
 	return s.hostProcPathPrefix + netNS
 }
 
+// validateInterfaceFromStore is a best-effort validation of the container network configuration, for
+// CNI versions older than 0.4.0 for which prevResult is not provided with CHECK requests. It confirms
+// that the container interface and its OVS port are known to the InterfaceStore. If the CNI result of
+// the ADD request was saved with the interface, the network devices are validated against it as they
+// would be against prevResult; otherwise (interfaces created by older versions) their configuration is
+// not checked. A nil response means that the validation succeeded.
+func (s *CNIServer) validateInterfaceFromStore(cfgArgs *cnipb.CniCmdArgs, k8sCNIArgs *k8sArgs) *cnipb.CniCmdResponse {
+	podName := string(k8sCNIArgs.K8S_POD_NAME)
+	podNamespace := string(k8sCNIArgs.K8S_POD_NAMESPACE)
+	containerConfig, found := s.ifaceStore.GetContainerInterface(podName, podNamespace)
+	if !found {
+		klog.Errorf("Failed to find interface for Pod %s/%s", podNamespace, podName)
+		return s.checkInterfaceFailureResponse(fmt.Errorf("interface for Pod %s/%s not found", podNamespace, podName))
+	}
+	if containerConfig.ID != cfgArgs.ContainerId {
+		klog.Errorf("Interface for Pod %s/%s belongs to container %s instead of %s", podNamespace, podName, containerConfig.ID, cfgArgs.ContainerId)
+		return s.checkInterfaceFailureResponse(fmt.Errorf("interface for Pod %s/%s does not belong to container %s", podNamespace, podName, cfgArgs.ContainerId))
+	}
+	if containerConfig.OVSPortConfig == nil || containerConfig.PortUUID == "" {
+		klog.Errorf("Failed to find OVS port for container %s", cfgArgs.ContainerId)
+		return s.checkInterfaceFailureResponse(fmt.Errorf("OVS port for container %s not found", cfgArgs.ContainerId))
+	}
+	storedResult, err := parseStoredCNIResult(containerConfig)
+	if err != nil {
+		klog.Errorf("Failed to parse CNI result saved for container %s: %v", cfgArgs.ContainerId, err)
+		return s.checkInterfaceFailureResponse(err)
+	}
+	if storedResult != nil {
+		if response, _ := s.validatePrevResult(cfgArgs, k8sCNIArgs, storedResult); response.Error != nil {
+			return response
+		}
+	}
+	return nil
+}
+
 func (s *CNIServer) validatePrevResult(cfgArgs *cnipb.CniCmdArgs, k8sCNIArgs *k8sArgs, prevResult *current.Result) (*cnipb.CniCmdResponse, error) {
 	var containerIntf, hostIntf *current.Interface
-	hostVethName := util.GenerateContainerInterfaceName(string(k8sCNIArgs.K8S_POD_NAME), string(k8sCNIArgs.K8S_POD_NAMESPACE))
+	hostVethName := s.containerIfaceName(string(k8sCNIArgs.K8S_POD_NAME), string(k8sCNIArgs.K8S_POD_NAMESPACE), cfgArgs.ContainerId)
 	containerID := cfgArgs.ContainerId
 	netNS := s.hostNetNsPath(cfgArgs.Netns)
 
@@ -349,20 +662,64 @@ func (s *CNIServer) validatePrevResult(cfgArgs *cnipb.CniCmdArgs, k8sCNIArgs *k8
 func (s *CNIServer) CmdAdd(ctx context.Context, request *cnipb.CniCmdRequest) (
 	*cnipb.CniCmdResponse, error) {
 	klog.Infof("Receive CmdAdd request %v", request)
+	if s.nodeConfig.PodCIDR == nil {
+		// No IP address can be allocated until the Node is assigned a PodCIDR, let kubelet
+		// retry the request.
+		klog.Warningf("No PodCIDR assigned to Node %s yet, cannot process CmdAdd request", s.nodeConfig.Name)
+		return s.tryAgainLaterResponse(), nil
+	}
 	cniConfig, response := s.checkRequestMessage(request)
 	if response != nil {
 		return response, nil
 	}
+	if response := s.checkK8sArgs(cniConfig); response != nil {
+		return response, nil
+	}
+	if err := validateQdisc(cniConfig.Qdisc); err != nil {
+		klog.Errorf("Invalid network configuration: %v", err)
+		return s.invalidNetworkConfigResponse(err.Error()), nil
+	}
+	if err := validateTxQueueLen(cniConfig.TxQueueLen); err != nil {
+		klog.Errorf("Invalid network configuration: %v", err)
+		return s.invalidNetworkConfigResponse(err.Error()), nil
+	}
+	dns, err := normalizeDNS(cniConfig.DNS)
+	if err != nil {
+		klog.Errorf("Invalid network configuration: %v", err)
+		return s.invalidNetworkConfigResponse(err.Error()), nil
+	}
+	podName := string(cniConfig.K8S_POD_NAME)
+	podNamespace := string(cniConfig.K8S_POD_NAMESPACE)
+	// The Pod is retrieved at most once per request, and before any resource is allocated, so
+	// there is nothing to roll back if the request is rejected.
+	var podRoutesAnnotation string
+	if s.validatePodExistence || s.enablePodRoutesAnnotation {
+		pod, err := s.getPod(ctx, podName, podNamespace)
+		if s.validatePodExistence {
+			if err := s.validatePod(podName, podNamespace, pod, err); err != nil {
+				klog.Errorf("Rejecting CmdAdd request for container %s: %v", cniConfig.ContainerId, err)
+				return s.unknownContainerResponse(cniConfig.ContainerId), nil
+			}
+		}
+		if s.enablePodRoutesAnnotation {
+			if err != nil {
+				klog.Errorf("Failed to get Pod %s/%s, cannot configure its extra routes: %v", podNamespace, podName, err)
+				return s.tryAgainLaterResponse(), nil
+			}
+			podRoutesAnnotation = pod.Annotations[PodRoutesAnnotationKey]
+		}
+	}
 	cniVersion := cniConfig.CNIVersion
 	result := &current.Result{CNIVersion: cniVersion}
 	netNS := s.hostNetNsPath(cniConfig.Netns)
 
 	success := false
 	defer func() {
-		// Rollback to delete configurations once ADD is failure.
+		// Rollback to delete configurations once ADD is failure. The request context may have
+		// been cancelled, in which case it cannot be used to release resources.
 		if !success {
 			klog.Warningf("CmdAdd has failed, and try to rollback")
-			if _, err := s.CmdDel(ctx, request); err != nil {
+			if _, err := s.CmdDel(context.Background(), request); err != nil {
 				klog.Warningf("Failed to rollback after CNI add failure: %v", err)
 			}
 		}
@@ -372,7 +729,7 @@ func (s *CNIServer) CmdAdd(ctx context.Context, request *cnipb.CniCmdRequest) (
 	defer s.containerAccess.unlockContainer(cniConfig.ContainerId)
 
 	// Request IP Address from IPAM driver
-	ipamResult, err := ipam.ExecIPAMAdd(cniConfig.CniCmdArgs, cniConfig.IPAM.Type)
+	ipamResult, err := ipam.ExecIPAMAdd(ctx, cniConfig.CniCmdArgs, cniConfig.IPAM.Type)
 	if err != nil {
 		klog.Errorf("Failed to add ip addresses from IPAM driver: %v", err)
 		return s.ipamFailureResponse(err), nil
@@ -381,27 +738,37 @@ func (s *CNIServer) CmdAdd(ctx context.Context, request *cnipb.CniCmdRequest) (
 	result.IPs = ipamResult.IPs
 	result.Routes = ipamResult.Routes
 	// Ensure interface gateway setting and mapping relations between result.Interfaces and result.IPs
-	updateResultIfaceConfig(result, s.nodeConfig.Gateway.IP)
+	updateResultIfaceConfig(result, s.nodeConfig.Gateway.IPv4, s.nodeConfig.Gateway.IPv6)
+	if podRoutesAnnotation != "" {
+		routes, err := parsePodRoutes(podRoutesAnnotation, result.IPs, s.nodeConfig.Gateway)
+		if err != nil {
+			klog.Errorf("Failed to parse extra routes for Pod %s/%s: %v", podNamespace, podName, err)
+			return s.invalidNetworkConfigResponse(err.Error()), nil
+		}
+		result.Routes = append(result.Routes, routes...)
+	}
+	// The DNS configuration is set before configuring the interface, as the result is saved with it.
+	result.DNS = dns
 	// Setup pod interfaces and connect to ovs bridge
-	podName := string(cniConfig.K8S_POD_NAME)
-	podNamespace := string(cniConfig.K8S_POD_NAMESPACE)
 	if err = configureInterface(
+		ctx,
 		s.ovsBridgeClient,
 		s.ofClient,
-		s.nodeConfig.Gateway,
+		s.nodeConfig.GatewayMACForPods(),
 		s.ifaceStore,
 		podName,
 		podNamespace,
+		s.containerIfaceName(podName, podNamespace, cniConfig.ContainerId),
 		cniConfig.ContainerId,
 		netNS,
 		cniConfig.Ifname,
-		cniConfig.MTU,
+		cniConfig.InterfaceSettings,
 		result,
+		&agent.IPAMArgs{IfName: cniConfig.Ifname, Path: cniConfig.Path, NetworkConfig: cniConfig.NetworkConfiguration},
 	); err != nil {
 		klog.Errorf("Failed to configure container %s interface: %v", cniConfig.ContainerId, err)
 		return s.configInterfaceFailureResponse(err), nil
 	}
-	result.DNS = cniConfig.DNS
 	var resultBytes bytes.Buffer
 	result.PrintTo(&resultBytes)
 	klog.Infof("CmdAdd request success")
@@ -423,19 +790,46 @@ func (s *CNIServer) CmdDel(ctx context.Context, request *cnipb.CniCmdRequest) (
 	s.containerAccess.lockContainer(cniConfig.ContainerId)
 	defer s.containerAccess.unlockContainer(cniConfig.ContainerId)
 
-	// Release IP to IPAM driver
-	if err := ipam.ExecIPAMDelete(cniConfig.CniCmdArgs, cniConfig.IPAM.Type); err != nil {
-		klog.Errorf("Failed to delete IP addresses by IPAM driver: %v", err)
-		return s.ipamFailureResponse(err), nil
-	}
-	klog.Info("Deleted IP addresses by IPAM driver")
-	// Remove host interface and OVS configuration
+	// Release IP to IPAM driver. A failure does not prevent the removal of the interface and OVS
+	// configuration, so that the datapath is cleaned up even if the IP address cannot be released;
+	// the IPAM error takes precedence and is returned once the removal has been attempted.
 	podName := string(cniConfig.K8S_POD_NAME)
 	podNamespace := string(cniConfig.K8S_POD_NAMESPACE)
+	var containerConfig *agent.InterfaceConfig
+	if podName == "" || podNamespace == "" {
+		// The K8s args are not required for DEL: the interface is looked up by container ID
+		// instead, so that its OVS port is removed as well.
+		if iface, found := s.findContainerInterface(cniConfig.ContainerId); found {
+			containerConfig = iface
+			podName, podNamespace = iface.PodName, iface.PodNamespace
+		}
+	} else if iface, found := getPodContainerInterface(s.ifaceStore, podName, podNamespace, cniConfig.ContainerId); found {
+		containerConfig = iface
+	}
+
+	ipamErr := ipam.ExecIPAMDelete(ctx, cniConfig.CniCmdArgs, cniConfig.IPAM.Type)
+	// If the IP address of the container was reassigned, it was allocated with another container
+	// ID, which must be released as well.
+	if ipamErr == nil && containerConfig != nil && containerConfig.IPAMArgs != nil && containerConfig.IPAMArgs.ContainerID != "" {
+		reassignedArgs := *cniConfig.CniCmdArgs
+		reassignedArgs.ContainerId = containerConfig.IPAMArgs.ContainerID
+		ipamErr = ipam.ExecIPAMDelete(ctx, &reassignedArgs, cniConfig.IPAM.Type)
+	}
+	if ipamErr != nil {
+		klog.Errorf("Failed to delete IP addresses by IPAM driver: %v", ipamErr)
+	} else {
+		klog.Info("Deleted IP addresses by IPAM driver")
+	}
+	// Remove host interface and OVS configuration
 	netNS := s.hostNetNsPath(cniConfig.Netns)
 	if err := removeInterfaces(s.ovsBridgeClient, s.ofClient, s.ifaceStore, podName, podNamespace, cniConfig.ContainerId, netNS, cniConfig.Ifname); err != nil {
 		klog.Errorf("Failed to remove container %s interface configuration: %v", cniConfig.ContainerId, err)
-		return s.configInterfaceFailureResponse(err), nil
+		if ipamErr == nil {
+			return s.configInterfaceFailureResponse(err), nil
+		}
+	}
+	if ipamErr != nil {
+		return s.ipamFailureResponse(ipamErr), nil
 	}
 	return &cnipb.CniCmdResponse{
 		CniResult: []byte(""),
@@ -453,7 +847,7 @@ func (s *CNIServer) CmdCheck(ctx context.Context, request *cnipb.CniCmdRequest)
 	s.containerAccess.lockContainer(cniConfig.ContainerId)
 	defer s.containerAccess.unlockContainer(cniConfig.ContainerId)
 
-	if err := ipam.ExecIPAMCheck(cniConfig.CniCmdArgs, cniConfig.IPAM.Type); err != nil {
+	if err := ipam.ExecIPAMCheck(ctx, cniConfig.CniCmdArgs, cniConfig.IPAM.Type); err != nil {
 		klog.Errorf("Failed to check IPAM configuration: %v", err)
 		return s.ipamFailureResponse(err), nil
 	}
@@ -465,6 +859,8 @@ func (s *CNIServer) CmdCheck(ctx context.Context, request *cnipb.CniCmdRequest)
 		} else if response, err := s.validatePrevResult(cniConfig.CniCmdArgs, cniConfig.k8sArgs, prevResult); err != nil {
 			return response, err
 		}
+	} else if response := s.validateInterfaceFromStore(cniConfig.CniCmdArgs, cniConfig.k8sArgs); response != nil {
+		return response, nil
 	}
 	klog.Info("Succeed to check network configuration")
 	return &cnipb.CniCmdResponse{
@@ -472,27 +868,68 @@ func (s *CNIServer) CmdCheck(ctx context.Context, request *cnipb.CniCmdRequest)
 	}, nil
 }
 
+// Options contains the optional settings of a CNIServer. The zero value is valid and corresponds
+// to the default behavior.
+type Options struct {
+	// SocketMode is the file mode of the CNI socket. DefaultCNISocketMode is used if it is 0.
+	SocketMode os.FileMode
+	// SupportedVersions are the CNI versions supported by the server. DefaultSupportedCNIVersions
+	// are used if it is empty.
+	SupportedVersions []string
+	// VerifyPodFlows indicates whether the Pod flows should be checked against OVS after the
+	// startup reconciliation.
+	VerifyPodFlows bool
+	// ContainerIfacePrefix is the prefix of the name of all the host interfaces created for Pods.
+	ContainerIfacePrefix string
+	// HashedContainerIfaceNames indicates whether the names of the host interfaces created for
+	// Pods are generated with util.GenerateHashedContainerInterfaceName.
+	HashedContainerIfaceNames bool
+	// ValidatePodExistence indicates whether ADD requests should be rejected if the Pod does not
+	// exist or is not scheduled on this Node.
+	ValidatePodExistence bool
+	// EnablePodRoutesAnnotation indicates whether the routes from the PodRoutesAnnotationKey
+	// annotation of the Pod should be configured on ADD.
+	EnablePodRoutesAnnotation bool
+}
+
+// New creates a CNIServer. The optional settings are provided with opts.
 func New(
-	cniSocket, hostProcPathPrefix string,
+	cniSocket string,
+	hostProcPathPrefix string,
 	defaultMTU int,
 	nodeConfig *agent.NodeConfig,
 	ovsBridgeClient ovsconfig.OVSBridgeClient,
 	ofClient openflow.Client,
 	ifaceStore agent.InterfaceStore,
 	kubeClient clientset.Interface,
+	opts Options,
 ) *CNIServer {
+	socketMode := opts.SocketMode
+	if socketMode == 0 {
+		socketMode = DefaultCNISocketMode
+	}
+	supportedCNIVersions := opts.SupportedVersions
+	if len(supportedCNIVersions) == 0 {
+		supportedCNIVersions = DefaultSupportedCNIVersions
+	}
 	return &CNIServer{
-		cniSocket:            cniSocket,
-		supportedCNIVersions: supportedCNIVersionSet,
-		serverVersion:        cni.AntreaCNIVersion,
-		nodeConfig:           nodeConfig,
-		ovsBridgeClient:      ovsBridgeClient,
-		ifaceStore:           ifaceStore,
-		hostProcPathPrefix:   hostProcPathPrefix,
-		ofClient:             ofClient,
-		defaultMTU:           defaultMTU,
-		kubeClient:           kubeClient,
-		containerAccess:      newContainerAccessArbitrator(),
+		cniSocket:                 cniSocket,
+		cniSocketMode:             socketMode,
+		supportedCNIVersions:      buildVersionSet(supportedCNIVersions),
+		serverVersion:             cni.AntreaCNIVersion,
+		nodeConfig:                nodeConfig,
+		ovsBridgeClient:           ovsBridgeClient,
+		ifaceStore:                ifaceStore,
+		hostProcPathPrefix:        hostProcPathPrefix,
+		ofClient:                  ofClient,
+		defaultMTU:                defaultMTU,
+		kubeClient:                kubeClient,
+		containerAccess:           newContainerAccessArbitrator(),
+		verifyPodFlows:            opts.VerifyPodFlows,
+		containerIfacePrefix:      opts.ContainerIfacePrefix,
+		hashedContainerIfaceNames: opts.HashedContainerIfaceNames,
+		validatePodExistence:      opts.ValidatePodExistence,
+		enablePodRoutesAnnotation: opts.EnablePodRoutesAnnotation,
 	}
 }
 
@@ -507,9 +944,7 @@ func (s *CNIServer) Run(stopCh <-chan struct{}) {
 	klog.Info("Starting CNI server")
 	defer klog.Info("Shutting down CNI server")
 
-	// remove before bind to avoid "address already in use" errors
-	os.Remove(s.cniSocket)
-	listener, err := net.Listen("unix", s.cniSocket)
+	listener, err := s.listen()
 	if err != nil {
 		klog.Errorf("Failed to bind on %s: %v", s.cniSocket, err)
 		os.Exit(1)
@@ -526,11 +961,32 @@ func (s *CNIServer) Run(stopCh <-chan struct{}) {
 	<-stopCh
 }
 
+// listen creates the CNI socket and sets its file mode to cniSocketMode, so that the permissions of
+// the socket do not depend on the umask of the antrea-agent process.
+func (s *CNIServer) listen() (net.Listener, error) {
+	// remove before bind to avoid "address already in use" errors
+	os.Remove(s.cniSocket)
+	listener, err := net.Listen("unix", s.cniSocket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(s.cniSocket, s.cniSocketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set mode of %s to %#o: %v", s.cniSocket, s.cniSocketMode, err)
+	}
+	return listener, nil
+}
+
 // reconcile performs startup reconciliation for the CNI server. The CNI server is in charge of
 // installing Pod flows, so as part of this reconciliation process we retrieve the Pod list from the
 // K8s apiserver and replay the necessary flows.
 func (s *CNIServer) reconcile() error {
 	klog.Infof("Reconciliation for CNI server")
+	// Pod flows forward traffic to and from the host gateway, so the gateway port must be
+	// reconciled first.
+	if err := s.reconcileGatewayInterface(); err != nil {
+		return fmt.Errorf("failed to reconcile gateway interface: %v", err)
+	}
 	pods, err := s.kubeClient.CoreV1().Pods("").List(metav1.ListOptions{
 		FieldSelector: "spec.nodeName=" + s.nodeConfig.Name,
 	})
@@ -543,6 +999,8 @@ func (s *CNIServer) reconcile() error {
 	desiredInterfaces := make(map[string]bool)
 	// knownInterfaces is the list of interfaces currently in the local cache.
 	knownInterfaces := s.ifaceStore.GetInterfaceIDs()
+	// reconciledPods maps the Pods for which flows were installed to their interface names.
+	reconciledPods := make(map[string]string)
 
 	for _, pod := range pods.Items {
 		// Skip Pods for which we are not in charge of the networking.
@@ -572,13 +1030,25 @@ func (s *CNIServer) reconcile() error {
 			containerConfig.IfaceName,
 			containerConfig.IP,
 			containerConfig.MAC,
-			s.nodeConfig.Gateway.MAC,
+			s.nodeConfig.GatewayMACForPods(),
 			uint32(containerConfig.OFPort),
 		); err != nil {
 			klog.Errorf("Error when re-installing flows for Pod %s/%s", pod.Namespace, pod.Name)
 			continue
 		}
 		desiredInterfaces[containerConfig.IfaceName] = true
+		reconciledPods[pod.Namespace+"/"+pod.Name] = containerConfig.IfaceName
+	}
+
+	if s.verifyPodFlows {
+		if missingPods := s.checkPodFlows(reconciledPods); len(missingPods) > 0 {
+			klog.Errorf("Flows are missing in OVS for Pods %v after reconciliation", missingPods)
+		}
+	}
+
+	if s.isReconcilePaused() {
+		klog.Infof("Reconciliation is paused, skipping the deletion of orphaned interfaces")
+		return nil
 	}
 
 	for _, ifaceID := range knownInterfaces {
@@ -598,6 +1068,18 @@ func (s *CNIServer) reconcile() error {
 			// not a container interface, skipping.
 			continue
 		}
+		if !strings.HasPrefix(ifaceID, s.containerIfacePrefix) {
+			// not created by this CNI server (e.g. the bridge is shared), skipping.
+			klog.V(2).Infof("Ignoring interface %s which does not have prefix %q", ifaceID, s.containerIfacePrefix)
+			continue
+		}
+		// The CNI DEL request was never received for this container (otherwise the interface
+		// would have been removed from the store), so the IP address may still be allocated.
+		if err := releaseIPAMAllocation(containerConfig); err != nil {
+			// Keep the interface so that we can try again during the next reconciliation.
+			klog.Errorf("Failed to release IP address for stale interface %s: %v", ifaceID, err)
+			continue
+		}
 		klog.V(4).Infof("Deleting interface %s", ifaceID)
 		// ignore error, removeInterfaces already log them
 		_ = removeInterfaces(
@@ -615,6 +1097,324 @@ func (s *CNIServer) reconcile() error {
 	return nil
 }
 
-func init() {
-	supportedCNIVersionSet = buildVersionSet(supportedCNIVersions)
+// PauseReconcile prevents reconciliation from deleting the interfaces which do not match any Pod
+// running on the Node, until ResumeReconcile is called. The flows of known Pods are still
+// installed. This is useful during maintenance operations, when these interfaces may be migrated.
+func (s *CNIServer) PauseReconcile() {
+	s.reconcilePausedMutex.Lock()
+	defer s.reconcilePausedMutex.Unlock()
+	s.reconcilePaused = true
+}
+
+// ResumeReconcile allows reconciliation to delete orphaned interfaces again.
+func (s *CNIServer) ResumeReconcile() {
+	s.reconcilePausedMutex.Lock()
+	defer s.reconcilePausedMutex.Unlock()
+	s.reconcilePaused = false
+}
+
+func (s *CNIServer) isReconcilePaused() bool {
+	s.reconcilePausedMutex.RLock()
+	defer s.reconcilePausedMutex.RUnlock()
+	return s.reconcilePaused
+}
+
+// releaseIPAMAllocation releases the IP address allocated to the container of a stale interface, by
+// invoking the IPAM driver with the arguments persisted when the interface was created. Interfaces
+// without IPAM arguments (created by an older version) are ignored.
+func releaseIPAMAllocation(containerConfig *agent.InterfaceConfig) error {
+	if containerConfig.IPAMArgs == nil {
+		klog.Warningf("No IPAM arguments for interface %s, cannot release its IP address", containerConfig.IfaceName)
+		return nil
+	}
+	cniArgs, networkConfig, err := buildIPAMCmdArgs(containerConfig)
+	if err != nil {
+		return err
+	}
+	if err := ipam.ExecIPAMDelete(context.Background(), cniArgs, networkConfig.IPAM.Type); err != nil {
+		return err
+	}
+	klog.Infof("Released IP address for stale interface %s", containerConfig.IfaceName)
+	return nil
+}
+
+// buildIPAMCmdArgs builds the CNI arguments required to invoke the IPAM driver for the container of
+// an existing interface, from the IPAM arguments persisted when the interface was created or when
+// its IP address was reassigned. The network configuration is returned as well.
+func buildIPAMCmdArgs(containerConfig *agent.InterfaceConfig) (*cnipb.CniCmdArgs, *NetworkConfig, error) {
+	networkConfig := &NetworkConfig{}
+	if err := json.Unmarshal(containerConfig.IPAMArgs.NetworkConfig, networkConfig); err != nil {
+		return nil, nil, fmt.Errorf("invalid network configuration: %v", err)
+	}
+	if !ipam.IsIPAMTypeValid(networkConfig.IPAM.Type) {
+		return nil, nil, fmt.Errorf("unsupported IPAM type %s", networkConfig.IPAM.Type)
+	}
+	containerID := containerConfig.ID
+	if containerConfig.IPAMArgs.ContainerID != "" {
+		containerID = containerConfig.IPAMArgs.ContainerID
+	}
+	cniArgs := &cnipb.CniCmdArgs{
+		ContainerId:          containerID,
+		Ifname:               containerConfig.IPAMArgs.IfName,
+		Path:                 containerConfig.IPAMArgs.Path,
+		NetworkConfiguration: containerConfig.IPAMArgs.NetworkConfig,
+	}
+	return cniArgs, networkConfig, nil
+}
+
+// ReassignPodIP allocates a new IP address to the container with the provided ID and reconfigures
+// the container network accordingly, e.g. to repair an IP address conflict. The current IP address
+// is only released once the container has been reconfigured, so that it cannot be allocated to
+// another container in the meantime. If the reconfiguration fails, the container keeps its current
+// IP address and the new one is released. The container is locked during the whole operation,
+// which therefore cannot run concurrently with a CNI request for the same container. The network
+// namespace of the container must be known, which is not the case for interfaces created by older
+// versions. The new IP address is returned.
+func (s *CNIServer) ReassignPodIP(ctx context.Context, containerID string) (net.IP, error) {
+	s.containerAccess.lockContainer(containerID)
+	defer s.containerAccess.unlockContainer(containerID)
+
+	containerConfig, err := s.getContainerInterface(containerID)
+	if err != nil {
+		return nil, err
+	}
+	if containerConfig.NetNS == "" {
+		return nil, fmt.Errorf("network namespace of container %s is unknown", containerID)
+	}
+	oldArgs, networkConfig, err := buildIPAMCmdArgs(containerConfig)
+	if err != nil {
+		return nil, err
+	}
+	oldResult, err := parseStoredCNIResult(containerConfig)
+	if err != nil {
+		klog.Warningf("Failed to parse CNI result saved for container %s: %v", containerID, err)
+	}
+	if oldResult == nil {
+		if oldResult, err = s.buildFallbackCNIResult(containerConfig, networkConfig.CNIVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	// IPAM drivers allocate a single IP address per container ID, so the new IP address is
+	// allocated with another container ID, which is persisted with the IPAM arguments.
+	newArgs, _, _ := buildIPAMCmdArgs(containerConfig)
+	newArgs.ContainerId = reassignedIPAMContainerID(containerID, oldArgs.ContainerId)
+	ipamResult, err := ipam.ExecIPAMAdd(ctx, newArgs, networkConfig.IPAM.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate new IP address for container %s: %v", containerID, err)
+	}
+	newIPAMArgs := *containerConfig.IPAMArgs
+	newIPAMArgs.ContainerID = ""
+	if newArgs.ContainerId != containerID {
+		newIPAMArgs.ContainerID = newArgs.ContainerId
+	}
+	result := &current.Result{CNIVersion: networkConfig.CNIVersion, IPs: ipamResult.IPs, Routes: ipamResult.Routes}
+	updateResultIfaceConfig(result, s.nodeConfig.Gateway.IPv4, s.nodeConfig.Gateway.IPv6)
+	newConfig, err := reconfigureInterfaceIP(s.ovsBridgeClient, s.ofClient, s.nodeConfig.GatewayMACForPods(), s.ifaceStore, containerConfig, &newIPAMArgs, oldResult, result)
+	if err != nil {
+		klog.Errorf("Failed to reconfigure container %s with new IP addresses %v: %v", containerID, result.IPs, err)
+		if err := ipam.ExecIPAMDelete(context.Background(), newArgs, networkConfig.IPAM.Type); err != nil {
+			klog.Errorf("Failed to release new IP addresses %v of container %s: %v", result.IPs, containerID, err)
+		}
+		return nil, err
+	}
+
+	oldIP := containerConfig.IP
+	if err := ipam.ExecIPAMDelete(context.Background(), oldArgs, networkConfig.IPAM.Type); err != nil {
+		// The container already uses the new IP address, so the error is not returned. The
+		// old IP address is released again on DEL.
+		klog.Errorf("Failed to release IP address %s of container %s: %v", oldIP, containerID, err)
+	}
+	klog.Infof("Reassigned IP address of container %s from %s to %s", containerID, oldIP, newConfig.IP)
+	return newConfig.IP, nil
+}
+
+// reassignedIPAMContainerID returns the container ID with which a new IP address is allocated to
+// the container with the provided ID, while its current IP address, allocated with currentID, is
+// still in use. The container ID and an ID derived from it are used alternately.
+func reassignedIPAMContainerID(containerID, currentID string) string {
+	if currentID == containerID {
+		return containerID + "-reassigned"
+	}
+	return containerID
+}
+
+// buildFallbackCNIResult builds the CNI result used to repair the interface of a container for
+// which no result was saved, e.g. an interface created by an older version. The IP configuration is
+// re-computed from the IP address of the container, which belongs to the PodCIDR of the Node if it
+// is of the same IP family, with a default route through the gateway.
+func (s *CNIServer) buildFallbackCNIResult(containerConfig *agent.InterfaceConfig, cniVersion string) (*current.Result, error) {
+	ipConfig := &current.IPConfig{
+		Version: "4",
+		Address: net.IPNet{IP: containerConfig.IP, Mask: net.CIDRMask(32, 32)},
+	}
+	defaultRoute := "0.0.0.0/0"
+	isIPv6 := containerConfig.IP.To4() == nil
+	if isIPv6 {
+		ipConfig.Version = "6"
+		ipConfig.Address.Mask = net.CIDRMask(128, 128)
+		defaultRoute = "::/0"
+	}
+	if podCIDR := s.nodeConfig.PodCIDR; podCIDR != nil && (podCIDR.IP.To4() == nil) == isIPv6 {
+		ipConfig.Address.Mask = podCIDR.Mask
+	}
+	result := &current.Result{CNIVersion: cniVersion, IPs: []*current.IPConfig{ipConfig}}
+	updateResultIfaceConfig(result, s.nodeConfig.Gateway.IPv4, s.nodeConfig.Gateway.IPv6)
+	if ipConfig.Gateway != nil {
+		addDefaultRouteIfMissing(result, defaultRoute, ipConfig.Gateway)
+	}
+	if s.enablePodRoutesAnnotation {
+		pod, err := s.getPod(context.Background(), containerConfig.PodName, containerConfig.PodNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Pod %s/%s: %v", containerConfig.PodNamespace, containerConfig.PodName, err)
+		}
+		if annotation := pod.Annotations[PodRoutesAnnotationKey]; annotation != "" {
+			routes, err := parsePodRoutes(annotation, result.IPs, s.nodeConfig.Gateway)
+			if err != nil {
+				return nil, err
+			}
+			result.Routes = append(result.Routes, routes...)
+		}
+	}
+	return result, nil
+}
+
+// RepairPodInterface re-creates the network interface of the container with the provided ID in the
+// network namespace containerNetNS, e.g. when the container runtime has re-created the network
+// namespace of the container while the Pod still exists. The IP address of the container is
+// preserved and its ofport is requested for the new OVS port, then the Pod flows are reinstalled.
+// The container is locked during the whole operation, which therefore cannot run concurrently with
+// a CNI request for the same container.
+func (s *CNIServer) RepairPodInterface(containerID string, containerNetNS string) error {
+	s.containerAccess.lockContainer(containerID)
+	defer s.containerAccess.unlockContainer(containerID)
+
+	containerConfig, err := s.getContainerInterface(containerID)
+	if err != nil {
+		return err
+	}
+	_, networkConfig, err := buildIPAMCmdArgs(containerConfig)
+	if err != nil {
+		return err
+	}
+	ifaceSettings := networkConfig.InterfaceSettings
+	if ifaceSettings.MTU == 0 {
+		ifaceSettings.MTU = s.defaultMTU
+	}
+	// The CNI result saved on ADD includes all the IP addresses and routes of the container, as
+	// well as the routes from the Pod annotation, so it is used as is.
+	result, err := parseStoredCNIResult(containerConfig)
+	if err != nil {
+		klog.Warningf("Failed to parse CNI result saved for container %s: %v", containerID, err)
+	}
+	if result == nil {
+		if result, err = s.buildFallbackCNIResult(containerConfig, networkConfig.CNIVersion); err != nil {
+			return err
+		}
+	}
+	if _, err := repairInterface(s.ovsBridgeClient, s.ofClient, s.nodeConfig.GatewayMACForPods(), s.ifaceStore, containerConfig, containerNetNS, ifaceSettings, result); err != nil {
+		klog.Errorf("Failed to repair interface of container %s: %v", containerID, err)
+		return err
+	}
+	klog.Infof("Repaired interface of container %s in netns %s", containerID, containerNetNS)
+	return nil
+}
+
+// getContainerInterface returns the interface configuration of the container with the provided ID.
+// An error is returned if the interface cannot be found, or if it has no IPAM arguments.
+func (s *CNIServer) getContainerInterface(containerID string) (*agent.InterfaceConfig, error) {
+	iface, found := s.findContainerInterface(containerID)
+	if !found {
+		return nil, fmt.Errorf("interface for container %s not found", containerID)
+	}
+	if iface.IPAMArgs == nil {
+		return nil, fmt.Errorf("no IPAM arguments for container %s", containerID)
+	}
+	return iface, nil
+}
+
+// findContainerInterface returns the interface of the container with the provided ID from the
+// InterfaceStore.
+func (s *CNIServer) findContainerInterface(containerID string) (*agent.InterfaceConfig, bool) {
+	for _, ifaceID := range s.ifaceStore.GetInterfaceIDs() {
+		if iface, found := s.ifaceStore.GetInterface(ifaceID); found && iface.Type == agent.ContainerInterface && iface.ID == containerID {
+			return iface, true
+		}
+	}
+	return nil, false
+}
+
+// reconcileGatewayInterface ensures that the OVS internal port for the host gateway exists on the
+// bridge. If it is missing, e.g. because OVSDB was cleaned, the gateway is set up again like when
+// the agent is initialized (see agent.SetupGatewayInterface), and the gateway flows are installed
+// again. The MAC address of the gateway in the NodeConfig is updated to the MAC address of the new
+// link.
+func (s *CNIServer) reconcileGatewayInterface() error {
+	gateway := s.nodeConfig.Gateway
+	// err is declared explicitly so that it can hold both OVS and gateway setup errors.
+	var err error
+	ports, err := s.ovsBridgeClient.GetPortList()
+	if err != nil {
+		return fmt.Errorf("failed to list OVS ports: %v", err)
+	}
+	for _, port := range ports {
+		if port.Name == gateway.Name {
+			klog.V(2).Infof("Gateway port %s exists on OVS bridge", gateway.Name)
+			return nil
+		}
+	}
+
+	klog.Warningf("Gateway port %s not found on OVS bridge, re-creating it", gateway.Name)
+	// Any configuration in the store is stale since the port no longer exists.
+	s.ifaceStore.DeleteInterface(gateway.Name)
+	newGateway, err := agent.SetupGatewayInterface(s.ovsBridgeClient, s.ifaceStore, gateway.Name, s.defaultMTU, s.nodeConfig.PodCIDR)
+	if err != nil {
+		return fmt.Errorf("failed to re-create gateway %s: %v", gateway.Name, err)
+	}
+	gateway.MAC = newGateway.MAC
+
+	gwIP := newGateway.IPv4
+	if gwIP == nil {
+		gwIP = newGateway.IPv6
+	}
+	if gwIP == nil {
+		klog.Warningf("Gateway %s has no IP address, not installing its flows", gateway.Name)
+		return nil
+	}
+	if err := s.ofClient.InstallGatewayFlows(gwIP, gateway.MAC, uint32(agent.HostGatewayOFPort)); err != nil {
+		return fmt.Errorf("failed to install flows for gateway %s: %v", gateway.Name, err)
+	}
+	if s.nodeConfig.PodGatewayMAC != nil {
+		if err := s.ofClient.InstallGatewayVirtualMACFlows(gwIP, gateway.MAC, s.nodeConfig.PodGatewayMAC, uint32(agent.HostGatewayOFPort)); err != nil {
+			return fmt.Errorf("failed to install flows for gateway MAC %s: %v", s.nodeConfig.PodGatewayMAC, err)
+		}
+	}
+	return nil
+}
+
+// checkPodFlows verifies that the flows installed for each of the provided Pods (identified by
+// "<namespace>/<name>" and mapped to their interface name) are present in OVS, and returns the Pods
+// for which at least one flow is missing or the flows could not be retrieved. The flows of all the
+// Pods are checked against a single dump of each flow table.
+func (s *CNIServer) checkPodFlows(pods map[string]string) []string {
+	var missingPods []string
+	ifaceNames := make([]string, 0, len(pods))
+	for _, ifaceName := range pods {
+		ifaceNames = append(ifaceNames, ifaceName)
+	}
+	sort.Strings(ifaceNames)
+	missingFlows, err := s.ofClient.GetMissingPodFlows(ifaceNames)
+	if err != nil {
+		klog.Errorf("Error when retrieving Pod flows from OVS: %v", err)
+	}
+	for podKey, ifaceName := range pods {
+		if err != nil {
+			missingPods = append(missingPods, podKey)
+		} else if flows := missingFlows[ifaceName]; len(flows) > 0 {
+			klog.Warningf("Flows missing in OVS for Pod %s: %v", podKey, flows)
+			missingPods = append(missingPods, podKey)
+		}
+	}
+	sort.Strings(missingPods)
+	return missingPods
 }
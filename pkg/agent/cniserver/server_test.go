@@ -18,15 +18,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"github.com/vmware-tanzu/antrea/pkg/agent"
 	"github.com/vmware-tanzu/antrea/pkg/agent/cniserver/ipam"
@@ -84,11 +95,33 @@ func TestLoadNetConfig(t *testing.T) {
 		"Network configuration (PodCIDR) was not updated",
 	)
 	assert.Equal(
-		netCfg.IPAM.Gateway, testNodeConfig.Gateway.IP.String(),
+		netCfg.IPAM.Gateway, testNodeConfig.Gateway.IPv4.String(),
 		"Network configuration (Gateway IP) was not updated",
 	)
 }
 
+func TestParseK8sArgs(t *testing.T) {
+	podUID := "c2d6a3b4-57e2-4b0e-9d5c-5d8e1e3f6a7b"
+	extraArgs := fmt.Sprintf("%s;K8S_POD_UID=%s;K8S_POD_EXTRA=foo", args, podUID)
+	parsedArgs, err := parseK8sArgs(extraArgs)
+	require.Nil(t, err, "Unexpected error when parsing extra CNI args")
+	assert.Equal(t, testPodName, string(parsedArgs.K8S_POD_NAME))
+	assert.Equal(t, testPodNamespace, string(parsedArgs.K8S_POD_NAMESPACE))
+	assert.Equal(t, testPodInfraContainerID, string(parsedArgs.K8S_POD_INFRA_CONTAINER_ID))
+	assert.Equal(t, podUID, string(parsedArgs.K8S_POD_UID))
+
+	// Unknown args are ignored even if the runtime does not set IgnoreUnknown.
+	parsedArgs, err = parseK8sArgs(fmt.Sprintf("K8S_POD_NAMESPACE=%s;K8S_POD_NAME=%s;K8S_POD_EXTRA=foo", testPodNamespace, testPodName))
+	require.Nil(t, err, "Unexpected error when parsing CNI args without IgnoreUnknown")
+	assert.Equal(t, testPodName, string(parsedArgs.K8S_POD_NAME))
+	assert.Empty(t, parsedArgs.K8S_POD_UID)
+
+	_, err = parseK8sArgs(fmt.Sprintf("IgnoreUnknown=0;K8S_POD_NAME=%s;K8S_POD_EXTRA=foo", testPodName))
+	assert.NotNil(t, err, "Expected error for unknown arg when IgnoreUnknown is disabled")
+	_, err = parseK8sArgs("K8S_POD_NAME")
+	assert.NotNil(t, err, "Expected error for invalid arg")
+}
+
 func TestRequestCheck(t *testing.T) {
 	cniService := generateCNIServer(t)
 	valid := cniService.isCNIVersionSupported(unsupportedCNIVersion)
@@ -101,6 +134,101 @@ func TestRequestCheck(t *testing.T) {
 	}
 }
 
+func TestSupportedCNIVersions(t *testing.T) {
+	defaultServer := New(testSocket, "", 1450, testNodeConfig, nil, nil, nil, fakeclientset.NewSimpleClientset(), Options{})
+	for _, version := range DefaultSupportedCNIVersions {
+		assert.True(t, defaultServer.isCNIVersionSupported(version), "Version %s should be supported by default", version)
+	}
+
+	cniServer := New(testSocket, "", 1450, testNodeConfig, nil, nil, nil, fakeclientset.NewSimpleClientset(), Options{SupportedVersions: []string{"0.4.0", "0.3.1"}})
+	assert.True(t, cniServer.isCNIVersionSupported("0.3.1"))
+	assert.True(t, cniServer.isCNIVersionSupported("0.4.0"))
+	assert.False(t, cniServer.isCNIVersionSupported("0.1.0"))
+	assert.False(t, cniServer.isCNIVersionSupported("0.2.0"))
+
+	networkCfg := generateNetworkConfiguration("testCfg", "0.2.0")
+	requestMsg, _ := newRequest(args, networkCfg, "", t)
+	response, err := cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_INCOMPATIBLE_CNI_VERSION, "supported versions [0.3.1,0.4.0]")
+}
+
+// TestCmdAddNoPodCIDR checks that ADD requests are rejected with TRY_AGAIN_LATER until the Node is
+// assigned a PodCIDR.
+func TestCmdAddNoPodCIDR(t *testing.T) {
+	cniServer := generateCNIServer(t)
+	cniServer.nodeConfig = &agent.NodeConfig{Name: testNodeConfig.Name}
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	requestMsg, _ := newRequest(args, networkCfg, "", t)
+
+	response, err := cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_TRY_AGAIN_LATER, "")
+}
+
+// TestCmdAddValidatePodExistence checks that ADD requests are rejected with UNKNOWN_CONTAINER when
+// Pod validation is enabled and the Pod does not exist or is scheduled on another Node.
+func TestCmdAddValidatePodExistence(t *testing.T) {
+	otherNodePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "other-node-pod", Namespace: testPodNamespace},
+		Spec:       corev1.PodSpec{NodeName: "other-node"},
+	}
+	cniServer := generateCNIServer(t)
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset(otherNodePod)
+	cniServer.validatePodExistence = true
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	// The request is rejected before IPAM is invoked, so the IPAM driver is never called.
+	networkCfg.IPAM.Type = ipam.IPAM_HOST_LOCAL
+
+	// The fake clientset does not include the test Pod.
+	requestMsg, containerID := newRequest(args, networkCfg, "", t)
+	response, err := cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_UNKNOWN_CONTAINER, containerID)
+
+	otherNodeArgs := cniservertest.GenerateCNIArgs(otherNodePod.Name, testPodNamespace, testPodInfraContainerID)
+	requestMsg, containerID = newRequest(otherNodeArgs, networkCfg, "", t)
+	response, err = cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_UNKNOWN_CONTAINER, containerID)
+}
+
+func TestValidatePod(t *testing.T) {
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: testPodNamespace},
+		Spec:       corev1.PodSpec{NodeName: testNodeConfig.Name},
+	}
+	cniServer := generateCNIServer(t)
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset(runningPod)
+	pod, err := cniServer.getPod(context.Background(), testPodName, testPodNamespace)
+	assert.Nil(t, cniServer.validatePod(testPodName, testPodNamespace, pod, err))
+	pod, err = cniServer.getPod(context.Background(), "deleted-pod", testPodNamespace)
+	assert.NotNil(t, cniServer.validatePod("deleted-pod", testPodNamespace, pod, err))
+	// Errors other than a missing Pod do not cause the validation to fail.
+	assert.Nil(t, cniServer.validatePod(testPodName, testPodNamespace, nil, fmt.Errorf("apiserver unavailable")))
+}
+
+// TestCmdAddPodRoutesAnnotationGetFailure checks that ADD requests fail with TRY_AGAIN_LATER when
+// the Pod routes annotation is enabled and the Pod cannot be retrieved.
+func TestCmdAddPodRoutesAnnotationGetFailure(t *testing.T) {
+	kubeClient := fakeclientset.NewSimpleClientset()
+	kubeClient.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("apiserver unavailable")
+	})
+	cniServer := generateCNIServer(t)
+	cniServer.kubeClient = kubeClient
+	cniServer.enablePodRoutesAnnotation = true
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	// The request is rejected before IPAM is invoked, so the IPAM driver is never called.
+	networkCfg.IPAM.Type = ipam.IPAM_HOST_LOCAL
+
+	requestMsg, _ := newRequest(args, networkCfg, "", t)
+	response, err := cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_TRY_AGAIN_LATER, "")
+	assert.Len(t, kubeClient.Actions(), 1, "Pod should be retrieved exactly once")
+}
+
 func checkErrorResponse(t *testing.T, resp *cnipb.CniCmdResponse, code cnipb.ErrorCode, message string) {
 	assert.NotNil(t, resp, "Response is nil")
 	assert.NotNil(t, resp.GetError(), "Error field is not set")
@@ -130,27 +258,122 @@ func TestIPAMService(t *testing.T) {
 	requestMsg, _ := newRequest(args, networkCfg, "", t)
 
 	t.Run("Error on ADD", func(t *testing.T) {
-		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("IPAM add error"))
+		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("IPAM add error"))
 		// A rollback will be tried if add failed.
-		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any()).Times(1)
+		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
 		response, err := cniServer.CmdAdd(cxt, &requestMsg)
 		require.Nil(t, err, "expected no rpc error")
 		checkErrorResponse(t, response, cnipb.ErrorCode_IPAM_FAILURE, "IPAM add error")
 	})
 
 	t.Run("Error on DEL", func(t *testing.T) {
-		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any()).Return(fmt.Errorf("IPAM delete error"))
+		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("IPAM delete error"))
 		response, err := cniServer.CmdDel(cxt, &requestMsg)
 		require.Nil(t, err, "expected no rpc error")
 		checkErrorResponse(t, response, cnipb.ErrorCode_IPAM_FAILURE, "IPAM delete error")
 	})
 
 	t.Run("Error on CHECK", func(t *testing.T) {
-		ipamMock.EXPECT().Check(gomock.Any(), gomock.Any()).Return(fmt.Errorf("IPAM check error"))
+		ipamMock.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("IPAM check error"))
 		response, err := cniServer.CmdCheck(cxt, &requestMsg)
 		require.Nil(t, err, "expected no rpc error")
 		checkErrorResponse(t, response, cnipb.ErrorCode_IPAM_FAILURE, "IPAM check error")
 	})
+
+	t.Run("Cancelled context on ADD", func(t *testing.T) {
+		requestMsg, _ := newRequest(args, networkCfg, "", t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ipamResult := ipamtest.GenerateIPAMResult(supportedCNIVersion, ips, routes, dns)
+		// The request is cancelled while the IPAM driver is allocating the IP address.
+		ipamMock.EXPECT().Add(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, args *invoke.Args, networkConfig []byte) (*current.Result, error) {
+				cancel()
+				return ipamResult, nil
+			})
+		// The allocated IP address must be released during the rollback, with a context which
+		// is not cancelled.
+		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, args *invoke.Args, networkConfig []byte) error {
+				assert.Nil(t, ctx.Err(), "Rollback should not use the cancelled request context")
+				return nil
+			}).Times(1)
+		// No OVS client is set for the server: configuring the interface must be aborted before
+		// any OVS operation.
+		response, err := cniServer.CmdAdd(ctx, &requestMsg)
+		require.Nil(t, err, "expected no rpc error")
+		checkErrorResponse(t, response, cnipb.ErrorCode_CONFIG_INTERFACE_FAILURE, "CNI request aborted: context canceled")
+	})
+
+	t.Run("Cached result on ADD retry", func(t *testing.T) {
+		requestMsg, _ := newRequest(args, networkCfg, "", t)
+		ipamResult := ipamtest.GenerateIPAMResult(supportedCNIVersion, ips, routes, dns)
+		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(ipamResult, nil).Times(1)
+		result1, err := ipam.ExecIPAMAdd(cxt, requestMsg.CniArgs, testIpamType)
+		require.Nil(t, err, "expected no IPAM error")
+		result2, err := ipam.ExecIPAMAdd(cxt, requestMsg.CniArgs, testIpamType)
+		require.Nil(t, err, "expected no IPAM error")
+		assert.Equal(t, result1, result2)
+
+		// The cached result must be invalidated after a successful DEL.
+		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		require.Nil(t, ipam.ExecIPAMDelete(cxt, requestMsg.CniArgs, testIpamType))
+		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(ipamResult, nil).Times(1)
+		_, err = ipam.ExecIPAMAdd(cxt, requestMsg.CniArgs, testIpamType)
+		require.Nil(t, err, "expected no IPAM error")
+
+		// The result is cached per interface of the container.
+		otherIfaceArgs := *requestMsg.CniArgs
+		otherIfaceArgs.Ifname = "eth1"
+		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(ipamResult, nil).Times(1)
+		_, err = ipam.ExecIPAMAdd(cxt, &otherIfaceArgs, testIpamType)
+		require.Nil(t, err, "expected no IPAM error")
+
+		// The cached result must also be invalidated when the IPAM driver fails to release the
+		// addresses, as the interface is removed anyway.
+		ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("IPAM delete error")).Times(1)
+		require.NotNil(t, ipam.ExecIPAMDelete(cxt, requestMsg.CniArgs, testIpamType))
+		ipamMock.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(ipamResult, nil).Times(1)
+		_, err = ipam.ExecIPAMAdd(cxt, requestMsg.CniArgs, testIpamType)
+		require.Nil(t, err, "expected no IPAM error")
+	})
+}
+
+func TestCmdCheckBeforeVersion040(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	// IPAM drivers cannot be unregistered, so a dedicated IPAM type is used to avoid conflicts
+	// with the mock driver registered by other tests.
+	ipamType := "test-check"
+	ipamMock := ipamtest.NewMockIPAMDriver(controller)
+	_ = ipam.RegisterIPAMDriver(ipamType, ipamMock)
+	ipamMock.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	cniServer := generateCNIServer(t)
+	cniServer.ifaceStore = agent.NewInterfaceStore()
+
+	networkCfg := generateNetworkConfiguration("testCfg", "0.3.1")
+	networkCfg.IPAM.Type = ipamType
+	requestMsg, containerID := newRequest(args, networkCfg, "", t)
+
+	// The interface is not known to the InterfaceStore.
+	response, err := cniServer.CmdCheck(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_CHECK_INTERFACE_FAILURE, "not found")
+
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerConfig := agent.NewContainerInterface(containerID, testPodName, testPodNamespace, netns, containerMAC, net.ParseIP("10.1.2.100"))
+	hostIfaceName := util.GenerateContainerInterfaceName(testPodName, testPodNamespace)
+	containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: hostIfaceName, PortUUID: uuid.New().String(), OFPort: 10}
+	cniServer.ifaceStore.AddInterface(hostIfaceName, containerConfig)
+	response, err = cniServer.CmdCheck(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	assert.Nil(t, response.GetError(), "CHECK should succeed when the interface and OVS port are known")
+
+	// The Pod's interface belongs to another container.
+	otherRequestMsg, _ := newRequest(args, networkCfg, "", t)
+	response, err = cniServer.CmdCheck(context.Background(), &otherRequestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_CHECK_INTERFACE_FAILURE, "does not belong to container")
 }
 
 func TestCheckRequestMessage(t *testing.T) {
@@ -168,8 +391,70 @@ func TestCheckRequestMessage(t *testing.T) {
 		networkCfg.IPAM.Type = "unknown"
 		requestMsg, _ := newRequest(args, networkCfg, "", t)
 		_, response := cniServer.checkRequestMessage(&requestMsg)
-		checkErrorResponse(t, response, cnipb.ErrorCode_UNSUPPORTED_FIELD, "")
+		// The response should list the registered IPAM types, including the default one.
+		supportedTypes := strings.Join(ipam.ListIPAMTypes(), ",")
+		require.Contains(t, supportedTypes, ipam.IPAM_HOST_LOCAL)
+		checkErrorResponse(t, response, cnipb.ErrorCode_UNSUPPORTED_FIELD, fmt.Sprintf("supported IPAM types [%s]", supportedTypes))
 	})
+
+	t.Run("Missing Pod name", func(t *testing.T) {
+		networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+		missingNameArgs := cniservertest.GenerateCNIArgs("", testPodNamespace, testPodInfraContainerID)
+		requestMsg, _ := newRequest(missingNameArgs, networkCfg, "", t)
+		cniConfig, response := cniServer.checkRequestMessage(&requestMsg)
+		require.Nil(t, response, "K8s args should not be required for all requests")
+		response = cniServer.checkK8sArgs(cniConfig)
+		checkErrorResponse(t, response, cnipb.ErrorCode_UNSUPPORTED_FIELD, "Required field K8S_POD_NAME is missing")
+	})
+
+	t.Run("Missing Pod Namespace", func(t *testing.T) {
+		networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+		missingNamespaceArgs := "IgnoreUnknown=1;K8S_POD_NAME=" + testPodName
+		requestMsg, _ := newRequest(missingNamespaceArgs, networkCfg, "", t)
+		cniConfig, response := cniServer.checkRequestMessage(&requestMsg)
+		require.Nil(t, response, "K8s args should not be required for all requests")
+		response = cniServer.checkK8sArgs(cniConfig)
+		checkErrorResponse(t, response, cnipb.ErrorCode_UNSUPPORTED_FIELD, "Required field K8S_POD_NAMESPACE is missing")
+	})
+}
+
+// TestCmdDelWithoutK8sArgs checks that a DEL request without K8s args releases the IP address and
+// removes the OVS port of the container, which is looked up by container ID.
+func TestCmdDelWithoutK8sArgs(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	// A dedicated IPAM type is used as drivers cannot be registered twice for the same type.
+	ipamType := "test-del"
+	ipamMock := ipamtest.NewMockIPAMDriver(controller)
+	_ = ipam.RegisterIPAMDriver(ipamType, ipamMock)
+	ovsMock := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	ofMock := openflowtest.NewMockClient(controller)
+
+	cniServer := generateCNIServer(t)
+	cniServer.ifaceStore = agent.NewInterfaceStore()
+	cniServer.ovsBridgeClient = ovsMock
+	cniServer.ofClient = ofMock
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	networkCfg.IPAM.Type = ipamType
+	requestMsg, containerID := newRequest("IgnoreUnknown=1", networkCfg, "", t)
+	// No netns is provided, so that only the OVS port is removed.
+	requestMsg.CniArgs.Netns = ""
+
+	hostIfaceName := util.GenerateContainerInterfaceName(testPodName, testPodNamespace)
+	containerMAC, _ := net.ParseMAC("11:22:33:44:55:66")
+	containerConfig := agent.NewContainerInterface(containerID, testPodName, testPodNamespace, "", containerMAC, net.ParseIP("10.1.2.100"))
+	portUUID := uuid.New().String()
+	containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: hostIfaceName, PortUUID: portUUID, OFPort: 10}
+	cniServer.ifaceStore.AddInterface(hostIfaceName, containerConfig)
+
+	ipamMock.EXPECT().Del(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	ofMock.EXPECT().UninstallPodFlows(hostIfaceName, uint32(10)).Return(nil)
+	ovsMock.EXPECT().DeletePort(portUUID).Return(nil)
+	response, err := cniServer.CmdDel(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	assert.Nil(t, response.GetError(), "DEL should succeed without K8s args")
+	_, found := cniServer.ifaceStore.GetInterface(hostIfaceName)
+	assert.False(t, found, "Interface should have been removed from the store")
 }
 
 func TestValidatePrevResult(t *testing.T) {
@@ -275,13 +560,13 @@ func TestUpdateResultIfaceConfig(t *testing.T) {
 	// return a Result with 2 v4 addresses.
 	testIps := []string{"10.1.2.100/24, ,4", "192.168.1.100/24, 192.168.2.253, 4"}
 
-	require.Equal(gwIP, testNodeConfig.Gateway.IP)
+	require.Equal(gwIP, testNodeConfig.Gateway.IPv4)
 
 	t.Run("Gateways updated", func(t *testing.T) {
 		assert := assert.New(t)
 
 		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, testIps, routes, dns)
-		updateResultIfaceConfig(result, gwIP)
+		updateResultIfaceConfig(result, gwIP, nil)
 
 		assert.Len(result.IPs, 2, "Failed to construct result")
 		for _, ipc := range result.IPs {
@@ -299,7 +584,7 @@ func TestUpdateResultIfaceConfig(t *testing.T) {
 	t.Run("Default route added", func(t *testing.T) {
 		emptyRoutes := []string{}
 		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, testIps, emptyRoutes, dns)
-		updateResultIfaceConfig(result, gwIP)
+		updateResultIfaceConfig(result, gwIP, nil)
 		require.NotEmpty(t, result.Routes)
 		defaultRoute := func() *types.Route {
 			for _, route := range result.Routes {
@@ -311,6 +596,279 @@ func TestUpdateResultIfaceConfig(t *testing.T) {
 		}()
 		assert.NotNil(t, defaultRoute.GW)
 	})
+
+	gwIPv6 := net.ParseIP("fd00:10:1:2::1")
+	findDefaultRoute := func(result *current.Result, dst string) *types.Route {
+		for _, route := range result.Routes {
+			if route.Dst.String() == dst {
+				return route
+			}
+		}
+		return nil
+	}
+
+	t.Run("Default route for IPv4-only Node", func(t *testing.T) {
+		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, []string{"10.1.2.100/24, ,4"}, []string{}, dns)
+		updateResultIfaceConfig(result, gwIP, nil)
+		assert.Len(t, result.Routes, 1)
+		assert.Equal(t, gwIP, findDefaultRoute(result, "0.0.0.0/0").GW)
+	})
+
+	t.Run("Default route for IPv6-only Node", func(t *testing.T) {
+		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, []string{"fd00:10:1:2::100/64, ,6"}, []string{}, dns)
+		updateResultIfaceConfig(result, nil, gwIPv6)
+		assert.Len(t, result.Routes, 1)
+		assert.Equal(t, gwIPv6, findDefaultRoute(result, "::/0").GW)
+		assert.Equal(t, "fd00:10:1:2::1", result.IPs[0].Gateway.String())
+	})
+
+	t.Run("Default routes for dual-stack Node", func(t *testing.T) {
+		dualStackIPs := []string{"10.1.2.100/24, ,4", "fd00:10:1:2::100/64, ,6"}
+		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, dualStackIPs, []string{}, dns)
+		updateResultIfaceConfig(result, gwIP, gwIPv6)
+		assert.Len(t, result.Routes, 2)
+		assert.Equal(t, gwIP, findDefaultRoute(result, "0.0.0.0/0").GW)
+		assert.Equal(t, gwIPv6, findDefaultRoute(result, "::/0").GW)
+	})
+
+	t.Run("Node gateway for single-host addresses", func(t *testing.T) {
+		singleHostIPs := []string{"10.1.2.100/32, ,4", "fd00:10:1:2::100/128, ,6"}
+		result := ipamtest.GenerateIPAMResult(supportedCNIVersion, singleHostIPs, []string{}, dns)
+		updateResultIfaceConfig(result, gwIP, gwIPv6)
+		require.Len(result.IPs, 2)
+		assert.Equal(t, gwIP, result.IPs[0].Gateway)
+		assert.Equal(t, gwIPv6, result.IPs[1].Gateway)
+		assert.Equal(t, gwIP, findDefaultRoute(result, "0.0.0.0/0").GW)
+	})
+}
+
+// TestBuildFallbackCNIResult checks the CNI result used to repair the interface of a container for
+// which no result was saved: the mask of the PodCIDR must only be used for an IP address of the same
+// IP family.
+func TestBuildFallbackCNIResult(t *testing.T) {
+	cniServer := generateCNIServer(t)
+	nodeConfig := *testNodeConfig
+	nodeConfig.Gateway = &agent.Gateway{IPv4: gwIP, IPv6: net.ParseIP("fd00::1")}
+	cniServer.nodeConfig = &nodeConfig
+
+	for _, tc := range []struct {
+		name            string
+		ip              string
+		expectedAddress string
+		expectedGateway string
+		expectedRoute   string
+	}{
+		{
+			name:            "IPv4 address in PodCIDR",
+			ip:              "192.168.1.100",
+			expectedAddress: "192.168.1.100/24",
+			expectedGateway: "192.168.1.1",
+			expectedRoute:   "0.0.0.0/0",
+		},
+		{
+			name:            "IPv6 address",
+			ip:              "fd00::100",
+			expectedAddress: "fd00::100/128",
+			expectedGateway: "fd00::1",
+			expectedRoute:   "::/0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			containerConfig := &agent.InterfaceConfig{ID: testPodInfraContainerID, IP: net.ParseIP(tc.ip)}
+			result, err := cniServer.buildFallbackCNIResult(containerConfig, supportedCNIVersion)
+			require.Nil(t, err)
+			require.Len(t, result.IPs, 1)
+			assert.Equal(t, tc.expectedAddress, result.IPs[0].Address.String())
+			assert.Equal(t, tc.expectedGateway, result.IPs[0].Gateway.String())
+			require.Len(t, result.Routes, 1)
+			assert.Equal(t, tc.expectedRoute, result.Routes[0].Dst.String())
+		})
+	}
+}
+
+func TestParsePodRoutes(t *testing.T) {
+	ipConfigs := ipamtest.GenerateIPAMResult(supportedCNIVersion, []string{"192.168.1.100/24, 192.168.1.1, 4"}, []string{}, dns).IPs
+	for _, tc := range []struct {
+		name           string
+		annotation     string
+		expectedRoutes []string
+		expectedErr    string
+	}{
+		{
+			name:           "gateway in Pod subnet",
+			annotation:     `[{"dst": "10.10.0.0/16", "gw": "192.168.1.254"}]`,
+			expectedRoutes: []string{"10.10.0.0/16 via 192.168.1.254"},
+		},
+		{
+			name:           "Node gateway by default",
+			annotation:     `[{"dst": "10.10.1.5/16"}, {"dst": "172.16.0.0/12", "gw": "192.168.1.1"}]`,
+			expectedRoutes: []string{"10.10.0.0/16 via 192.168.1.1", "172.16.0.0/12 via 192.168.1.1"},
+		},
+		{
+			name:        "unreachable gateway",
+			annotation:  `[{"dst": "10.10.0.0/16", "gw": "192.168.2.1"}]`,
+			expectedErr: "not reachable",
+		},
+		{
+			name:        "IP family mismatch",
+			annotation:  `[{"dst": "fd00:10::/64", "gw": "192.168.1.1"}]`,
+			expectedErr: "different IP families",
+		},
+		{
+			name:        "no Node gateway for family",
+			annotation:  `[{"dst": "fd00:10::/64"}]`,
+			expectedErr: "no Node gateway",
+		},
+		{
+			name:        "invalid JSON",
+			annotation:  `{"dst": "10.10.0.0/16"}`,
+			expectedErr: PodRoutesAnnotationKey,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			routes, err := parsePodRoutes(tc.annotation, ipConfigs, testNodeConfig.Gateway)
+			if tc.expectedErr != "" {
+				require.NotNil(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.Nil(t, err)
+			var routeStrs []string
+			for _, route := range routes {
+				routeStrs = append(routeStrs, fmt.Sprintf("%s via %s", route.Dst.String(), route.GW))
+			}
+			assert.Equal(t, tc.expectedRoutes, routeStrs)
+		})
+	}
+}
+
+func TestValidateQdisc(t *testing.T) {
+	assert.Nil(t, validateQdisc(""))
+	assert.Nil(t, validateQdisc("fq_codel"))
+	assert.Nil(t, validateQdisc("fq"))
+	assert.NotNil(t, validateQdisc("htb"))
+}
+
+func TestValidateTxQueueLen(t *testing.T) {
+	assert.Nil(t, validateTxQueueLen(0))
+	assert.Nil(t, validateTxQueueLen(1))
+	assert.Nil(t, validateTxQueueLen(maxTxQueueLen))
+	assert.NotNil(t, validateTxQueueLen(-1))
+	assert.NotNil(t, validateTxQueueLen(maxTxQueueLen+1))
+}
+
+func TestNormalizeDNS(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		dns         types.DNS
+		expectedDNS types.DNS
+		expectedErr string
+	}{
+		{
+			name:        "empty",
+			dns:         types.DNS{},
+			expectedDNS: types.DNS{},
+		},
+		{
+			name: "valid",
+			dns: types.DNS{
+				Nameservers: []string{"10.96.0.10", "fd00:10:96::000a", "10.96.0.10", "fd00:10:96::a"},
+				Domain:      "cluster.local",
+				Search:      []string{"test.svc.cluster.local", "svc.cluster.local", "test.svc.cluster.local"},
+				Options:     []string{"ndots:5"},
+			},
+			expectedDNS: types.DNS{
+				Nameservers: []string{"10.96.0.10", "fd00:10:96::a"},
+				Domain:      "cluster.local",
+				Search:      []string{"test.svc.cluster.local", "svc.cluster.local"},
+				Options:     []string{"ndots:5"},
+			},
+		},
+		{
+			name:        "too many search domains",
+			dns:         types.DNS{Search: []string{"a", "b", "c", "d", "e", "f", "g"}},
+			expectedDNS: types.DNS{Search: []string{"a", "b", "c", "d", "e", "f"}},
+		},
+		{
+			name:        "invalid nameserver",
+			dns:         types.DNS{Nameservers: []string{"10.96.0.10", "kube-dns"}},
+			expectedErr: "invalid DNS nameserver",
+		},
+		{
+			name:        "empty search domain",
+			dns:         types.DNS{Search: []string{""}},
+			expectedErr: "invalid DNS search domain",
+		},
+		{
+			name:        "invalid domain",
+			dns:         types.DNS{Domain: "cluster local"},
+			expectedErr: "invalid DNS domain",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dns, err := normalizeDNS(tc.dns)
+			if tc.expectedErr != "" {
+				require.NotNil(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, tc.expectedDNS, dns)
+			}
+		})
+	}
+}
+
+// TestCmdAddInvalidDNS checks that ADD requests with a malformed DNS configuration are rejected with
+// INVALID_NETWORK_CONFIG before any resource is allocated.
+func TestCmdAddInvalidDNS(t *testing.T) {
+	cniServer := generateCNIServer(t)
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	networkCfg.DNS = types.DNS{Nameservers: []string{"not-an-ip"}}
+	requestMsg, _ := newRequest(args, networkCfg, "", t)
+
+	response, err := cniServer.CmdAdd(context.Background(), &requestMsg)
+	require.Nil(t, err, "expected no rpc error")
+	checkErrorResponse(t, response, cnipb.ErrorCode_INVALID_NETWORK_CONFIG, "")
+}
+
+func TestParseContainerIP(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		ips        []string
+		expectedIP string
+	}{
+		{"IPv4-only", []string{"10.1.2.100/24,10.1.2.1,4"}, "10.1.2.100"},
+		{"IPv6-only", []string{"fd00:10:1:2::100/64,fd00:10:1:2::1,6"}, "fd00:10:1:2::100"},
+		{"Dual-stack", []string{"fd00:10:1:2::100/64,fd00:10:1:2::1,6", "10.1.2.100/24,10.1.2.1,4"}, "10.1.2.100"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ipamtest.GenerateIPAMResult(supportedCNIVersion, tc.ips, []string{}, dns)
+			containerIP, err := parseContainerIP(result.IPs)
+			require.Nil(t, err)
+			assert.Equal(t, tc.expectedIP, containerIP.String())
+		})
+	}
+}
+
+func TestHashedContainerIfaceName(t *testing.T) {
+	cniServer := generateCNIServer(t)
+	cniServer.hashedContainerIfaceNames = true
+	containerID := generateUUID(t)
+
+	name1 := cniServer.containerIfaceName(testPodName, "ns1", containerID)
+	name2 := cniServer.containerIfaceName(testPodName, "ns2", containerID)
+	assert.NotEqual(t, name1, name2, "Pods with the same name in different Namespaces should have different interface names")
+	for _, name := range []string{name1, name2} {
+		assert.Len(t, name, 15)
+		assert.True(t, strings.HasPrefix(name, util.DefaultHashedContainerInterfacePrefix+"-"), "Unexpected interface name %s", name)
+		assert.False(t, strings.ContainsAny(name, "/ \t\n"), "Invalid interface name %s", name)
+	}
+	assert.Equal(t, name1, cniServer.containerIfaceName(testPodName, "ns1", containerID), "Interface name should be deterministic")
+
+	cniServer.containerIfacePrefix = "ant"
+	name := cniServer.containerIfaceName(testPodName, "ns1", containerID)
+	assert.Len(t, name, 15)
+	assert.True(t, strings.HasPrefix(name, "ant-"), "Container interface prefix should replace the default prefix: %s", name)
 }
 
 func TestValidateOVSPort(t *testing.T) {
@@ -370,7 +928,7 @@ func TestRemoveInterface(t *testing.T) {
 		setup("test1")
 		ifaceStore.AddInterface(hostIfaceName, containerConfig)
 
-		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName).Return(nil)
+		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName, uint32(0)).Return(nil)
 		mockOVSBridgeClient.EXPECT().DeletePort(fakePortUUID).Return(nil)
 
 		err := removeInterfaces(mockOVSBridgeClient, mockOFClient, ifaceStore, podName, testPodNamespace, containerID, cniConfig.Netns, cniConfig.Ifname)
@@ -384,7 +942,7 @@ func TestRemoveInterface(t *testing.T) {
 		ifaceStore.AddInterface(hostIfaceName, containerConfig)
 
 		mockOVSBridgeClient.EXPECT().DeletePort(fakePortUUID).Return(ovsconfig.NewTransactionError(fmt.Errorf("error while deleting OVS port"), true))
-		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName).Return(nil)
+		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName, uint32(0)).Return(nil)
 
 		err := removeInterfaces(mockOVSBridgeClient, mockOFClient, ifaceStore, podName, testPodNamespace, containerID, "", cniConfig.Ifname)
 		require.NotNil(t, err, "Expected interface remove to fail")
@@ -396,13 +954,32 @@ func TestRemoveInterface(t *testing.T) {
 		setup("test3")
 		ifaceStore.AddInterface(hostIfaceName, containerConfig)
 
-		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName).Return(fmt.Errorf("failed to delete openflow entry"))
+		mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName, uint32(0)).Return(fmt.Errorf("failed to delete openflow entry"))
 
 		err := removeInterfaces(mockOVSBridgeClient, mockOFClient, ifaceStore, podName, testPodNamespace, containerID, "", cniConfig.Ifname)
 		require.NotNil(t, err, "Expected interface remove to fail")
 		_, found := ifaceStore.GetContainerInterface(podName, testPodNamespace)
 		assert.True(t, found, "Interface should still be in local cache because of flow deletion failure")
 	})
+
+	t.Run("Remove interface of previous sandbox", func(t *testing.T) {
+		setup("test4")
+		ifaceStore.AddInterface(hostIfaceName, containerConfig)
+		oldContainerID, oldIfaceName, oldPortUUID := containerID, hostIfaceName, fakePortUUID
+		// The new sandbox of the Pod is added before the previous one is deleted.
+		newContainerConfig := agent.NewContainerInterface(uuid.New().String(), podName, testPodNamespace, "", containerMAC, containerIP)
+		newContainerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: "new-iface", PortUUID: uuid.New().String()}
+		ifaceStore.AddInterface("new-iface", newContainerConfig)
+
+		mockOFClient.EXPECT().UninstallPodFlows(oldIfaceName, uint32(0)).Return(nil)
+		mockOVSBridgeClient.EXPECT().DeletePort(oldPortUUID).Return(nil)
+
+		err := removeInterfaces(mockOVSBridgeClient, mockOFClient, ifaceStore, podName, testPodNamespace, oldContainerID, "", cniConfig.Ifname)
+		require.Nil(t, err, "Failed to remove interface")
+		iface, found := ifaceStore.GetContainerInterface(podName, testPodNamespace)
+		require.True(t, found, "Interface of the new sandbox should still be in local cache")
+		assert.Equal(t, newContainerConfig, iface)
+	})
 }
 
 func translateRawPrevResult(prevResult *current.Result, cniVersion string) (map[string]interface{}, error) {
@@ -423,13 +1000,252 @@ func translateRawPrevResult(prevResult *current.Result, cniVersion string) (map[
 	return conf.RawPrevResult, nil
 }
 
+func TestReconcileStaleInterface(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	// A dedicated IPAM type is used as drivers cannot be registered twice for the same type.
+	reconcileIPAMType := "test-reconcile"
+	ipamMock := ipamtest.NewMockIPAMDriver(controller)
+	_ = ipam.RegisterIPAMDriver(reconcileIPAMType, ipamMock)
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	mockOFClient := openflowtest.NewMockClient(controller)
+	ifaceStore := agent.NewInterfaceStore()
+
+	cniServer := generateCNIServer(t)
+	cniServer.ovsBridgeClient = mockOVSBridgeClient
+	cniServer.ofClient = mockOFClient
+	cniServer.ifaceStore = ifaceStore
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset()
+
+	// The Pod for this interface does not exist any more, and the DEL request was never received.
+	containerID := generateUUID(t)
+	hostIfaceName := util.GenerateContainerInterfaceName(testPodName, testPodNamespace)
+	portUUID := generateUUID(t)
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerConfig := agent.NewContainerInterface(containerID, testPodName, testPodNamespace, "", containerMAC, net.ParseIP("10.1.2.100"))
+	networkCfg := generateNetworkConfiguration("testCfg", supportedCNIVersion)
+	networkCfg.IPAM.Type = reconcileIPAMType
+	networkConfig, _ := json.Marshal(networkCfg)
+	containerConfig.IPAMArgs = &agent.IPAMArgs{IfName: ifname, Path: "/opt/cni/bin", NetworkConfig: networkConfig}
+	containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: hostIfaceName, PortUUID: portUUID}
+	ifaceStore.AddInterface(hostIfaceName, containerConfig)
+	events, unsubscribe := ifaceStore.Subscribe()
+	defer unsubscribe()
+
+	expectedArgs := &invoke.Args{ContainerID: containerID, IfName: ifname, Path: "/opt/cni/bin"}
+	ipamMock.EXPECT().Del(gomock.Any(), expectedArgs, []byte(networkConfig)).Return(nil)
+	mockOFClient.EXPECT().UninstallPodFlows(hostIfaceName, uint32(0)).Return(nil)
+	mockOVSBridgeClient.EXPECT().DeletePort(portUUID).Return(nil)
+	expectGatewayPort(mockOVSBridgeClient)
+
+	require.Nil(t, cniServer.reconcile())
+	_, found := ifaceStore.GetInterface(hostIfaceName)
+	assert.False(t, found, "Stale interface should have been removed from the store")
+	select {
+	case event := <-events:
+		assert.Equal(t, agent.InterfaceEvent{Type: agent.InterfaceDeleted, IfaceID: hostIfaceName, Interface: containerConfig}, event)
+	case <-time.After(time.Second):
+		t.Errorf("No event received for the deletion of the stale interface")
+	}
+}
+
+func TestReconcileContainerInterfacePrefix(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	mockOFClient := openflowtest.NewMockClient(controller)
+	ifaceStore := agent.NewInterfaceStore()
+
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: testPodNamespace},
+		Spec:       corev1.PodSpec{NodeName: testNodeConfig.Name},
+	}
+	cniServer := generateCNIServer(t)
+	cniServer.ovsBridgeClient = mockOVSBridgeClient
+	cniServer.ofClient = mockOFClient
+	cniServer.ifaceStore = ifaceStore
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset(runningPod)
+	cniServer.containerIfacePrefix = "ant"
+
+	addInterface := func(ifaceName, podName string) *agent.InterfaceConfig {
+		containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+		containerConfig := agent.NewContainerInterface(generateUUID(t), podName, testPodNamespace, "", containerMAC, net.ParseIP("10.1.2.100"))
+		containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: ifaceName, PortUUID: generateUUID(t), OFPort: 3}
+		ifaceStore.AddInterface(ifaceName, containerConfig)
+		return containerConfig
+	}
+	// The name used when creating the interface must match the name used during reconciliation.
+	runningIfaceName := cniServer.containerIfaceName(testPodName, testPodNamespace, testPodInfraContainerID)
+	require.Equal(t, util.GenerateContainerInterfaceNameWithPrefix("ant", testPodName, testPodNamespace), runningIfaceName)
+	addInterface(runningIfaceName, testPodName)
+	// This stale interface was created by this CNI server and should be deleted.
+	staleIfaceName := cniServer.containerIfaceName("stale", testPodNamespace, testPodInfraContainerID)
+	staleConfig := addInterface(staleIfaceName, "stale")
+	// This interface does not have the expected prefix and should be ignored.
+	foreignIfaceName := util.GenerateContainerInterfaceName("foreign", testPodNamespace)
+	addInterface(foreignIfaceName, "foreign")
+
+	mockOFClient.EXPECT().InstallPodFlows(runningIfaceName, gomock.Any(), gomock.Any(), gomock.Any(), uint32(3)).Return(nil)
+	mockOFClient.EXPECT().UninstallPodFlows(staleIfaceName, uint32(3)).Return(nil)
+	mockOVSBridgeClient.EXPECT().DeletePort(staleConfig.PortUUID).Return(nil)
+	expectGatewayPort(mockOVSBridgeClient)
+
+	require.Nil(t, cniServer.reconcile())
+	_, found := ifaceStore.GetInterface(runningIfaceName)
+	assert.True(t, found, "Interface for running Pod should still be in the store")
+	_, found = ifaceStore.GetInterface(staleIfaceName)
+	assert.False(t, found, "Stale interface should have been removed from the store")
+	_, found = ifaceStore.GetInterface(foreignIfaceName)
+	assert.True(t, found, "Interface without the expected prefix should have been ignored")
+}
+
+func TestReconcilePodGatewayMAC(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	mockOFClient := openflowtest.NewMockClient(controller)
+	ifaceStore := agent.NewInterfaceStore()
+
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: testPodNamespace},
+		Spec:       corev1.PodSpec{NodeName: testNodeConfig.Name},
+	}
+	podGatewayMAC, _ := net.ParseMAC("02:00:00:00:00:01")
+	nodeConfig := *testNodeConfig
+	nodeConfig.PodGatewayMAC = podGatewayMAC
+	cniServer := generateCNIServer(t)
+	cniServer.nodeConfig = &nodeConfig
+	cniServer.ovsBridgeClient = mockOVSBridgeClient
+	cniServer.ofClient = mockOFClient
+	cniServer.ifaceStore = ifaceStore
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset(runningPod)
+
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerIP := net.ParseIP("10.1.2.100")
+	ifaceName := cniServer.containerIfaceName(testPodName, testPodNamespace, testPodInfraContainerID)
+	containerConfig := agent.NewContainerInterface(generateUUID(t), testPodName, testPodNamespace, "", containerMAC, containerIP)
+	containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: ifaceName, PortUUID: generateUUID(t), OFPort: 3}
+	ifaceStore.AddInterface(ifaceName, containerConfig)
+
+	// The Pod flows must be installed with the configured gateway MAC address, and not with the
+	// MAC address of the gateway interface.
+	mockOFClient.EXPECT().InstallPodFlows(ifaceName, containerIP, containerMAC, podGatewayMAC, uint32(3)).Return(nil)
+	expectGatewayPort(mockOVSBridgeClient)
+	require.Nil(t, cniServer.reconcile())
+}
+
+func TestReconcilePaused(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	mockOFClient := openflowtest.NewMockClient(controller)
+	ifaceStore := agent.NewInterfaceStore()
+
+	runningPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: testPodNamespace},
+		Spec:       corev1.PodSpec{NodeName: testNodeConfig.Name},
+	}
+	cniServer := generateCNIServer(t)
+	cniServer.ovsBridgeClient = mockOVSBridgeClient
+	cniServer.ofClient = mockOFClient
+	cniServer.ifaceStore = ifaceStore
+	cniServer.kubeClient = fakeclientset.NewSimpleClientset(runningPod)
+
+	addInterface := func(ifaceName, podName string) *agent.InterfaceConfig {
+		containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+		containerConfig := agent.NewContainerInterface(generateUUID(t), podName, testPodNamespace, "", containerMAC, net.ParseIP("10.1.2.100"))
+		containerConfig.OVSPortConfig = &agent.OVSPortConfig{IfaceName: ifaceName, PortUUID: generateUUID(t), OFPort: 3}
+		ifaceStore.AddInterface(ifaceName, containerConfig)
+		return containerConfig
+	}
+	runningIfaceName := cniServer.containerIfaceName(testPodName, testPodNamespace, testPodInfraContainerID)
+	addInterface(runningIfaceName, testPodName)
+	orphanIfaceName := cniServer.containerIfaceName("orphan", testPodNamespace, testPodInfraContainerID)
+	orphanConfig := addInterface(orphanIfaceName, "orphan")
+
+	// While reconciliation is paused, flows are installed for the running Pod, but the orphaned
+	// interface is not removed: the mocks would fail the test on any unexpected call.
+	cniServer.PauseReconcile()
+	mockOFClient.EXPECT().InstallPodFlows(runningIfaceName, gomock.Any(), gomock.Any(), gomock.Any(), uint32(3)).Return(nil)
+	expectGatewayPort(mockOVSBridgeClient)
+	require.Nil(t, cniServer.reconcile())
+	_, found := ifaceStore.GetInterface(orphanIfaceName)
+	assert.True(t, found, "Orphaned interface should not have been removed while reconciliation is paused")
+
+	cniServer.ResumeReconcile()
+	mockOFClient.EXPECT().InstallPodFlows(runningIfaceName, gomock.Any(), gomock.Any(), gomock.Any(), uint32(3)).Return(nil)
+	mockOFClient.EXPECT().UninstallPodFlows(orphanIfaceName, uint32(3)).Return(nil)
+	mockOVSBridgeClient.EXPECT().DeletePort(orphanConfig.PortUUID).Return(nil)
+	expectGatewayPort(mockOVSBridgeClient)
+	require.Nil(t, cniServer.reconcile())
+	_, found = ifaceStore.GetInterface(orphanIfaceName)
+	assert.False(t, found, "Orphaned interface should have been removed after resuming reconciliation")
+}
+
+// expectGatewayPort sets up the mock to report that the gateway port exists on the bridge, so that
+// reconciliation does not try to re-create it.
+func expectGatewayPort(mockOVSBridgeClient *ovsconfigtest.MockOVSBridgeClient) {
+	gatewayPort := ovsconfig.OVSPortData{Name: testNodeConfig.Gateway.Name, OFPort: agent.HostGatewayOFPort}
+	mockOVSBridgeClient.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{gatewayPort}, nil)
+}
+
+func TestCheckPodFlows(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	mockOFClient := openflowtest.NewMockClient(controller)
+	cniServer := generateCNIServer(t)
+	cniServer.ofClient = mockOFClient
+
+	pods := map[string]string{
+		"ns1/pod1": "pod1-a1b2c3",
+		"ns1/pod2": "pod2-d4e5f6",
+		"ns2/pod3": "pod3-a7b8c9",
+	}
+	ifaceNames := []string{"pod1-a1b2c3", "pod2-d4e5f6", "pod3-a7b8c9"}
+	// The flows of all the Pods must be retrieved with a single call.
+	mockOFClient.EXPECT().GetMissingPodFlows(ifaceNames).Return(map[string][]string{
+		"pod2-d4e5f6": {"table=0,priority=190,in_port=3,actions=resubmit(,10)"},
+	}, nil)
+	missingPods := cniServer.checkPodFlows(pods)
+	assert.Equal(t, []string{"ns1/pod2"}, missingPods)
+
+	// All the Pods are reported if the flows cannot be retrieved.
+	mockOFClient.EXPECT().GetMissingPodFlows(ifaceNames).Return(nil, fmt.Errorf("failed to dump flows"))
+	missingPods = cniServer.checkPodFlows(pods)
+	assert.Equal(t, []string{"ns1/pod1", "ns1/pod2", "ns2/pod3"}, missingPods)
+}
+
+func TestListenSocketMode(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "test-cniserver")
+	require.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	for _, mode := range []os.FileMode{DefaultCNISocketMode, 0660} {
+		t.Run(mode.String(), func(t *testing.T) {
+			cniServer := generateCNIServer(t)
+			cniServer.cniSocket = filepath.Join(tempDir, "cni.sock")
+			cniServer.cniSocketMode = mode
+			listener, err := cniServer.listen()
+			require.Nil(t, err, "Failed to create CNI socket")
+			defer listener.Close()
+
+			info, err := os.Stat(cniServer.cniSocket)
+			require.Nil(t, err)
+			assert.Equal(t, os.ModeSocket, info.Mode()&os.ModeType)
+			assert.Equal(t, mode, info.Mode().Perm())
+		})
+	}
+}
+
 func generateCNIServer(t *testing.T) *CNIServer {
-	supportedVersions := "0.3.0,0.3.1,0.4.0"
+	supportedVersions := []string{"0.3.0", "0.3.1", "0.4.0"}
 	cniServer := &CNIServer{
 		cniSocket:       testSocket,
 		nodeConfig:      testNodeConfig,
 		serverVersion:   cni.AntreaCNIVersion,
 		containerAccess: newContainerAccessArbitrator(),
+		kubeClient:      fakeclientset.NewSimpleClientset(),
+		ifaceStore:      agent.NewInterfaceStore(),
 	}
 	cniServer.supportedCNIVersions = buildVersionSet(supportedVersions)
 	return cniServer
@@ -477,6 +1293,6 @@ func init() {
 	gwIP = net.ParseIP("192.168.1.1")
 	_, nodePodCIDR, _ := net.ParseCIDR("192.168.1.0/24")
 	gwMAC, _ := net.ParseMAC("00:00:00:00:00:01")
-	gateway := &agent.Gateway{Name: "gw", IP: gwIP, MAC: gwMAC}
-	testNodeConfig = &agent.NodeConfig{testBr, nodeName, nodePodCIDR, gateway}
+	gateway := &agent.Gateway{Name: "gw", IPv4: gwIP, MAC: gwMAC}
+	testNodeConfig = &agent.NodeConfig{Bridge: testBr, Name: nodeName, PodCIDR: nodePodCIDR, Gateway: gateway}
 }
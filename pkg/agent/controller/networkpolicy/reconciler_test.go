@@ -81,7 +81,7 @@ func TestReconcilerReconcile(t *testing.T) {
 	appliedToGroup2 := newPodSet(v1beta1.PodReference{"pod2", "ns1"})
 	ifaceStore := agent.NewInterfaceStore()
 	ifaceStore.AddInterface(util.GenerateContainerInterfaceName("pod1", "ns1"),
-		&agent.InterfaceConfig{IP: net.ParseIP("2.2.2.2"), OVSPortConfig: &agent.OVSPortConfig{OFPort: 1}})
+		&agent.InterfaceConfig{IP: net.ParseIP("2.2.2.2"), PodName: "pod1", PodNamespace: "ns1", OVSPortConfig: &agent.OVSPortConfig{OFPort: 1}})
 	protocolTCP := v1beta1.ProtocolTCP
 	port80 := int32(80)
 	service1 := v1beta1.Service{Protocol: &protocolTCP, Port: &port80}
@@ -24,6 +24,7 @@ import (
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	coreinformers "k8s.io/client-go/informers/core/v1"
@@ -64,6 +65,10 @@ type Controller struct {
 	// key must not be nil.
 	// TODO: handle agent restart cases.
 	installedNodes *sync.Map
+	// staleNodes records the names of the Nodes whose flows were found to be stale by
+	// reconcileNodeFlows. The routes and flows of these Nodes are deleted the next time they are
+	// synced, before being installed again if the Node still exists.
+	staleNodes *sync.Map
 }
 
 func NewNodeRouteController(
@@ -85,6 +90,7 @@ func NewNodeRouteController(
 		nodeConfig:       config,
 		gatewayLink:      link,
 		installedNodes:   &sync.Map{},
+		staleNodes:       &sync.Map{},
 	}
 	nodeInformer.Informer().AddEventHandlerWithResyncPeriod(
 		cache.ResourceEventHandlerFuncs{
@@ -142,9 +148,47 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 	for i := 0; i < defaultWorkers; i++ {
 		go wait.Until(c.worker, time.Second, stopCh)
 	}
+	go wait.Until(func() {
+		if err := c.reconcileNodeFlows(); err != nil {
+			klog.Errorf("Error when reconciling flows to remote Nodes: %v", err)
+		}
+	}, nodeSyncPeriod, stopCh)
 	<-stopCh
 }
 
+// reconcileNodeFlows compares the tunnel peer addresses of the installed Node flows with the IP
+// addresses of the Nodes retrieved from the K8s apiserver. Flows which do not match any remote Node
+// (e.g. because a Node was removed while the corresponding event was missed) are considered stale:
+// the Node is marked as stale and enqueued, so that syncNodeRoute deletes its routes and flows.
+func (c *Controller) reconcileNodeFlows() error {
+	nodes, err := c.kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Nodes: %v", err)
+	}
+	nodeIPs := make(map[string]net.IP)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if node.Name == c.nodeConfig.Name {
+			continue
+		}
+		nodeIP, err := getNodeAddr(node)
+		if err != nil {
+			klog.Warningf("Failed to retrieve IP address of Node %s: %v", node.Name, err)
+			continue
+		}
+		nodeIPs[node.Name] = nodeIP
+	}
+	for nodeName, peerIP := range c.ofClient.GetNodeTunnelPeers() {
+		if nodeIP, ok := nodeIPs[nodeName]; ok && nodeIP.Equal(peerIP) {
+			continue
+		}
+		klog.Infof("Flows to Node %s with tunnel peer %s are stale", nodeName, peerIP)
+		c.staleNodes.Store(nodeName, struct{}{})
+		c.queue.Add(nodeName)
+	}
+	return nil
+}
+
 func (c *Controller) worker() {
 	for c.processNextWorkItem() {
 	}
@@ -194,7 +238,8 @@ func (c *Controller) processNextWorkItem() bool {
 //   * we install the appropriate OpenFlow flows to ensure that all the traffic destined to
 //   peerPodCIDR goes through the correct L3 tunnel.
 // If the Node no longer exists (cannot be retrieved by name from nodeLister) we delete the route
-// and OpenFlow flows associated with it.
+// and OpenFlow flows associated with it. If the Node was marked as stale by reconcileNodeFlows, we
+// delete the route and OpenFlow flows associated with it before installing them again.
 func (c *Controller) syncNodeRoute(nodeName string) error {
 	startTime := time.Now()
 	defer func() {
@@ -205,22 +250,20 @@ func (c *Controller) syncNodeRoute(nodeName string) error {
 	// same Node, which is required by the InstallNodeFlows / UninstallNodeFlows OF Client
 	// methods.
 
-	if node, err := c.nodeLister.Get(nodeName); err != nil {
-		klog.Infof("Deleting routes and flow entries to Node %s", nodeName)
-		route, flowsAreInstalled := c.installedNodes.Load(nodeName)
-		if route != nil {
-			if err = netlink.RouteDel(route.(*netlink.Route)); err != nil {
-				return fmt.Errorf("failed to delete the route to Node %s: %v", nodeName, err)
-			}
-			c.installedNodes.Store(nodeName, nil)
-		}
-		if flowsAreInstalled {
-			if err = c.ofClient.UninstallNodeFlows(nodeName); err != nil {
-				return fmt.Errorf("failed to uninstall flows to Node %s: %v", nodeName, err)
-			}
+	node, err := c.nodeLister.Get(nodeName)
+	// The routes and flows of a stale Node are deleted first, and installed again below if the
+	// Node still exists.
+	if _, isStale := c.staleNodes.Load(nodeName); err != nil || isStale {
+		if delErr := c.deleteNodeRoute(nodeName); delErr != nil {
+			return delErr
 		}
-		c.installedNodes.Delete(nodeName)
-	} else if route, flowsAreInstalled := c.installedNodes.Load(nodeName); route == nil {
+		c.staleNodes.Delete(nodeName)
+	}
+	if err != nil {
+		return nil
+	}
+
+	if route, flowsAreInstalled := c.installedNodes.Load(nodeName); route == nil {
 		klog.Infof("Adding routes and flows to Node %s, podCIDR: %s, addresses: %v",
 			nodeName, node.Spec.PodCIDR, node.Status.Addresses)
 		if node.Spec.PodCIDR == "" {
@@ -269,6 +312,25 @@ func (c *Controller) syncNodeRoute(nodeName string) error {
 	return nil
 }
 
+// deleteNodeRoute deletes the route and the OpenFlow flows to the Node with name nodeName.
+func (c *Controller) deleteNodeRoute(nodeName string) error {
+	klog.Infof("Deleting routes and flow entries to Node %s", nodeName)
+	route, _ := c.installedNodes.Load(nodeName)
+	if route != nil {
+		if err := netlink.RouteDel(route.(*netlink.Route)); err != nil {
+			return fmt.Errorf("failed to delete the route to Node %s: %v", nodeName, err)
+		}
+		c.installedNodes.Store(nodeName, nil)
+	}
+	// UninstallNodeFlows does nothing if no flows were installed for the Node, so it is called
+	// even if the Node is not in installedNodes, to make sure that stale flows are removed.
+	if err := c.ofClient.UninstallNodeFlows(nodeName); err != nil {
+		return fmt.Errorf("failed to uninstall flows to Node %s: %v", nodeName, err)
+	}
+	c.installedNodes.Delete(nodeName)
+	return nil
+}
+
 // getNodeAddr gets the available IP address of a Node. getNodeAddr will first try to get the
 // NodeInternalIP, then try to get the NodeExternalIP.
 func getNodeAddr(node *v1.Node) (net.IP, error) {
@@ -0,0 +1,91 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noderoute
+
+import (
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/antrea/pkg/agent"
+	openflowtest "github.com/vmware-tanzu/antrea/pkg/agent/openflow/testing"
+)
+
+func newNode(name string, nodeIP string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: nodeIP}},
+		},
+	}
+}
+
+func TestReconcileNodeFlows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ofClient := openflowtest.NewMockClient(ctrl)
+
+	localNode := newNode("node1", "192.168.1.1")
+	node2 := newNode("node2", "192.168.1.2")
+	node3 := newNode("node3", "192.168.1.3")
+	clientset := fake.NewSimpleClientset(localNode, node2, node3)
+	informerFactory := informers.NewSharedInformerFactory(clientset, 0)
+	c := NewNodeRouteController(clientset, informerFactory, ofClient, &agent.NodeConfig{
+		Name:    localNode.Name,
+		Gateway: &agent.Gateway{Name: "antrea-test-gw0"},
+	})
+	nodeIndexer := informerFactory.Core().V1().Nodes().Informer().GetIndexer()
+	for _, node := range []*v1.Node{localNode, node2, node3} {
+		require.Nil(t, nodeIndexer.Add(node))
+	}
+	tunnelPeers := map[string]net.IP{
+		node2.Name: net.ParseIP("192.168.1.2"),
+		node3.Name: net.ParseIP("192.168.1.3"),
+	}
+	for nodeName := range tunnelPeers {
+		c.installedNodes.Store(nodeName, nil)
+	}
+
+	ofClient.EXPECT().GetNodeTunnelPeers().Return(tunnelPeers)
+	require.Nil(t, c.reconcileNodeFlows())
+	assert.Equal(t, 0, c.queue.Len(), "No Node should be enqueued when all Nodes are present")
+
+	// Remove node3 from the cluster without going through the informer, as if the deletion
+	// event had been missed.
+	require.Nil(t, clientset.CoreV1().Nodes().Delete(node3.Name, &metav1.DeleteOptions{}))
+	require.Nil(t, nodeIndexer.Delete(node3))
+
+	ofClient.EXPECT().GetNodeTunnelPeers().Return(tunnelPeers)
+	require.Nil(t, c.reconcileNodeFlows())
+	require.Equal(t, 1, c.queue.Len())
+	key, _ := c.queue.Get()
+	assert.Equal(t, node3.Name, key)
+
+	ofClient.EXPECT().UninstallNodeFlows(node3.Name).Return(nil)
+	require.Nil(t, c.syncNodeRoute(node3.Name))
+	_, installed := c.installedNodes.Load(node3.Name)
+	assert.False(t, installed, "Node3 should have been removed from installedNodes")
+	_, isStale := c.staleNodes.Load(node3.Name)
+	assert.False(t, isStale, "Node3 should no longer be marked as stale")
+	_, installed = c.installedNodes.Load(node2.Name)
+	assert.True(t, installed, "Node2 should still be in installedNodes")
+}
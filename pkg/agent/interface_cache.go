@@ -15,12 +15,14 @@
 package agent
 
 import (
+	"encoding/json"
 	"net"
+	"sort"
+	"strings"
 	"sync"
 
 	"k8s.io/klog"
 
-	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
 )
 
@@ -30,8 +32,52 @@ const (
 	OVSExternalIDContainerID  = "container-id"
 	OVSExternalIDPodName      = "pod-name"
 	OVSExternalIDPodNamespace = "pod-namespace"
+	OVSExternalIDIPAMArgs     = "ipam-args"
+	OVSExternalIDCNIResult    = "cni-result"
+	OVSExternalIDNetNS        = "netns"
+	// OVSExternalIDInterfaceType is set on the OVS ports created by the agent which are not
+	// container ports, to identify their type (e.g. OVSInterfaceTypeTunnel).
+	OVSExternalIDInterfaceType = "interface-type"
+
+	OVSInterfaceTypeTunnel = "tunnel"
+	OVSInterfaceTypePatch  = "patch"
 )
 
+// requiredContainerExternalIDs are the external IDs which must be set on the OVS port of a container
+// interface for the interface to be restored from OVSDB.
+var requiredContainerExternalIDs = []string{
+	OVSExternalIDMAC,
+	OVSExternalIDIP,
+	OVSExternalIDPodName,
+	OVSExternalIDPodNamespace,
+}
+
+// getExternalID returns the value of the external ID with the provided key. If there is no exact
+// match, the key is matched case-insensitively, to accept keys written with a different case by
+// other tools.
+func getExternalID(externalIDs map[string]string, key string) (string, bool) {
+	if value, found := externalIDs[key]; found {
+		return value, true
+	}
+	for k, value := range externalIDs {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// missingExternalIDs returns the required container external IDs which are not set in externalIDs.
+func missingExternalIDs(externalIDs map[string]string) []string {
+	var missing []string
+	for _, key := range requiredContainerExternalIDs {
+		if _, found := getExternalID(externalIDs, key); !found {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
 type InterfaceType uint8
 
 const (
@@ -57,9 +103,28 @@ type InterfaceConfig struct {
 	PodName      string
 	PodNamespace string
 	NetNS        string
+	// IPAMArgs are the CNI arguments used to allocate the IP address of a container interface.
+	// They are persisted in the OVS port external_ids so that the address can still be released
+	// if the CNI DEL request for the container is never received.
+	IPAMArgs *IPAMArgs
+	// CNIResult is the serialized CNI result returned for the ADD request of a container interface,
+	// including the routes and DNS configuration. It is persisted in the OVS port external_ids so
+	// that the interface can still be fully validated by a CHECK request after a restart.
+	CNIResult json.RawMessage
 	*OVSPortConfig
 }
 
+// IPAMArgs includes the subset of the CNI arguments received in the ADD request for a container
+// which are needed to invoke the IPAM driver for this container at a later time.
+type IPAMArgs struct {
+	// ContainerID is the container ID with which the IP address was allocated, if it differs from
+	// the ID of the container, e.g. after the IP address has been reassigned.
+	ContainerID   string          `json:"containerID,omitempty"`
+	IfName        string          `json:"ifName"`
+	Path          string          `json:"path"`
+	NetworkConfig json.RawMessage `json:"networkConfig"`
+}
+
 // InterfaceStore is a service interface to create local interfaces for container, host gateway, and tunnel port.
 // Support add/delete/get operations
 type InterfaceStore interface {
@@ -67,10 +132,21 @@ type InterfaceStore interface {
 	AddInterface(ifaceID string, interfaceConfig *InterfaceConfig)
 	DeleteInterface(ifaceID string)
 	GetInterface(ifaceID string) (*InterfaceConfig, bool)
+	GetInterfaceByOFPort(ofPort int32) (*InterfaceConfig, bool)
 	GetContainerInterface(podName string, podNamespace string) (*InterfaceConfig, bool)
+	// GetContainerInterfaces returns all the container interfaces of the Pod, from the least to the
+	// most recently added one. There can be more than one after a Pod sandbox restart, until the
+	// interface of the previous sandbox is deleted.
+	GetContainerInterfaces(podName string, podNamespace string) []*InterfaceConfig
 	GetContainerInterfaceNum() int
 	Len() int
 	GetInterfaceIDs() []string
+	// FindDuplicateIPs returns the IP addresses used by more than one interface, each mapped to
+	// the sorted IDs of the interfaces using it. A non-empty result indicates an IP leak.
+	FindDuplicateIPs() map[string][]string
+	// Subscribe returns a channel receiving an InterfaceEvent each time an interface is added to
+	// or deleted from the store, and a function to call to unsubscribe.
+	Subscribe() (<-chan InterfaceEvent, func())
 }
 
 // Local cache for interfaces created on node, including container, host gateway, and tunnel
@@ -87,10 +163,23 @@ type InterfaceStore interface {
 // Host gateway and tunnel interfaces are added into cache in node initialization phase or
 // retrieved from existing OVS ports
 // Todo: add periodic task to sync local cache with container veth pair
+// Components which need to react to interface changes can subscribe to the cache with Subscribe.
+// Events are emitted for all changes, including the ones made during initialization and by the
+// reconciliation of the cniserver.
 
 type interfaceCache struct {
 	sync.RWMutex
 	cache map[string]*InterfaceConfig
+	// ofPortIndex maps the OpenFlow port number of each interface with an assigned port to the
+	// interface ID.
+	ofPortIndex map[int32]string
+	// podIndex maps the "<podNamespace>/<podName>" key of each Pod to the IDs of its container
+	// interfaces, in the order in which they were added.
+	podIndex map[string][]string
+	// subscribersMutex protects subscribers. It is acquired after the cache lock when both are
+	// needed.
+	subscribersMutex sync.Mutex
+	subscribers      map[*interfaceSubscriber]struct{}
 }
 
 func (c *interfaceCache) Initialize(ovsBridgeClient ovsconfig.OVSBridgeClient, gatewayPort string, tunnelPort string) error {
@@ -100,6 +189,8 @@ func (c *interfaceCache) Initialize(ovsBridgeClient ovsconfig.OVSBridgeClient, g
 		return err
 	}
 
+	// invalidPorts is the number of container ports skipped because of missing external IDs.
+	invalidPorts := 0
 	for _, port := range ovsPorts {
 		ovsPort := &OVSPortConfig{IfaceName: port.Name, PortUUID: port.UUID, OFPort: port.OFPort}
 		var intf *InterfaceConfig
@@ -108,30 +199,63 @@ func (c *interfaceCache) Initialize(ovsBridgeClient ovsconfig.OVSBridgeClient, g
 			intf = &InterfaceConfig{Type: GatewayInterface, OVSPortConfig: ovsPort, ID: gatewayPort}
 		case port.Name == tunnelPort:
 			intf = &InterfaceConfig{Type: TunnelInterface, OVSPortConfig: ovsPort, ID: tunnelPort}
+		case port.ExternalIDs[OVSExternalIDInterfaceType] == OVSInterfaceTypeTunnel:
+			// A tunnel port created by the agent with a different name.
+			intf = &InterfaceConfig{Type: TunnelInterface, OVSPortConfig: ovsPort, ID: port.Name}
 		default:
 			if port.ExternalIDs == nil {
 				klog.V(2).Infof("OVS port %s has no external_ids, continue to next", port.Name)
 				continue
 			}
 
-			if containerID, found := port.ExternalIDs[OVSExternalIDContainerID]; found {
-				containerIP := net.ParseIP(port.ExternalIDs[OVSExternalIDIP])
-				containerMAC, err := net.ParseMAC(port.ExternalIDs[OVSExternalIDMAC])
+			if containerID, found := getExternalID(port.ExternalIDs, OVSExternalIDContainerID); found {
+				if missing := missingExternalIDs(port.ExternalIDs); len(missing) > 0 {
+					klog.Warningf("OVS port %s for container %s is missing external IDs %v, skipping it", port.Name, containerID, missing)
+					invalidPorts++
+					continue
+				}
+				macStr, _ := getExternalID(port.ExternalIDs, OVSExternalIDMAC)
+				containerMAC, err := net.ParseMAC(macStr)
 				if err != nil {
-					klog.Errorf("Failed to parse MAC address from OVS external config %s: %v",
-						port.ExternalIDs[OVSExternalIDMAC], err)
+					klog.Errorf("Failed to parse MAC address from OVS external config %s: %v", macStr, err)
 					return err
 				}
-				podName, _ := port.ExternalIDs[OVSExternalIDPodName]
-				podNamespace, _ := port.ExternalIDs[OVSExternalIDPodNamespace]
+				ipStr, _ := getExternalID(port.ExternalIDs, OVSExternalIDIP)
+				containerIP := net.ParseIP(ipStr)
+				podName, _ := getExternalID(port.ExternalIDs, OVSExternalIDPodName)
+				podNamespace, _ := getExternalID(port.ExternalIDs, OVSExternalIDPodNamespace)
+				// The network namespace is missing for OVS ports created by older versions.
+				netNS, _ := getExternalID(port.ExternalIDs, OVSExternalIDNetNS)
 				intf = &InterfaceConfig{Type: ContainerInterface, OVSPortConfig: ovsPort, ID: containerID,
-					IP: containerIP, MAC: containerMAC, PodName: podName, PodNamespace: podNamespace}
+					IP: containerIP, MAC: containerMAC, PodName: podName, PodNamespace: podNamespace, NetNS: netNS}
+				// The IPAM arguments are missing for OVS ports created by older versions.
+				if ipamArgsStr, found := getExternalID(port.ExternalIDs, OVSExternalIDIPAMArgs); found {
+					ipamArgs := &IPAMArgs{}
+					if err := json.Unmarshal([]byte(ipamArgsStr), ipamArgs); err != nil {
+						klog.Errorf("Failed to parse IPAM arguments from OVS external config %s: %v", ipamArgsStr, err)
+					} else {
+						intf.IPAMArgs = ipamArgs
+					}
+				}
+				// The CNI result is missing for OVS ports created by older versions.
+				if cniResultStr, found := getExternalID(port.ExternalIDs, OVSExternalIDCNIResult); found {
+					if !json.Valid([]byte(cniResultStr)) {
+						klog.Errorf("Failed to parse CNI result from OVS external config %s", cniResultStr)
+					} else {
+						intf.CNIResult = json.RawMessage(cniResultStr)
+					}
+				}
 			}
 		}
 		if intf != nil {
-			c.cache[intf.IfaceName] = intf
+			c.Lock()
+			c.add(intf.IfaceName, intf)
+			c.Unlock()
 		}
 	}
+	if invalidPorts > 0 {
+		klog.Warningf("Skipped %d OVS container ports with missing external IDs, they may have been created by an older version of antrea-agent", invalidPorts)
+	}
 	return nil
 }
 
@@ -161,6 +285,19 @@ func BuildOVSPortExternalIDs(containerConfig *InterfaceConfig) map[string]interf
 	externalIDs[OVSExternalIDIP] = containerConfig.IP.String()
 	externalIDs[OVSExternalIDPodName] = containerConfig.PodName
 	externalIDs[OVSExternalIDPodNamespace] = containerConfig.PodNamespace
+	if containerConfig.NetNS != "" {
+		externalIDs[OVSExternalIDNetNS] = containerConfig.NetNS
+	}
+	if containerConfig.IPAMArgs != nil {
+		if ipamArgs, err := json.Marshal(containerConfig.IPAMArgs); err != nil {
+			klog.Errorf("Failed to marshal IPAM arguments for container %s: %v", containerConfig.ID, err)
+		} else {
+			externalIDs[OVSExternalIDIPAMArgs] = string(ipamArgs)
+		}
+	}
+	if len(containerConfig.CNIResult) > 0 {
+		externalIDs[OVSExternalIDCNIResult] = string(containerConfig.CNIResult)
+	}
 	return externalIDs
 }
 
@@ -168,14 +305,81 @@ func BuildOVSPortExternalIDs(containerConfig *InterfaceConfig) map[string]interf
 func (c *interfaceCache) AddInterface(ifaceID string, interfaceConfig *InterfaceConfig) {
 	c.Lock()
 	defer c.Unlock()
+	c.add(ifaceID, interfaceConfig)
+}
+
+// add adds interfaceConfig to the cache and updates the OFPort and Pod indexes. It must be called
+// with the cache lock held.
+func (c *interfaceCache) add(ifaceID string, interfaceConfig *InterfaceConfig) {
+	oldIface, found := c.cache[ifaceID]
+	if found {
+		c.removeFromOFPortIndex(ifaceID, oldIface)
+	}
+	// An interface which is updated keeps its position in the Pod index, so that updating the
+	// interface of a previous sandbox does not make it the current one.
+	samePod := found && oldIface.Type == ContainerInterface && interfaceConfig.Type == ContainerInterface &&
+		oldIface.PodName == interfaceConfig.PodName && oldIface.PodNamespace == interfaceConfig.PodNamespace
+	if found && !samePod {
+		c.removeFromPodIndex(ifaceID, oldIface)
+	}
 	c.cache[ifaceID] = interfaceConfig
+	// An OFPort of 0 means that the port number is not assigned yet, and a negative value that
+	// OVS failed to assign it.
+	if interfaceConfig.OVSPortConfig != nil && interfaceConfig.OFPort > 0 {
+		c.ofPortIndex[interfaceConfig.OFPort] = ifaceID
+	}
+	if interfaceConfig.Type == ContainerInterface && !samePod {
+		key := podKey(interfaceConfig.PodName, interfaceConfig.PodNamespace)
+		c.podIndex[key] = append(c.podIndex[key], ifaceID)
+	}
+	c.notify(InterfaceAdded, ifaceID, interfaceConfig)
+}
+
+func podKey(podName, podNamespace string) string {
+	return podNamespace + "/" + podName
+}
+
+func (c *interfaceCache) removeFromOFPortIndex(ifaceID string, iface *InterfaceConfig) {
+	if iface.OVSPortConfig == nil {
+		return
+	}
+	if id, found := c.ofPortIndex[iface.OFPort]; found && id == ifaceID {
+		delete(c.ofPortIndex, iface.OFPort)
+	}
+}
+
+func (c *interfaceCache) removeFromPodIndex(ifaceID string, iface *InterfaceConfig) {
+	if iface.Type != ContainerInterface {
+		return
+	}
+	key := podKey(iface.PodName, iface.PodNamespace)
+	ids := c.podIndex[key]
+	for i, id := range ids {
+		if id != ifaceID {
+			continue
+		}
+		ids = append(ids[:i:i], ids[i+1:]...)
+		break
+	}
+	if len(ids) == 0 {
+		delete(c.podIndex, key)
+	} else {
+		c.podIndex[key] = ids
+	}
 }
 
 // DeleteInterface deletes interface from local cache
 func (c *interfaceCache) DeleteInterface(ifaceID string) {
 	c.Lock()
 	defer c.Unlock()
+	iface, found := c.cache[ifaceID]
+	if !found {
+		return
+	}
 	delete(c.cache, ifaceID)
+	c.removeFromOFPortIndex(ifaceID, iface)
+	c.removeFromPodIndex(ifaceID, iface)
+	c.notify(InterfaceDeleted, ifaceID, iface)
 }
 
 // GetInterface retrieves interface from local cache
@@ -186,6 +390,18 @@ func (c *interfaceCache) GetInterface(ifaceID string) (*InterfaceConfig, bool) {
 	return iface, found
 }
 
+// GetInterfaceByOFPort retrieves the interface with the provided OpenFlow port number from local
+// cache. Interfaces with no assigned port number cannot be looked up.
+func (c *interfaceCache) GetInterfaceByOFPort(ofPort int32) (*InterfaceConfig, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	ifaceID, found := c.ofPortIndex[ofPort]
+	if !found {
+		return nil, false
+	}
+	return c.cache[ifaceID], true
+}
+
 func (c *interfaceCache) GetContainerInterfaceNum() int {
 	num := 0
 	c.RLock()
@@ -214,15 +430,58 @@ func (c *interfaceCache) GetInterfaceIDs() []string {
 	return ids
 }
 
-// GetPodInterface retrieves interface for Pod filtered by Pod name and Pod namespace.
+func (c *interfaceCache) FindDuplicateIPs() map[string][]string {
+	c.RLock()
+	defer c.RUnlock()
+	ifaceIDsByIP := make(map[string][]string)
+	for id, iface := range c.cache {
+		if iface.IP == nil {
+			continue
+		}
+		ip := iface.IP.String()
+		ifaceIDsByIP[ip] = append(ifaceIDsByIP[ip], id)
+	}
+	duplicates := make(map[string][]string)
+	for ip, ids := range ifaceIDsByIP {
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			duplicates[ip] = ids
+		}
+	}
+	return duplicates
+}
+
+// GetContainerInterface retrieves interface for Pod filtered by Pod name and Pod namespace. The
+// interface is looked up using the Pod information persisted with it rather than by computing its
+// name, so that the lookup does not depend on the naming scheme used to create the interface. If
+// the Pod has more than one interface, e.g. after a sandbox restart, the most recently added one,
+// which belongs to the current sandbox, is returned.
 func (c *interfaceCache) GetContainerInterface(podName string, podNamespace string) (*InterfaceConfig, bool) {
-	ovsPortName := util.GenerateContainerInterfaceName(podName, podNamespace)
 	c.RLock()
 	defer c.RUnlock()
-	iface, ok := c.cache[ovsPortName]
-	return iface, ok
+	ids := c.podIndex[podKey(podName, podNamespace)]
+	if len(ids) == 0 {
+		return nil, false
+	}
+	return c.cache[ids[len(ids)-1]], true
+}
+
+func (c *interfaceCache) GetContainerInterfaces(podName string, podNamespace string) []*InterfaceConfig {
+	c.RLock()
+	defer c.RUnlock()
+	ids := c.podIndex[podKey(podName, podNamespace)]
+	ifaces := make([]*InterfaceConfig, 0, len(ids))
+	for _, id := range ids {
+		ifaces = append(ifaces, c.cache[id])
+	}
+	return ifaces
 }
 
 func NewInterfaceStore() InterfaceStore {
-	return &interfaceCache{cache: map[string]*InterfaceConfig{}}
+	return &interfaceCache{
+		cache:       map[string]*InterfaceConfig{},
+		ofPortIndex: map[int32]string{},
+		podIndex:    map[string][]string{},
+		subscribers: map[*interfaceSubscriber]struct{}{},
+	}
 }
@@ -15,10 +15,15 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/current"
 	mock "github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 
@@ -75,6 +80,41 @@ func TestInitCache(t *testing.T) {
 	}
 }
 
+func TestInitCacheMissingExternalIDs(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+
+	validPort := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "p1", IFName: "p1", OFPort: 1,
+		ExternalIDs: map[string]string{OVSExternalIDContainerID: uuid.New().String(),
+			OVSExternalIDMAC: "11:22:33:44:55:66", OVSExternalIDIP: "1.1.1.1", OVSExternalIDPodName: "pod1", OVSExternalIDPodNamespace: "test"}}
+	// The IP address external ID is missing, as for a port created by an older version.
+	portWithoutIP := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "p2", IFName: "p2", OFPort: 2,
+		ExternalIDs: map[string]string{OVSExternalIDContainerID: uuid.New().String(),
+			OVSExternalIDMAC: "11:22:33:44:55:77", OVSExternalIDPodName: "pod2", OVSExternalIDPodNamespace: "test"}}
+	// The external ID keys are matched case-insensitively.
+	portWithUpperCaseKeys := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "p3", IFName: "p3", OFPort: 3,
+		ExternalIDs: map[string]string{"Container-ID": uuid.New().String(),
+			"Attached-MAC": "11:22:33:44:55:88", "IP-Address": "1.1.1.3", "Pod-Name": "pod3", "Pod-Namespace": "test"}}
+	mockOVSBridgeClient.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{validPort, portWithoutIP, portWithUpperCaseKeys}, nil)
+
+	cache := NewInterfaceStore()
+	if err := cache.Initialize(mockOVSBridgeClient, "", ""); err != nil {
+		t.Fatalf("Failed to initialize cache: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 interfaces in the cache, got %d", cache.Len())
+	}
+	if _, found := cache.GetInterface("p2"); found {
+		t.Errorf("Port with missing IP external ID should have been skipped")
+	}
+	if iface, found := cache.GetInterface("p3"); !found {
+		t.Errorf("Port with upper-case external ID keys should have been loaded")
+	} else if iface.IP.String() != "1.1.1.3" || iface.PodName != "pod3" {
+		t.Errorf("Failed to load configuration of port with upper-case external ID keys")
+	}
+}
+
 func TestParseContainerAttachInfo(t *testing.T) {
 	containerID := uuid.New().String()
 	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
@@ -94,3 +134,277 @@ func TestParseContainerAttachInfo(t *testing.T) {
 		t.Errorf("Failed to parse container configuration")
 	}
 }
+
+func TestIPAMArgsExternalIDs(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+
+	containerID := uuid.New().String()
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerIP := net.ParseIP("10.1.2.100")
+	containerConfig := NewContainerInterface(containerID, "test-1", "t1", "/var/run/netns/test", containerMAC, containerIP)
+	containerConfig.IPAMArgs = &IPAMArgs{
+		ContainerID:   containerID + "-1",
+		IfName:        "eth0",
+		Path:          "/opt/cni/bin",
+		NetworkConfig: []byte(`{"cniVersion":"0.3.0","name":"antrea","type":"antrea","ipam":{"type":"host-local"}}`),
+	}
+	externalIDs := BuildOVSPortExternalIDs(containerConfig)
+	if _, existed := externalIDs[OVSExternalIDIPAMArgs]; !existed {
+		t.Fatalf("Failed to build IPAM arguments external ID")
+	}
+
+	ovsExternalIDs := make(map[string]string)
+	for k, v := range externalIDs {
+		ovsExternalIDs[k] = v.(string)
+	}
+	ovsPort := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "p1", IFName: "p1", OFPort: 1, ExternalIDs: ovsExternalIDs}
+	mockOVSBridgeClient.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{ovsPort}, nil)
+	cache := NewInterfaceStore()
+	if err := cache.Initialize(mockOVSBridgeClient, "", ""); err != nil {
+		t.Fatalf("Failed to initialize interface store: %v", err)
+	}
+	container, found := cache.GetInterface("p1")
+	if !found {
+		t.Fatalf("Failed to load OVS port into local cache")
+	}
+	if container.IPAMArgs == nil || container.IPAMArgs.IfName != "eth0" || container.IPAMArgs.Path != "/opt/cni/bin" ||
+		string(container.IPAMArgs.NetworkConfig) != string(containerConfig.IPAMArgs.NetworkConfig) {
+		t.Errorf("Failed to load IPAM arguments into local cache: %+v", container.IPAMArgs)
+	}
+	if container.IPAMArgs != nil && container.IPAMArgs.ContainerID != containerID+"-1" {
+		t.Errorf("Failed to load IPAM container ID into local cache: %s", container.IPAMArgs.ContainerID)
+	}
+	// The network namespace is required to reconfigure the container interface after a restart.
+	if container.NetNS != "/var/run/netns/test" {
+		t.Errorf("Failed to load network namespace into local cache: %s", container.NetNS)
+	}
+}
+
+func TestCNIResultExternalIDs(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+
+	containerID := uuid.New().String()
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerIP := net.ParseIP("10.1.2.100")
+	containerConfig := NewContainerInterface(containerID, "test-1", "t1", "/var/run/netns/test", containerMAC, containerIP)
+	ifaceIndex := 1
+	_, extraRoute, _ := net.ParseCIDR("10.10.0.0/16")
+	result := &current.Result{
+		CNIVersion: "0.3.1",
+		Interfaces: []*current.Interface{
+			{Name: "test-1-abcdef", Mac: "11:22:33:44:55:66"},
+			{Name: "eth0", Mac: containerMAC.String(), Sandbox: "/var/run/netns/test"},
+		},
+		IPs: []*current.IPConfig{{
+			Version:   "4",
+			Interface: &ifaceIndex,
+			Address:   net.IPNet{IP: containerIP, Mask: net.CIDRMask(24, 32)},
+			Gateway:   net.ParseIP("10.1.2.1"),
+		}},
+		Routes: []*types.Route{
+			{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, GW: net.ParseIP("10.1.2.1")},
+			{Dst: *extraRoute, GW: net.ParseIP("10.1.2.1")},
+		},
+		DNS: types.DNS{Nameservers: []string{"10.96.0.10"}, Search: []string{"t1.svc.cluster.local"}, Options: []string{"ndots:5"}},
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal CNI result: %v", err)
+	}
+	containerConfig.CNIResult = resultBytes
+	externalIDs := BuildOVSPortExternalIDs(containerConfig)
+	if _, existed := externalIDs[OVSExternalIDCNIResult]; !existed {
+		t.Fatalf("Failed to build CNI result external ID")
+	}
+
+	ovsExternalIDs := make(map[string]string)
+	for k, v := range externalIDs {
+		ovsExternalIDs[k] = v.(string)
+	}
+	ovsPort := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "p1", IFName: "p1", OFPort: 1, ExternalIDs: ovsExternalIDs}
+	mockOVSBridgeClient.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{ovsPort}, nil)
+	cache := NewInterfaceStore()
+	if err := cache.Initialize(mockOVSBridgeClient, "", ""); err != nil {
+		t.Fatalf("Failed to initialize interface store: %v", err)
+	}
+	container, found := cache.GetInterface("p1")
+	if !found {
+		t.Fatalf("Failed to load OVS port into local cache")
+	}
+	restored := &current.Result{}
+	if err := json.Unmarshal(container.CNIResult, restored); err != nil {
+		t.Fatalf("Failed to unmarshal CNI result loaded into local cache: %v", err)
+	}
+	// IP addresses may be parsed with a different length, so the results are compared serialized.
+	restoredBytes, _ := json.Marshal(restored)
+	if string(restoredBytes) != string(resultBytes) {
+		t.Errorf("CNI result loaded into local cache does not match: expected %s, got %s", resultBytes, restoredBytes)
+	}
+	if len(restored.Routes) != 2 || len(restored.DNS.Nameservers) != 1 {
+		t.Errorf("Routes or DNS configuration missing from CNI result loaded into local cache: %+v", restored)
+	}
+}
+
+func TestInterfaceStoreSubscribe(t *testing.T) {
+	cache := NewInterfaceStore()
+	events, unsubscribe := cache.Subscribe()
+
+	expectEvent := func(eventType InterfaceEventType, ifaceID string) {
+		select {
+		case event := <-events:
+			if event.Type != eventType || event.IfaceID != ifaceID {
+				t.Errorf("Unexpected event %+v, expected type %d for interface %s", event, eventType, ifaceID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No event received for interface %s", ifaceID)
+		}
+	}
+
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	containerConfig := NewContainerInterface(uuid.New().String(), "test-1", "t1", "", containerMAC, net.ParseIP("10.1.2.100"))
+	cache.AddInterface("p1", containerConfig)
+	// Deleting an interface which is not in the store does not generate an event.
+	cache.DeleteInterface("p2")
+	cache.DeleteInterface("p1")
+	expectEvent(InterfaceAdded, "p1")
+	expectEvent(InterfaceDeleted, "p1")
+
+	unsubscribe()
+	cache.AddInterface("p1", containerConfig)
+	select {
+	case event, ok := <-events:
+		if ok {
+			t.Errorf("Unexpected event %+v after unsubscribing", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Channel was not closed after unsubscribing")
+	}
+}
+
+func TestGetInterfaceByOFPort(t *testing.T) {
+	cache := NewInterfaceStore()
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	container1 := NewContainerInterface(uuid.New().String(), "test-1", "t1", "", containerMAC, net.ParseIP("10.1.2.100"))
+	container1.OVSPortConfig = &OVSPortConfig{IfaceName: "p1", PortUUID: uuid.New().String(), OFPort: 11}
+	container2 := NewContainerInterface(uuid.New().String(), "test-2", "t1", "", containerMAC, net.ParseIP("10.1.2.101"))
+	container2.OVSPortConfig = &OVSPortConfig{IfaceName: "p2", PortUUID: uuid.New().String(), OFPort: 12}
+	// The OFPort of this interface is not assigned yet.
+	container3 := NewContainerInterface(uuid.New().String(), "test-3", "t1", "", containerMAC, net.ParseIP("10.1.2.102"))
+	container3.OVSPortConfig = &OVSPortConfig{IfaceName: "p3", PortUUID: uuid.New().String(), OFPort: 0}
+	cache.AddInterface("p1", container1)
+	cache.AddInterface("p2", container2)
+	cache.AddInterface("p3", container3)
+
+	if iface, found := cache.GetInterfaceByOFPort(11); !found || iface != container1 {
+		t.Errorf("Failed to look up interface p1 by OFPort")
+	}
+	if iface, found := cache.GetInterfaceByOFPort(12); !found || iface != container2 {
+		t.Errorf("Failed to look up interface p2 by OFPort")
+	}
+	if _, found := cache.GetInterfaceByOFPort(0); found {
+		t.Errorf("Interface with unassigned OFPort should not be indexed")
+	}
+
+	cache.DeleteInterface("p1")
+	if _, found := cache.GetInterfaceByOFPort(11); found {
+		t.Errorf("Deleted interface p1 should not be found by OFPort")
+	}
+	if _, found := cache.GetInterfaceByOFPort(12); !found {
+		t.Errorf("Interface p2 should still be found by OFPort")
+	}
+}
+
+func TestGetContainerInterface(t *testing.T) {
+	cache := NewInterfaceStore()
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	// Two interfaces for the same Pod, as after a sandbox restart.
+	oldContainer := NewContainerInterface(uuid.New().String(), "test-1", "t1", "", containerMAC, net.ParseIP("10.1.2.100"))
+	oldContainer.OVSPortConfig = &OVSPortConfig{IfaceName: "p1", PortUUID: uuid.New().String(), OFPort: 11}
+	newContainer := NewContainerInterface(uuid.New().String(), "test-1", "t1", "", containerMAC, net.ParseIP("10.1.2.101"))
+	newContainer.OVSPortConfig = &OVSPortConfig{IfaceName: "p2", PortUUID: uuid.New().String(), OFPort: 12}
+	otherContainer := NewContainerInterface(uuid.New().String(), "test-2", "t1", "", containerMAC, net.ParseIP("10.1.2.102"))
+	otherContainer.OVSPortConfig = &OVSPortConfig{IfaceName: "p3", PortUUID: uuid.New().String(), OFPort: 13}
+	cache.AddInterface("p1", oldContainer)
+	cache.AddInterface("p2", newContainer)
+	cache.AddInterface("p3", otherContainer)
+
+	if iface, found := cache.GetContainerInterface("test-1", "t1"); !found || iface != newContainer {
+		t.Errorf("The most recently added interface of the Pod should be returned")
+	}
+	if ifaces := cache.GetContainerInterfaces("test-1", "t1"); len(ifaces) != 2 || ifaces[0] != oldContainer || ifaces[1] != newContainer {
+		t.Errorf("Unexpected interfaces for the Pod: %v", ifaces)
+	}
+	if iface, found := cache.GetContainerInterface("test-2", "t1"); !found || iface != otherContainer {
+		t.Errorf("Failed to look up the interface of Pod test-2")
+	}
+
+	// Updating the old interface must not make it the current one.
+	cache.AddInterface("p1", oldContainer)
+	if iface, _ := cache.GetContainerInterface("test-1", "t1"); iface != newContainer {
+		t.Errorf("The updated interface should not replace the most recently added one")
+	}
+
+	cache.DeleteInterface("p1")
+	if iface, found := cache.GetContainerInterface("test-1", "t1"); !found || iface != newContainer {
+		t.Errorf("The remaining interface of the Pod should be returned")
+	}
+	cache.DeleteInterface("p2")
+	if _, found := cache.GetContainerInterface("test-1", "t1"); found {
+		t.Errorf("No interface should be found for the Pod after deleting all its interfaces")
+	}
+	if ifaces := cache.GetContainerInterfaces("test-1", "t1"); len(ifaces) != 0 {
+		t.Errorf("Unexpected interfaces for the Pod: %v", ifaces)
+	}
+}
+
+func TestFindDuplicateIPs(t *testing.T) {
+	cache := NewInterfaceStore()
+	containerMAC, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	container1 := NewContainerInterface(uuid.New().String(), "test-1", "t1", "", containerMAC, net.ParseIP("10.1.2.100"))
+	container2 := NewContainerInterface(uuid.New().String(), "test-2", "t1", "", containerMAC, net.ParseIP("10.1.2.101"))
+	cache.AddInterface("p1", container1)
+	cache.AddInterface("p2", container2)
+	cache.AddInterface("tun0", NewTunnelInterface("tun0"))
+
+	if duplicates := cache.FindDuplicateIPs(); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicate IPs, got %v", duplicates)
+	}
+
+	// The IP address of container1 is assigned to another interface.
+	container3 := NewContainerInterface(uuid.New().String(), "test-3", "t1", "", containerMAC, net.ParseIP("10.1.2.100"))
+	cache.AddInterface("p3", container3)
+	expected := map[string][]string{"10.1.2.100": {"p1", "p3"}}
+	if duplicates := cache.FindDuplicateIPs(); !reflect.DeepEqual(expected, duplicates) {
+		t.Errorf("Expected duplicate IPs %v, got %v", expected, duplicates)
+	}
+}
+
+func TestInitCacheTunnelPort(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	mockOVSBridgeClient := ovsconfigtest.NewMockOVSBridgeClient(controller)
+
+	// The tunnel port with the expected name is identified by its name, while another tunnel port
+	// created by the agent is identified by its external IDs.
+	tunnelPort := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "tun0", IFName: "tun0", OFPort: 1}
+	taggedPort := ovsconfig.OVSPortData{UUID: uuid.New().String(), Name: "old-tun0", IFName: "old-tun0", OFPort: 3,
+		ExternalIDs: map[string]string{OVSExternalIDInterfaceType: OVSInterfaceTypeTunnel}}
+	mockOVSBridgeClient.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{tunnelPort, taggedPort}, nil)
+
+	cache := NewInterfaceStore()
+	if err := cache.Initialize(mockOVSBridgeClient, "", "tun0"); err != nil {
+		t.Fatalf("Failed to initialize cache: %v", err)
+	}
+	for _, name := range []string{"tun0", "old-tun0"} {
+		iface, found := cache.GetInterface(name)
+		if !found {
+			t.Errorf("Failed to load tunnel port %s into local cache", name)
+		} else if iface.Type != TunnelInterface {
+			t.Errorf("Port %s should have been loaded as a tunnel interface", name)
+		}
+	}
+}
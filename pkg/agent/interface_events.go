@@ -0,0 +1,135 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"sync"
+)
+
+type InterfaceEventType uint8
+
+const (
+	// InterfaceAdded is emitted when an interface is added to the InterfaceStore, or when the
+	// configuration of an existing interface is replaced.
+	InterfaceAdded InterfaceEventType = iota
+	// InterfaceDeleted is emitted when an interface is deleted from the InterfaceStore.
+	InterfaceDeleted
+)
+
+// InterfaceEvent describes a change to the InterfaceStore. Interface is the configuration of the
+// interface which was added or deleted, and must not be modified by subscribers.
+type InterfaceEvent struct {
+	Type      InterfaceEventType
+	IfaceID   string
+	Interface *InterfaceConfig
+}
+
+// interfaceSubscriber delivers events to a single subscriber. Events are queued without bound, so
+// that a slow subscriber never blocks updates to the InterfaceStore, and are delivered in the order
+// in which the updates were made.
+type interfaceSubscriber struct {
+	ch     chan InterfaceEvent
+	stopCh chan struct{}
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	queue  []InterfaceEvent
+	// stopped is set to true when the subscriber unsubscribes.
+	stopped bool
+}
+
+func newInterfaceSubscriber() *interfaceSubscriber {
+	s := &interfaceSubscriber{
+		ch:     make(chan InterfaceEvent),
+		stopCh: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	go s.run()
+	return s
+}
+
+func (s *interfaceSubscriber) enqueue(event InterfaceEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return
+	}
+	s.queue = append(s.queue, event)
+	s.cond.Signal()
+}
+
+// run delivers queued events to the subscriber's channel until the subscriber unsubscribes, at
+// which point the channel is closed.
+func (s *interfaceSubscriber) run() {
+	defer close(s.ch)
+	for {
+		s.mutex.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			s.mutex.Unlock()
+			return
+		}
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mutex.Unlock()
+
+		select {
+		case s.ch <- event:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *interfaceSubscriber) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	s.queue = nil
+	close(s.stopCh)
+	s.cond.Signal()
+}
+
+// Subscribe returns a channel on which an event is received for each interface added to or deleted
+// from the store after the call, as well as a function to call to unsubscribe. The channel is
+// closed after unsubscribing, and pending events are discarded.
+func (c *interfaceCache) Subscribe() (<-chan InterfaceEvent, func()) {
+	s := newInterfaceSubscriber()
+	c.subscribersMutex.Lock()
+	c.subscribers[s] = struct{}{}
+	c.subscribersMutex.Unlock()
+
+	unsubscribe := func() {
+		c.subscribersMutex.Lock()
+		delete(c.subscribers, s)
+		c.subscribersMutex.Unlock()
+		s.stop()
+	}
+	return s.ch, unsubscribe
+}
+
+// notify sends the event to all the subscribers. It must be called with the cache lock held, so that
+// events are queued in the order in which the cache is updated.
+func (c *interfaceCache) notify(eventType InterfaceEventType, ifaceID string, iface *InterfaceConfig) {
+	c.subscribersMutex.Lock()
+	defer c.subscribersMutex.Unlock()
+	for s := range c.subscribers {
+		s.enqueue(InterfaceEvent{Type: eventType, IfaceID: ifaceID, Interface: iface})
+	}
+}
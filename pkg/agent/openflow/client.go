@@ -35,6 +35,12 @@ type Client interface {
 	// InstallGatewayFlows sets up flows related to an OVS gateway port, the gateway must exist.
 	InstallGatewayFlows(gatewayAddr net.IP, gatewayMAC net.HardwareAddr, gatewayOFPort uint32) error
 
+	// InstallGatewayVirtualMACFlows sets up flows so that local Pods resolve the gateway IP address
+	// to virtualMAC instead of the MAC address of the gateway interface: ARP requests for
+	// gatewayAddr are answered with virtualMAC, and traffic sent to virtualMAC is forwarded to the
+	// gateway port, with its destination MAC address rewritten to gatewayMAC.
+	InstallGatewayVirtualMACFlows(gatewayAddr net.IP, gatewayMAC, virtualMAC net.HardwareAddr, gatewayOFPort uint32) error
+
 	// InstallClusterServiceCIDRFlows sets up the appropriate flows so that traffic can reach
 	// the different Services running in the Cluster. This method needs to be invoked once with
 	// the Cluster Service CIDR as a parameter.
@@ -53,6 +59,10 @@ type Client interface {
 	// hostname. UninstallNodeFlows will do nothing if no connection to the host was established.
 	UninstallNodeFlows(hostname string) error
 
+	// GetNodeTunnelPeers returns the tunnel peer address of every remote Node for which flows
+	// were installed with InstallNodeFlows, indexed by hostname.
+	GetNodeTunnelPeers() map[string]net.IP
+
 	// InstallPodFlows should be invoked when a connection to a Pod on current Node. The
 	// containerID is used to identify the added flows. Calls to InstallPodFlows are
 	// idempotent. Concurrent calls to InstallPodFlows and / or UninstallPodFlows are
@@ -61,7 +71,16 @@ type Client interface {
 
 	// UninstallPodFlows removes the connection to the local Pod specified with the
 	// containerID. UninstallPodFlows will do nothing if no connection to the Pod was established.
-	UninstallPodFlows(containerID string) error
+	// If ofPort is not zero, all the flows matching ofPort as the input port are removed as well,
+	// including flows which were not installed with containerID (e.g. if the ofport of the Pod
+	// interface changed after InstallPodFlows was called).
+	UninstallPodFlows(containerID string, ofPort uint32) error
+
+	// GetMissingPodFlows returns, for each of the local Pods specified with containerIDs, the
+	// flows which were installed for the Pod but which cannot be found in OVS. Pods for which no
+	// flows were installed or no flows are missing are not included in the returned map. Each
+	// flow table is dumped at most once, regardless of the number of Pods.
+	GetMissingPodFlows(containerIDs []string) (map[string][]string, error)
 
 	// GetFlowTableStatus should return an array of flow table status, all existing flow tables should be included in the list.
 	GetFlowTableStatus() []binding.TableStatus
@@ -146,11 +165,28 @@ func (c *client) InstallNodeFlows(hostname string, localGatewayMAC net.HardwareA
 		c.l3FwdFlowToRemote(localGatewayMAC, peerPodCIDR, tunnelPeerAddr),
 	}
 
-	return c.addMissingFlows(c.nodeFlowCache, hostname, flows)
+	if err := c.addMissingFlows(c.nodeFlowCache, hostname, flows); err != nil {
+		return err
+	}
+	c.nodeTunnelPeers.Store(hostname, tunnelPeerAddr)
+	return nil
 }
 
 func (c *client) UninstallNodeFlows(hostname string) error {
-	return c.deleteFlows(c.nodeFlowCache, hostname)
+	if err := c.deleteFlows(c.nodeFlowCache, hostname); err != nil {
+		return err
+	}
+	c.nodeTunnelPeers.Delete(hostname)
+	return nil
+}
+
+func (c *client) GetNodeTunnelPeers() map[string]net.IP {
+	peers := make(map[string]net.IP)
+	c.nodeTunnelPeers.Range(func(key, value interface{}) bool {
+		peers[key.(string)] = value.(net.IP)
+		return true
+	})
+	return peers
 }
 
 func (c *client) InstallPodFlows(containerID string, podInterfaceIP net.IP, podInterfaceMAC, gatewayMAC net.HardwareAddr, ofPort uint32) error {
@@ -165,8 +201,56 @@ func (c *client) InstallPodFlows(containerID string, podInterfaceIP net.IP, podI
 	return c.addMissingFlows(c.podFlowCache, containerID, flows)
 }
 
-func (c *client) UninstallPodFlows(containerID string) error {
-	return c.deleteFlows(c.podFlowCache, containerID)
+func (c *client) UninstallPodFlows(containerID string, ofPort uint32) error {
+	if err := c.deleteFlows(c.podFlowCache, containerID); err != nil {
+		return err
+	}
+	if ofPort == 0 {
+		return nil
+	}
+	for _, flow := range c.podInPortFlows(ofPort) {
+		if err := c.flowOperations.Delete(flow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) GetMissingPodFlows(containerIDs []string) (map[string][]string, error) {
+	dumpedTables := map[binding.TableIDType][]string{}
+	missingFlows := map[string][]string{}
+	for _, containerID := range containerIDs {
+		fCacheI, ok := c.podFlowCache.Load(containerID)
+		if !ok {
+			continue
+		}
+		for _, flow := range fCacheI.(flowCache) {
+			tableID := flow.GetTable().GetID()
+			dumpedFlows, ok := dumpedTables[tableID]
+			if !ok {
+				var err error
+				if dumpedFlows, err = c.bridge.DumpFlows(fmt.Sprintf("table=%d", tableID)); err != nil {
+					return nil, err
+				}
+				dumpedTables[tableID] = dumpedFlows
+			}
+			if !flowInDump(dumpedFlows, flow) {
+				missingFlows[containerID] = append(missingFlows[containerID], flow.String())
+			}
+		}
+	}
+	return missingFlows, nil
+}
+
+// flowInDump returns true if flow matches one of the dumped flows.
+func flowInDump(dumpedFlows []string, flow binding.Flow) bool {
+	matchString := flow.MatchString()
+	for _, dumpedFlow := range dumpedFlows {
+		if binding.FlowMatches(dumpedFlow, matchString) {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *client) InstallClusterServiceCIDRFlows(serviceNet *net.IPNet, gatewayOFPort uint32) error {
@@ -188,6 +272,15 @@ func (c *client) InstallGatewayFlows(gatewayAddr net.IP, gatewayMAC net.Hardware
 	return nil
 }
 
+func (c *client) InstallGatewayVirtualMACFlows(gatewayAddr net.IP, gatewayMAC, virtualMAC net.HardwareAddr, gatewayOFPort uint32) error {
+	if err := c.flowOperations.Add(c.arpResponderFlowWithMAC(gatewayAddr, virtualMAC)); err != nil {
+		return err
+	} else if err := c.flowOperations.Add(c.l2ForwardCalcRewriteFlow(virtualMAC, gatewayMAC, gatewayOFPort)); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (c *client) InstallTunnelFlows(tunnelOFPort uint32) error {
 	if err := c.flowOperations.Add(c.tunnelClassifierFlow(tunnelOFPort)); err != nil {
 		return err
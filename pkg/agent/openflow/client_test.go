@@ -17,6 +17,7 @@ package openflow
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"testing"
@@ -26,6 +27,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	oftest "github.com/vmware-tanzu/antrea/pkg/agent/openflow/testing"
+	binding "github.com/vmware-tanzu/antrea/pkg/ovs/openflow"
+	ovsoftest "github.com/vmware-tanzu/antrea/pkg/ovs/openflow/testing"
 )
 
 const bridgeName = "dummy-br"
@@ -71,7 +74,7 @@ func TestIdempotentFlowInstallation(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 			m := oftest.NewMockFlowOperations(ctrl)
-			ofClient := NewClient(bridgeName)
+			ofClient := NewClient(bridgeName, DefaultCTZone)
 			client := ofClient.(*client)
 			client.flowOperations = m
 
@@ -106,7 +109,7 @@ func TestFlowInstallationPartialSuccess(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 			m := oftest.NewMockFlowOperations(ctrl)
-			ofClient := NewClient(bridgeName)
+			ofClient := NewClient(bridgeName, DefaultCTZone)
 			client := ofClient.(*client)
 			client.flowOperations = m
 
@@ -148,7 +151,7 @@ func TestConcurrentFlowInstallation(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 			m := oftest.NewMockFlowOperations(ctrl)
-			ofClient := NewClient(bridgeName)
+			ofClient := NewClient(bridgeName, DefaultCTZone)
 			client := ofClient.(*client)
 			client.flowOperations = m
 
@@ -207,3 +210,76 @@ func TestConcurrentFlowInstallation(t *testing.T) {
 		})
 	}
 }
+
+// TestUninstallPodFlowsOFPort checks that UninstallPodFlows deletes the cached Pod flows, as well as
+// the flows matching the provided ofport as the input port.
+func TestUninstallPodFlowsOFPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := oftest.NewMockFlowOperations(ctrl)
+	ofClient := NewClient(bridgeName, DefaultCTZone)
+	client := ofClient.(*client)
+	client.flowOperations = m
+
+	containerID := "aaaa-bbbb-cccc-dddd"
+	m.EXPECT().Add(gomock.Any()).Return(nil).Times(5)
+	numCached, err := installPodFlows(ofClient, containerID)
+	require.Nil(t, err, "Error when installing Pod flows")
+
+	var deletedMatches []string
+	m.EXPECT().Delete(gomock.Any()).DoAndReturn(func(flow binding.Flow) error {
+		deletedMatches = append(deletedMatches, flow.MatchString())
+		return nil
+	}).Times(numCached + 2)
+	require.Nil(t, ofClient.UninstallPodFlows(containerID, 11), "Error when uninstalling Pod flows")
+	assert.Contains(t, deletedMatches, "table=0,in_port=11")
+	assert.Contains(t, deletedMatches, "table=10,in_port=11")
+	_, found := client.podFlowCache.Load(containerID)
+	assert.False(t, found, "Pod flows should have been removed from the cache")
+}
+
+// TestGetMissingPodFlows checks that GetMissingPodFlows dumps each flow table only once for all the
+// Pods, and reports the flows which are not found in the dumps.
+func TestGetMissingPodFlows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := oftest.NewMockFlowOperations(ctrl)
+	mockBridge := ovsoftest.NewMockBridge(ctrl)
+	ofClient := NewClient(bridgeName, DefaultCTZone)
+	client := ofClient.(*client)
+	client.flowOperations = m
+	client.bridge = mockBridge
+
+	gwMAC, _ := net.ParseMAC("AA:BB:CC:DD:EE:FF")
+	pod1MAC, _ := net.ParseMAC("AA:BB:CC:DD:EE:01")
+	pod2MAC, _ := net.ParseMAC("AA:BB:CC:DD:EE:02")
+	m.EXPECT().Add(gomock.Any()).Return(nil).Times(10)
+	require.Nil(t, ofClient.InstallPodFlows("pod1", net.ParseIP("10.0.0.2"), pod1MAC, gwMAC, 10))
+	require.Nil(t, ofClient.InstallPodFlows("pod2", net.ParseIP("10.0.0.3"), pod2MAC, gwMAC, 11))
+
+	// Only the flows of pod1 are present in OVS.
+	dumps := map[string][]string{}
+	fCacheI, _ := client.podFlowCache.Load("pod1")
+	for _, flow := range fCacheI.(flowCache) {
+		table := fmt.Sprintf("table=%d", flow.GetTable().GetID())
+		dumps[table] = append(dumps[table], "cookie=0x0, "+flow.MatchString()+" actions=drop")
+	}
+	mockBridge.EXPECT().DumpFlows(gomock.Any()).DoAndReturn(func(matchString string) ([]string, error) {
+		return dumps[matchString], nil
+	}).Times(len(dumps))
+
+	missingFlows, err := ofClient.GetMissingPodFlows([]string{"pod1", "pod2", "pod3"})
+	require.Nil(t, err, "Error when retrieving missing Pod flows")
+	assert.NotContains(t, missingFlows, "pod1")
+	assert.Len(t, missingFlows["pod2"], 5)
+	assert.NotContains(t, missingFlows, "pod3", "No flows were installed for pod3")
+}
+
+func TestValidateCTZone(t *testing.T) {
+	for _, zone := range []int{1, int(DefaultCTZone), 0xffff} {
+		assert.NoError(t, ValidateCTZone(zone), "Conntrack zone %d should be valid", zone)
+	}
+	for _, zone := range []int{-1, 0, 0x10000} {
+		assert.Error(t, ValidateCTZone(zone), "Conntrack zone %d should be invalid", zone)
+	}
+}
@@ -83,16 +83,33 @@ const (
 	marksReg     regType = 0
 	portCacheReg regType = 1
 
-	ctZone = 0xfff0
-
 	portFoundMark = 0x1
 	gatewayCTMark = 0x20
 )
 
+const (
+	// DefaultCTZone is the conntrack zone used by default for the connections of Pod traffic.
+	DefaultCTZone uint16 = 0xfff0
+	// minCTZone is the smallest conntrack zone which can be used for Pod traffic. Zone 0 is the
+	// default zone, used by the host network stack and all other consumers of conntrack which
+	// do not specify a zone.
+	minCTZone = 1
+	// maxCTZone is the largest conntrack zone supported by OVS (zones are 16-bit values).
+	maxCTZone = 0xffff
+)
+
 var (
 	globalVirtualMAC, _ = net.ParseMAC("aa:bb:cc:dd:ee:ff")
 )
 
+// ValidateCTZone returns an error if zone cannot be used as the conntrack zone for Pod traffic.
+func ValidateCTZone(zone int) error {
+	if zone < minCTZone || zone > maxCTZone {
+		return fmt.Errorf("conntrack zone %d is not in the valid range [%d, %d]", zone, minCTZone, maxCTZone)
+	}
+	return nil
+}
+
 //go:generate mockgen -copyright_file ../../../hack/boilerplate/license_header.go.txt -package=testing -destination testing/mock_operations.go github.com/vmware-tanzu/antrea/pkg/agent/openflow FlowOperations
 
 type FlowOperations interface {
@@ -112,6 +129,9 @@ type client struct {
 	pipeline                                  map[binding.TableIDType]binding.Table
 	nodeFlowCache, podFlowCache, serviceCache *flowCategoryCache // cache for corresponding deletions
 	flowOperations                            FlowOperations
+	// nodeTunnelPeers is a map from the hostname of a remote Node to the tunnel peer address
+	// used in the flows installed for the Node.
+	nodeTunnelPeers sync.Map
 	// policyCache is a map from PolicyRule ID to policyRuleConjunction. It's guaranteed that one policyRuleConjunction
 	// is processed by at most one goroutine at any given time.
 	policyCache       sync.Map
@@ -119,6 +139,8 @@ type client struct {
 	// globalConjMatchFlowCache is a global map for conjMatchFlowContext. The key is a string generated from the
 	// conjMatchFlowContext.
 	globalConjMatchFlowCache map[string]*conjMatchFlowContext
+	// ctZone is the conntrack zone used for the connections of Pod traffic.
+	ctZone uint16
 }
 
 func (c *client) Add(flow binding.Flow) error {
@@ -181,6 +203,16 @@ func (c *client) podClassifierFlow(podOFPort uint32) binding.Flow {
 		Done()
 }
 
+// podInPortFlows generates the flows matching all the traffic received from the provided Pod
+// ofport, in the tables where Pod flows match on the input port. As flows are deleted with a
+// non-strict match, they can be used to delete all the Pod flows for that ofport.
+func (c *client) podInPortFlows(podOFPort uint32) []binding.Flow {
+	return []binding.Flow{
+		c.pipeline[classifierTable].BuildFlow().MatchInPort(podOFPort).Done(),
+		c.pipeline[spoofGuardTable].BuildFlow().MatchInPort(podOFPort).Done(),
+	}
+}
+
 // connectionTrackFlows generates flows that redirect traffic to ct_zone and handle traffic according to ct_state:
 // 1) commit new connections to ct that sent from non-gateway.
 // 2) Add ct_mark on traffic replied from the host gateway.
@@ -190,7 +222,7 @@ func (c *client) podClassifierFlow(podOFPort uint32) binding.Flow {
 func (c *client) connectionTrackFlows() (flows []binding.Flow) {
 	connectionTrackTable := c.pipeline[conntrackTable]
 	baseConnectionTrackFlow := connectionTrackTable.BuildFlow().MatchProtocol(binding.ProtocolIP).Priority(priorityNormal).
-		Action().CT(false, connectionTrackTable.GetNext(), ctZone).CTDone().
+		Action().CT(false, connectionTrackTable.GetNext(), int(c.ctZone)).CTDone().
 		Done()
 	flows = append(flows, baseConnectionTrackFlow)
 
@@ -206,7 +238,7 @@ func (c *client) connectionTrackFlows() (flows []binding.Flow) {
 	gatewaySendFlow := connectionTrackStateTable.BuildFlow().MatchProtocol(binding.ProtocolIP).Priority(priorityNormal).
 		MatchRegRange(int(marksReg), markTrafficFromGateway, binding.Range{0, 15}).
 		MatchCTState("+new+trk").
-		Action().CT(true, connectionTrackStateTable.GetNext(), ctZone).LoadToMark(gatewayCTMark).MoveToLabel(binding.NxmFieldSrcMAC, &binding.Range{0, 47}, &binding.Range{0, 47}).CTDone().
+		Action().CT(true, connectionTrackStateTable.GetNext(), int(c.ctZone)).LoadToMark(gatewayCTMark).MoveToLabel(binding.NxmFieldSrcMAC, &binding.Range{0, 47}, &binding.Range{0, 47}).CTDone().
 		Done()
 	flows = append(flows, gatewaySendFlow)
 
@@ -220,7 +252,7 @@ func (c *client) connectionTrackFlows() (flows []binding.Flow) {
 
 	nonGatewaySendFlow := connectionTrackStateTable.BuildFlow().MatchProtocol(binding.ProtocolIP).Priority(priorityLow).
 		MatchCTState("+new+trk").
-		Action().CT(true, connectionTrackStateTable.GetNext(), ctZone).CTDone().
+		Action().CT(true, connectionTrackStateTable.GetNext(), int(c.ctZone)).CTDone().
 		Done()
 	flows = append(flows, nonGatewaySendFlow)
 
@@ -244,6 +276,19 @@ func (c *client) l2ForwardCalcFlow(dstMAC net.HardwareAddr, ofPort uint32) bindi
 		Done()
 }
 
+// l2ForwardCalcRewriteFlow generates the flow that matches dstMAC, rewrites the destination MAC
+// address to newDstMAC and sets the output port to ofPort.
+func (c *client) l2ForwardCalcRewriteFlow(dstMAC, newDstMAC net.HardwareAddr, ofPort uint32) binding.Flow {
+	l2FwdCalcTable := c.pipeline[l2ForwardingCalcTable]
+	return l2FwdCalcTable.BuildFlow().Priority(priorityNormal).
+		MatchDstMAC(dstMAC).
+		Action().SetDstMAC(newDstMAC).
+		Action().LoadRegRange(int(portCacheReg), ofPort, ofPortRegRange).
+		Action().LoadRegRange(int(marksReg), portFoundMark, ofPortMarkRange).
+		Action().Resubmit(emptyPlaceholderStr, l2FwdCalcTable.GetNext()).
+		Done()
+}
+
 // l2ForwardOutputFlow generates the flow that outputs packets to OVS port after L2 forwarding calculation.
 func (c *client) l2ForwardOutputFlow() binding.Flow {
 	return c.pipeline[l2ForwardingOutTable].BuildFlow().
@@ -295,17 +340,23 @@ func (c *client) l3FwdFlowToRemote(localGatewayMAC net.HardwareAddr, peerSubnet
 // arpResponderFlow generates the ARP responder flow entry that replies request comes from local gateway for peer
 // gateway MAC.
 func (c *client) arpResponderFlow(peerGatewayIP net.IP) binding.Flow {
+	return c.arpResponderFlowWithMAC(peerGatewayIP, globalVirtualMAC)
+}
+
+// arpResponderFlowWithMAC generates the ARP responder flow entry that replies to ARP requests for
+// ip with the provided MAC address.
+func (c *client) arpResponderFlowWithMAC(ip net.IP, mac net.HardwareAddr) binding.Flow {
 	return c.pipeline[arpResponderTable].BuildFlow().
 		MatchProtocol(binding.ProtocolARP).Priority(priorityNormal).
 		MatchARPOp(1).
-		MatchARPTpa(peerGatewayIP).
+		MatchARPTpa(ip).
 		Action().Move(binding.NxmFieldSrcMAC, binding.NxmFieldDstMAC).
-		Action().SetSrcMAC(globalVirtualMAC).
+		Action().SetSrcMAC(mac).
 		Action().LoadARPOperation(2).
 		Action().Move(binding.NxmFieldARPSha, binding.NxmFieldARPTha).
-		Action().SetARPSha(globalVirtualMAC).
+		Action().SetARPSha(mac).
 		Action().Move(binding.NxmFieldARPSpa, binding.NxmFieldARPTpa).
-		Action().SetARPSpa(peerGatewayIP).
+		Action().SetARPSpa(ip).
 		Action().OutputInPort().
 		Done()
 }
@@ -452,8 +503,9 @@ func (c *client) defaultDropFlow(tableID binding.TableIDType, matchKey int, matc
 		Action().Drop().Done()
 }
 
-// NewClient is the constructor of the Client interface.
-func NewClient(bridgeName string) Client {
+// NewClient is the constructor of the Client interface. ctZone is the conntrack zone used for the
+// connections of Pod traffic, it should have been validated with ValidateCTZone.
+func NewClient(bridgeName string, ctZone uint16) Client {
 	bridge := binding.NewBridge(bridgeName)
 	c := &client{
 		bridge: bridge,
@@ -477,6 +529,7 @@ func NewClient(bridgeName string) Client {
 		serviceCache:             newFlowCategoryCache(),
 		policyCache:              sync.Map{},
 		globalConjMatchFlowCache: map[string]*conjMatchFlowContext{},
+		ctZone:                   ctZone,
 	}
 	c.flowOperations = c
 	return c
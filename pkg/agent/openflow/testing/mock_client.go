@@ -106,6 +106,35 @@ func (mr *MockClientMockRecorder) GetFlowTableStatus() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFlowTableStatus", reflect.TypeOf((*MockClient)(nil).GetFlowTableStatus))
 }
 
+// GetMissingPodFlows mocks base method
+func (m *MockClient) GetMissingPodFlows(arg0 []string) (map[string][]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMissingPodFlows", arg0)
+	ret0, _ := ret[0].(map[string][]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMissingPodFlows indicates an expected call of GetMissingPodFlows
+func (mr *MockClientMockRecorder) GetMissingPodFlows(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMissingPodFlows", reflect.TypeOf((*MockClient)(nil).GetMissingPodFlows), arg0)
+}
+
+// GetNodeTunnelPeers mocks base method
+func (m *MockClient) GetNodeTunnelPeers() map[string]net.IP {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNodeTunnelPeers")
+	ret0, _ := ret[0].(map[string]net.IP)
+	return ret0
+}
+
+// GetNodeTunnelPeers indicates an expected call of GetNodeTunnelPeers
+func (mr *MockClientMockRecorder) GetNodeTunnelPeers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeTunnelPeers", reflect.TypeOf((*MockClient)(nil).GetNodeTunnelPeers))
+}
+
 // Initialize mocks base method
 func (m *MockClient) Initialize() error {
 	m.ctrl.T.Helper()
@@ -148,6 +177,20 @@ func (mr *MockClientMockRecorder) InstallGatewayFlows(arg0, arg1, arg2 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallGatewayFlows", reflect.TypeOf((*MockClient)(nil).InstallGatewayFlows), arg0, arg1, arg2)
 }
 
+// InstallGatewayVirtualMACFlows mocks base method
+func (m *MockClient) InstallGatewayVirtualMACFlows(arg0 net.IP, arg1, arg2 net.HardwareAddr, arg3 uint32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InstallGatewayVirtualMACFlows", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InstallGatewayVirtualMACFlows indicates an expected call of InstallGatewayVirtualMACFlows
+func (mr *MockClientMockRecorder) InstallGatewayVirtualMACFlows(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallGatewayVirtualMACFlows", reflect.TypeOf((*MockClient)(nil).InstallGatewayVirtualMACFlows), arg0, arg1, arg2, arg3)
+}
+
 // InstallNodeFlows mocks base method
 func (m *MockClient) InstallNodeFlows(arg0 string, arg1 net.HardwareAddr, arg2 net.IP, arg3 net.IPNet, arg4 net.IP) error {
 	m.ctrl.T.Helper()
@@ -219,17 +262,17 @@ func (mr *MockClientMockRecorder) UninstallNodeFlows(arg0 interface{}) *gomock.C
 }
 
 // UninstallPodFlows mocks base method
-func (m *MockClient) UninstallPodFlows(arg0 string) error {
+func (m *MockClient) UninstallPodFlows(arg0 string, arg1 uint32) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UninstallPodFlows", arg0)
+	ret := m.ctrl.Call(m, "UninstallPodFlows", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UninstallPodFlows indicates an expected call of UninstallPodFlows
-func (mr *MockClientMockRecorder) UninstallPodFlows(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) UninstallPodFlows(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UninstallPodFlows", reflect.TypeOf((*MockClient)(nil).UninstallPodFlows), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UninstallPodFlows", reflect.TypeOf((*MockClient)(nil).UninstallPodFlows), arg0, arg1)
 }
 
 // UninstallPolicyRuleFlows mocks base method
@@ -0,0 +1,50 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"fmt"
+	"net"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/vmware-tanzu/antrea/pkg/agent"
+	"github.com/vmware-tanzu/antrea/pkg/agent/util"
+)
+
+// NodeConfigForNode builds a NodeConfig for the Node with the provided name, using the PodCIDR of
+// the Node. The gateway is assigned the first usable IP of the PodCIDR, like it is done by
+// antrea-agent, as well as the provided name and MAC address.
+func NodeConfigForNode(client clientset.Interface, nodeName string, bridge string, gatewayName string, gatewayMAC net.HardwareAddr) (*agent.NodeConfig, error) {
+	node, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Node %s: %v", nodeName, err)
+	}
+	if node.Spec.PodCIDR == "" {
+		return nil, fmt.Errorf("PodCIDR is empty for Node %s", nodeName)
+	}
+	_, podCIDR, err := net.ParseCIDR(node.Spec.PodCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PodCIDR %s for Node %s: %v", node.Spec.PodCIDR, nodeName, err)
+	}
+	gateway := &agent.Gateway{Name: gatewayName, MAC: gatewayMAC}
+	if gwIP := util.GetGatewayIPForPodCIDR(podCIDR); gwIP.To4() != nil {
+		gateway.IPv4 = gwIP
+	} else {
+		gateway.IPv6 = gwIP
+	}
+	return &agent.NodeConfig{Bridge: bridge, Name: nodeName, PodCIDR: podCIDR, Gateway: gateway}, nil
+}
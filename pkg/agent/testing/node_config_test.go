@@ -0,0 +1,55 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeConfigForNode(t *testing.T) {
+	gwMAC, _ := net.ParseMAC("11:11:11:11:11:11")
+	client := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: corev1.NodeSpec{PodCIDR: "10.10.1.0/24"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: corev1.NodeSpec{PodCIDR: "fd00:10:10:1::/64"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+	)
+
+	nodeConfig, err := NodeConfigForNode(client, "node1", "br-int", "gw0", gwMAC)
+	require.Nil(t, err)
+	assert.Equal(t, "node1", nodeConfig.Name)
+	assert.Equal(t, "br-int", nodeConfig.Bridge)
+	assert.Equal(t, "10.10.1.0/24", nodeConfig.PodCIDR.String())
+	assert.True(t, net.ParseIP("10.10.1.1").Equal(nodeConfig.Gateway.IPv4))
+	assert.Nil(t, nodeConfig.Gateway.IPv6)
+	assert.Equal(t, "gw0", nodeConfig.Gateway.Name)
+	assert.Equal(t, gwMAC, nodeConfig.Gateway.MAC)
+
+	nodeConfig, err = NodeConfigForNode(client, "node2", "br-int", "gw0", gwMAC)
+	require.Nil(t, err)
+	assert.Nil(t, nodeConfig.Gateway.IPv4)
+	assert.True(t, net.ParseIP("fd00:10:10:1::1").Equal(nodeConfig.Gateway.IPv6))
+
+	_, err = NodeConfigForNode(client, "node3", "br-int", "gw0", gwMAC)
+	assert.NotNil(t, err, "Expected error for Node without PodCIDR")
+	_, err = NodeConfigForNode(client, "node4", "br-int", "gw0", gwMAC)
+	assert.NotNil(t, err, "Expected error for non-existent Node")
+}
@@ -19,7 +19,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"strings"
+
+	"github.com/containernetworking/plugins/pkg/ip"
 )
 
 const (
@@ -28,19 +31,68 @@ const (
 	containerKeyConnector = `-`
 )
 
+// MaxContainerInterfacePrefixLength is the maximum length of the prefix which can be provided to
+// GenerateContainerInterfaceNameWithPrefix, so that the generated name still includes enough
+// characters from the hash to make collisions unlikely.
+const MaxContainerInterfacePrefixLength = podNamePrefixLength
+
 // Calculates a suitable interface name using the pod namespace and pod name. The output should be
 // deterministic (so that multiple calls to GenerateContainerInterfaceName with the same parameters
 // return the same value). The output should have length interfaceNameLength (15). The probability of
 // collision should be neglectable.
 func GenerateContainerInterfaceName(podName string, podNamespace string) string {
+	return GenerateContainerInterfaceNameWithPrefix("", podName, podNamespace)
+}
+
+// PortNameForPod returns the name of the OVS port created for the Pod with the provided name and
+// namespace, which is also the name of the host interface of the Pod, when antrea-agent uses the
+// default naming scheme (no containerInterfacePrefix and no hashed names). Tests should use it
+// rather than computing the name themselves, so that they agree with antrea-agent.
+func PortNameForPod(podName string, podNamespace string) string {
+	return GenerateContainerInterfaceName(podName, podNamespace)
+}
+
+// GenerateContainerInterfaceNameWithPrefix is like GenerateContainerInterfaceName, but the
+// generated name starts with the provided prefix, which takes the place of the first characters of
+// the pod name. The prefix should not be longer than MaxContainerInterfacePrefixLength.
+func GenerateContainerInterfaceNameWithPrefix(prefix string, podName string, podNamespace string) string {
 	hash := sha1.New()
 	podID := fmt.Sprintf("%s/%s", podNamespace, podName)
 	io.WriteString(hash, podID)
 	podKey := hex.EncodeToString(hash.Sum(nil))
-	name := strings.Replace(podName, "-", "", -1)
+	name := prefix + strings.Replace(podName, "-", "", -1)
 	if len(name) > podNamePrefixLength {
 		name = name[:podNamePrefixLength]
 	}
 	podKeyLength := interfaceNameLength - len(name) - len(containerKeyConnector)
 	return strings.Join([]string{name, podKey[:podKeyLength]}, containerKeyConnector)
 }
+
+// DefaultHashedContainerInterfacePrefix is the prefix of the names generated by
+// GenerateHashedContainerInterfaceName when no prefix is provided.
+const DefaultHashedContainerInterfacePrefix = "antrea"
+
+// GenerateHashedContainerInterfaceName calculates an interface name which does not include any part
+// of the Pod name: it consists of the provided prefix (DefaultHashedContainerInterfacePrefix if
+// empty) followed by a hash of the Pod namespace, Pod name and container ID, e.g. "antrea-1a2b3c4d".
+// Unlike GenerateContainerInterfaceName, the whole name is therefore derived from the hash, which
+// makes collisions unlikely even for Pods with long names sharing a common prefix. The output has
+// length interfaceNameLength (15), so it is always a valid interface name. The prefix should not be
+// longer than MaxContainerInterfacePrefixLength.
+func GenerateHashedContainerInterfaceName(prefix string, podName string, podNamespace string, containerID string) string {
+	if prefix == "" {
+		prefix = DefaultHashedContainerInterfacePrefix
+	}
+	hash := sha1.New()
+	io.WriteString(hash, fmt.Sprintf("%s/%s/%s", podNamespace, podName, containerID))
+	key := hex.EncodeToString(hash.Sum(nil))
+	keyLength := interfaceNameLength - len(prefix) - len(containerKeyConnector)
+	return strings.Join([]string{prefix, key[:keyLength]}, containerKeyConnector)
+}
+
+// GetGatewayIPForPodCIDR returns the IP address assigned to the host gateway interface for the
+// provided Pod subnet, which is the first usable address of the subnet.
+func GetGatewayIPForPodCIDR(podCIDR *net.IPNet) net.IP {
+	subnetID := podCIDR.IP.Mask(podCIDR.Mask)
+	return ip.NextIP(subnetID)
+}
@@ -44,3 +44,93 @@ func TestGenerateContainerInterfaceName(t *testing.T) {
 		t.Errorf("failed to differentiate interfaces with pods has the same prefix")
 	}
 }
+
+func TestPortNameForPod(t *testing.T) {
+	podNamespace := "namespace1"
+	for _, tc := range []struct {
+		podName        string
+		expectedPrefix string
+	}{
+		{"pod0", "pod0-"},
+		{"nginx-6db489d4b7-2xkqz", "nginx6db-"},
+		{strings.Repeat("a", 253), "aaaaaaaa-"},
+		{"web.v1", "web.v1-"},
+		{"a", "a-"},
+		{"0-1-2-3-4-5-6-7-8-9", "01234567-"},
+	} {
+		portName := PortNameForPod(tc.podName, podNamespace)
+		if len(portName) != interfaceNameLength {
+			t.Errorf("Port name %s for Pod %s does not have length %d", portName, tc.podName, interfaceNameLength)
+		}
+		if !strings.HasPrefix(portName, tc.expectedPrefix) {
+			t.Errorf("Port name %s for Pod %s does not start with %s", portName, tc.podName, tc.expectedPrefix)
+		}
+		if strings.ContainsAny(portName, "/ \t\n") {
+			t.Errorf("Port name %q for Pod %s is not a valid interface name", portName, tc.podName)
+		}
+		if portName != PortNameForPod(tc.podName, podNamespace) {
+			t.Errorf("Port name for Pod %s is not deterministic", tc.podName)
+		}
+		if portName != GenerateContainerInterfaceName(tc.podName, podNamespace) {
+			t.Errorf("Port name for Pod %s does not match the host interface name", tc.podName)
+		}
+		if portName == PortNameForPod(tc.podName, "namespace2") {
+			t.Errorf("failed to differentiate ports of Pods with the same name in different Namespaces")
+		}
+	}
+}
+
+func TestGenerateHashedContainerInterfaceName(t *testing.T) {
+	podName := "pod1-abcde-12345"
+	containerID := "1a2b3c4d5e6f"
+	iface1 := GenerateHashedContainerInterfaceName("", podName, "namespace1", containerID)
+	iface2 := GenerateHashedContainerInterfaceName("", podName, "namespace2", containerID)
+	for _, iface := range []string{iface1, iface2} {
+		if len(iface) != interfaceNameLength {
+			t.Errorf("Failed to ensure length of interface name %s as %d", iface, interfaceNameLength)
+		}
+		if !strings.HasPrefix(iface, DefaultHashedContainerInterfacePrefix+"-") {
+			t.Errorf("failed to use default prefix: %s", iface)
+		}
+		if strings.ContainsAny(iface, "/ \t\n") {
+			t.Errorf("generated interface name %q is not valid", iface)
+		}
+	}
+	if iface1 == iface2 {
+		t.Errorf("failed to differentiate interfaces of Pods with the same name in different Namespaces")
+	}
+	if iface1 != GenerateHashedContainerInterfaceName("", podName, "namespace1", containerID) {
+		t.Errorf("generated interface name is not deterministic")
+	}
+	if iface1 == GenerateHashedContainerInterfaceName("", podName, "namespace1", "6f5e4d3c2b1a") {
+		t.Errorf("failed to differentiate interfaces of different containers for the same Pod")
+	}
+	longPrefix := strings.Repeat("a", MaxContainerInterfacePrefixLength)
+	iface := GenerateHashedContainerInterfaceName(longPrefix, podName, "namespace1", containerID)
+	if len(iface) != interfaceNameLength || !strings.HasPrefix(iface, longPrefix+"-") {
+		t.Errorf("failed to generate a valid interface name with the maximum prefix length: %s", iface)
+	}
+}
+
+func TestGenerateContainerInterfaceNameWithPrefix(t *testing.T) {
+	podNamespace := "namespace1"
+	podName := "pod1-abcde-12345"
+	iface := GenerateContainerInterfaceNameWithPrefix("ant", podName, podNamespace)
+	if len(iface) != interfaceNameLength {
+		t.Errorf("Failed to ensure length of interface name %s as %d", iface, interfaceNameLength)
+	}
+	if !strings.HasPrefix(iface, "antpod1a-") {
+		t.Errorf("failed to use prefix and first valid characters of podName: %s", iface)
+	}
+	if iface == GenerateContainerInterfaceName(podName, podNamespace) {
+		t.Errorf("failed to differentiate interfaces generated with different prefixes")
+	}
+	if GenerateContainerInterfaceNameWithPrefix("", podName, podNamespace) != GenerateContainerInterfaceName(podName, podNamespace) {
+		t.Errorf("an empty prefix should not change the generated interface name")
+	}
+	longPrefix := strings.Repeat("a", MaxContainerInterfacePrefixLength)
+	iface = GenerateContainerInterfaceNameWithPrefix(longPrefix, podName, podNamespace)
+	if len(iface) != interfaceNameLength || !strings.HasPrefix(iface, longPrefix+"-") {
+		t.Errorf("failed to generate a valid interface name with the maximum prefix length: %s", iface)
+	}
+}
@@ -39,6 +39,7 @@ type OVSInfo struct {
 	Version    string           `json:"version,omitempty"`
 	BridgeName string           `json:"bridgeName,omitempty"`
 	FlowTable  map[string]int32 `json:"flowTable,omitempty"` // Key: flow table name, Value: flow number
+	FlowCount  int32            `json:"flowCount,omitempty"` // Total number of flows installed on the bridge, as reported by OVS
 }
 
 type AgentConditionType string
@@ -168,7 +168,7 @@ func (monitor *agentMonitor) createAgentCRD() (*v1beta1.AntreaAgentInfo, error)
 		PodRef:      monitor.GetSelfPod(),
 		NodeRef:     monitor.GetSelfNode(),
 		NodeSubnet:  []string{monitor.nodeSubnet},
-		OVSInfo:     v1beta1.OVSInfo{BridgeName: monitor.ovsBridge, FlowTable: monitor.GetOVSFlowTable()},
+		OVSInfo:     v1beta1.OVSInfo{BridgeName: monitor.ovsBridge, FlowTable: monitor.GetOVSFlowTable(), FlowCount: monitor.GetOVSFlowCount()},
 		LocalPodNum: monitor.GetLocalPodNum(),
 		AgentConditions: []v1beta1.AgentCondition{
 			{
@@ -183,9 +183,10 @@ func (monitor *agentMonitor) createAgentCRD() (*v1beta1.AntreaAgentInfo, error)
 }
 
 func (monitor *agentMonitor) updateAgentCRD(agentCRD *v1beta1.AntreaAgentInfo) (*v1beta1.AntreaAgentInfo, error) {
-	// LocalPodNum and FlowTable can be changed, so reset these fields.
+	// LocalPodNum, FlowTable and FlowCount can be changed, so reset these fields.
 	agentCRD.LocalPodNum = monitor.GetLocalPodNum()
 	agentCRD.OVSInfo.FlowTable = monitor.GetOVSFlowTable()
+	agentCRD.OVSInfo.FlowCount = monitor.GetOVSFlowCount()
 	agentCRD.AgentConditions = []v1beta1.AgentCondition{
 		{
 			Type:              v1beta1.AgentHealthy,
@@ -19,6 +19,9 @@ import (
 	"strconv"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/vmware-tanzu/antrea/pkg/ovs/openflow"
 )
 
 const (
@@ -37,6 +40,7 @@ type Querier interface {
 type AgentQuerier interface {
 	Querier
 	GetOVSFlowTable() map[string]int32
+	GetOVSFlowCount() int32
 	GetLocalPodNum() int32
 }
 
@@ -68,6 +72,17 @@ func (monitor *agentMonitor) GetOVSFlowTable() map[string]int32 {
 	return flowTable
 }
 
+// GetOVSFlowCount gets the total number of flows installed on the OVS bridge, as reported by OVS.
+// -1 is returned if the flow count cannot be retrieved.
+func (monitor *agentMonitor) GetOVSFlowCount() int32 {
+	count, err := openflow.GetFlowCount(monitor.ovsBridge)
+	if err != nil {
+		klog.Errorf("Failed to get flow count for OVS bridge %s: %v", monitor.ovsBridge, err)
+		return -1
+	}
+	return int32(count)
+}
+
 // GetLocalPodNum gets the number of Pod which the Agent is in charge of.
 func (monitor *agentMonitor) GetLocalPodNum() int32 {
 	return int32(monitor.interfaceStore.GetContainerInterfaceNum())
@@ -17,6 +17,8 @@ package openflow
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -80,3 +82,152 @@ func (b *commandBridge) Connect(maxRetry int) error {
 func (b *commandBridge) Disconnect() error {
 	return nil
 }
+
+// DumpFlows executes command "ovs-ofctl dump-flows" to retrieve the flows matching matchString from
+// the OFSwitch. The reply header is removed from the output, and each returned string is one flow.
+func (b *commandBridge) DumpFlows(matchString string) ([]string, error) {
+	args := []string{"dump-flows", b.name, "-O" + Version13}
+	if matchString != "" {
+		args = append(args, matchString)
+	}
+	output, err := executor("ovs-ofctl", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump flows %q: %v (%q)", matchString, err, output)
+	}
+	var flows []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "OFPST_FLOW") {
+			continue
+		}
+		flows = append(flows, line)
+	}
+	return flows, nil
+}
+
+// FlowMatches returns true if dumpedFlow, a flow as returned by DumpFlows, contains all the match
+// fields in matchString (as returned by Flow.MatchString). Like a non-strict "ovs-ofctl dump-flows",
+// it ignores the priority and accepts flows with additional match fields. This can be used to check
+// a set of flows against a single dump instead of running one command per flow.
+func FlowMatches(dumpedFlow, matchString string) bool {
+	if i := strings.Index(dumpedFlow, " actions="); i >= 0 {
+		dumpedFlow = dumpedFlow[:i]
+	}
+	fields := map[string]bool{}
+	for _, field := range strings.Split(strings.Replace(dumpedFlow, ", ", ",", -1), ",") {
+		fields[strings.TrimSpace(field)] = true
+	}
+	for _, matcher := range strings.Split(matchString, ",") {
+		if !fields[normalizeMatcher(matcher)] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeMatcher converts a range matcher such as "reg0[0..15]=0x1" to the value/mask format
+// used by OVS when dumping flows. Other matchers are returned unchanged.
+func normalizeMatcher(matcher string) string {
+	start := strings.Index(matcher, "[")
+	end := strings.Index(matcher, "]=")
+	if start < 0 || end < start {
+		return matcher
+	}
+	bounds := strings.Split(matcher[start+1:end], "..")
+	if len(bounds) != 2 {
+		return matcher
+	}
+	lo, err1 := strconv.ParseUint(bounds[0], 10, 32)
+	hi, err2 := strconv.ParseUint(bounds[1], 10, 32)
+	value, err3 := strconv.ParseUint(matcher[end+2:], 0, 64)
+	if err1 != nil || err2 != nil || err3 != nil || hi < lo || hi > 63 {
+		return matcher
+	}
+	name := matcher[:start]
+	if lo == 0 && hi == 31 {
+		return fmt.Sprintf("%s=0x%x", name, value)
+	}
+	mask := (uint64(1)<<(hi-lo+1) - 1) << lo
+	return fmt.Sprintf("%s=0x%x/0x%x", name, value<<lo, mask)
+}
+
+// GetFlowCount executes command "ovs-ofctl dump-aggregate" to retrieve the total number of flows
+// installed in all the tables of the provided bridge.
+func GetFlowCount(bridge string) (int, error) {
+	output, err := executor("ovs-ofctl", "dump-aggregate", bridge, "-O"+Version13).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("failed to dump aggregate flow statistics for bridge %s: %v (%q)", bridge, err, output)
+	}
+	return parseFlowCount(string(output))
+}
+
+// GetDatapathFlows executes command "ovs-appctl dpif/dump-flows" to retrieve the datapath flows of
+// the provided bridge, which reflect the actual forwarding decisions made by the datapath for the
+// recent traffic. Each returned string is one flow.
+func GetDatapathFlows(bridge string) ([]string, error) {
+	output, err := executor("ovs-appctl", "dpif/dump-flows", bridge).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump datapath flows for bridge %s: %v (%q)", bridge, err, output)
+	}
+	return ParseDatapathFlows(string(output)), nil
+}
+
+// ParseDatapathFlows extracts the flows from the output of "ovs-appctl dpif/dump-flows" or
+// "ovs-appctl dpctl/dump-flows", e.g. "recirc_id(0),in_port(2),eth_type(0x0800),ipv4(frag=no),
+// packets:10, bytes:980, used:0.5s, actions:3". The headers printed by the userspace datapath
+// (e.g. "flow-dump from pmd on cpu core: 0") are removed.
+func ParseDatapathFlows(output string) []string {
+	var flows []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "flow-dump from") {
+			continue
+		}
+		flows = append(flows, line)
+	}
+	return flows
+}
+
+// TracePacket executes command "ovs-appctl ofproto/trace" to trace a packet matching flowSpec (e.g.
+// "in_port=gw0,ip,nw_dst=10.10.1.2") through the flow tables of the provided bridge, without sending
+// it. The full trace output is returned, which shows the flows matched in each table and the
+// resulting datapath actions.
+func TracePacket(bridge, flowSpec string) (string, error) {
+	output, err := executor("ovs-appctl", "ofproto/trace", bridge, flowSpec).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to trace packet %q on bridge %s: %v (%q)", flowSpec, bridge, err, output)
+	}
+	return string(output), nil
+}
+
+// ParseTraceDatapathActions extracts the datapath actions from the output of "ovs-appctl
+// ofproto/trace", i.e. the last line of the output, e.g. "Datapath actions: 3" or "Datapath
+// actions: drop". The actions are returned without the prefix.
+func ParseTraceDatapathActions(output string) (string, error) {
+	const datapathActionsPrefix = "Datapath actions:"
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, datapathActionsPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, datapathActionsPrefix)), nil
+		}
+	}
+	return "", fmt.Errorf("datapath actions not found in trace output %q", output)
+}
+
+// parseFlowCount extracts the flow_count field from the output of "ovs-ofctl dump-aggregate", e.g.
+// "OFPST_AGGREGATE reply (OF1.3) (xid=0x2): packet_count=20 byte_count=1764 flow_count=42".
+func parseFlowCount(output string) (int, error) {
+	const flowCountKey = "flow_count="
+	for _, field := range strings.Fields(output) {
+		if !strings.HasPrefix(field, flowCountKey) {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimPrefix(field, flowCountKey))
+		if err != nil {
+			return 0, fmt.Errorf("invalid flow count in %q: %v", output, err)
+		}
+		return count, nil
+	}
+	return 0, fmt.Errorf("flow count not found in %q", output)
+}
@@ -15,6 +15,8 @@
 package openflow
 
 import (
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"strings"
 	"testing"
@@ -51,3 +53,259 @@ func TestBasic(t *testing.T) {
 		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
 	}
 }
+
+func TestDumpFlows(t *testing.T) {
+	dummyBridge := NewBridge("ut0")
+	dumpOutput := "OFPST_FLOW reply (OF1.3) (xid=0x2):\n" +
+		" cookie=0x0, duration=1.0s, table=0, n_packets=0, n_bytes=0, priority=190,in_port=3 actions=resubmit(,10)\n"
+
+	var executedCommand string
+	executor = func(name string, args ...string) *exec.Cmd {
+		executedCommand = name + " " + strings.Join(args, " ")
+		return exec.Command("printf", dumpOutput)
+	}
+	defer func() { executor = exec.Command }()
+
+	flows, err := dummyBridge.DumpFlows("table=0,in_port=3")
+	if err != nil {
+		t.Fatalf("Failed to dump flows: %v", err)
+	}
+	expectedCommand := "ovs-ofctl dump-flows ut0 -OOpenflow13 table=0,in_port=3"
+	if executedCommand != expectedCommand {
+		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
+	}
+	if len(flows) != 1 || !strings.Contains(flows[0], "in_port=3 actions=resubmit(,10)") {
+		t.Fatalf("Unexpected flows in dump: %v", flows)
+	}
+}
+
+func TestFlowMatches(t *testing.T) {
+	dumpedFlow := "cookie=0x0, duration=1.0s, table=10, n_packets=0, n_bytes=0, priority=200,ip,reg0=0x1/0xffff,in_port=3,dl_src=aa:bb:cc:dd:ee:ee,nw_src=10.0.0.2 actions=resubmit(,20)"
+	testCases := []struct {
+		matchString string
+		expected    bool
+	}{
+		{"table=10,ip,in_port=3,dl_src=aa:bb:cc:dd:ee:ee,nw_src=10.0.0.2", true},
+		{"table=10,in_port=3", true},
+		{"table=10,reg0[0..15]=0x1", true},
+		{"table=10,ip,in_port=4", false},
+		{"table=10,arp,in_port=3", false},
+		{"table=20,in_port=3", false},
+		{"table=10,reg0[0..15]=0x2", false},
+		// Actions must not be matched.
+		{"table=10,resubmit(,20)", false},
+	}
+	for _, tc := range testCases {
+		if matches := FlowMatches(dumpedFlow, tc.matchString); matches != tc.expected {
+			t.Errorf("Expected FlowMatches to return %t for %q, got %t", tc.expected, tc.matchString, matches)
+		}
+	}
+}
+
+func TestGetFlowCount(t *testing.T) {
+	dumpOutput := "OFPST_AGGREGATE reply (OF1.3) (xid=0x2): packet_count=20 byte_count=1764 flow_count=42\n"
+
+	var executedCommand string
+	executor = func(name string, args ...string) *exec.Cmd {
+		executedCommand = name + " " + strings.Join(args, " ")
+		return exec.Command("printf", dumpOutput)
+	}
+	defer func() { executor = exec.Command }()
+
+	count, err := GetFlowCount("ut0")
+	if err != nil {
+		t.Fatalf("Failed to get flow count: %v", err)
+	}
+	expectedCommand := "ovs-ofctl dump-aggregate ut0 -OOpenflow13"
+	if executedCommand != expectedCommand {
+		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
+	}
+	if count != 42 {
+		t.Fatalf("Expected flow count 42, got %d", count)
+	}
+}
+
+func TestParseFlowCount(t *testing.T) {
+	tests := []struct {
+		output        string
+		expectedCount int
+		expectedErr   bool
+	}{
+		{"NXST_AGGREGATE reply (xid=0x4): packet_count=0 byte_count=0 flow_count=7", 7, false},
+		{"OFPST_AGGREGATE reply (OF1.3) (xid=0x2): packet_count=20 byte_count=1764 flow_count=0\n", 0, false},
+		{"OFPST_AGGREGATE reply (OF1.3) (xid=0x2): packet_count=20 byte_count=1764", 0, true},
+		{"OFPST_AGGREGATE reply (OF1.3) (xid=0x2): flow_count=abc", 0, true},
+	}
+	for _, tc := range tests {
+		count, err := parseFlowCount(tc.output)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("Expected error when parsing <%s>", tc.output)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse <%s>: %v", tc.output, err)
+		} else if count != tc.expectedCount {
+			t.Errorf("Expected flow count %d for <%s>, got %d", tc.expectedCount, tc.output, count)
+		}
+	}
+}
+
+func TestGetDatapathFlows(t *testing.T) {
+	dumpOutput := `flow-dump from pmd on cpu core: 0
+recirc_id(0),in_port(2),eth(src=aa:bb:cc:dd:ee:01,dst=aa:bb:cc:dd:ee:ff),eth_type(0x0800),ipv4(dst=10.10.1.0/255.255.255.0,frag=no), packets:10, bytes:980, used:0.512s, actions:set(tunnel(dst=192.168.1.2,ttl=64,flags(df|key))),3
+recirc_id(0),in_port(3),eth_type(0x0806), packets:1, bytes:42, used:never, actions:2
+
+`
+
+	var executedCommand string
+	executor = func(name string, args ...string) *exec.Cmd {
+		executedCommand = name + " " + strings.Join(args, " ")
+		return exec.Command("printf", "%s", dumpOutput)
+	}
+	defer func() { executor = exec.Command }()
+
+	flows, err := GetDatapathFlows("ut0")
+	if err != nil {
+		t.Fatalf("Failed to get datapath flows: %v", err)
+	}
+	expectedCommand := "ovs-appctl dpif/dump-flows ut0"
+	if executedCommand != expectedCommand {
+		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("Expected 2 datapath flows, got %v", flows)
+	}
+	if !strings.HasPrefix(flows[0], "recirc_id(0),in_port(2)") || !strings.HasSuffix(flows[0], "actions:set(tunnel(dst=192.168.1.2,ttl=64,flags(df|key))),3") {
+		t.Errorf("Unexpected first datapath flow: %s", flows[0])
+	}
+	if flows[1] != "recirc_id(0),in_port(3),eth_type(0x0806), packets:1, bytes:42, used:never, actions:2" {
+		t.Errorf("Unexpected second datapath flow: %s", flows[1])
+	}
+}
+
+func TestTracePacket(t *testing.T) {
+	traceOutput := `Flow: ip,in_port=2,vlan_tci=0x0000,dl_src=00:00:00:00:00:00,dl_dst=00:00:00:00:00:00,nw_src=0.0.0.0,nw_dst=10.10.1.2,nw_proto=0,nw_tos=0,nw_ecn=0,nw_ttl=0
+
+bridge("ut0")
+-------------
+ 0. ip,in_port=2, priority 200, cookie 0x0
+    goto_table:10
+10. priority 0, cookie 0x0
+    goto_table:70
+70. ip,nw_dst=10.10.1.2, priority 200, cookie 0x0
+    output:3
+
+Final flow: unchanged
+Megaflow: recirc_id=0,eth,ip,in_port=2,nw_dst=10.10.1.2,nw_frag=no
+Datapath actions: 3
+`
+
+	var executedCommand string
+	executor = func(name string, args ...string) *exec.Cmd {
+		executedCommand = name + " " + strings.Join(args, " ")
+		return exec.Command("printf", "%s", traceOutput)
+	}
+	defer func() { executor = exec.Command }()
+
+	output, err := TracePacket("ut0", "in_port=2,ip,nw_dst=10.10.1.2")
+	if err != nil {
+		t.Fatalf("Failed to trace packet: %v", err)
+	}
+	expectedCommand := "ovs-appctl ofproto/trace ut0 in_port=2,ip,nw_dst=10.10.1.2"
+	if executedCommand != expectedCommand {
+		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
+	}
+	if output != traceOutput {
+		t.Errorf("Unexpected trace output: %s", output)
+	}
+	actions, err := ParseTraceDatapathActions(output)
+	if err != nil {
+		t.Fatalf("Failed to parse datapath actions: %v", err)
+	}
+	if actions != "3" {
+		t.Errorf("Expected datapath actions <3>, got <%s>", actions)
+	}
+}
+
+func TestParseTraceDatapathActions(t *testing.T) {
+	for _, tc := range []struct {
+		output          string
+		expectedActions string
+		expectedErr     bool
+	}{
+		{"Final flow: unchanged\nDatapath actions: drop\n", "drop", false},
+		{"Datapath actions: set(tunnel(dst=192.168.1.2,ttl=64,flags(df|key))),4", "set(tunnel(dst=192.168.1.2,ttl=64,flags(df|key))),4", false},
+		{"ovs-appctl: br0: unknown bridge", "", true},
+		{"", "", true},
+	} {
+		actions, err := ParseTraceDatapathActions(tc.output)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("Expected error when parsing <%s>", tc.output)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when parsing <%s>: %v", tc.output, err)
+		} else if actions != tc.expectedActions {
+			t.Errorf("Expected datapath actions <%s> for <%s>, got <%s>", tc.expectedActions, tc.output, actions)
+		}
+	}
+}
+
+func TestApplyFlowBundle(t *testing.T) {
+	flowMods := []FlowMod{
+		{FlowModAdd, "table=0,priority=200,in_port=2,actions=resubmit(,10)"},
+		{FlowModModify, "table=10,priority=200,ip,in_port=3,actions=resubmit(,30)"},
+		{FlowModDelete, "table=70,ip,nw_dst=10.10.1.2"},
+	}
+	expectedBundle := "add table=0,priority=200,in_port=2,actions=resubmit(,10)\n" +
+		"modify table=10,priority=200,ip,in_port=3,actions=resubmit(,30)\n" +
+		"delete table=70,ip,nw_dst=10.10.1.2\n"
+
+	bundleFile, err := ioutil.TempFile("", "bundle")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	bundleFile.Close()
+	defer os.Remove(bundleFile.Name())
+
+	var executedCommand string
+	executor = func(name string, args ...string) *exec.Cmd {
+		executedCommand = name + " " + strings.Join(args, " ")
+		// The bundle is provided on stdin, save it to check its content.
+		return exec.Command("sh", "-c", "cat > "+bundleFile.Name())
+	}
+	defer func() { executor = exec.Command }()
+
+	if err := ApplyFlowBundle("ut0", flowMods); err != nil {
+		t.Fatalf("Failed to apply bundle: %v", err)
+	}
+	expectedCommand := "ovs-ofctl --bundle add-flows ut0 -OOpenflow14 -"
+	if executedCommand != expectedCommand {
+		t.Fatalf("Expected running <%s>, got <%s>", expectedCommand, executedCommand)
+	}
+	bundle, err := ioutil.ReadFile(bundleFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	if string(bundle) != expectedBundle {
+		t.Errorf("Expected bundle <%s>, got <%s>", expectedBundle, string(bundle))
+	}
+
+	executor = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("false")
+	}
+	if err := ApplyFlowBundle("ut0", flowMods); err == nil {
+		t.Errorf("Expected error when the bundle fails")
+	}
+
+	if _, err := formatFlowBundle([]FlowMod{{"replace", "table=0,actions=drop"}}); err == nil {
+		t.Errorf("Expected error for unknown flow modification type")
+	}
+	if _, err := formatFlowBundle([]FlowMod{{FlowModAdd, "table=0,actions=drop\nadd table=1,actions=drop"}}); err == nil {
+		t.Errorf("Expected error for flow with a newline")
+	}
+}
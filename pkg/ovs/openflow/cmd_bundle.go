@@ -0,0 +1,75 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openflow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FlowModType is the type of a flow modification in an OpenFlow bundle, using the keywords
+// understood by "ovs-ofctl add-flows".
+type FlowModType string
+
+const (
+	FlowModAdd    FlowModType = "add"
+	FlowModModify FlowModType = "modify"
+	FlowModDelete FlowModType = "delete"
+)
+
+// FlowMod is a flow modification in an OpenFlow bundle. Flow is the flow in the format accepted by
+// ovs-ofctl, e.g. "table=0,priority=200,in_port=2,actions=resubmit(,10)". For deletions, it is a
+// match: the actions are omitted.
+type FlowMod struct {
+	Type FlowModType
+	Flow string
+}
+
+// ApplyFlowBundle executes command "ovs-ofctl --bundle add-flows" to apply all the provided flow
+// modifications to the bridge atomically: if any of them fails, none of them is applied and an
+// error is returned. Bundles require OpenFlow 1.4, which must be enabled on the bridge.
+func ApplyFlowBundle(bridge string, flowMods []FlowMod) error {
+	if len(flowMods) == 0 {
+		return nil
+	}
+	bundle, err := formatFlowBundle(flowMods)
+	if err != nil {
+		return err
+	}
+	cmd := executor("ovs-ofctl", "--bundle", "add-flows", bridge, "-O"+Version14, "-")
+	cmd.Stdin = strings.NewReader(bundle)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply bundle of %d flow modifications on bridge %s: %v (%q)", len(flowMods), bridge, err, output)
+	}
+	return nil
+}
+
+// formatFlowBundle returns the content of the file read by "ovs-ofctl add-flows" for the provided
+// flow modifications, with one modification per line.
+func formatFlowBundle(flowMods []FlowMod) (string, error) {
+	var b strings.Builder
+	for _, flowMod := range flowMods {
+		switch flowMod.Type {
+		case FlowModAdd, FlowModModify, FlowModDelete:
+		default:
+			return "", fmt.Errorf("unknown flow modification type %q", flowMod.Type)
+		}
+		if flowMod.Flow == "" || strings.ContainsAny(flowMod.Flow, "\n\r") {
+			return "", fmt.Errorf("invalid flow %q", flowMod.Flow)
+		}
+		fmt.Fprintf(&b, "%s %s\n", flowMod.Type, flowMod.Flow)
+	}
+	return b.String(), nil
+}
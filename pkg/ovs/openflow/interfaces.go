@@ -33,6 +33,8 @@ type Range [2]uint32
 
 const (
 	Version13 versionType = "Openflow13"
+	// Version14 is required for OpenFlow bundles (see ApplyFlowBundle).
+	Version14 versionType = "Openflow14"
 
 	ProtocolIP   protocol = "ip"
 	ProtocolARP  protocol = "arp"
@@ -73,6 +75,10 @@ type Bridge interface {
 	Connect(maxRetry int) error
 	// Disconnect stops connection to the OFSwitch.
 	Disconnect() error
+	// DumpFlows returns the flows currently installed in the OFSwitch which match the provided
+	// match string (as returned by Flow.MatchString). All flows are returned if matchString is
+	// empty.
+	DumpFlows(matchString string) ([]string, error)
 }
 
 func NewBridge(name string) Bridge {
@@ -105,6 +105,21 @@ func (mr *MockBridgeMockRecorder) Disconnect() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disconnect", reflect.TypeOf((*MockBridge)(nil).Disconnect))
 }
 
+// DumpFlows mocks base method
+func (m *MockBridge) DumpFlows(arg0 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DumpFlows", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DumpFlows indicates an expected call of DumpFlows
+func (mr *MockBridgeMockRecorder) DumpFlows(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DumpFlows", reflect.TypeOf((*MockBridge)(nil).DumpFlows), arg0)
+}
+
 // DumpTableStatus mocks base method
 func (m *MockBridge) DumpTableStatus() []openflow.TableStatus {
 	m.ctrl.T.Helper()
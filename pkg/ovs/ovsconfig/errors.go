@@ -15,9 +15,18 @@
 package ovsconfig
 
 import (
+	"errors"
 	"strings"
 )
 
+// ErrBridgeNotFound is returned by OVSBridge.Delete when the bridge does not exist. Callers which
+// only care about the bridge being absent (e.g. for idempotent cleanup) can treat it as a success.
+var ErrBridgeNotFound = NewTransactionError(errors.New("bridge not found"), false)
+
+// ErrPortNotFound is returned by OVSBridge.GetPortUUID when no port has an interface with the
+// provided name.
+var ErrPortNotFound = NewTransactionError(errors.New("port not found"), false)
+
 type Error interface {
 	error
 	Timeout() bool   // Is the error a timeout?
@@ -40,3 +49,60 @@ func (e *TransactionError) Temporary() bool {
 func (e *TransactionError) Timeout() bool {
 	return strings.HasPrefix(e.Error(), "timed out:")
 }
+
+// MultiError aggregates the errors of multiple OVSDB transactions, e.g. for a setup made of several
+// steps which should all be attempted even if some of them fail. The aggregate is only temporary
+// (resp. a timeout) if all the aggregated errors are temporary (resp. timeouts), since retrying is
+// not useful if any of the steps failed permanently.
+type MultiError struct {
+	errs []Error
+}
+
+// Append adds err to the aggregate. Nil errors are ignored.
+func (e *MultiError) Append(err Error) {
+	if err == nil {
+		return
+	}
+	e.errs = append(e.errs, err)
+}
+
+// Errors returns the aggregated errors.
+func (e *MultiError) Errors() []Error {
+	return e.errs
+}
+
+// ErrorOrNil returns nil if no error was aggregated, and the MultiError otherwise. It should be used
+// when returning the aggregate as an Error, to avoid returning a non-nil interface holding an empty
+// MultiError.
+func (e *MultiError) ErrorOrNil() Error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *MultiError) Temporary() bool {
+	for _, err := range e.errs {
+		if !err.Temporary() {
+			return false
+		}
+	}
+	return len(e.errs) > 0
+}
+
+func (e *MultiError) Timeout() bool {
+	for _, err := range e.errs {
+		if !err.Timeout() {
+			return false
+		}
+	}
+	return len(e.errs) > 0
+}
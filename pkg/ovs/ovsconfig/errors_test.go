@@ -0,0 +1,64 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovsconfig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiError(t *testing.T) {
+	temporaryErr := NewTransactionError(errors.New("transaction failed"), true)
+	permanentErr := NewTransactionError(errors.New("constraint violation"), false)
+	timeoutErr := NewTransactionError(errors.New("timed out: no reply"), false)
+
+	for _, tc := range []struct {
+		name              string
+		errs              []Error
+		expectedTemporary bool
+		expectedTimeout   bool
+		expectedMsg       string
+	}{
+		{"single temporary", []Error{temporaryErr}, true, false, "transaction failed"},
+		{"all temporary", []Error{temporaryErr, timeoutErr}, true, false, "transaction failed; timed out: no reply"},
+		{"one permanent", []Error{temporaryErr, permanentErr}, false, false, "transaction failed; constraint violation"},
+		{"all timeouts", []Error{timeoutErr, timeoutErr}, true, true, "timed out: no reply; timed out: no reply"},
+		{"nil ignored", []Error{nil, permanentErr}, false, false, "constraint violation"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			multiErr := &MultiError{}
+			for _, err := range tc.errs {
+				multiErr.Append(err)
+			}
+			err := multiErr.ErrorOrNil()
+			if !assert.NotNil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.expectedTemporary, err.Temporary())
+			assert.Equal(t, tc.expectedTimeout, err.Timeout())
+			assert.Equal(t, tc.expectedMsg, err.Error())
+		})
+	}
+}
+
+func TestMultiErrorEmpty(t *testing.T) {
+	multiErr := &MultiError{}
+	multiErr.Append(nil)
+	assert.Nil(t, multiErr.ErrorOrNil())
+	assert.Empty(t, multiErr.Errors())
+	assert.False(t, multiErr.Temporary(), "Empty aggregate should not be temporary")
+}
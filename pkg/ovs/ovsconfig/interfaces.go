@@ -14,12 +14,26 @@
 
 package ovsconfig
 
+import "time"
+
 const (
 	GENEVE_TUNNEL = "geneve"
 	VXLAN_TUNNEL  = "vxlan"
 
+	// GCExternalIDKey is the external ID set to "true" on the ports marked for garbage collection
+	// by MarkPortsForGC.
+	GCExternalIDKey = "antrea:gc"
+
 	OVSDatapathSystem = "system"
 	OVSDatapathNetdev = "netdev"
+
+	// OpenFlow protocol versions which can be enabled for a bridge.
+	OpenFlow10 = "OpenFlow10"
+	OpenFlow11 = "OpenFlow11"
+	OpenFlow12 = "OpenFlow12"
+	OpenFlow13 = "OpenFlow13"
+	OpenFlow14 = "OpenFlow14"
+	OpenFlow15 = "OpenFlow15"
 )
 
 //go:generate mockgen -copyright_file ../../../hack/boilerplate/license_header.raw.txt -destination testing/mock_ovsconfig.go -package=testing github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig OVSBridgeClient
@@ -27,16 +41,42 @@ const (
 type OVSBridgeClient interface {
 	Create() Error
 	Delete() Error
+	GetDatapathType() (string, Error)
+	GetOVSVersion() (string, Error)
+	SetHardwareOffload(enable bool) Error
+	GetFlowRestoreWait() (bool, Error)
 	GetExternalIDs() (map[string]string, Error)
 	SetExternalIDs(externalIDs map[string]interface{}) Error
+	SetSTPEnable(enable bool) Error
+	SetRSTPEnable(enable bool) Error
+	SetMcastSnoopingEnable(enable bool) Error
+	SetMcastSnoopingDisableFloodUnregistered(disable bool) Error
+	SetProtocols(protocols []string) Error
+	SetBridgeMAC(mac string) Error
+	GetBridgeMAC() (string, Error)
+	SetController(target string) Error
+	DeleteController() Error
+	GetControllerStatus() (connected bool, target string, err Error)
 	CreatePort(name, ifDev string, externalIDs map[string]interface{}) (string, Error)
-	CreateGenevePort(name string, ofPortRequest int32, remoteIP string) (string, Error)
+	CreateGenevePort(name string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) (string, Error)
 	CreateInternalPort(name string, ofPortRequest int32, externalIDs map[string]interface{}) (string, Error)
-	CreateVXLANPort(name string, ofPortRequest int32, remoteIP string) (string, Error)
+	CreateVXLANPort(name string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) (string, Error)
+	CreatePatchPort(name, peerName string, ofPortRequest int32, externalIDs map[string]interface{}) (string, Error)
+	CreatePorts(specs []PortSpec) ([]string, Error)
 	DeletePort(portUUID string) Error
 	DeletePorts(portUUIDList []string) Error
+	ReplacePort(oldPortUUID string, spec PortSpec) (string, Error)
 	GetOFPort(ifName string) (int32, Error)
+	GetInterfaceMAC(ifName string) (string, Error)
+	GetPortUUID(ifName string) (string, Error)
 	GetPortData(portUUID, ifName string) (*OVSPortData, Error)
 	GetPortList() ([]OVSPortData, Error)
-	SetInterfaceMTU(name string, MTU int) error
+	GetTunnelPorts() ([]TunnelPortData, Error)
+	WaitForPorts(names []string, timeout time.Duration) Error
+	SetPortExternalIDs(portName string, externalIDs map[string]interface{}) Error
+	MarkPortsForGC(portUUIDList []string) Error
+	DeletePortsMarkedForGC() ([]string, Error)
+	SetInterfaceMTU(name string, MTU int) Error
+	SetInterfaceIngressPolicing(ifName string, rateKbps, burstKb int) Error
+	ClearInterfaceIngressPolicing(ifName string) Error
 }
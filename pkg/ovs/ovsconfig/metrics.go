@@ -0,0 +1,87 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovsconfig
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operation types used to label the OVSDB transaction metrics.
+const (
+	opCreateBridge      = "create_bridge"
+	opDeleteBridge      = "delete_bridge"
+	opUpdateBridge      = "update_bridge"
+	opCreatePorts       = "create_ports"
+	opDeletePorts       = "delete_ports"
+	opReplacePort       = "replace_port"
+	opUpdatePort        = "update_port"
+	opUpdateInterface   = "update_interface"
+	opUpdateOpenvSwitch = "update_open_vswitch"
+)
+
+const (
+	failureTemporary = "temporary"
+	failurePermanent = "permanent"
+)
+
+var (
+	transactionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "antrea_agent",
+			Subsystem: "ovsdb",
+			Name:      "transaction_duration_seconds",
+			Help:      "Latency of the mutating OVSDB transactions, including the time spent waiting for the other transactions committed on the same connection.",
+			// From 1ms to ~4s.
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 13),
+		},
+		[]string{"operation"},
+	)
+	transactionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "antrea_agent",
+			Subsystem: "ovsdb",
+			Name:      "transaction_failures_total",
+			Help:      "Number of mutating OVSDB transactions which failed, by failure type (temporary or permanent).",
+		},
+		[]string{"operation", "type"},
+	)
+)
+
+var registerMetricsOnce sync.Once
+
+// RegisterMetrics registers the OVSDB transaction metrics with the default Prometheus registry.
+// They are only exposed if the registry is served, e.g. by antrea-agent at /metrics when
+// metricsBindAddress is set. It can be called multiple times.
+func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(transactionDuration, transactionFailures)
+	})
+}
+
+// observeTransaction records the latency and the outcome of a committed transaction.
+func observeTransaction(operation string, start time.Time, err error, temporary bool) {
+	transactionDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	failureType := failurePermanent
+	if NewTransactionError(err, temporary).Temporary() {
+		failureType = failureTemporary
+	}
+	transactionFailures.WithLabelValues(operation, failureType).Inc()
+}
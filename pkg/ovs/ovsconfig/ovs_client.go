@@ -15,20 +15,77 @@
 package ovsconfig
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/dbtransaction"
 	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/helpers"
 	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/ovsdb"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog"
 )
 
 type OVSBridge struct {
-	ovsdb        *ovsdb.OVSDB
 	name         string
 	datapathType string
-	uuid         string
+	// protocols are the OpenFlow protocol versions enabled for the bridge.
+	protocols []string
+	uuid      string
+	// commitMutex serializes the mutating transactions committed on the OVSDB connection. It is
+	// shared by all the OVSBridge instances using the same connection.
+	commitMutex *sync.Mutex
+	// newTransaction creates the transactions on the OVSDB connection. It is replaced in tests to
+	// run the transactions against a fake connection.
+	newTransaction func() *dbtransaction.Transaction
+}
+
+// connectionLocks maps each OVSDB connection to the mutex used to serialize the mutating
+// transactions committed on it by OVSBridge instances.
+var connectionLocks = struct {
+	sync.Mutex
+	locks map[*ovsdb.OVSDB]*sync.Mutex
+}{locks: make(map[*ovsdb.OVSDB]*sync.Mutex)}
+
+// commitMutexFor returns the mutex used to serialize mutating transactions on the provided OVSDB
+// connection, creating it if needed.
+func commitMutexFor(db *ovsdb.OVSDB) *sync.Mutex {
+	connectionLocks.Lock()
+	defer connectionLocks.Unlock()
+	m, ok := connectionLocks.locks[db]
+	if !ok {
+		m = &sync.Mutex{}
+		connectionLocks.locks[db] = m
+	}
+	return m
+}
+
+// connectionProbes maps each OVSDB connection returned by NewOVSDBConnectionUDS which is probed to
+// the channel used to stop probing it.
+var connectionProbes = struct {
+	sync.Mutex
+	stopChs map[*ovsdb.OVSDB]chan struct{}
+}{stopChs: make(map[*ovsdb.OVSDB]chan struct{})}
+
+// PortSpec describes a port to create on the bridge, along with the single interface attached to
+// it. It is used to create multiple ports in a single transaction with CreatePorts.
+type PortSpec struct {
+	Name string
+	// IFName is the name of the interface attached to the port.
+	IFName string
+	// IFType is the interface type (e.g. "internal" or "vxlan"). It can be left empty for a
+	// regular interface backed by an existing network device.
+	IFType string
+	// If OFPortRequest is not zero, it will be passed to the OVS port creation.
+	OFPortRequest int32
+	ExternalIDs   map[string]interface{}
+	// Options are the interface options, e.g. the remote_ip for a tunnel interface.
+	Options map[string]interface{}
 }
 
 type OVSPortData struct {
@@ -39,62 +96,238 @@ type OVSPortData struct {
 	OFPort      int32
 }
 
+// defaultProtocols are the OpenFlow protocol versions enabled for a bridge when SetProtocols is not
+// called.
+var defaultProtocols = []string{OpenFlow10, OpenFlow13}
+
+// supportedProtocols are the OpenFlow protocol versions which can be provided to SetProtocols.
+var supportedProtocols = map[string]bool{
+	OpenFlow10: true,
+	OpenFlow11: true,
+	OpenFlow12: true,
+	OpenFlow13: true,
+	OpenFlow14: true,
+	OpenFlow15: true,
+}
+
+// minOVSVersionForProtocol is the first OVS version in which each OpenFlow protocol version can be
+// enabled for a bridge. Older OVS versions reject the protocol in the Bridge protocols column. Some
+// versions only have partial support for the protocol, in which case it is still enabled.
+var minOVSVersionForProtocol = map[string]*utilversion.Version{
+	OpenFlow10: utilversion.MustParseGeneric("1.0.0"),
+	OpenFlow11: utilversion.MustParseGeneric("2.0.0"),
+	OpenFlow12: utilversion.MustParseGeneric("1.10.0"),
+	OpenFlow13: utilversion.MustParseGeneric("1.10.0"),
+	OpenFlow14: utilversion.MustParseGeneric("2.2.0"),
+	OpenFlow15: utilversion.MustParseGeneric("2.2.0"),
+}
+
+// TunnelPortData describes a tunnel interface of the bridge.
+type TunnelPortData struct {
+	Name   string
+	OFPort int32
+	// Type is the tunnel type, VXLAN_TUNNEL or GENEVE_TUNNEL.
+	Type string
+	// RemoteIP is the value of options:remote_ip for the interface: either the IP address of
+	// the remote tunnel endpoint, or "flow" for a flow-based tunnel, for which the remote
+	// endpoint is set by the OpenFlow actions.
+	RemoteIP string
+}
+
 const (
 	defaultUDSAddress = "/run/openvswitch/db.sock"
 	openvSwitchSchema = "Open_vSwitch"
-	// Openflow protocol version 1.0.
-	openflowProtoVersion10 = "OpenFlow10"
-	// Openflow protocol version 1.3.
-	openflowProtoVersion13 = "OpenFlow13"
+	// defaultProbeInterval matches the default inactivity probe of OVSDB clients.
+	defaultProbeInterval  = 5 * time.Second
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 8 * time.Second
+	// waitForPortsInterval is the interval at which the port list is polled by WaitForPorts.
+	waitForPortsInterval = 200 * time.Millisecond
+	// bridgeMACOtherConfigKey is the key of other_config which sets the MAC address of the bridge
+	// local port.
+	bridgeMACOtherConfigKey = "hwaddr"
+	// hwOffloadOtherConfigKey is the key of other_config in the Open_vSwitch table which enables
+	// hardware offload.
+	hwOffloadOtherConfigKey = "hw-offload"
+	// flowRestoreWaitOtherConfigKey is the key in the other_config column of the Open_vSwitch
+	// table which, when set to true, prevents ovs-vswitchd from forwarding packets until it is
+	// cleared, so that flows can be restored after a restart.
+	flowRestoreWaitOtherConfigKey = "flow-restore-wait"
 )
 
+// ConnectionOptions can be used to tune the behavior of NewOVSDBConnectionUDS. For each field, the
+// zero value means that the default value is used.
+type ConnectionOptions struct {
+	// ProbeInterval is the interval between two "echo" requests sent to the OVSDB server to
+	// check that the connection is alive. If the server does not reply within ProbeInterval,
+	// the connection is considered dead and is closed: pending transactions fail with a
+	// "connection closed" error instead of hanging until the TCP timeout, and the OVSDB library
+	// reconnects to the server. Probing stops when the connection is closed with
+	// CloseOVSDBConnection. Defaults to 5 seconds. If negative, the connection is not probed.
+	ProbeInterval time.Duration
+	// InitialBackoff is the delay after which a message is logged if the connection to the
+	// OVSDB server is not established yet. The delay between two successive log messages is
+	// then doubled each time, up to MaxBackoff. Defaults to 1 second.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two successive log messages while the
+	// connection to the OVSDB server is not established. Defaults to 8 seconds.
+	MaxBackoff time.Duration
+}
+
+func (o *ConnectionOptions) setDefaults() {
+	if o.ProbeInterval == 0 {
+		o.ProbeInterval = defaultProbeInterval
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = defaultInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+}
+
 // NewOVSDBConnectionUDS connects to the OVSDB server on the UNIX domain socket
 // specified by address.
 // If address is set to "", the default UNIX domain socket path
 // "/run/openvswitch/db.sock" will be used.
+// If options is nil, the default options are used (see ConnectionOptions).
 // Returns the OVSDB struct on success.
-func NewOVSDBConnectionUDS(address string) (*ovsdb.OVSDB, Error) {
+func NewOVSDBConnectionUDS(address string, options *ConnectionOptions) (*ovsdb.OVSDB, Error) {
 	klog.Infof("Connecting to OVSDB at address %s", address)
 
 	if address == "" {
 		address = defaultUDSAddress
 	}
+	opts := ConnectionOptions{}
+	if options != nil {
+		opts = *options
+	}
+	opts.setDefaults()
 
 	// For the sake of debugging, we keep logging messages until the
-	// connection is succesful. We use exponential backoff to determine the
-	// sleep  duration between two successive log messages (up to
-	// maxBackoffTime).
-	const maxBackoffTime = 8 * time.Second
+	// connection is succesful.
 	success := make(chan bool, 1)
-	go func() {
-		backoff := 1 * time.Second
-		for {
-			select {
-			case <-success:
-				return
-			case <-time.After(backoff):
-				backoff *= 2
-				if backoff > maxBackoffTime {
-					backoff = maxBackoffTime
-				}
-				klog.Infof("Not connected yet, will try again in %v", backoff)
-			}
-		}
-	}()
+	go logUntilConnected(success, opts.InitialBackoff, opts.MaxBackoff)
 
 	db := ovsdb.Dial([][]string{{"unix", address}}, nil, nil)
 	success <- true
+
+	if opts.ProbeInterval > 0 {
+		stopCh := make(chan struct{})
+		connectionProbes.Lock()
+		connectionProbes.stopChs[db] = stopCh
+		connectionProbes.Unlock()
+		go probeConnection(db, opts.ProbeInterval, stopCh)
+	}
 	return db, nil
 }
 
+// logUntilConnected logs a message until a value is received from the success channel. We use
+// exponential backoff to determine the sleep duration between two successive log messages (up to
+// maxBackoff).
+func logUntilConnected(success <-chan bool, initialBackoff, maxBackoff time.Duration) {
+	backoff := initialBackoff
+	for {
+		select {
+		case <-success:
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			klog.Infof("Not connected yet, will try again in %v", backoff)
+		}
+	}
+}
+
+// probedConnection is the subset of the OVSDB connection methods used by probeConnection.
+type probedConnection interface {
+	Call(method string, args interface{}, idref *uint64) (json.RawMessage, error)
+	Close() error
+}
+
+// probeConnection sends an "echo" request to the OVSDB server every probeInterval and closes the
+// connection if there is no reply within probeInterval. Closing the connection unblocks all the
+// pending calls, and the connection is then re-established by the OVSDB library. Probing stops
+// when stopCh is closed.
+func probeConnection(db probedConnection, probeInterval time.Duration, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(probeInterval):
+		}
+		replyCh := make(chan error, 1)
+		go func() {
+			_, err := db.Call("echo", []interface{}{}, nil)
+			replyCh <- err
+		}()
+		select {
+		case <-stopCh:
+			return
+		case err := <-replyCh:
+			if err != nil {
+				klog.Warningf("Echo request to OVSDB server failed: %v", err)
+			}
+		case <-time.After(probeInterval):
+			klog.Errorf("No reply from OVSDB server after %v, closing connection", probeInterval)
+			db.Close()
+		}
+	}
+}
+
+// CloseOVSDBConnection closes an OVSDB connection returned by NewOVSDBConnectionUDS and stops
+// probing it. It should be called instead of db.Close() once all the OVSBridge instances using the
+// connection are done.
+func CloseOVSDBConnection(db *ovsdb.OVSDB) {
+	connectionProbes.Lock()
+	if stopCh, ok := connectionProbes.stopChs[db]; ok {
+		close(stopCh)
+		delete(connectionProbes.stopChs, db)
+	}
+	connectionProbes.Unlock()
+	connectionLocks.Lock()
+	delete(connectionLocks.locks, db)
+	connectionLocks.Unlock()
+	db.Close()
+}
+
 // NewOVSBridge creates and returns a new OVSBridge struct.
+// A single OVSDB connection can be shared by multiple OVSBridge instances (e.g. the main bridge and
+// an integration bridge), instead of opening one connection per bridge. This is safe for concurrent
+// use: the OVSDB library serializes the requests sent on the connection, and the mutating
+// transactions (the ones creating, updating or deleting rows) of all the bridges sharing the
+// connection are committed one at a time, so that the OVSDB server applies them in the order in
+// which they were committed. Read-only transactions are not serialized.
 func NewOVSBridge(bridgeName string, ovsDatapathType string, ovsdb *ovsdb.OVSDB) *OVSBridge {
-	return &OVSBridge{ovsdb, bridgeName, ovsDatapathType, ""}
+	return &OVSBridge{
+		name:         bridgeName,
+		datapathType: ovsDatapathType,
+		protocols:    defaultProtocols,
+		commitMutex:  commitMutexFor(ovsdb),
+		newTransaction: func() *dbtransaction.Transaction {
+			return ovsdb.Transaction(openvSwitchSchema)
+		},
+	}
+}
+
+// commit commits a mutating transaction while holding the commit mutex of the OVSDB connection.
+// The latency and the outcome of the transaction are recorded in the metrics for the provided
+// operation type.
+func (br *OVSBridge) commit(operation string, tx *dbtransaction.Transaction) (dbtransaction.Transact, error, bool) {
+	start := time.Now()
+	br.commitMutex.Lock()
+	defer br.commitMutex.Unlock()
+	res, err, temporary := tx.Commit()
+	observeTransaction(operation, start, err, temporary)
+	return res, err, temporary
 }
 
 // Create looks up or creates the bridge. If the bridge with name bridgeName
-// does not exist, it will be created. Openflow protocol version 1.0 and 1.3
-// will be enabled for the bridge.
+// does not exist, it will be created. The OpenFlow protocol versions provided
+// to SetProtocols (by default 1.0 and 1.3) will be enabled for the bridge, if
+// they are supported by the running OVS version.
 func (br *OVSBridge) Create() Error {
 	if exists, err := br.lookupByName(); err != nil {
 		return err
@@ -110,11 +343,57 @@ func (br *OVSBridge) Create() Error {
 		klog.Info("Created bridge: ", br.uuid)
 	}
 
+	// OVS may not apply the requested datapath type, e.g. if the bridge already exists with a
+	// different type.
+	if datapathType, err := br.GetDatapathType(); err != nil {
+		klog.Warningf("Failed to read datapath type of bridge %s: %v", br.name, err)
+	} else if requested := normalizeDatapathType(br.datapathType); datapathType != requested {
+		klog.Warningf("Bridge %s has datapath type %s instead of requested type %s", br.name, datapathType, requested)
+	}
 	return nil
 }
 
+// GetDatapathType returns the datapath type applied by OVS to the bridge. OVSDatapathSystem is
+// returned if the datapath_type column is empty, as it is the default type used by OVS.
+func (br *OVSBridge) GetDatapathType() (string, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Bridge",
+		Columns: []string{"datapath_type"},
+		Where:   [][]interface{}{{"name", "==", br.name}},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return "", ErrBridgeNotFound
+	}
+	return parseDatapathType(res[0].Rows[0].(map[string]interface{}))
+}
+
+// parseDatapathType returns the datapath type from a Bridge row including the datapath_type column.
+func parseDatapathType(row map[string]interface{}) (string, Error) {
+	datapathType, ok := row["datapath_type"].(string)
+	if !ok {
+		return "", NewTransactionError(fmt.Errorf("invalid datapath_type column in Bridge row: %v", row["datapath_type"]), false)
+	}
+	return normalizeDatapathType(datapathType), nil
+}
+
+// normalizeDatapathType returns OVSDatapathSystem for the empty datapath type, which is how OVS
+// interprets it.
+func normalizeDatapathType(datapathType string) string {
+	if datapathType == "" {
+		return OVSDatapathSystem
+	}
+	return datapathType
+}
+
 func (br *OVSBridge) lookupByName() (bool, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Select(dbtransaction.Select{
 		Table:   "Bridge",
 		Columns: []string{"_uuid"},
@@ -134,18 +413,75 @@ func (br *OVSBridge) lookupByName() (bool, Error) {
 	return true, nil
 }
 
+// SetProtocols sets the OpenFlow protocol versions to enable for the bridge (e.g. OpenFlow13 and
+// OpenFlow14). An error is returned if the list is empty or if any version is unknown. If called
+// before Create, the versions are applied when the bridge is created; otherwise the bridge is
+// updated immediately.
+func (br *OVSBridge) SetProtocols(protocols []string) Error {
+	if len(protocols) == 0 {
+		return NewTransactionError(fmt.Errorf("at least one OpenFlow protocol version must be enabled"), false)
+	}
+	for _, protocol := range protocols {
+		if !supportedProtocols[protocol] {
+			return NewTransactionError(fmt.Errorf("unknown OpenFlow protocol version %s", protocol), false)
+		}
+	}
+	br.protocols = append([]string(nil), protocols...)
+	if br.uuid == "" {
+		return nil
+	}
+	return br.updateProtocols()
+}
+
+// enabledProtocols returns the OpenFlow protocol versions to enable for the bridge: the ones
+// provided to SetProtocols which are supported by the running OVS version. The provided versions are
+// returned unchanged if the OVS version cannot be determined.
+func (br *OVSBridge) enabledProtocols() ([]string, error) {
+	ovsVersion, err := br.GetOVSVersion()
+	if err != nil {
+		klog.Warningf("Failed to get OVS version, enabling OpenFlow protocols %v: %v", br.protocols, err)
+		return br.protocols, nil
+	}
+	return protocolsForOVSVersion(br.protocols, ovsVersion)
+}
+
+// protocolsForOVSVersion returns the subset of protocols supported by the provided OVS version. A
+// warning is logged for each protocol which is not supported, and an error is returned if none of
+// them is.
+func protocolsForOVSVersion(protocols []string, ovsVersion string) ([]string, error) {
+	parsedVersion, err := utilversion.ParseGeneric(ovsVersion)
+	if err != nil {
+		klog.Warningf("Failed to parse OVS version %s, enabling OpenFlow protocols %v: %v", ovsVersion, protocols, err)
+		return protocols, nil
+	}
+	var enabled []string
+	for _, protocol := range protocols {
+		if minVersion := minOVSVersionForProtocol[protocol]; parsedVersion.LessThan(minVersion) {
+			klog.Warningf("OpenFlow protocol %s is not supported by OVS version %s and will not be enabled", protocol, ovsVersion)
+			continue
+		}
+		enabled = append(enabled, protocol)
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("none of the OpenFlow protocols %v is supported by OVS version %s", protocols, ovsVersion)
+	}
+	return enabled, nil
+}
+
 func (br *OVSBridge) updateProtocols() Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
-	// Use Openflow protocol version 1.0 and 1.3.
+	protocols, err := br.enabledProtocols()
+	if err != nil {
+		return NewTransactionError(err, false)
+	}
+	tx := br.newTransaction()
 	tx.Update(dbtransaction.Update{
 		Table: "Bridge",
 		Where: [][]interface{}{{"name", "==", br.name}},
 		Row: map[string]interface{}{
-			"protocols": makeOVSDBSetFromList([]string{openflowProtoVersion10,
-				openflowProtoVersion13}),
+			"protocols": makeOVSDBSetFromList(protocols),
 		},
 	})
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opUpdateBridge, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -154,12 +490,14 @@ func (br *OVSBridge) updateProtocols() Error {
 }
 
 func (br *OVSBridge) create() Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	protocols, err := br.enabledProtocols()
+	if err != nil {
+		return NewTransactionError(err, false)
+	}
+	tx := br.newTransaction()
 	bridge := Bridge{
-		Name: br.name,
-		// Use Openflow protocol version 1.0 and 1.3.
-		Protocols: makeOVSDBSetFromList([]string{openflowProtoVersion10,
-			openflowProtoVersion13}),
+		Name:         br.name,
+		Protocols:    makeOVSDBSetFromList(protocols),
 		DatapathType: br.datapathType,
 	}
 	namedUUID := tx.Insert(dbtransaction.Insert{
@@ -175,7 +513,7 @@ func (br *OVSBridge) create() Error {
 		Mutations: [][]interface{}{{"bridges", "insert", mutateSet}},
 	})
 
-	res, err, temporary := tx.Commit()
+	res, err, temporary := br.commit(opCreateBridge, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -185,8 +523,20 @@ func (br *OVSBridge) create() Error {
 	return nil
 }
 
+// Delete deletes the bridge. If the bridge UUID is not known yet (i.e. neither Create nor Delete
+// was called successfully before), it is first looked up by name. ErrBridgeNotFound is returned if
+// the bridge does not exist.
 func (br *OVSBridge) Delete() Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	if br.uuid == "" {
+		if exists, err := br.lookupByName(); err != nil {
+			return err
+		} else if !exists {
+			klog.Warningf("Bridge %s not found, nothing to delete", br.name)
+			return ErrBridgeNotFound
+		}
+	}
+
+	tx := br.newTransaction()
 	mutateSet := helpers.MakeOVSDBSet(map[string]interface{}{
 		"uuid": []string{br.uuid},
 	})
@@ -195,7 +545,48 @@ func (br *OVSBridge) Delete() Error {
 		Mutations: [][]interface{}{{"bridges", "delete", mutateSet}},
 	})
 
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opDeleteBridge, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	br.uuid = ""
+	return nil
+}
+
+// GetOVSVersion returns the version of the running OVS, as reported in the Open_vSwitch table.
+func (br *OVSBridge) GetOVSVersion() (string, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Open_vSwitch",
+		Columns: []string{"ovs_version"},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return "", NewTransactionError(fmt.Errorf("no row in Open_vSwitch table"), false)
+	}
+	// The column is an optional string, which is an empty set if not populated.
+	ovsVersion, ok := res[0].Rows[0].(map[string]interface{})["ovs_version"].(string)
+	if !ok || ovsVersion == "" {
+		return "", NewTransactionError(fmt.Errorf("OVS version not reported"), false)
+	}
+	return ovsVersion, nil
+}
+
+// SetHardwareOffload sets other_config:hw-offload in the Open_vSwitch table, which enables the
+// offload of datapath flows to the hardware (e.g. SmartNICs). The setting is global to OVS and should
+// be applied before the bridge is created. Note that ovs-vswitchd only reads it at startup, so OVS
+// must be restarted for a change to take effect.
+func (br *OVSBridge) SetHardwareOffload(enable bool) Error {
+	tx := br.newTransaction()
+	setHardwareOffloadOps(tx, enable)
+
+	_, err, temporary := br.commit(opUpdateOpenvSwitch, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -203,9 +594,46 @@ func (br *OVSBridge) Delete() Error {
 	return nil
 }
 
+// setHardwareOffloadOps adds the mutations setting other_config:hw-offload in the Open_vSwitch
+// table, which has a single row, to the transaction.
+func setHardwareOffloadOps(tx *dbtransaction.Transaction, enable bool) {
+	setOtherConfigOps(tx, "Open_vSwitch", nil, hwOffloadOtherConfigKey, strconv.FormatBool(enable))
+}
+
+// GetFlowRestoreWait returns whether other_config:flow-restore-wait is set to true in the
+// Open_vSwitch table. While it is set, ovs-vswitchd does not forward any packet, so it can be used to
+// check that the flag was cleared after the flows were restored.
+func (br *OVSBridge) GetFlowRestoreWait() (bool, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Open_vSwitch",
+		Columns: []string{"other_config"},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return false, NewTransactionError(err, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return false, NewTransactionError(fmt.Errorf("no row in Open_vSwitch table"), false)
+	}
+	return parseFlowRestoreWait(res[0].Rows[0].(map[string]interface{}))
+}
+
+// parseFlowRestoreWait returns the value of other_config:flow-restore-wait in an Open_vSwitch row.
+// Like ovs-vswitchd, it treats any value other than "true" as false.
+func parseFlowRestoreWait(row map[string]interface{}) (bool, Error) {
+	otherConfig, ok := row["other_config"].([]interface{})
+	if !ok {
+		return false, NewTransactionError(fmt.Errorf("unexpected other_config in Open_vSwitch row: %v", row["other_config"]), false)
+	}
+	return buildMapFromOVSDBMap(otherConfig)[flowRestoreWaitOtherConfigKey] == "true", nil
+}
+
 // GetExternalIDs returns the external IDs of the bridge.
 func (br *OVSBridge) GetExternalIDs() (map[string]string, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Select(dbtransaction.Select{
 		Table:   "Bridge",
 		Columns: []string{"external_ids"},
@@ -224,7 +652,7 @@ func (br *OVSBridge) GetExternalIDs() (map[string]string, Error) {
 
 // SetExternalIDs sets the provided external IDs to the bridge.
 func (br *OVSBridge) SetExternalIDs(externalIDs map[string]interface{}) Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Update(dbtransaction.Update{
 		Table: "Bridge",
 		Where: [][]interface{}{{"name", "==", br.name}},
@@ -233,7 +661,226 @@ func (br *OVSBridge) SetExternalIDs(externalIDs map[string]interface{}) Error {
 		},
 	})
 
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opUpdateBridge, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	return nil
+}
+
+// SetSTPEnable enables or disables the Spanning Tree Protocol (802.1D) on the bridge, by setting
+// the stp_enable column of the Bridge row. STP is disabled by default.
+func (br *OVSBridge) SetSTPEnable(enable bool) Error {
+	return br.updateBridgeRow(map[string]interface{}{"stp_enable": enable})
+}
+
+// SetRSTPEnable enables or disables the Rapid Spanning Tree Protocol (802.1D-2004) on the bridge,
+// by setting the rstp_enable column of the Bridge row. RSTP is disabled by default.
+func (br *OVSBridge) SetRSTPEnable(enable bool) Error {
+	return br.updateBridgeRow(map[string]interface{}{"rstp_enable": enable})
+}
+
+// SetMcastSnoopingEnable enables or disables IGMP snooping on the bridge, by setting the
+// mcast_snooping_enable column of the Bridge row. When enabled, multicast traffic is only forwarded
+// to the ports which joined the group instead of being flooded. Multicast snooping is disabled by
+// default.
+func (br *OVSBridge) SetMcastSnoopingEnable(enable bool) Error {
+	return br.updateBridgeRow(map[string]interface{}{"mcast_snooping_enable": enable})
+}
+
+// SetMcastSnoopingDisableFloodUnregistered sets other_config:mcast-snooping-disable-flood-unregistered
+// for the bridge. If set to true, multicast packets for unregistered groups are not flooded when
+// multicast snooping is enabled. Other keys of other_config are not modified.
+func (br *OVSBridge) SetMcastSnoopingDisableFloodUnregistered(disable bool) Error {
+	return br.setBridgeOtherConfig("mcast-snooping-disable-flood-unregistered", strconv.FormatBool(disable))
+}
+
+// SetBridgeMAC sets other_config:hwaddr for the bridge, which pins the MAC address of the bridge
+// local port instead of letting OVS derive it from the ports attached to the bridge. An error is
+// returned if mac is not a valid MAC address.
+func (br *OVSBridge) SetBridgeMAC(mac string) Error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return NewTransactionError(fmt.Errorf("invalid MAC address %s: %v", mac, err), false)
+	}
+	return br.setBridgeOtherConfig(bridgeMACOtherConfigKey, hwAddr.String())
+}
+
+// GetBridgeMAC returns other_config:hwaddr for the bridge, or an empty string if it is not set.
+func (br *OVSBridge) GetBridgeMAC() (string, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Bridge",
+		Columns: []string{"other_config"},
+		Where:   [][]interface{}{{"name", "==", br.name}},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return "", ErrBridgeNotFound
+	}
+	return parseBridgeMAC(res[0].Rows[0].(map[string]interface{}))
+}
+
+func parseBridgeMAC(row map[string]interface{}) (string, Error) {
+	otherConfig, ok := row["other_config"].([]interface{})
+	if !ok {
+		return "", NewTransactionError(fmt.Errorf("unexpected other_config in Bridge row: %v", row["other_config"]), false)
+	}
+	return buildMapFromOVSDBMap(otherConfig)[bridgeMACOtherConfigKey], nil
+}
+
+// setBridgeOtherConfig sets a single key of the other_config column of the Bridge row.
+func (br *OVSBridge) setBridgeOtherConfig(key, value string) Error {
+	tx := br.newTransaction()
+	setBridgeOtherConfigOps(tx, br.name, key, value)
+
+	_, err, temporary := br.commit(opUpdateBridge, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	return nil
+}
+
+// setBridgeOtherConfigOps adds the mutations setting a key of the other_config column of the Bridge
+// row to the transaction.
+func setBridgeOtherConfigOps(tx *dbtransaction.Transaction, bridgeName, key, value string) {
+	setOtherConfigOps(tx, "Bridge", [][]interface{}{{"name", "==", bridgeName}}, key, value)
+}
+
+// setOtherConfigOps adds the mutations setting a key of the other_config column of the rows of table
+// matching where to the transaction. An OVSDB "insert" mutation does not overwrite an existing key in
+// a map, so the key is deleted first.
+func setOtherConfigOps(tx *dbtransaction.Transaction, table string, where [][]interface{}, key, value string) {
+	tx.Mutate(dbtransaction.Mutate{
+		Table: table,
+		Where: where,
+		Mutations: [][]interface{}{
+			{"other_config", "delete", []interface{}{"set", []interface{}{key}}},
+			{"other_config", "insert", helpers.MakeOVSDBMap(map[string]interface{}{key: value})},
+		},
+	})
+}
+
+// SetController sets the OpenFlow controller of the bridge to the provided target (e.g.
+// "tcp:127.0.0.1:6653"). A new Controller row is created and replaces any controller previously
+// set for the bridge; OVSDB garbage-collects the Controller rows which are no longer referenced.
+func (br *OVSBridge) SetController(target string) Error {
+	tx := br.newTransaction()
+	setControllerOps(tx, br.name, target)
+
+	_, err, temporary := br.commit(opUpdateBridge, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	return nil
+}
+
+// DeleteController removes the OpenFlow controller of the bridge, if any.
+func (br *OVSBridge) DeleteController() Error {
+	tx := br.newTransaction()
+	deleteControllerOps(tx, br.name)
+
+	_, err, temporary := br.commit(opUpdateBridge, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	return nil
+}
+
+func setControllerOps(tx *dbtransaction.Transaction, bridgeName, target string) {
+	namedUUID := tx.Insert(dbtransaction.Insert{
+		Table: "Controller",
+		Row:   Controller{Target: target},
+	})
+	tx.Update(dbtransaction.Update{
+		Table: "Bridge",
+		Where: [][]interface{}{{"name", "==", bridgeName}},
+		Row: map[string]interface{}{
+			"controller": helpers.MakeOVSDBSet(map[string]interface{}{
+				"named-uuid": []string{namedUUID},
+			}),
+		},
+	})
+}
+
+func deleteControllerOps(tx *dbtransaction.Transaction, bridgeName string) {
+	tx.Update(dbtransaction.Update{
+		Table: "Bridge",
+		Where: [][]interface{}{{"name", "==", bridgeName}},
+		Row: map[string]interface{}{
+			"controller": makeOVSDBSetFromList([]string{}),
+		},
+	})
+}
+
+// GetControllerStatus returns whether the bridge is connected to its OpenFlow controller, as
+// reported by the is_connected column of the Controller row, along with the target of the
+// controller. If no controller is set for the bridge, false and an empty target are returned.
+func (br *OVSBridge) GetControllerStatus() (connected bool, target string, err Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Bridge",
+		Columns: []string{"controller"},
+		Where:   [][]interface{}{{"name", "==", br.name}},
+	})
+	tx.Select(dbtransaction.Select{
+		Table:   "Controller",
+		Columns: []string{"_uuid", "target", "is_connected"},
+	})
+
+	res, txErr, temporary := tx.Commit()
+	if txErr != nil {
+		klog.Error("Transaction failed: ", txErr)
+		return false, "", NewTransactionError(txErr, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return false, "", ErrBridgeNotFound
+	}
+	return parseControllerStatus(res[0].Rows[0].(map[string]interface{}), res[1].Rows)
+}
+
+// parseControllerStatus returns the status and target of the controller referenced by bridgeRow (a
+// Bridge row including the controller column) among controllerRows (Controller rows including the
+// _uuid, target and is_connected columns).
+func parseControllerStatus(bridgeRow map[string]interface{}, controllerRows []interface{}) (bool, string, Error) {
+	controllers, ok := bridgeRow["controller"].([]interface{})
+	if !ok {
+		return false, "", NewTransactionError(fmt.Errorf("unexpected controller in Bridge row: %v", bridgeRow["controller"]), false)
+	}
+	controllerUUIDs := helpers.GetIdListFromOVSDBSet(controllers)
+	if len(controllerUUIDs) == 0 {
+		return false, "", nil
+	}
+	for _, row := range controllerRows {
+		controller := row.(map[string]interface{})
+		if controller["_uuid"].([]interface{})[1].(string) != controllerUUIDs[0] {
+			continue
+		}
+		target, _ := controller["target"].(string)
+		connected, _ := controller["is_connected"].(bool)
+		return connected, target, nil
+	}
+	return false, "", NewTransactionError(fmt.Errorf("controller %s not found", controllerUUIDs[0]), false)
+}
+
+func (br *OVSBridge) updateBridgeRow(row map[string]interface{}) Error {
+	tx := br.newTransaction()
+	tx.Update(dbtransaction.Update{
+		Table: "Bridge",
+		Where: [][]interface{}{{"name", "==", br.name}},
+		Row:   row,
+	})
+
+	_, err, temporary := br.commit(opUpdateBridge, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -243,7 +890,7 @@ func (br *OVSBridge) SetExternalIDs(externalIDs map[string]interface{}) Error {
 
 // GetPortUUIDList returns UUIDs of all ports on the bridge.
 func (br *OVSBridge) GetPortUUIDList() ([]string, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Select(dbtransaction.Select{
 		Table:   "Bridge",
 		Columns: []string{"ports"},
@@ -262,7 +909,7 @@ func (br *OVSBridge) GetPortUUIDList() ([]string, Error) {
 
 // DeletePorts deletes ports in portUUIDList on the bridge
 func (br *OVSBridge) DeletePorts(portUUIDList []string) Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	mutateSet := helpers.MakeOVSDBSet(map[string]interface{}{
 		"uuid": portUUIDList,
 	})
@@ -271,7 +918,7 @@ func (br *OVSBridge) DeletePorts(portUUIDList []string) Error {
 		Mutations: [][]interface{}{{"ports", "delete", mutateSet}},
 	})
 
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opDeletePorts, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -282,7 +929,7 @@ func (br *OVSBridge) DeletePorts(portUUIDList []string) Error {
 // DeletePort deletes the port with the provided portUUID.
 // If the port does not exist no change will be done.
 func (br *OVSBridge) DeletePort(portUUID string) Error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	mutateSet := helpers.MakeOVSDBSet(map[string]interface{}{
 		"uuid": []string{portUUID},
 	})
@@ -291,7 +938,7 @@ func (br *OVSBridge) DeletePort(portUUID string) Error {
 		Mutations: [][]interface{}{{"ports", "delete", mutateSet}},
 	})
 
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opDeletePorts, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
@@ -310,30 +957,96 @@ func (br *OVSBridge) CreateInternalPort(name string, ofPortRequest int32, extern
 
 // CreateVXLANPort creates a VXLAN tunnel port with the specified name on the
 // bridge.
-// If ofPortRequest is not zero, it will be passed to the OVS port creation.
+// If ofPortRequest is not zero, it will be passed to the OVS port creation, and
+// an error will be returned if OVS does not assign the requested ofport to the
+// port (e.g. because it is already used by another port).
 // If remoteIP is not empty, it will be set to the tunnel port interface
 // options; otherwise flow based tunneling will be configured.
-func (br *OVSBridge) CreateVXLANPort(name string, ofPortRequest int32, remoteIP string) (string, Error) {
-	return br.createTunnelPort(name, "vxlan", ofPortRequest, remoteIP)
+// If externalIDs is not empty, the map key/value pairs will be set to the
+// port's external_ids.
+func (br *OVSBridge) CreateVXLANPort(name string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) (string, Error) {
+	return br.createTunnelPort(name, "vxlan", ofPortRequest, remoteIP, externalIDs)
 }
 
 // CreateGenevePort creates a Geneve tunnel port with the specified name on the
 // bridge.
-// If ofPortRequest is not zero, it will be passed to the OVS port creation.
+// If ofPortRequest is not zero, it will be passed to the OVS port creation, and
+// an error will be returned if OVS does not assign the requested ofport to the
+// port (e.g. because it is already used by another port).
 // If remoteIP is not empty, it will be set to the tunnel port interface
 // options; otherwise flow based tunneling will be configured.
-func (br *OVSBridge) CreateGenevePort(name string, ofPortRequest int32, remoteIP string) (string, Error) {
-	return br.createTunnelPort(name, "geneve", ofPortRequest, remoteIP)
+// If externalIDs is not empty, the map key/value pairs will be set to the
+// port's external_ids.
+func (br *OVSBridge) CreateGenevePort(name string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) (string, Error) {
+	return br.createTunnelPort(name, "geneve", ofPortRequest, remoteIP, externalIDs)
 }
 
-func (br *OVSBridge) createTunnelPort(name, ifType string, ofPortRequest int32, remoteIP string) (string, Error) {
+// CreatePatchPort creates a patch port with the specified name on the bridge, connected to the
+// patch port named peerName, which is expected to be created on another bridge.
+// If ofPortRequest is not zero, it will be passed to the OVS port creation.
+// If externalIDs is not empty, the map key/value pairs will be set to the
+// port's external_ids.
+func (br *OVSBridge) CreatePatchPort(name, peerName string, ofPortRequest int32, externalIDs map[string]interface{}) (string, Error) {
+	uuids, err := br.CreatePorts([]PortSpec{patchPortSpec(name, peerName, ofPortRequest, externalIDs)})
+	if err != nil {
+		return "", err
+	}
+	return uuids[0], nil
+}
+
+// patchPortSpec returns the PortSpec used to create a patch port connected to peerName.
+func patchPortSpec(name, peerName string, ofPortRequest int32, externalIDs map[string]interface{}) PortSpec {
+	return PortSpec{
+		Name:          name,
+		IFName:        name,
+		IFType:        "patch",
+		OFPortRequest: ofPortRequest,
+		ExternalIDs:   externalIDs,
+		Options:       map[string]interface{}{"peer": peerName},
+	}
+}
+
+// tunnelPortSpec returns the PortSpec used to create a tunnel port of type ifType.
+func tunnelPortSpec(name, ifType string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) PortSpec {
 	var options map[string]interface{}
 	if remoteIP != "" {
 		options = map[string]interface{}{"remote_ip": remoteIP}
 	} else {
 		options = map[string]interface{}{"key": "flow", "remote_ip": "flow"}
 	}
-	return br.createPort(name, name, ifType, ofPortRequest, nil, options)
+	return PortSpec{
+		Name:          name,
+		IFName:        name,
+		IFType:        ifType,
+		OFPortRequest: ofPortRequest,
+		ExternalIDs:   externalIDs,
+		Options:       options,
+	}
+}
+
+func (br *OVSBridge) createTunnelPort(name, ifType string, ofPortRequest int32, remoteIP string, externalIDs map[string]interface{}) (string, Error) {
+	uuids, err := br.CreatePorts([]PortSpec{tunnelPortSpec(name, ifType, ofPortRequest, remoteIP, externalIDs)})
+	if err != nil {
+		return "", err
+	}
+	portUUID := uuids[0]
+	if ofPortRequest == 0 {
+		return portUUID, nil
+	}
+	// OVS does not fail the port creation if the requested ofport cannot be assigned, so we
+	// need to check the actual ofport to detect collisions.
+	ofPort, err := br.GetOFPort(name)
+	if err != nil {
+		return "", err
+	}
+	if ofPort != ofPortRequest {
+		klog.Errorf("Tunnel port %s was assigned ofport %d instead of requested ofport %d, deleting it", name, ofPort, ofPortRequest)
+		if err := br.DeletePort(portUUID); err != nil {
+			klog.Errorf("Failed to delete tunnel port %s: %v", name, err)
+		}
+		return "", NewTransactionError(fmt.Errorf("tunnel port %s was assigned ofport %d instead of requested ofport %d", name, ofPort, ofPortRequest), false)
+	}
+	return portUUID, nil
 }
 
 // CreatePort creates a port with the specified name on the bridge, and connects
@@ -345,22 +1058,101 @@ func (br *OVSBridge) CreatePort(name, ifDev string, externalIDs map[string]inter
 }
 
 func (br *OVSBridge) createPort(name, ifName, ifType string, ofPortRequest int32, externalIDs, options map[string]interface{}) (string, Error) {
+	uuids, err := br.CreatePorts([]PortSpec{{
+		Name:          name,
+		IFName:        ifName,
+		IFType:        ifType,
+		OFPortRequest: ofPortRequest,
+		ExternalIDs:   externalIDs,
+		Options:       options,
+	}})
+	if err != nil {
+		return "", err
+	}
+	return uuids[0], nil
+}
+
+// CreatePorts creates all the ports described by specs on the bridge, in a single OVSDB
+// transaction. Either all the ports are created, or none of them is. On success, the UUIDs of the
+// created ports are returned, in the same order as specs.
+func (br *OVSBridge) CreatePorts(specs []PortSpec) ([]string, Error) {
+	tx := br.newTransaction()
+
+	portNamedUUIDs := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		portNamedUUIDs = append(portNamedUUIDs, insertPort(tx, spec))
+	}
+
+	mutateSet := helpers.MakeOVSDBSet(map[string]interface{}{
+		"named-uuid": portNamedUUIDs,
+	})
+	tx.Mutate(dbtransaction.Mutate{
+		Table:     "Bridge",
+		Mutations: [][]interface{}{{"ports", "insert", mutateSet}},
+		Where:     [][]interface{}{{"name", "==", br.name}},
+	})
+
+	res, err, temporary := br.commit(opCreatePorts, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return nil, NewTransactionError(err, temporary)
+	}
+
+	// Each port is inserted with 2 operations: one for the interface and one for the port.
+	uuids := make([]string, len(specs))
+	for i := range specs {
+		uuids[i] = res[2*i+1].UUID[1]
+	}
+	return uuids, nil
+}
+
+// ReplacePort deletes the port with UUID oldPortUUID and creates the port described by spec in a
+// single transaction, so that the old port is left untouched if the new one cannot be created. The
+// new port may reuse the name and the ofport of the old one. The UUID of the new port is returned.
+func (br *OVSBridge) ReplacePort(oldPortUUID string, spec PortSpec) (string, Error) {
+	tx := br.newTransaction()
+	replacePortOps(tx, br.name, oldPortUUID, spec)
+
+	res, err, temporary := br.commit(opReplacePort, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	// The interface and the port are inserted first.
+	return res[1].UUID[1], nil
+}
+
+// replacePortOps adds the operations required to replace the port with UUID oldPortUUID by the port
+// described by spec to the transaction.
+func replacePortOps(tx *dbtransaction.Transaction, bridgeName, oldPortUUID string, spec PortSpec) {
+	portNamedUUID := insertPort(tx, spec)
+	tx.Mutate(dbtransaction.Mutate{
+		Table: "Bridge",
+		Mutations: [][]interface{}{
+			{"ports", "delete", helpers.MakeOVSDBSet(map[string]interface{}{"uuid": []string{oldPortUUID}})},
+			{"ports", "insert", helpers.MakeOVSDBSet(map[string]interface{}{"named-uuid": []string{portNamedUUID}})},
+		},
+		Where: [][]interface{}{{"name", "==", bridgeName}},
+	})
+}
+
+// insertPort adds the operations required to insert the interface and the port described by spec
+// to the transaction, and returns the named UUID of the port.
+func insertPort(tx *dbtransaction.Transaction, spec PortSpec) string {
 	var externalIDMap []interface{}
 	var optionMap []interface{}
 
-	if externalIDs != nil {
-		externalIDMap = helpers.MakeOVSDBMap(externalIDs)
+	if spec.ExternalIDs != nil {
+		externalIDMap = helpers.MakeOVSDBMap(spec.ExternalIDs)
 	}
-	if options != nil {
-		optionMap = helpers.MakeOVSDBMap(options)
+	if spec.Options != nil {
+		optionMap = helpers.MakeOVSDBMap(spec.Options)
 	}
 
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
-
 	interf := Interface{
-		Name:          ifName,
-		Type:          ifType,
-		OFPortRequest: ofPortRequest,
+		Name:          spec.IFName,
+		Type:          spec.IFType,
+		OFPortRequest: spec.OFPortRequest,
 		Options:       optionMap,
 	}
 	ifNamedUUID := tx.Insert(dbtransaction.Insert{
@@ -369,33 +1161,16 @@ func (br *OVSBridge) createPort(name, ifName, ifType string, ofPortRequest int32
 	})
 
 	port := Port{
-		Name: name,
+		Name: spec.Name,
 		Interfaces: helpers.MakeOVSDBSet(map[string]interface{}{
 			"named-uuid": []string{ifNamedUUID},
 		}),
 		ExternalIDs: externalIDMap,
 	}
-	portNamedUUID := tx.Insert(dbtransaction.Insert{
+	return tx.Insert(dbtransaction.Insert{
 		Table: "Port",
 		Row:   port,
 	})
-
-	mutateSet := helpers.MakeOVSDBSet(map[string]interface{}{
-		"named-uuid": []string{portNamedUUID},
-	})
-	tx.Mutate(dbtransaction.Mutate{
-		Table:     "Bridge",
-		Mutations: [][]interface{}{{"ports", "insert", mutateSet}},
-		Where:     [][]interface{}{{"name", "==", br.name}},
-	})
-
-	res, err, temporary := tx.Commit()
-	if err != nil {
-		klog.Error("Transaction failed: ", err)
-		return "", NewTransactionError(err, temporary)
-	}
-
-	return res[1].UUID[1], nil
 }
 
 // GetOFPort retrieves the ofport value of an interface given the interface name.
@@ -403,7 +1178,7 @@ func (br *OVSBridge) createPort(name, ifName, ifType string, ofPortRequest int32
 // the ofport is set on the interface, and so could be blocked for 1 second. If
 // the "wait" operation timeout, value 0 will be returned.
 func (br *OVSBridge) GetOFPort(ifName string) (int32, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 
 	tx.Wait(dbtransaction.Wait{
 		Table:   "Interface",
@@ -432,6 +1207,44 @@ func (br *OVSBridge) GetOFPort(ifName string) (int32, Error) {
 	return ofport, nil
 }
 
+// GetInterfaceMAC returns the MAC address in use by the interface with the provided name, as
+// reported by the mac_in_use column, or an empty string if OVS has not set it yet. This can be used
+// to retrieve the MAC address assigned to an internal port after creating it.
+func (br *OVSBridge) GetInterfaceMAC(ifName string) (string, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Interface",
+		Columns: []string{"mac_in_use"},
+		Where:   [][]interface{}{{"name", "==", ifName}},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	if len(res[0].Rows) == 0 {
+		return "", NewTransactionError(fmt.Errorf("interface %s not found", ifName), false)
+	}
+	return parseInterfaceMAC(res[0].Rows[0].(map[string]interface{}))
+}
+
+// parseInterfaceMAC returns the value of the mac_in_use column of an Interface row. The column is
+// optional, so it is represented as an empty OVSDB set when it is not set.
+func parseInterfaceMAC(row map[string]interface{}) (string, Error) {
+	switch mac := row["mac_in_use"].(type) {
+	case string:
+		return mac, nil
+	case []interface{}:
+		if len(mac) == 2 && mac[0] == "set" {
+			if elems, ok := mac[1].([]interface{}); ok && len(elems) == 0 {
+				return "", nil
+			}
+		}
+	}
+	return "", NewTransactionError(fmt.Errorf("unexpected mac_in_use in Interface row: %v", row["mac_in_use"]), false)
+}
+
 func makeOVSDBSetFromList(list []string) []interface{} {
 	return []interface{}{"set", list}
 }
@@ -458,12 +1271,53 @@ func buildPortDataCommon(port, intf map[string]interface{}, portData *OVSPortDat
 	}
 }
 
+// GetPortUUID returns the UUID of the port to which the interface with the provided name is
+// attached. An empty string and ErrPortNotFound are returned if there is no such port.
+func (br *OVSBridge) GetPortUUID(ifName string) (string, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Interface",
+		Columns: []string{"_uuid"},
+		Where:   [][]interface{}{{"name", "==", ifName}},
+	})
+	tx.Select(dbtransaction.Select{
+		Table:   "Port",
+		Columns: []string{"_uuid", "interfaces"},
+	})
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return "", NewTransactionError(err, temporary)
+	}
+	return parsePortUUID(res[0].Rows, res[1].Rows)
+}
+
+// parsePortUUID returns the UUID of the port among portRows (Port rows including the _uuid and
+// interfaces columns) to which the interface in ifRows (Interface rows including the _uuid column)
+// is attached.
+func parsePortUUID(ifRows, portRows []interface{}) (string, Error) {
+	if len(ifRows) == 0 {
+		return "", ErrPortNotFound
+	}
+	ifUUID := ifRows[0].(map[string]interface{})["_uuid"].([]interface{})[1].(string)
+	for _, row := range portRows {
+		port := row.(map[string]interface{})
+		for _, uuid := range helpers.GetIdListFromOVSDBSet(port["interfaces"].([]interface{})) {
+			if uuid == ifUUID {
+				return port["_uuid"].([]interface{})[1].(string), nil
+			}
+		}
+	}
+	return "", ErrPortNotFound
+}
+
 // GetPortData retrieves port data given the OVS port UUID and interface name.
 // nil is returned, if the port or interface could not be found, or the
 // interface is not attached to the port.
 // The port's OFPort will be set to 0, if its ofport is not assigned by OVS yet.
 func (br *OVSBridge) GetPortData(portUUID, ifName string) (*OVSPortData, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Select(dbtransaction.Select{
 		Table:   "Port",
 		Columns: []string{"name", "external_ids", "interfaces"},
@@ -514,7 +1368,7 @@ func (br *OVSBridge) GetPortData(portUUID, ifName string) (*OVSPortData, Error)
 // GetPortList returns all ports on the bridge.
 // A port's OFPort will be set to 0, if its ofport is not assigned by OVS yet.
 func (br *OVSBridge) GetPortList() ([]OVSPortData, Error) {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+	tx := br.newTransaction()
 	tx.Select(dbtransaction.Select{
 		Table:   "Bridge",
 		Columns: []string{"ports"},
@@ -567,22 +1421,258 @@ func (br *OVSBridge) GetPortList() ([]OVSPortData, Error) {
 	return portList, nil
 }
 
-func (br *OVSBridge) SetInterfaceMTU(name string, MTU int) error {
-	tx := br.ovsdb.Transaction(openvSwitchSchema)
+// WaitForPorts polls the port list of the bridge until all the ports with the provided names exist
+// and have been assigned an ofport by OVS. A timeout error is returned if the ports are not ready
+// after the provided timeout.
+func (br *OVSBridge) WaitForPorts(names []string, timeout time.Duration) Error {
+	return waitForPorts(br.GetPortList, names, waitForPortsInterval, timeout)
+}
+
+func waitForPorts(getPortList func() ([]OVSPortData, Error), names []string, interval, timeout time.Duration) Error {
+	var pending []string
+	var lastErr Error
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		ports, err := getPortList()
+		if err != nil {
+			if !err.Temporary() {
+				return false, err
+			}
+			// Keep polling, the error is reported if the ports are still not ready when
+			// the timeout expires.
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		pending = missingPorts(ports, names)
+		return len(pending) == 0, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if err != wait.ErrWaitTimeout {
+		return err.(Error)
+	}
+	if lastErr != nil {
+		return NewTransactionError(fmt.Errorf("timed out: waiting for ports %v: %v", names, lastErr), true)
+	}
+	return NewTransactionError(fmt.Errorf("timed out: ports %v not ready", pending), true)
+}
+
+// missingPorts returns the names which do not match a port with an assigned ofport.
+func missingPorts(ports []OVSPortData, names []string) []string {
+	ready := make(map[string]bool, len(ports))
+	for _, port := range ports {
+		if port.OFPort > 0 {
+			ready[port.Name] = true
+		}
+	}
+	var missing []string
+	for _, name := range names {
+		if !ready[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// GetTunnelPorts returns all the VXLAN and Geneve tunnel interfaces of the bridge. An interface's
+// OFPort will be set to 0, if its ofport is not assigned by OVS yet.
+func (br *OVSBridge) GetTunnelPorts() ([]TunnelPortData, Error) {
+	tx := br.newTransaction()
+	tx.Select(dbtransaction.Select{
+		Table:   "Bridge",
+		Columns: []string{"ports"},
+		Where:   [][]interface{}{{"name", "==", br.name}},
+	})
+	tx.Select(dbtransaction.Select{
+		Table:   "Port",
+		Columns: []string{"_uuid", "interfaces"},
+	})
+	for _, tunnelType := range []string{VXLAN_TUNNEL, GENEVE_TUNNEL} {
+		tx.Select(dbtransaction.Select{
+			Table:   "Interface",
+			Columns: []string{"_uuid", "name", "type", "ofport", "options"},
+			Where:   [][]interface{}{{"type", "==", tunnelType}},
+		})
+	}
+
+	res, err, temporary := tx.Commit()
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return nil, NewTransactionError(err, temporary)
+	}
+
+	if len(res[0].Rows) == 0 {
+		klog.Warning("Could not find bridge")
+		return []TunnelPortData{}, nil
+	}
+	bridgePorts := make(map[string]bool)
+	for _, uuid := range helpers.GetIdListFromOVSDBSet(res[0].Rows[0].(map[string]interface{})["ports"].([]interface{})) {
+		bridgePorts[uuid] = true
+	}
+	// Tunnel interfaces may belong to other bridges, so only the interfaces attached to the
+	// ports of this bridge are returned.
+	bridgeIfaces := make(map[string]bool)
+	for _, row := range res[1].Rows {
+		port := row.(map[string]interface{})
+		if !bridgePorts[port["_uuid"].([]interface{})[1].(string)] {
+			continue
+		}
+		for _, uuid := range helpers.GetIdListFromOVSDBSet(port["interfaces"].([]interface{})) {
+			bridgeIfaces[uuid] = true
+		}
+	}
+
+	tunnelPorts := []TunnelPortData{}
+	for _, ifRes := range res[2:] {
+		for _, row := range ifRes.Rows {
+			intf := row.(map[string]interface{})
+			if !bridgeIfaces[intf["_uuid"].([]interface{})[1].(string)] {
+				continue
+			}
+			tunnelPorts = append(tunnelPorts, buildTunnelPortData(intf))
+		}
+	}
+	return tunnelPorts, nil
+}
+
+func buildTunnelPortData(intf map[string]interface{}) TunnelPortData {
+	portData := TunnelPortData{
+		Name:     intf["name"].(string),
+		Type:     intf["type"].(string),
+		RemoteIP: buildMapFromOVSDBMap(intf["options"].([]interface{}))["remote_ip"],
+	}
+	if ofPort, ok := intf["ofport"].(float64); ok {
+		portData.OFPort = int32(ofPort)
+	}
+	return portData
+}
 
+// SetPortExternalIDs replaces the external IDs of the port with the provided name.
+func (br *OVSBridge) SetPortExternalIDs(portName string, externalIDs map[string]interface{}) Error {
+	tx := br.newTransaction()
 	tx.Update(dbtransaction.Update{
-		Table: "Interface",
-		Where: [][]interface{}{{"name", "==", name}},
+		Table: "Port",
+		Where: [][]interface{}{{"name", "==", portName}},
 		Row: map[string]interface{}{
-			"mtu_request": MTU,
+			"external_ids": helpers.MakeOVSDBMap(externalIDs),
 		},
 	})
 
-	_, err, temporary := tx.Commit()
+	_, err, temporary := br.commit(opUpdatePort, tx)
 	if err != nil {
 		klog.Error("Transaction failed: ", err)
 		return NewTransactionError(err, temporary)
 	}
+	return nil
+}
+
+// MarkPortsForGC sets the GCExternalIDKey external ID to "true" on the ports with the provided
+// UUIDs, without changing their other external IDs. The marked ports are deleted by the next call
+// to DeletePortsMarkedForGC.
+func (br *OVSBridge) MarkPortsForGC(portUUIDList []string) Error {
+	tx := br.newTransaction()
+	markPortsForGCOps(tx, portUUIDList)
+
+	_, err, temporary := br.commit(opUpdatePort, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
+	return nil
+}
 
+// markPortsForGCOps adds the mutations marking the ports with the provided UUIDs for garbage
+// collection to the transaction. An OVSDB "insert" mutation does not overwrite an existing key in a
+// map, so the key is deleted first.
+func markPortsForGCOps(tx *dbtransaction.Transaction, portUUIDList []string) {
+	for _, portUUID := range portUUIDList {
+		tx.Mutate(dbtransaction.Mutate{
+			Table: "Port",
+			Where: [][]interface{}{{"_uuid", "==", []string{"uuid", portUUID}}},
+			Mutations: [][]interface{}{
+				{"external_ids", "delete", []interface{}{"set", []interface{}{GCExternalIDKey}}},
+				{"external_ids", "insert", helpers.MakeOVSDBMap(map[string]interface{}{GCExternalIDKey: "true"})},
+			},
+		})
+	}
+}
+
+// DeletePortsMarkedForGC deletes all the ports of the bridge which have been marked for garbage
+// collection with MarkPortsForGC, and returns the names of the deleted ports.
+func (br *OVSBridge) DeletePortsMarkedForGC() ([]string, Error) {
+	ports, err := br.GetPortList()
+	if err != nil {
+		return nil, err
+	}
+	marked := portsMarkedForGC(ports)
+	if len(marked) == 0 {
+		return nil, nil
+	}
+	portUUIDList := make([]string, 0, len(marked))
+	portNames := make([]string, 0, len(marked))
+	for _, port := range marked {
+		portUUIDList = append(portUUIDList, port.UUID)
+		portNames = append(portNames, port.Name)
+	}
+	if err := br.DeletePorts(portUUIDList); err != nil {
+		return nil, err
+	}
+	return portNames, nil
+}
+
+// portsMarkedForGC returns the ports among the provided ones which are marked for garbage
+// collection.
+func portsMarkedForGC(ports []OVSPortData) []OVSPortData {
+	var marked []OVSPortData
+	for _, port := range ports {
+		if port.ExternalIDs[GCExternalIDKey] == "true" {
+			marked = append(marked, port)
+		}
+	}
+	return marked
+}
+
+// SetInterfaceMTU sets the requested MTU (mtu_request) of the interface with the provided name.
+func (br *OVSBridge) SetInterfaceMTU(name string, MTU int) Error {
+	return br.updateInterfaceRow(name, map[string]interface{}{
+		"mtu_request": MTU,
+	})
+}
+
+// SetInterfaceIngressPolicing limits the rate at which the interface with the provided name
+// receives packets from the attached device, by setting the ingress_policing_rate (in kbps) and
+// ingress_policing_burst (in kb) columns of the Interface row. Packets exceeding the rate are
+// dropped. A rate of 0 disables policing; a burst of 0 lets OVS use its default burst size.
+func (br *OVSBridge) SetInterfaceIngressPolicing(ifName string, rateKbps, burstKb int) Error {
+	if rateKbps < 0 || burstKb < 0 {
+		return NewTransactionError(fmt.Errorf("invalid ingress policing rate %d or burst %d for interface %s", rateKbps, burstKb, ifName), false)
+	}
+	return br.updateInterfaceRow(ifName, map[string]interface{}{
+		"ingress_policing_rate":  rateKbps,
+		"ingress_policing_burst": burstKb,
+	})
+}
+
+// ClearInterfaceIngressPolicing disables ingress policing for the interface with the provided name.
+func (br *OVSBridge) ClearInterfaceIngressPolicing(ifName string) Error {
+	return br.SetInterfaceIngressPolicing(ifName, 0, 0)
+}
+
+// updateInterfaceRow updates the columns provided in row for the Interface row with the provided
+// name.
+func (br *OVSBridge) updateInterfaceRow(ifName string, row map[string]interface{}) Error {
+	tx := br.newTransaction()
+	tx.Update(dbtransaction.Update{
+		Table: "Interface",
+		Where: [][]interface{}{{"name", "==", ifName}},
+		Row:   row,
+	})
+
+	_, err, temporary := br.commit(opUpdateInterface, tx)
+	if err != nil {
+		klog.Error("Transaction failed: ", err)
+		return NewTransactionError(err, temporary)
+	}
 	return nil
 }
@@ -0,0 +1,585 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovsconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/dbtransaction"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionOptionsDefaults(t *testing.T) {
+	opts := ConnectionOptions{MaxBackoff: 30 * time.Second}
+	opts.setDefaults()
+	assert.Equal(t, defaultProbeInterval, opts.ProbeInterval)
+	assert.Equal(t, defaultInitialBackoff, opts.InitialBackoff)
+	assert.Equal(t, 30*time.Second, opts.MaxBackoff, "Provided value should not be overridden")
+}
+
+func TestLogUntilConnectedExits(t *testing.T) {
+	success := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		logUntilConnected(success, 10*time.Millisecond, 20*time.Millisecond)
+		close(done)
+	}()
+
+	// Let the goroutine log a few messages before signaling success.
+	time.Sleep(50 * time.Millisecond)
+	success <- true
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Logging goroutine did not exit after connection success")
+	}
+}
+
+// probeCountingOVSDB counts the echo requests sent by probeConnection, and replies to all of them.
+type probeCountingOVSDB struct {
+	sync.Mutex
+	calls int
+}
+
+func (db *probeCountingOVSDB) Call(method string, args interface{}, id *uint64) (json.RawMessage, error) {
+	db.Lock()
+	defer db.Unlock()
+	db.calls++
+	return nil, nil
+}
+
+func (db *probeCountingOVSDB) Close() error {
+	return nil
+}
+
+func (db *probeCountingOVSDB) numCalls() int {
+	db.Lock()
+	defer db.Unlock()
+	return db.calls
+}
+
+func TestProbeConnectionStops(t *testing.T) {
+	db := &probeCountingOVSDB{}
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		probeConnection(db, 10*time.Millisecond, stopCh)
+		close(done)
+	}()
+
+	// Let the goroutine send a few echo requests before stopping it.
+	time.Sleep(50 * time.Millisecond)
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Probing goroutine did not exit after being stopped")
+	}
+	assert.NotZero(t, db.numCalls(), "Connection should have been probed")
+}
+
+func TestParseDatapathType(t *testing.T) {
+	for _, tc := range []struct {
+		row          map[string]interface{}
+		expectedType string
+		expectedErr  bool
+	}{
+		{map[string]interface{}{"datapath_type": "netdev"}, OVSDatapathNetdev, false},
+		{map[string]interface{}{"datapath_type": "system"}, OVSDatapathSystem, false},
+		// OVS uses the system datapath when the column is empty.
+		{map[string]interface{}{"datapath_type": ""}, OVSDatapathSystem, false},
+		{map[string]interface{}{}, "", true},
+		{map[string]interface{}{"datapath_type": []interface{}{"set", []interface{}{}}}, "", true},
+	} {
+		datapathType, err := parseDatapathType(tc.row)
+		if tc.expectedErr {
+			assert.NotNil(t, err, "Expected error when parsing row %v", tc.row)
+		} else {
+			assert.Nil(t, err, "Unexpected error when parsing row %v", tc.row)
+			assert.Equal(t, tc.expectedType, datapathType)
+		}
+	}
+}
+
+func TestSetControllerOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	setControllerOps(tx, "br-int", "tcp:127.0.0.1:6653")
+	require.Len(t, tx.Actions, 2)
+
+	insert := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "insert", insert["op"])
+	assert.Equal(t, "Controller", insert["table"])
+	assert.Equal(t, Controller{Target: "tcp:127.0.0.1:6653"}, insert["row"])
+
+	update := tx.Actions[1].(map[string]interface{})
+	assert.Equal(t, "update", update["op"])
+	assert.Equal(t, "Bridge", update["table"])
+	assert.Equal(t, [][]interface{}{{"name", "==", "br-int"}}, update["where"])
+	expectedSet := []interface{}{"set", []interface{}{[]string{"named-uuid", insert["uuid-name"].(string)}}}
+	assert.Equal(t, map[string]interface{}{"controller": expectedSet}, update["row"])
+}
+
+func TestDeleteControllerOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	deleteControllerOps(tx, "br-int")
+	require.Len(t, tx.Actions, 1)
+
+	update := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "update", update["op"])
+	assert.Equal(t, "Bridge", update["table"])
+	assert.Equal(t, [][]interface{}{{"name", "==", "br-int"}}, update["where"])
+	assert.Equal(t, map[string]interface{}{"controller": []interface{}{"set", []string{}}}, update["row"])
+}
+
+func TestSetBridgeOtherConfigOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	setBridgeOtherConfigOps(tx, "br-int", bridgeMACOtherConfigKey, "aa:bb:cc:dd:ee:ff")
+	require.Len(t, tx.Actions, 1)
+
+	mutate := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "mutate", mutate["op"])
+	assert.Equal(t, "Bridge", mutate["table"])
+	assert.Equal(t, [][]interface{}{{"name", "==", "br-int"}}, mutate["where"])
+	expectedMutations := [][]interface{}{
+		{"other_config", "delete", []interface{}{"set", []interface{}{"hwaddr"}}},
+		{"other_config", "insert", []interface{}{"map", []interface{}{[]string{"hwaddr", "aa:bb:cc:dd:ee:ff"}}}},
+	}
+	assert.Equal(t, expectedMutations, mutate["mutations"])
+}
+
+func TestSetHardwareOffloadOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	setHardwareOffloadOps(tx, true)
+	require.Len(t, tx.Actions, 1)
+
+	mutate := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "mutate", mutate["op"])
+	assert.Equal(t, "Open_vSwitch", mutate["table"])
+	// The Open_vSwitch table has a single row, which is matched by an empty condition.
+	assert.Equal(t, [][]interface{}{}, mutate["where"])
+	expectedMutations := [][]interface{}{
+		{"other_config", "delete", []interface{}{"set", []interface{}{"hw-offload"}}},
+		{"other_config", "insert", []interface{}{"map", []interface{}{[]string{"hw-offload", "true"}}}},
+	}
+	assert.Equal(t, expectedMutations, mutate["mutations"])
+}
+
+func TestParseControllerStatus(t *testing.T) {
+	controllerRow := func(uuid, target string, connected bool) interface{} {
+		return map[string]interface{}{"_uuid": []interface{}{"uuid", uuid}, "target": target, "is_connected": connected}
+	}
+	controllerRows := []interface{}{
+		controllerRow("uuid1", "tcp:127.0.0.1:6653", true),
+		controllerRow("uuid2", "tcp:10.0.0.1:6653", false),
+	}
+	for _, tc := range []struct {
+		name              string
+		bridgeRow         map[string]interface{}
+		expectedConnected bool
+		expectedTarget    string
+		expectedErr       bool
+	}{
+		{"connected", map[string]interface{}{"controller": []interface{}{"uuid", "uuid1"}}, true, "tcp:127.0.0.1:6653", false},
+		{"disconnected", map[string]interface{}{"controller": []interface{}{"uuid", "uuid2"}}, false, "tcp:10.0.0.1:6653", false},
+		{"no controller", map[string]interface{}{"controller": []interface{}{"set", []interface{}{}}}, false, "", false},
+		{"missing controller row", map[string]interface{}{"controller": []interface{}{"uuid", "uuid3"}}, false, "", true},
+		{"invalid bridge row", map[string]interface{}{}, false, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			connected, target, err := parseControllerStatus(tc.bridgeRow, controllerRows)
+			if tc.expectedErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.expectedConnected, connected)
+				assert.Equal(t, tc.expectedTarget, target)
+			}
+		})
+	}
+}
+
+func TestSetBridgeMACInvalid(t *testing.T) {
+	br := NewOVSBridge("br-test", OVSDatapathSystem, nil)
+	// The MAC address is validated before any transaction is created.
+	assert.NotNil(t, br.SetBridgeMAC("aa:bb:cc:dd:ee"), "Expected error for invalid MAC address")
+}
+
+func TestParseBridgeMAC(t *testing.T) {
+	for _, tc := range []struct {
+		row         map[string]interface{}
+		expectedMAC string
+		expectedErr bool
+	}{
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{[]interface{}{"hwaddr", "aa:bb:cc:dd:ee:ff"}}}}, "aa:bb:cc:dd:ee:ff", false},
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{[]interface{}{"stp-priority", "32768"}}}}, "", false},
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{}}}, "", false},
+		{map[string]interface{}{}, "", true},
+	} {
+		mac, err := parseBridgeMAC(tc.row)
+		if tc.expectedErr {
+			assert.NotNil(t, err, "Expected error when parsing row %v", tc.row)
+		} else {
+			assert.Nil(t, err, "Unexpected error when parsing row %v", tc.row)
+			assert.Equal(t, tc.expectedMAC, mac)
+		}
+	}
+}
+
+func TestParseFlowRestoreWait(t *testing.T) {
+	for _, tc := range []struct {
+		row         map[string]interface{}
+		expected    bool
+		expectedErr bool
+	}{
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{[]interface{}{"flow-restore-wait", "true"}}}}, true, false},
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{[]interface{}{"flow-restore-wait", "false"}}}}, false, false},
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{[]interface{}{"hw-offload", "true"}}}}, false, false},
+		{map[string]interface{}{"other_config": []interface{}{"map", []interface{}{}}}, false, false},
+		{map[string]interface{}{}, false, true},
+	} {
+		flowRestoreWait, err := parseFlowRestoreWait(tc.row)
+		if tc.expectedErr {
+			assert.NotNil(t, err, "Expected error when parsing row %v", tc.row)
+		} else {
+			assert.Nil(t, err, "Unexpected error when parsing row %v", tc.row)
+			assert.Equal(t, tc.expected, flowRestoreWait)
+		}
+	}
+}
+
+func TestParseInterfaceMAC(t *testing.T) {
+	for _, tc := range []struct {
+		row         map[string]interface{}
+		expectedMAC string
+		expectedErr bool
+	}{
+		{map[string]interface{}{"mac_in_use": "aa:bb:cc:dd:ee:ff"}, "aa:bb:cc:dd:ee:ff", false},
+		{map[string]interface{}{"mac_in_use": []interface{}{"set", []interface{}{}}}, "", false},
+		{map[string]interface{}{"mac_in_use": []interface{}{"map", []interface{}{}}}, "", true},
+		{map[string]interface{}{}, "", true},
+	} {
+		mac, err := parseInterfaceMAC(tc.row)
+		if tc.expectedErr {
+			assert.NotNil(t, err, "Expected error when parsing row %v", tc.row)
+		} else {
+			assert.Nil(t, err, "Unexpected error when parsing row %v", tc.row)
+			assert.Equal(t, tc.expectedMAC, mac)
+		}
+	}
+}
+
+func TestParsePortUUID(t *testing.T) {
+	uuidRow := func(uuid string) map[string]interface{} {
+		return map[string]interface{}{"_uuid": []interface{}{"uuid", uuid}}
+	}
+	ifRows := []interface{}{uuidRow("if-2")}
+	portRows := []interface{}{
+		map[string]interface{}{
+			"_uuid":      []interface{}{"uuid", "port-1"},
+			"interfaces": []interface{}{"uuid", "if-1"},
+		},
+		// A port with multiple interfaces (e.g. a bond) is represented with a set.
+		map[string]interface{}{
+			"_uuid":      []interface{}{"uuid", "port-2"},
+			"interfaces": []interface{}{"set", []interface{}{[]interface{}{"uuid", "if-3"}, []interface{}{"uuid", "if-2"}}},
+		},
+	}
+
+	portUUID, err := parsePortUUID(ifRows, portRows)
+	require.Nil(t, err)
+	assert.Equal(t, "port-2", portUUID)
+
+	portUUID, err = parsePortUUID(nil, portRows)
+	assert.Equal(t, ErrPortNotFound, err)
+	assert.Empty(t, portUUID)
+
+	// The interface exists but is not attached to any port.
+	portUUID, err = parsePortUUID([]interface{}{uuidRow("if-4")}, portRows)
+	assert.Equal(t, ErrPortNotFound, err)
+	assert.Empty(t, portUUID)
+}
+
+func TestSetProtocols(t *testing.T) {
+	br := NewOVSBridge("br-test", OVSDatapathSystem, nil)
+	assert.Equal(t, []string{OpenFlow10, OpenFlow13}, br.protocols, "Unexpected default protocols")
+
+	// The bridge is not created yet, so no transaction is committed.
+	require.Nil(t, br.SetProtocols([]string{OpenFlow13, OpenFlow14}))
+	assert.Equal(t, []string{OpenFlow13, OpenFlow14}, br.protocols)
+
+	assert.NotNil(t, br.SetProtocols([]string{OpenFlow13, "OpenFlow16"}), "Expected error for unknown version")
+	assert.NotNil(t, br.SetProtocols(nil), "Expected error for empty list")
+	assert.Equal(t, []string{OpenFlow13, OpenFlow14}, br.protocols, "Protocols should not change on error")
+}
+
+// fakeOVSDB fails all the requests with the provided error.
+type fakeOVSDB struct {
+	err error
+}
+
+func (db *fakeOVSDB) Call(method string, args interface{}, id *uint64) (json.RawMessage, error) {
+	return nil, db.err
+}
+
+func (db *fakeOVSDB) Notify(method string, args interface{}) error {
+	return db.err
+}
+
+func TestCommitFailureMetrics(t *testing.T) {
+	br := NewOVSBridge("br-test", OVSDatapathSystem, nil)
+	temporaryFailures := transactionFailures.WithLabelValues(opCreatePorts, failureTemporary)
+	permanentFailures := transactionFailures.WithLabelValues(opCreatePorts, failurePermanent)
+	before := testutil.ToFloat64(temporaryFailures)
+
+	// The OVSDB library reports connection errors as temporary.
+	tx := &dbtransaction.Transaction{OVSDB: &fakeOVSDB{err: errors.New("connection closed")}, Schema: openvSwitchSchema}
+	_, err, temporary := br.commit(opCreatePorts, tx)
+	require.NotNil(t, err)
+	assert.True(t, temporary)
+	assert.Equal(t, before+1, testutil.ToFloat64(temporaryFailures))
+	assert.Equal(t, float64(0), testutil.ToFloat64(permanentFailures))
+}
+
+// TestSetInterfaceMTUTemporaryError checks that SetInterfaceMTU preserves the temporary flag of the
+// error returned by a failed transaction.
+func TestSetInterfaceMTUTemporaryError(t *testing.T) {
+	br := NewOVSBridge("br-test", OVSDatapathSystem, nil)
+	var tx *dbtransaction.Transaction
+	br.newTransaction = func() *dbtransaction.Transaction {
+		tx = &dbtransaction.Transaction{OVSDB: &fakeOVSDB{err: errors.New("connection closed")}, Schema: openvSwitchSchema}
+		return tx
+	}
+	temporaryFailures := transactionFailures.WithLabelValues(opUpdateInterface, failureTemporary)
+	before := testutil.ToFloat64(temporaryFailures)
+
+	err := br.SetInterfaceMTU("gw0", 1450)
+	require.NotNil(t, err)
+	assert.True(t, err.Temporary(), "The temporary flag of the transaction error should be preserved")
+	assert.Equal(t, before+1, testutil.ToFloat64(temporaryFailures))
+	require.Len(t, tx.Actions, 1)
+	assert.Equal(t, map[string]interface{}{"mtu_request": 1450}, tx.Actions[0].(map[string]interface{})["row"])
+}
+
+func TestBuildTunnelPortData(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		intf     map[string]interface{}
+		expected TunnelPortData
+	}{
+		{
+			name: "flow-based tunnel",
+			intf: map[string]interface{}{
+				"name":    "tun0",
+				"type":    VXLAN_TUNNEL,
+				"ofport":  float64(1),
+				"options": []interface{}{"map", []interface{}{[]interface{}{"key", "flow"}, []interface{}{"remote_ip", "flow"}}},
+			},
+			expected: TunnelPortData{Name: "tun0", OFPort: 1, Type: VXLAN_TUNNEL, RemoteIP: "flow"},
+		},
+		{
+			name: "point-to-point tunnel",
+			intf: map[string]interface{}{
+				"name":    "node2-tun",
+				"type":    GENEVE_TUNNEL,
+				"ofport":  float64(12),
+				"options": []interface{}{"map", []interface{}{[]interface{}{"remote_ip", "10.10.0.2"}}},
+			},
+			expected: TunnelPortData{Name: "node2-tun", OFPort: 12, Type: GENEVE_TUNNEL, RemoteIP: "10.10.0.2"},
+		},
+		{
+			name: "ofport not assigned",
+			intf: map[string]interface{}{
+				"name":    "node3-tun",
+				"type":    GENEVE_TUNNEL,
+				"ofport":  []interface{}{"set", []interface{}{}},
+				"options": []interface{}{"map", []interface{}{[]interface{}{"remote_ip", "10.10.0.3"}}},
+			},
+			expected: TunnelPortData{Name: "node3-tun", OFPort: 0, Type: GENEVE_TUNNEL, RemoteIP: "10.10.0.3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, buildTunnelPortData(tc.intf))
+		})
+	}
+}
+
+func TestCreateTunnelPortOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	externalIDs := map[string]interface{}{"interface-type": "tunnel"}
+	insertPort(tx, tunnelPortSpec("tun0", GENEVE_TUNNEL, 1, "10.10.0.2", externalIDs))
+	require.Len(t, tx.Actions, 2)
+
+	ifaceInsert := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "insert", ifaceInsert["op"])
+	assert.Equal(t, "Interface", ifaceInsert["table"])
+	intf := ifaceInsert["row"].(Interface)
+	assert.Equal(t, "tun0", intf.Name)
+	assert.Equal(t, GENEVE_TUNNEL, intf.Type)
+	assert.Equal(t, int32(1), intf.OFPortRequest)
+	assert.Equal(t, []interface{}{"map", []interface{}{[]string{"remote_ip", "10.10.0.2"}}}, intf.Options)
+
+	portInsert := tx.Actions[1].(map[string]interface{})
+	assert.Equal(t, "insert", portInsert["op"])
+	assert.Equal(t, "Port", portInsert["table"])
+	port := portInsert["row"].(Port)
+	assert.Equal(t, "tun0", port.Name)
+	assert.Equal(t, []interface{}{"map", []interface{}{[]string{"interface-type", "tunnel"}}}, port.ExternalIDs)
+}
+
+func TestCreatePatchPortOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	insertPort(tx, patchPortSpec("patch-ext", "patch-int", 0, nil))
+	require.Len(t, tx.Actions, 2)
+
+	ifaceInsert := tx.Actions[0].(map[string]interface{})
+	assert.Equal(t, "Interface", ifaceInsert["table"])
+	intf := ifaceInsert["row"].(Interface)
+	assert.Equal(t, "patch-ext", intf.Name)
+	assert.Equal(t, "patch", intf.Type)
+	assert.Equal(t, []interface{}{"map", []interface{}{[]string{"peer", "patch-int"}}}, intf.Options)
+
+	portInsert := tx.Actions[1].(map[string]interface{})
+	assert.Equal(t, "Port", portInsert["table"])
+	assert.Equal(t, "patch-ext", portInsert["row"].(Port).Name)
+}
+
+func TestReplacePortOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	replacePortOps(tx, "br-int", "old-uuid", PortSpec{Name: "port1", IFName: "port1", OFPortRequest: 10})
+	require.Len(t, tx.Actions, 3)
+
+	intf := tx.Actions[0].(map[string]interface{})["row"].(Interface)
+	assert.Equal(t, "port1", intf.Name)
+	assert.Equal(t, int32(10), intf.OFPortRequest)
+	portInsert := tx.Actions[1].(map[string]interface{})
+	assert.Equal(t, "Port", portInsert["table"])
+	portNamedUUID := portInsert["uuid-name"]
+
+	mutate := tx.Actions[2].(map[string]interface{})
+	assert.Equal(t, "mutate", mutate["op"])
+	assert.Equal(t, "Bridge", mutate["table"])
+	assert.Equal(t, [][]interface{}{{"name", "==", "br-int"}}, mutate["where"])
+	assert.Equal(t, [][]interface{}{
+		{"ports", "delete", []interface{}{"set", []interface{}{[]string{"uuid", "old-uuid"}}}},
+		{"ports", "insert", []interface{}{"set", []interface{}{[]string{"named-uuid", portNamedUUID.(string)}}}},
+	}, mutate["mutations"])
+}
+
+func TestMarkPortsForGCOperations(t *testing.T) {
+	tx := &dbtransaction.Transaction{}
+	markPortsForGCOps(tx, []string{"uuid1", "uuid2"})
+	require.Len(t, tx.Actions, 2)
+
+	for i, uuid := range []string{"uuid1", "uuid2"} {
+		mutate := tx.Actions[i].(map[string]interface{})
+		assert.Equal(t, "mutate", mutate["op"])
+		assert.Equal(t, "Port", mutate["table"])
+		assert.Equal(t, [][]interface{}{{"_uuid", "==", []string{"uuid", uuid}}}, mutate["where"])
+		assert.Equal(t, [][]interface{}{
+			{"external_ids", "delete", []interface{}{"set", []interface{}{GCExternalIDKey}}},
+			{"external_ids", "insert", []interface{}{"map", []interface{}{[]string{GCExternalIDKey, "true"}}}},
+		}, mutate["mutations"])
+	}
+}
+
+func TestPortsMarkedForGC(t *testing.T) {
+	markedPort := OVSPortData{UUID: "uuid1", Name: "port1", ExternalIDs: map[string]string{"container-id": "c1", GCExternalIDKey: "true"}}
+	ports := []OVSPortData{
+		markedPort,
+		{UUID: "uuid2", Name: "port2", ExternalIDs: map[string]string{"container-id": "c2"}},
+		{UUID: "uuid3", Name: "port3", ExternalIDs: map[string]string{GCExternalIDKey: "false"}},
+		{UUID: "uuid4", Name: "port4"},
+	}
+	assert.Equal(t, []OVSPortData{markedPort}, portsMarkedForGC(ports))
+	assert.Empty(t, portsMarkedForGC(ports[1:]))
+}
+
+func TestWaitForPorts(t *testing.T) {
+	gwPort := OVSPortData{Name: "gw0", IFName: "gw0", OFPort: 2}
+	tunPort := OVSPortData{Name: "tun0", IFName: "tun0", OFPort: 1}
+	tunPortNoOFPort := OVSPortData{Name: "tun0", IFName: "tun0"}
+	transientErr := NewTransactionError(errors.New("connection reset"), true)
+
+	// fakePortList returns the provided results in order, and keeps returning the last one.
+	fakePortList := func(results ...func() ([]OVSPortData, Error)) func() ([]OVSPortData, Error) {
+		calls := 0
+		return func() ([]OVSPortData, Error) {
+			result := results[calls]
+			if calls < len(results)-1 {
+				calls++
+			}
+			return result()
+		}
+	}
+	ports := func(ports ...OVSPortData) func() ([]OVSPortData, Error) {
+		return func() ([]OVSPortData, Error) { return ports, nil }
+	}
+	failure := func(err Error) func() ([]OVSPortData, Error) {
+		return func() ([]OVSPortData, Error) { return nil, err }
+	}
+
+	t.Run("ports eventually ready", func(t *testing.T) {
+		getPortList := fakePortList(ports(), failure(transientErr), ports(gwPort, tunPortNoOFPort), ports(gwPort, tunPort))
+		err := waitForPorts(getPortList, []string{"gw0", "tun0"}, time.Millisecond, time.Second)
+		assert.Nil(t, err)
+	})
+
+	t.Run("port never assigned an ofport", func(t *testing.T) {
+		getPortList := fakePortList(ports(gwPort, tunPortNoOFPort))
+		err := waitForPorts(getPortList, []string{"gw0", "tun0"}, time.Millisecond, 20*time.Millisecond)
+		require.NotNil(t, err)
+		assert.True(t, err.Timeout())
+		assert.Contains(t, err.Error(), "[tun0]")
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		permanentErr := NewTransactionError(errors.New("invalid schema"), false)
+		getPortList := fakePortList(failure(permanentErr), ports(gwPort))
+		err := waitForPorts(getPortList, []string{"gw0"}, time.Millisecond, time.Second)
+		assert.Equal(t, permanentErr, err)
+	})
+}
+
+func TestProtocolsForOVSVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		protocols  []string
+		ovsVersion string
+		expected   []string
+		expectErr  bool
+	}{
+		{"recent OVS", []string{OpenFlow10, OpenFlow13}, "2.11.1", []string{OpenFlow10, OpenFlow13}, false},
+		{"OVS without OpenFlow 1.3", []string{OpenFlow10, OpenFlow13}, "1.9.3", []string{OpenFlow10}, false},
+		{"OVS without OpenFlow 1.4", []string{OpenFlow13, OpenFlow14}, "2.1.0", []string{OpenFlow13}, false},
+		{"no supported protocol", []string{OpenFlow14, OpenFlow15}, "2.0.2", nil, true},
+		{"unparsable version", []string{OpenFlow10, OpenFlow13}, "unknown", []string{OpenFlow10, OpenFlow13}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			protocols, err := protocolsForOVSVersion(tc.protocols, tc.ovsVersion)
+			if tc.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, tc.expected, protocols)
+			}
+		})
+	}
+}
@@ -20,6 +20,10 @@ type Bridge struct {
 	DatapathType string        `json:"datapath_type,omitempty"`
 }
 
+type Controller struct {
+	Target string `json:"target"`
+}
+
 type Port struct {
 	Name        string        `json:"name"`
 	Interfaces  []interface{} `json:"interfaces"`
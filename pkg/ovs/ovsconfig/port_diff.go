@@ -0,0 +1,56 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovsconfig
+
+// DiffPortLists compares two lists of OVS ports, e.g. the results of GetPortList before and after an
+// operation, and returns the ports which were added, the ports which were removed, and the ports
+// whose OpenFlow port number or external IDs changed. Ports are matched by UUID. The returned ports
+// follow the order of the input lists, and changed ports are returned with their data from after.
+func DiffPortLists(before, after []OVSPortData) (added, removed, changed []OVSPortData) {
+	beforePorts := make(map[string]*OVSPortData, len(before))
+	for i := range before {
+		beforePorts[before[i].UUID] = &before[i]
+	}
+	afterPorts := make(map[string]bool, len(after))
+	for _, port := range after {
+		afterPorts[port.UUID] = true
+		oldPort, found := beforePorts[port.UUID]
+		if !found {
+			added = append(added, port)
+		} else if oldPort.OFPort != port.OFPort || !externalIDsEqual(oldPort.ExternalIDs, port.ExternalIDs) {
+			changed = append(changed, port)
+		}
+	}
+	for _, port := range before {
+		if !afterPorts[port.UUID] {
+			removed = append(removed, port)
+		}
+	}
+	return added, removed, changed
+}
+
+// externalIDsEqual returns whether two external ID maps have the same entries. A nil map is equal
+// to an empty one.
+func externalIDsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
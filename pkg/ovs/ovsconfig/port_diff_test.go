@@ -0,0 +1,84 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovsconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPortLists(t *testing.T) {
+	gatewayPort := OVSPortData{UUID: "uuid-gw", Name: "gw0", OFPort: 2}
+	podPort := OVSPortData{UUID: "uuid-pod1", Name: "pod1-abc", OFPort: 3, ExternalIDs: map[string]string{"pod-name": "pod1"}}
+	tests := []struct {
+		name            string
+		before          []OVSPortData
+		after           []OVSPortData
+		expectedAdded   []OVSPortData
+		expectedRemoved []OVSPortData
+		expectedChanged []OVSPortData
+	}{
+		{
+			name:   "unchanged",
+			before: []OVSPortData{gatewayPort, podPort},
+			after:  []OVSPortData{podPort, gatewayPort},
+		},
+		{
+			name:          "added",
+			before:        []OVSPortData{gatewayPort},
+			after:         []OVSPortData{gatewayPort, podPort},
+			expectedAdded: []OVSPortData{podPort},
+		},
+		{
+			name:            "removed",
+			before:          []OVSPortData{gatewayPort, podPort},
+			after:           []OVSPortData{gatewayPort},
+			expectedRemoved: []OVSPortData{podPort},
+		},
+		{
+			name:            "ofport changed",
+			before:          []OVSPortData{podPort},
+			after:           []OVSPortData{{UUID: "uuid-pod1", Name: "pod1-abc", OFPort: 4, ExternalIDs: map[string]string{"pod-name": "pod1"}}},
+			expectedChanged: []OVSPortData{{UUID: "uuid-pod1", Name: "pod1-abc", OFPort: 4, ExternalIDs: map[string]string{"pod-name": "pod1"}}},
+		},
+		{
+			name:            "external IDs changed",
+			before:          []OVSPortData{podPort},
+			after:           []OVSPortData{{UUID: "uuid-pod1", Name: "pod1-abc", OFPort: 3, ExternalIDs: map[string]string{"pod-name": "pod2"}}},
+			expectedChanged: []OVSPortData{{UUID: "uuid-pod1", Name: "pod1-abc", OFPort: 3, ExternalIDs: map[string]string{"pod-name": "pod2"}}},
+		},
+		{
+			name:   "nil and empty external IDs",
+			before: []OVSPortData{gatewayPort},
+			after:  []OVSPortData{{UUID: "uuid-gw", Name: "gw0", OFPort: 2, ExternalIDs: map[string]string{}}},
+		},
+		{
+			name:            "port re-created with same name",
+			before:          []OVSPortData{podPort},
+			after:           []OVSPortData{{UUID: "uuid-pod1-new", Name: "pod1-abc", OFPort: 3}},
+			expectedAdded:   []OVSPortData{{UUID: "uuid-pod1-new", Name: "pod1-abc", OFPort: 3}},
+			expectedRemoved: []OVSPortData{podPort},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, changed := DiffPortLists(tt.before, tt.after)
+			assert.Equal(t, tt.expectedAdded, added)
+			assert.Equal(t, tt.expectedRemoved, removed)
+			assert.Equal(t, tt.expectedChanged, changed)
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	ovsconfig "github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
 	reflect "reflect"
+	time "time"
 )
 
 // MockOVSBridgeClient is a mock of OVSBridgeClient interface
@@ -48,6 +49,20 @@ func (m *MockOVSBridgeClient) EXPECT() *MockOVSBridgeClientMockRecorder {
 	return m.recorder
 }
 
+// ClearInterfaceIngressPolicing mocks base method
+func (m *MockOVSBridgeClient) ClearInterfaceIngressPolicing(arg0 string) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearInterfaceIngressPolicing", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// ClearInterfaceIngressPolicing indicates an expected call of ClearInterfaceIngressPolicing
+func (mr *MockOVSBridgeClientMockRecorder) ClearInterfaceIngressPolicing(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearInterfaceIngressPolicing", reflect.TypeOf((*MockOVSBridgeClient)(nil).ClearInterfaceIngressPolicing), arg0)
+}
+
 // Create mocks base method
 func (m *MockOVSBridgeClient) Create() ovsconfig.Error {
 	m.ctrl.T.Helper()
@@ -63,18 +78,18 @@ func (mr *MockOVSBridgeClientMockRecorder) Create() *gomock.Call {
 }
 
 // CreateGenevePort mocks base method
-func (m *MockOVSBridgeClient) CreateGenevePort(arg0 string, arg1 int32, arg2 string) (string, ovsconfig.Error) {
+func (m *MockOVSBridgeClient) CreateGenevePort(arg0 string, arg1 int32, arg2 string, arg3 map[string]interface{}) (string, ovsconfig.Error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateGenevePort", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "CreateGenevePort", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(ovsconfig.Error)
 	return ret0, ret1
 }
 
 // CreateGenevePort indicates an expected call of CreateGenevePort
-func (mr *MockOVSBridgeClientMockRecorder) CreateGenevePort(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockOVSBridgeClientMockRecorder) CreateGenevePort(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGenevePort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreateGenevePort), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGenevePort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreateGenevePort), arg0, arg1, arg2, arg3)
 }
 
 // CreateInternalPort mocks base method
@@ -92,6 +107,21 @@ func (mr *MockOVSBridgeClientMockRecorder) CreateInternalPort(arg0, arg1, arg2 i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInternalPort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreateInternalPort), arg0, arg1, arg2)
 }
 
+// CreatePatchPort mocks base method
+func (m *MockOVSBridgeClient) CreatePatchPort(arg0, arg1 string, arg2 int32, arg3 map[string]interface{}) (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePatchPort", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// CreatePatchPort indicates an expected call of CreatePatchPort
+func (mr *MockOVSBridgeClientMockRecorder) CreatePatchPort(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePatchPort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreatePatchPort), arg0, arg1, arg2, arg3)
+}
+
 // CreatePort mocks base method
 func (m *MockOVSBridgeClient) CreatePort(arg0, arg1 string, arg2 map[string]interface{}) (string, ovsconfig.Error) {
 	m.ctrl.T.Helper()
@@ -107,19 +137,34 @@ func (mr *MockOVSBridgeClientMockRecorder) CreatePort(arg0, arg1, arg2 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreatePort), arg0, arg1, arg2)
 }
 
+// CreatePorts mocks base method
+func (m *MockOVSBridgeClient) CreatePorts(arg0 []ovsconfig.PortSpec) ([]string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePorts", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// CreatePorts indicates an expected call of CreatePorts
+func (mr *MockOVSBridgeClientMockRecorder) CreatePorts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePorts", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreatePorts), arg0)
+}
+
 // CreateVXLANPort mocks base method
-func (m *MockOVSBridgeClient) CreateVXLANPort(arg0 string, arg1 int32, arg2 string) (string, ovsconfig.Error) {
+func (m *MockOVSBridgeClient) CreateVXLANPort(arg0 string, arg1 int32, arg2 string, arg3 map[string]interface{}) (string, ovsconfig.Error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateVXLANPort", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "CreateVXLANPort", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(ovsconfig.Error)
 	return ret0, ret1
 }
 
 // CreateVXLANPort indicates an expected call of CreateVXLANPort
-func (mr *MockOVSBridgeClientMockRecorder) CreateVXLANPort(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockOVSBridgeClientMockRecorder) CreateVXLANPort(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVXLANPort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreateVXLANPort), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVXLANPort", reflect.TypeOf((*MockOVSBridgeClient)(nil).CreateVXLANPort), arg0, arg1, arg2, arg3)
 }
 
 // Delete mocks base method
@@ -136,6 +181,20 @@ func (mr *MockOVSBridgeClientMockRecorder) Delete() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockOVSBridgeClient)(nil).Delete))
 }
 
+// DeleteController mocks base method
+func (m *MockOVSBridgeClient) DeleteController() ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteController")
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// DeleteController indicates an expected call of DeleteController
+func (mr *MockOVSBridgeClientMockRecorder) DeleteController() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteController", reflect.TypeOf((*MockOVSBridgeClient)(nil).DeleteController))
+}
+
 // DeletePort mocks base method
 func (m *MockOVSBridgeClient) DeletePort(arg0 string) ovsconfig.Error {
 	m.ctrl.T.Helper()
@@ -164,6 +223,67 @@ func (mr *MockOVSBridgeClientMockRecorder) DeletePorts(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePorts", reflect.TypeOf((*MockOVSBridgeClient)(nil).DeletePorts), arg0)
 }
 
+// DeletePortsMarkedForGC mocks base method
+func (m *MockOVSBridgeClient) DeletePortsMarkedForGC() ([]string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePortsMarkedForGC")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// DeletePortsMarkedForGC indicates an expected call of DeletePortsMarkedForGC
+func (mr *MockOVSBridgeClientMockRecorder) DeletePortsMarkedForGC() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePortsMarkedForGC", reflect.TypeOf((*MockOVSBridgeClient)(nil).DeletePortsMarkedForGC))
+}
+
+// GetBridgeMAC mocks base method
+func (m *MockOVSBridgeClient) GetBridgeMAC() (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBridgeMAC")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetBridgeMAC indicates an expected call of GetBridgeMAC
+func (mr *MockOVSBridgeClientMockRecorder) GetBridgeMAC() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBridgeMAC", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetBridgeMAC))
+}
+
+// GetControllerStatus mocks base method
+func (m *MockOVSBridgeClient) GetControllerStatus() (bool, string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetControllerStatus")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(ovsconfig.Error)
+	return ret0, ret1, ret2
+}
+
+// GetControllerStatus indicates an expected call of GetControllerStatus
+func (mr *MockOVSBridgeClientMockRecorder) GetControllerStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetControllerStatus", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetControllerStatus))
+}
+
+// GetDatapathType mocks base method
+func (m *MockOVSBridgeClient) GetDatapathType() (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDatapathType")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetDatapathType indicates an expected call of GetDatapathType
+func (mr *MockOVSBridgeClientMockRecorder) GetDatapathType() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDatapathType", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetDatapathType))
+}
+
 // GetExternalIDs mocks base method
 func (m *MockOVSBridgeClient) GetExternalIDs() (map[string]string, ovsconfig.Error) {
 	m.ctrl.T.Helper()
@@ -179,6 +299,36 @@ func (mr *MockOVSBridgeClientMockRecorder) GetExternalIDs() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExternalIDs", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetExternalIDs))
 }
 
+// GetFlowRestoreWait mocks base method
+func (m *MockOVSBridgeClient) GetFlowRestoreWait() (bool, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFlowRestoreWait")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetFlowRestoreWait indicates an expected call of GetFlowRestoreWait
+func (mr *MockOVSBridgeClientMockRecorder) GetFlowRestoreWait() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFlowRestoreWait", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetFlowRestoreWait))
+}
+
+// GetInterfaceMAC mocks base method
+func (m *MockOVSBridgeClient) GetInterfaceMAC(arg0 string) (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInterfaceMAC", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetInterfaceMAC indicates an expected call of GetInterfaceMAC
+func (mr *MockOVSBridgeClientMockRecorder) GetInterfaceMAC(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInterfaceMAC", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetInterfaceMAC), arg0)
+}
+
 // GetOFPort mocks base method
 func (m *MockOVSBridgeClient) GetOFPort(arg0 string) (int32, ovsconfig.Error) {
 	m.ctrl.T.Helper()
@@ -194,6 +344,21 @@ func (mr *MockOVSBridgeClientMockRecorder) GetOFPort(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOFPort", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetOFPort), arg0)
 }
 
+// GetOVSVersion mocks base method
+func (m *MockOVSBridgeClient) GetOVSVersion() (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOVSVersion")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetOVSVersion indicates an expected call of GetOVSVersion
+func (mr *MockOVSBridgeClientMockRecorder) GetOVSVersion() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOVSVersion", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetOVSVersion))
+}
+
 // GetPortData mocks base method
 func (m *MockOVSBridgeClient) GetPortData(arg0, arg1 string) (*ovsconfig.OVSPortData, ovsconfig.Error) {
 	m.ctrl.T.Helper()
@@ -224,6 +389,93 @@ func (mr *MockOVSBridgeClientMockRecorder) GetPortList() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortList", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetPortList))
 }
 
+// GetPortUUID mocks base method
+func (m *MockOVSBridgeClient) GetPortUUID(arg0 string) (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortUUID", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetPortUUID indicates an expected call of GetPortUUID
+func (mr *MockOVSBridgeClientMockRecorder) GetPortUUID(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortUUID", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetPortUUID), arg0)
+}
+
+// GetTunnelPorts mocks base method
+func (m *MockOVSBridgeClient) GetTunnelPorts() ([]ovsconfig.TunnelPortData, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTunnelPorts")
+	ret0, _ := ret[0].([]ovsconfig.TunnelPortData)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// GetTunnelPorts indicates an expected call of GetTunnelPorts
+func (mr *MockOVSBridgeClientMockRecorder) GetTunnelPorts() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTunnelPorts", reflect.TypeOf((*MockOVSBridgeClient)(nil).GetTunnelPorts))
+}
+
+// MarkPortsForGC mocks base method
+func (m *MockOVSBridgeClient) MarkPortsForGC(arg0 []string) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkPortsForGC", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// MarkPortsForGC indicates an expected call of MarkPortsForGC
+func (mr *MockOVSBridgeClientMockRecorder) MarkPortsForGC(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkPortsForGC", reflect.TypeOf((*MockOVSBridgeClient)(nil).MarkPortsForGC), arg0)
+}
+
+// ReplacePort mocks base method
+func (m *MockOVSBridgeClient) ReplacePort(arg0 string, arg1 ovsconfig.PortSpec) (string, ovsconfig.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplacePort", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(ovsconfig.Error)
+	return ret0, ret1
+}
+
+// ReplacePort indicates an expected call of ReplacePort
+func (mr *MockOVSBridgeClientMockRecorder) ReplacePort(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplacePort", reflect.TypeOf((*MockOVSBridgeClient)(nil).ReplacePort), arg0, arg1)
+}
+
+// SetBridgeMAC mocks base method
+func (m *MockOVSBridgeClient) SetBridgeMAC(arg0 string) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBridgeMAC", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetBridgeMAC indicates an expected call of SetBridgeMAC
+func (mr *MockOVSBridgeClientMockRecorder) SetBridgeMAC(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBridgeMAC", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetBridgeMAC), arg0)
+}
+
+// SetController mocks base method
+func (m *MockOVSBridgeClient) SetController(arg0 string) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetController", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetController indicates an expected call of SetController
+func (mr *MockOVSBridgeClientMockRecorder) SetController(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetController", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetController), arg0)
+}
+
 // SetExternalIDs mocks base method
 func (m *MockOVSBridgeClient) SetExternalIDs(arg0 map[string]interface{}) ovsconfig.Error {
 	m.ctrl.T.Helper()
@@ -238,11 +490,39 @@ func (mr *MockOVSBridgeClientMockRecorder) SetExternalIDs(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExternalIDs", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetExternalIDs), arg0)
 }
 
+// SetHardwareOffload mocks base method
+func (m *MockOVSBridgeClient) SetHardwareOffload(arg0 bool) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHardwareOffload", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetHardwareOffload indicates an expected call of SetHardwareOffload
+func (mr *MockOVSBridgeClientMockRecorder) SetHardwareOffload(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHardwareOffload", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetHardwareOffload), arg0)
+}
+
+// SetInterfaceIngressPolicing mocks base method
+func (m *MockOVSBridgeClient) SetInterfaceIngressPolicing(arg0 string, arg1, arg2 int) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetInterfaceIngressPolicing", arg0, arg1, arg2)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetInterfaceIngressPolicing indicates an expected call of SetInterfaceIngressPolicing
+func (mr *MockOVSBridgeClientMockRecorder) SetInterfaceIngressPolicing(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInterfaceIngressPolicing", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetInterfaceIngressPolicing), arg0, arg1, arg2)
+}
+
 // SetInterfaceMTU mocks base method
-func (m *MockOVSBridgeClient) SetInterfaceMTU(arg0 string, arg1 int) error {
+func (m *MockOVSBridgeClient) SetInterfaceMTU(arg0 string, arg1 int) ovsconfig.Error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SetInterfaceMTU", arg0, arg1)
-	ret0, _ := ret[0].(error)
+	ret0, _ := ret[0].(ovsconfig.Error)
 	return ret0
 }
 
@@ -251,3 +531,101 @@ func (mr *MockOVSBridgeClientMockRecorder) SetInterfaceMTU(arg0, arg1 interface{
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInterfaceMTU", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetInterfaceMTU), arg0, arg1)
 }
+
+// SetMcastSnoopingDisableFloodUnregistered mocks base method
+func (m *MockOVSBridgeClient) SetMcastSnoopingDisableFloodUnregistered(arg0 bool) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMcastSnoopingDisableFloodUnregistered", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetMcastSnoopingDisableFloodUnregistered indicates an expected call of SetMcastSnoopingDisableFloodUnregistered
+func (mr *MockOVSBridgeClientMockRecorder) SetMcastSnoopingDisableFloodUnregistered(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMcastSnoopingDisableFloodUnregistered", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetMcastSnoopingDisableFloodUnregistered), arg0)
+}
+
+// SetMcastSnoopingEnable mocks base method
+func (m *MockOVSBridgeClient) SetMcastSnoopingEnable(arg0 bool) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMcastSnoopingEnable", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetMcastSnoopingEnable indicates an expected call of SetMcastSnoopingEnable
+func (mr *MockOVSBridgeClientMockRecorder) SetMcastSnoopingEnable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMcastSnoopingEnable", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetMcastSnoopingEnable), arg0)
+}
+
+// SetPortExternalIDs mocks base method
+func (m *MockOVSBridgeClient) SetPortExternalIDs(arg0 string, arg1 map[string]interface{}) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPortExternalIDs", arg0, arg1)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetPortExternalIDs indicates an expected call of SetPortExternalIDs
+func (mr *MockOVSBridgeClientMockRecorder) SetPortExternalIDs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPortExternalIDs", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetPortExternalIDs), arg0, arg1)
+}
+
+// SetProtocols mocks base method
+func (m *MockOVSBridgeClient) SetProtocols(arg0 []string) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetProtocols", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetProtocols indicates an expected call of SetProtocols
+func (mr *MockOVSBridgeClientMockRecorder) SetProtocols(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProtocols", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetProtocols), arg0)
+}
+
+// SetRSTPEnable mocks base method
+func (m *MockOVSBridgeClient) SetRSTPEnable(arg0 bool) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRSTPEnable", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetRSTPEnable indicates an expected call of SetRSTPEnable
+func (mr *MockOVSBridgeClientMockRecorder) SetRSTPEnable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRSTPEnable", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetRSTPEnable), arg0)
+}
+
+// SetSTPEnable mocks base method
+func (m *MockOVSBridgeClient) SetSTPEnable(arg0 bool) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSTPEnable", arg0)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// SetSTPEnable indicates an expected call of SetSTPEnable
+func (mr *MockOVSBridgeClientMockRecorder) SetSTPEnable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSTPEnable", reflect.TypeOf((*MockOVSBridgeClient)(nil).SetSTPEnable), arg0)
+}
+
+// WaitForPorts mocks base method
+func (m *MockOVSBridgeClient) WaitForPorts(arg0 []string, arg1 time.Duration) ovsconfig.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForPorts", arg0, arg1)
+	ret0, _ := ret[0].(ovsconfig.Error)
+	return ret0
+}
+
+// WaitForPorts indicates an expected call of WaitForPorts
+func (mr *MockOVSBridgeClientMockRecorder) WaitForPorts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForPorts", reflect.TypeOf((*MockOVSBridgeClient)(nil).WaitForPorts), arg0, arg1)
+}
@@ -16,10 +16,13 @@ package e2e
 
 import (
 	"fmt"
-	"strings"
+	"net"
 	"testing"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
 	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 )
 
@@ -63,6 +66,57 @@ func TestPodAssignIP(t *testing.T) {
 		} else {
 			t.Logf("Pod IP is valid!")
 		}
+
+		pod, err := data.clientset.CoreV1().Pods(data.testNamespace).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Error when getting Pod '%s': %v", podName, err)
+		}
+		isValid, err = data.validatePodIPForNode(pod.Spec.NodeName, podIP)
+		if err != nil {
+			t.Errorf("Error when trying to validate Pod IP against Node '%s' Pod CIDR: %v", pod.Spec.NodeName, err)
+		} else if !isValid {
+			t.Errorf("Pod IP is not in the Pod CIDR of Node '%s'", pod.Spec.NodeName)
+		}
+
+		gatewayIP, err := data.getNodeGatewayIP(pod.Spec.NodeName)
+		if err != nil {
+			t.Fatalf("Error when getting gateway IP of Node '%s': %v", pod.Spec.NodeName, err)
+		}
+		if defaultGatewayIP, err := data.getPodDefaultRoute(podName); err != nil {
+			t.Errorf("Error when getting default route of Pod '%s': %v", podName, err)
+		} else if defaultGatewayIP != gatewayIP {
+			t.Errorf("Default route of Pod '%s' is via '%s', expected gateway IP '%s'", podName, defaultGatewayIP, gatewayIP)
+		}
+	}
+}
+
+// TestPodInterfaceMTU verifies that the network interface of a Pod is configured with the expected
+// MTU. We use the default Antrea configuration, in which the MTU is set to a value which accounts for
+// the tunnel encapsulation overhead (identical for VXLAN and Geneve).
+func TestPodInterfaceMTU(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	podName := randPodName("test-pod-")
+
+	t.Logf("Creating a busybox test Pod")
+	if err := data.createBusyboxPod(podName); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be in the Running state", podName)
+	}
+
+	mtu, err := data.getPodInterfaceMTU(podName, podInterfaceName)
+	if err != nil {
+		t.Fatalf("Error when retrieving Pod interface MTU: %v", err)
+	}
+	if mtu != defaultMTU {
+		t.Errorf("Pod interface MTU is %d, expected %d", mtu, defaultMTU)
 	}
 }
 
@@ -86,7 +140,7 @@ func TestDeletePod(t *testing.T) {
 		t.Fatalf("Error when waiting for Pod '%s' to be in the Running state", podName)
 	}
 
-	ifName := util.GenerateContainerInterfaceName(podName, testNamespace)
+	ifName := util.GenerateContainerInterfaceName(podName, data.testNamespace)
 	t.Logf("Host interface name for Pod is '%s'", ifName)
 
 	var AntreaPodName string
@@ -106,15 +160,11 @@ func TestDeletePod(t *testing.T) {
 	}
 
 	doesOVSPortExist := func() bool {
-		cmd := []string{"ovs-vsctl", "port-to-br", ifName}
-		if _, stderr, err := data.runCommandFromPod(AntreaNamespace, AntreaPodName, OVSContainerName, cmd); err == nil {
-			return true
-		} else if strings.Contains(stderr, "no port named") {
-			return false
-		} else {
-			t.Fatalf("Error when running ovs-vsctl command on Pod '%s': %v", AntreaPodName, err)
+		exists, err := data.doesOVSPortExist(AntreaPodName, ifName)
+		if err != nil {
+			t.Fatalf("Error when checking OVS port: %v", err)
 		}
-		return true
+		return exists
 	}
 
 	t.Logf("Checking that the veth interface and the OVS port exist")
@@ -139,6 +189,128 @@ func TestDeletePod(t *testing.T) {
 	}
 }
 
+// TestDeletePodNoGracePeriod deletes a Pod with a grace period of 0, to simulate an abrupt
+// termination, and checks that the Pod is deleted and that its OVS port is removed.
+func TestDeletePodNoGracePeriod(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	nodeName := nodeName(0)
+	podName := randPodName("test-pod-")
+	t.Logf("Creating a busybox test Pod on '%s'", nodeName)
+	if err := data.createBusyboxPodOnNode(podName, nodeName); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be in the Running state", podName)
+	}
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		t.Fatalf("Error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	portName, err := data.getOVSPortNameForPod(antreaPodName, podName)
+	if err != nil || portName == "" {
+		t.Fatalf("Error when looking up OVS port for Pod '%s': %v", podName, err)
+	}
+
+	t.Logf("Deleting Pod '%s' with a grace period of 0", podName)
+	var gracePeriodSeconds int64 = 0
+	if err := data.deletePodWithOptions(podName, PodDeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}); err != nil {
+		t.Fatalf("Error when deleting Pod: %v", err)
+	}
+	if pod, err := data.clientset.CoreV1().Pods(data.testNamespace).Get(podName, metav1.GetOptions{}); err == nil {
+		if pod.DeletionGracePeriodSeconds != nil && *pod.DeletionGracePeriodSeconds != 0 {
+			t.Errorf("Pod '%s' is being deleted with a grace period of %ds instead of 0", podName, *pod.DeletionGracePeriodSeconds)
+		}
+	}
+	if err := data.podWaitForDeletion(data.testNamespace, podName, defaultTimeout); err != nil {
+		t.Fatalf("Error when waiting for Pod deletion: %v", err)
+	}
+
+	t.Logf("Checking that OVS port '%s' is removed", portName)
+	if err := wait.PollImmediate(1*time.Second, defaultTimeout, func() (bool, error) {
+		exists, err := data.doesOVSPortExist(antreaPodName, portName)
+		return !exists, err
+	}); err == wait.ErrWaitTimeout {
+		t.Errorf("OVS port '%s' still exists on Node '%s' after Pod deletion", portName, nodeName)
+	} else if err != nil {
+		t.Fatalf("Error when checking OVS port: %v", err)
+	}
+}
+
+// TestDeletePodOVSPortRemoved checks on every Node that the OVS port of a Pod is removed once the
+// Pod is deleted.
+func TestDeletePodOVSPortRemoved(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	if err := forAllNodes(func(nodeName string) error {
+		t.Logf("Checking that the OVS port of a deleted Pod is removed on Node '%s'", nodeName)
+		return data.checkOVSPortRemovedAfterPodDeletion(nodeName, defaultTimeout)
+	}); err != nil {
+		t.Errorf("Error when checking OVS port removal: %v", err)
+	}
+}
+
+// TestDrainNode cordons and drains a Node, then checks that the OVS ports for the evicted Pods have
+// been removed on that Node.
+func TestDrainNode(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	nodeName := nodeName(0)
+	podName := randPodName("test-pod-")
+
+	t.Logf("Creating a busybox test Pod on '%s'", nodeName)
+	if err := data.createBusyboxPodOnNode(podName, nodeName); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be in the Running state", podName)
+	}
+
+	ifName := util.PortNameForPod(podName, data.testNamespace)
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		t.Fatalf("Error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	if exists, err := data.doesOVSPortExist(antreaPodName, ifName); err != nil {
+		t.Fatalf("Error when checking OVS port: %v", err)
+	} else if !exists {
+		t.Fatalf("OVS port '%s' does not exist on Node '%s'", ifName, nodeName)
+	}
+
+	t.Logf("Cordoning and draining Node '%s'", nodeName)
+	if err := data.cordonNode(nodeName); err != nil {
+		t.Fatalf("Error when cordoning Node: %v", err)
+	}
+	defer func() {
+		if err := data.uncordonNode(nodeName); err != nil {
+			t.Errorf("Error when uncordoning Node: %v", err)
+		}
+	}()
+	if err := data.drainTestPodsFromNode(nodeName, defaultTimeout); err != nil {
+		t.Fatalf("Error when draining Node: %v", err)
+	}
+
+	if exists, err := data.doesOVSPortExist(antreaPodName, ifName); err != nil {
+		t.Fatalf("Error when checking OVS port: %v", err)
+	} else if exists {
+		t.Errorf("OVS port '%s' still exists on Node '%s' after drain", ifName, nodeName)
+	}
+}
+
 // TestAntreaGracefulExit verifies that Antrea Pods can terminate gracefully.
 func TestAntreaGracefulExit(t *testing.T) {
 	data, err := setupTest(t)
@@ -159,6 +331,58 @@ func TestAntreaGracefulExit(t *testing.T) {
 	// TODO: ideally we would be able to also check the exit code but it may not be possible.
 }
 
+// TestAntreaAgentVersion verifies that the antrea-agent running on every Node reports a valid
+// version, and that all the agents report the same version (e.g. after an upgrade rollout).
+func TestAntreaAgentVersion(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	var expectedVersion string
+	if err := forAllNodes(func(nodeName string) error {
+		version, err := data.getAntreaAgentVersion(nodeName)
+		if err != nil {
+			return err
+		}
+		t.Logf("antrea-agent on Node '%s' reports version '%s'", nodeName, version)
+		if expectedVersion == "" {
+			expectedVersion = version
+		} else if version != expectedVersion {
+			return fmt.Errorf("antrea-agent on Node '%s' reports version '%s' instead of '%s'", nodeName, version, expectedVersion)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Error when checking antrea-agent versions: %v", err)
+	}
+}
+
+// TestAntreaAgentHealthy verifies that the antrea-agent running on every Node reports itself ready
+// after Antrea has been deployed.
+func TestAntreaAgentHealthy(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	if err := forAllNodes(func(nodeName string) error {
+		return wait.PollImmediate(1*time.Second, defaultTimeout, func() (bool, error) {
+			healthy, err := data.getAntreaAgentHealthz(nodeName)
+			if err != nil {
+				return false, err
+			}
+			if !healthy {
+				t.Logf("antrea-agent on Node '%s' is not healthy yet", nodeName)
+			}
+			return healthy, nil
+		})
+	}); err != nil {
+		t.Fatalf("Error when waiting for antrea-agents to be healthy: %v", err)
+	}
+}
+
 // TestIPAMRestart checks that when the Antrea agent is restarted the information about which IP
 // address is already allocated is not lost. It does that by creating a first Pod and retrieving
 // its IP address, restarting the Antrea agent, then creating a second Pod and retrieving its IP
@@ -221,3 +445,130 @@ func TestIPAMRestart(t *testing.T) {
 		t.Errorf("Pods '%s' and '%s' were assigned the same IP %s", podName1, podName2, podIP1)
 	}
 }
+
+// TestPodInterfacesReconciled checks that, once the test Pods are running, antrea-agent has created
+// an OVS port for every running Pod on each Node, and that no OVS port is left for a Pod which no
+// longer exists.
+func TestPodInterfacesReconciled(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	podNames, deletePods := createPodsOnDifferentNodes(t, data, clusterInfo.numNodes)
+	defer deletePods()
+	if err := data.podsWaitForRunning(defaultTimeout, podNames); err != nil {
+		t.Fatalf("Error when waiting for Pods to be in the Running state: %v", err)
+	}
+
+	if err := forAllNodes(func(nodeName string) error {
+		var missing, orphaned []string
+		// Ports for Pods deleted by a previous test may still be in the process of being
+		// removed.
+		if err := wait.PollImmediate(1*time.Second, defaultTimeout, func() (bool, error) {
+			missing, orphaned, err = data.checkPodInterfaces(nodeName)
+			if err != nil {
+				return false, err
+			}
+			return len(missing) == 0 && len(orphaned) == 0, nil
+		}); err == wait.ErrWaitTimeout {
+			return fmt.Errorf("interfaces on Node '%s' do not match running Pods: missing %v, orphaned %v", nodeName, missing, orphaned)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Error when checking Pod interfaces: %v", err)
+	}
+}
+
+// TestCNICheckFailsAfterInterfaceDeletion checks that a CNI CHECK request does not silently pass
+// when the networking of a Pod is broken, by deleting the host interface of a test Pod and sending
+// a CHECK request for it.
+func TestCNICheckFailsAfterInterfaceDeletion(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	nodeName := nodeName(0)
+	podName := randPodName("test-pod-")
+
+	t.Logf("Creating a busybox test Pod on '%s'", nodeName)
+	if err := data.createBusyboxPodOnNode(podName, nodeName); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be in the Running state: %v", podName, err)
+	}
+
+	checkErr, err := data.checkCNICheckAfterHostVethDeletion(podName, nodeName)
+	if err != nil {
+		t.Fatalf("Error when sending CNI CHECK request: %v", err)
+	}
+	if checkErr == nil {
+		t.Errorf("CNI CHECK succeeded for Pod '%s' after its interface was deleted", podName)
+	} else {
+		t.Logf("CNI CHECK failed as expected: %v", checkErr)
+	}
+}
+
+// TestIPAMReleaseAfterChurn repeatedly creates and deletes Pods on a Node, and checks that the IP
+// addresses of the deleted Pods are released by the IPAM plugin, so that the pool of the Node is not
+// exhausted under churn and the addresses can be reused. The IPAM plugin allocates addresses
+// sequentially, so freed addresses are only reused once the end of the pool is reached.
+func TestIPAMReleaseAfterChurn(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	const numPods, numRounds = 5, 3
+	nodeName := nodeName(0)
+	podCIDRs, err := data.getNodePodCIDRs(nodeName)
+	if err != nil {
+		t.Fatalf("Error when getting Pod CIDR of Node '%s': %v", nodeName, err)
+	}
+	_, podCIDR, err := net.ParseCIDR(podCIDRs[0])
+	if err != nil {
+		t.Fatalf("Invalid Pod CIDR '%s' for Node '%s': %v", podCIDRs[0], nodeName, err)
+	}
+	ones, bits := podCIDR.Mask.Size()
+	// The network address, the gateway address and the broadcast address cannot be allocated.
+	poolSize := (1 << uint(bits-ones)) - 3
+
+	t.Logf("Creating and deleting %d Pods on Node '%s' over %d rounds", numPods, nodeName, numRounds)
+	seenIPs, err := data.runPodChurn(nodeName, numPods, numRounds)
+	if err != nil {
+		t.Fatalf("Error during Pod churn: %v", err)
+	}
+	t.Logf("%d distinct IP addresses assigned to %d Pods", len(seenIPs), numPods*numRounds)
+	if len(seenIPs) < numPods || len(seenIPs) > poolSize {
+		t.Errorf("Unexpected number of distinct IP addresses: %d (pool size: %d)", len(seenIPs), poolSize)
+	}
+
+	// The CNI DEL request may still be in progress when a deleted Pod is no longer visible to the
+	// client, so we poll until the addresses are released.
+	var leakedIPs []string
+	if err := wait.PollImmediate(1*time.Second, defaultTimeout, func() (bool, error) {
+		allocatedIPs, err := data.getAllocatedPodIPs(nodeName)
+		if err != nil {
+			return false, err
+		}
+		leakedIPs = nil
+		for ip := range seenIPs {
+			if allocatedIPs[ip] {
+				leakedIPs = append(leakedIPs, ip)
+			}
+		}
+		return len(leakedIPs) == 0, nil
+	}); err == wait.ErrWaitTimeout {
+		t.Errorf("IP addresses of deleted Pods still allocated on Node '%s' after %v: %v", nodeName, defaultTimeout, leakedIPs)
+	} else if err != nil {
+		t.Fatalf("Error when checking allocated IP addresses: %v", err)
+	}
+}
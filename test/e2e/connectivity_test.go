@@ -16,7 +16,9 @@ package e2e
 
 import (
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 // runPingMesh runs a ping mesh between all the provided Pods after first retrieveing their IP
@@ -29,6 +31,7 @@ func (data *TestData) runPingMesh(t *testing.T, podNames []string) {
 			t.Fatalf("Error when waiting for IP for Pod '%s': %v", podName, err)
 		} else {
 			podIPs[podName] = podIP
+			data.addPacketTrace(fmt.Sprintf("ip,nw_dst=%s", podIP))
 		}
 	}
 	t.Logf("Retrieved all Pod IPs: %v", podIPs)
@@ -120,6 +123,32 @@ func TestPodConnectivityDifferentNodes(t *testing.T) {
 	data.runPingMesh(t, podNames)
 }
 
+// TestPodToExternalConnectivity checks that a Pod can reach an endpoint outside of the cluster,
+// which requires the traffic to be SNATed to the Node IP address.
+func TestPodToExternalConnectivity(t *testing.T) {
+	if testOptions.externalURL == "" {
+		t.Skipf("Skipping test as no external URL was provided")
+	}
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	podName := randPodName("test-pod-")
+	if err := data.createBusyboxPodOnNode(podName, nodeName(0)); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podName, err)
+	}
+
+	if err := data.runCurlToExternalFromPod(podName, testOptions.externalURL); err != nil {
+		t.Errorf("Pod '%s' cannot reach external network: %v", podName, err)
+	}
+}
+
 // TestPodConnectivityAfterAntreaRestart checks that restarting antrea-agent does not create
 // connectivity issues between Pods.
 func TestPodConnectivityAfterAntreaRestart(t *testing.T) {
@@ -151,3 +180,151 @@ func TestPodConnectivityAfterAntreaRestart(t *testing.T) {
 
 	data.runPingMesh(t, podNames)
 }
+
+// TestPodConnectivityAfterOVSRestart checks that the data-plane connectivity between two Pods
+// recovers after the OVS processes are restarted on the Node of the target Pod, and that
+// antrea-agent reconnects to OVSDB.
+func TestPodConnectivityAfterOVSRestart(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	numPods := 2
+	podNames, deletePods := createPodsOnDifferentNodes(t, data, numPods)
+	defer deletePods()
+
+	targetIP, err := data.podWaitForIP(defaultTimeout, podNames[1])
+	if err != nil {
+		t.Fatalf("Error when waiting for IP for Pod '%s': %v", podNames[1], err)
+	}
+	if err := data.podWaitForRunning(defaultTimeout, podNames[0]); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podNames[0], err)
+	}
+	targetNode := nodeName(1 % clusterInfo.numNodes)
+
+	t.Logf("Restarting OVS on Node '%s' while pinging '%s' from Pod '%s'", targetNode, targetIP, podNames[0])
+	recoveryTime, err := data.measureRecoveryAfterOVSRestart(podNames[0], targetIP, targetNode, defaultTimeout)
+	if err != nil {
+		t.Fatalf("Error when restarting OVS: %v", err)
+	}
+	t.Logf("Connectivity recovered %v after restarting OVS", recoveryTime)
+}
+
+// TestPodConnectivityAfterNodeIPChange checks that antrea-agent updates the tunnel flows to a remote
+// Node when the IP address of that Node changes, and that the data-plane connectivity between Pods
+// running on the two Nodes recovers. The new address is obtained by adding 100 to the last byte of
+// the current InternalIP address, and is assumed to be unused (which is the case in the Vagrant
+// test setup).
+func TestPodConnectivityAfterNodeIPChange(t *testing.T) {
+	if clusterInfo.numNodes < 2 {
+		t.Skipf("Skipping test as it requires 2 different nodes")
+	}
+	// antrea-agent detects IP changes when reconciling the flows to remote Nodes, which happens
+	// every 60 seconds.
+	const recoveryTimeout = 3 * time.Minute
+
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	numPods := 2
+	podNames, deletePods := createPodsOnDifferentNodes(t, data, numPods)
+	defer deletePods()
+
+	targetIP, err := data.podWaitForIP(defaultTimeout, podNames[1])
+	if err != nil {
+		t.Fatalf("Error when waiting for IP for Pod '%s': %v", podNames[1], err)
+	}
+	if err := data.podWaitForRunning(defaultTimeout, podNames[0]); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podNames[0], err)
+	}
+	targetNode := nodeName(1)
+
+	oldIP, err := data.getNodeInternalIP(targetNode)
+	if err != nil {
+		t.Fatalf("Error when retrieving IP address of Node '%s': %v", targetNode, err)
+	}
+	newIP := net.ParseIP(oldIP).To4()
+	if newIP == nil {
+		t.Skipf("Skipping test as Node '%s' does not have an IPv4 address", targetNode)
+	}
+	newIP[3] += 100
+
+	t.Logf("Changing IP address of Node '%s' from '%s' to '%s'", targetNode, oldIP, newIP)
+	recovered, err := data.checkConnectivityAfterNodeIPChange(podNames[0], targetIP, nodeName(0), targetNode, newIP.String(), recoveryTimeout)
+	if err != nil {
+		t.Fatalf("Error when changing IP address of Node '%s': %v", targetNode, err)
+	}
+	if !recovered {
+		t.Errorf("Connectivity from Pod '%s' to '%s' not recovered after changing IP address of Node '%s'", podNames[0], targetIP, targetNode)
+	}
+}
+
+// TestDataplaneDowntimeDuringAgentRestart measures the data-plane downtime between two Pods while
+// the antrea-agent Pod is restarted on the Node of the target Pod, and checks that it stays below
+// maxAgentRestartDowntime.
+func TestDataplaneDowntimeDuringAgentRestart(t *testing.T) {
+	const maxAgentRestartDowntime = 10 * time.Second
+
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	numPods := 2
+	podNames, deletePods := createPodsOnDifferentNodes(t, data, numPods)
+	defer deletePods()
+
+	targetIP, err := data.podWaitForIP(defaultTimeout, podNames[1])
+	if err != nil {
+		t.Fatalf("Error when waiting for IP for Pod '%s': %v", podNames[1], err)
+	}
+	if err := data.podWaitForRunning(defaultTimeout, podNames[0]); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podNames[0], err)
+	}
+	targetNode := nodeName(1 % clusterInfo.numNodes)
+
+	t.Logf("Restarting antrea-agent on Node '%s' while pinging '%s' from Pod '%s'", targetNode, targetIP, podNames[0])
+	downtime, err := data.measureDowntimeDuringAgentRestart(podNames[0], targetIP, targetNode, defaultTimeout)
+	if err != nil {
+		t.Fatalf("Error when measuring data-plane downtime: %v", err)
+	}
+	t.Logf("Data-plane downtime during antrea-agent restart: %v", downtime)
+	if downtime > maxAgentRestartDowntime {
+		t.Errorf("Data-plane downtime (%v) exceeds the maximum allowed value (%v)", downtime, maxAgentRestartDowntime)
+	}
+}
+
+// TestPodTrafficEncapsulation checks that the traffic between Pods running on different Nodes is
+// encapsulated with the configured tunnel type.
+func TestPodTrafficEncapsulation(t *testing.T) {
+	if clusterInfo.numNodes < 2 {
+		t.Skipf("Skipping test as it requires 2 different nodes")
+	}
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	podNames, deletePods := createPodsOnDifferentNodes(t, data, 2)
+	defer deletePods()
+	dstPodIP, err := data.podWaitForIP(defaultTimeout, podNames[1])
+	if err != nil {
+		t.Fatalf("Error when waiting for IP for Pod '%s': %v", podNames[1], err)
+	}
+	if err := data.podWaitForRunning(defaultTimeout, podNames[0]); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podNames[0], err)
+	}
+
+	numPackets, err := data.captureEncapsulatedPackets(podNames[0], nodeName(0), dstPodIP, nodeName(1), 5)
+	if err != nil {
+		t.Fatalf("Error when checking traffic encapsulation: %v", err)
+	}
+	t.Logf("Captured %d encapsulated packets", numPackets)
+}
@@ -18,19 +18,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/vmware-tanzu/antrea/pkg/ovs/openflow"
 )
 
 func setupTest(t *testing.T) (*TestData, error) {
-	data := &TestData{}
+	data := &TestData{testNamespace: testNamespaceName()}
 	t.Logf("Creating K8s clientset")
 	// TODO: it is probably not needed to re-create the clientset in each test, maybe we could
 	// just keep it in clusterInfo?
 	if err := data.createClient(); err != nil {
 		return nil, err
 	}
-	t.Logf("Creating '%s' K8s Namespace", testNamespace)
+	t.Logf("Creating '%s' K8s Namespace", data.testNamespace)
 	if err := data.createTestNamespace(); err != nil {
 		return nil, err
 	}
@@ -149,6 +152,44 @@ func exportLogs(t *testing.T, data *TestData) {
 		return nil
 	})
 
+	// dump the datapath flows of the OVS bridge for Antrea Pods to disk.
+	data.forAllAntreaPods(func(nodeName, podName string) error {
+		flows, err := data.getDatapathFlows(podName)
+		if err != nil {
+			t.Logf("Error when exporting datapath flows: %v", err)
+			return nil
+		}
+		w := getPodWriter(nodeName, podName, "datapath-flows")
+		if w == nil {
+			return nil
+		}
+		defer w.Close()
+		w.WriteString(strings.Join(flows, "\n") + "\n")
+		return nil
+	})
+
+	// dump the traces of the registered packets through the flow tables of the OVS bridge for
+	// Antrea Pods to disk.
+	if len(data.packetTraceFlows) > 0 {
+		data.forAllAntreaPods(func(nodeName, podName string) error {
+			w := getPodWriter(nodeName, podName, "packet-traces")
+			if w == nil {
+				return nil
+			}
+			defer w.Close()
+			for _, flowSpec := range data.packetTraceFlows {
+				output, err := data.tracePacket(podName, flowSpec)
+				if err != nil {
+					t.Logf("Error when exporting packet trace: %v", err)
+					continue
+				}
+				actions, _ := openflow.ParseTraceDatapathActions(output)
+				fmt.Fprintf(w, "### %s (datapath actions: %s)\n%s\n", flowSpec, actions, output)
+			}
+			return nil
+		})
+	}
+
 	// export kubelet logs with journalctl for each Node. If the Nodes do not use journalctl we
 	// print a log message. If kubelet is not run with systemd, the log file will be empty.
 	if err := forAllNodes(func(nodeName string) error {
@@ -174,7 +215,11 @@ func exportLogs(t *testing.T, data *TestData) {
 
 func teardownTest(t *testing.T, data *TestData) {
 	exportLogs(t, data)
-	t.Logf("Deleting '%s' K8s Namespace", testNamespace)
+	if t.Failed() && testOptions.keepNamespaceOnFailure {
+		t.Logf("Test failed, preserving '%s' K8s Namespace for debugging", data.testNamespace)
+		return
+	}
+	t.Logf("Deleting '%s' K8s Namespace", data.testNamespace)
 	if err := data.deleteTestNamespace(defaultTimeout); err != nil {
 		t.Logf("Error when tearing down test: %v", err)
 	}
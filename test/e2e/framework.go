@@ -16,23 +16,36 @@ package e2e
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/retry"
 
+	crdv1beta1 "github.com/vmware-tanzu/antrea/pkg/apis/clusterinformation/crd/antrea/v1beta1"
+	crdclientset "github.com/vmware-tanzu/antrea/pkg/client/clientset/versioned"
+	"github.com/vmware-tanzu/antrea/pkg/cni"
+	"github.com/vmware-tanzu/antrea/pkg/ovs/openflow"
 	"github.com/vmware-tanzu/antrea/test/e2e/providers"
 )
 
@@ -40,17 +53,48 @@ const defaultTimeout time.Duration = 90 * time.Second
 
 const AntreaDaemonSet string = "antrea-agent"
 
-const testNamespace string = "antrea-test"
+// defaultTestNamespace is the K8s Namespace in which test Pods are created, unless a random
+// Namespace is requested with --random-namespace.
+const defaultTestNamespace string = "antrea-test"
+
+// testPodNameLabel is the label set on all test Pods, with the Pod name as the value, so that
+// individual Pods can be selected (e.g. by NetworkPolicies).
+const testPodNameLabel string = "antrea-e2e"
 
 const defaultContainerName string = "busybox"
 
+// defaultExternalURL is the endpoint outside of the cluster used to validate Pod egress
+// connectivity, unless another one is provided with --external-url. Plain HTTP is used as the
+// busybox implementation of wget may not support TLS.
+const defaultExternalURL string = "http://example.com"
+
 const podNameSuffixLength int = 8
 
 const OVSContainerName string = "antrea-ovs"
 
+// defaultBridgeName is the name of the OVS bridge created by antrea-agent with the default
+// configuration.
+const defaultBridgeName string = "br-int"
+
+// tunnelPortName is the name of the OVS tunnel port created by antrea-agent.
+const tunnelPortName string = "tun0"
+
+const agentContainerName string = "antrea-agent"
+
+// podInterfaceName is the name of the network interface created by Antrea in each Pod's network
+// namespace (the CNI "ifName" provided by kubelet).
+const podInterfaceName string = "eth0"
+
+// defaultMTU is the MTU used by antrea-agent for Pod interfaces when none is provided in the agent
+// configuration, for both VXLAN and Geneve encapsulation.
+const defaultMTU int = 1450
+
 // AntreaNamespace is the K8s Namespace in which all Antrea resources are running.
 const AntreaNamespace string = "kube-system"
 
+// defaultAntreaImage is the container image used for all Antrea components in antrea.yml.
+const defaultAntreaImage string = "antrea/antrea-ubuntu:latest"
+
 type ClusterNode struct {
 	idx  int // 0 for master Node
 	name string
@@ -71,6 +115,20 @@ type TestOptions struct {
 	providerConfigPath  string
 	logsExportDir       string
 	logsExportOnSuccess bool
+	// antreaImage is the Antrea container image to deploy, instead of the one specified in
+	// antrea.yml.
+	antreaImage string
+	// keepNamespaceOnFailure indicates whether the test Namespace should be preserved when a test
+	// fails, so that the test Pods can be inspected.
+	keepNamespaceOnFailure bool
+	// randomNamespace indicates whether each test should use its own Namespace, named after
+	// defaultTestNamespace with a random suffix, so that test suites can run concurrently against
+	// the same cluster without their Pods colliding.
+	randomNamespace bool
+	// externalURL is the endpoint outside of the cluster which test Pods try to reach to
+	// validate egress connectivity. An empty value disables the tests which require access to
+	// an external network, e.g. for air-gapped clusters.
+	externalURL string
 }
 
 var testOptions TestOptions
@@ -81,6 +139,13 @@ var provider providers.ProviderInterface
 type TestData struct {
 	kubeConfig *restclient.Config
 	clientset  kubernetes.Interface
+	crdClient  crdclientset.Interface
+	// testNamespace is the K8s Namespace in which the test Pods, Services and NetworkPolicies are
+	// created, and which is deleted when the test completes.
+	testNamespace string
+	// packetTraceFlows are the flows traced through the flow tables of each Node when exporting
+	// the logs of the test, as registered with addPacketTrace.
+	packetTraceFlows []string
 }
 
 // workerNodeName returns an empty string if there is no worker Node with the provided idx
@@ -136,6 +201,16 @@ func RunSSHCommandOnNode(nodeName string, cmd string) (code int, stdout string,
 	return RunSSHCommand(host, config, cmd)
 }
 
+// A convenience wrapper around RunSSHCommandWithStdin which runs the provided command on the node
+// with name nodeName.
+func RunSSHCommandOnNodeWithStdin(nodeName string, cmd string, stdin string) (code int, stdout string, stderr string, err error) {
+	host, config, err := provider.GetSSHConfig(nodeName)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("error when retrieving SSH config for node '%s': %v", nodeName, err)
+	}
+	return RunSSHCommandWithStdin(host, config, cmd, stdin)
+}
+
 func collectClusterInfo() error {
 	// first create client set
 	testData := &TestData{}
@@ -198,23 +273,43 @@ func collectClusterInfo() error {
 	return nil
 }
 
+// createTestNamespace creates the test Namespace. If the Namespace already exists (e.g. it was
+// preserved after a test failure with --keep-namespace-on-failure), it is reused. If it is still
+// being deleted, we wait for the deletion to complete before creating it again.
 func (data *TestData) createTestNamespace() error {
 	ns := v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: testNamespace,
+			Name: data.testNamespace,
 		},
 	}
-	if ns, err := data.clientset.CoreV1().Namespaces().Create(&ns); err != nil {
+	err := wait.PollImmediate(1*time.Second, defaultTimeout, func() (bool, error) {
+		_, err := data.clientset.CoreV1().Namespaces().Create(&ns)
+		if err == nil {
+			return true, nil
+		}
 		// Ignore error if the namespace already exists
 		if !errors.IsAlreadyExists(err) {
-			return fmt.Errorf("error when creating '%s' Namespace: %v", testNamespace, err)
+			return false, fmt.Errorf("error when creating '%s' Namespace: %v", data.testNamespace, err)
 		}
 		// When namespace already exists, check phase
-		if ns.Status.Phase == v1.NamespaceTerminating {
-			return fmt.Errorf("error when creating '%s' Namespace: namespace exists but is in 'Terminating' phase", testNamespace)
+		existingNS, err := data.clientset.CoreV1().Namespaces().Get(data.testNamespace, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				// Namespace was deleted in the meantime, try to create it again
+				return false, nil
+			}
+			return false, fmt.Errorf("error when getting '%s' Namespace: %v", data.testNamespace, err)
 		}
+		if existingNS.Status.Phase == v1.NamespaceTerminating {
+			// Keep trying until deletion is complete
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("error when creating '%s' Namespace: namespace still in 'Terminating' phase after %v", data.testNamespace, defaultTimeout)
 	}
-	return nil
+	return err
 }
 
 // deleteTestNamespace deletes test namespace and waits for deletion to actually complete.
@@ -225,22 +320,22 @@ func (data *TestData) deleteTestNamespace(timeout time.Duration) error {
 		GracePeriodSeconds: &gracePeriodSeconds,
 		PropagationPolicy:  &propagationPolicy,
 	}
-	if err := data.clientset.CoreV1().Namespaces().Delete(testNamespace, deleteOptions); err != nil {
+	if err := data.clientset.CoreV1().Namespaces().Delete(data.testNamespace, deleteOptions); err != nil {
 		if errors.IsNotFound(err) {
 			// namespace does not exist, we return right away
 			return nil
 		}
-		return fmt.Errorf("error when deleting '%s' Namespace: %v", testNamespace, err)
+		return fmt.Errorf("error when deleting '%s' Namespace: %v", data.testNamespace, err)
 	}
 	err := wait.Poll(1*time.Second, timeout, func() (bool, error) {
-		if ns, err := data.clientset.CoreV1().Namespaces().Get(testNamespace, metav1.GetOptions{}); err != nil {
+		if ns, err := data.clientset.CoreV1().Namespaces().Get(data.testNamespace, metav1.GetOptions{}); err != nil {
 			if errors.IsNotFound(err) {
 				// Success
 				return true, nil
 			}
-			return false, fmt.Errorf("error when getting Namespace '%s' after delete: %v", testNamespace, err)
+			return false, fmt.Errorf("error when getting Namespace '%s' after delete: %v", data.testNamespace, err)
 		} else if ns.Status.Phase != v1.NamespaceTerminating {
-			return false, fmt.Errorf("deleted Namespace '%s' should be in 'Terminating' phase", testNamespace)
+			return false, fmt.Errorf("deleted Namespace '%s' should be in 'Terminating' phase", data.testNamespace)
 		}
 
 		// Keep trying
@@ -249,24 +344,92 @@ func (data *TestData) deleteTestNamespace(timeout time.Duration) error {
 	return err
 }
 
+// antreaManifestPath is the path of the Antrea manifest on the master Node.
+const antreaManifestPath string = "~/antrea.yml"
+
+// deployAntreaRetries is the number of times "kubectl apply" is attempted when deploying Antrea.
+const deployAntreaRetries int = 3
+
+// fileExistsOnNode checks whether a regular file exists at the provided path on the Node with name
+// nodeName, by running "test -f" through an SSH session.
+func fileExistsOnNode(nodeName string, path string) (bool, error) {
+	rc, _, stderr, err := RunSSHCommandOnNode(nodeName, fmt.Sprintf("test -f %s", path))
+	if err != nil {
+		return false, fmt.Errorf("error when checking for file '%s' on Node '%s': %v", path, nodeName, err)
+	}
+	switch rc {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	default:
+		return false, fmt.Errorf("error when checking for file '%s' on Node '%s', rc: %d, stderr: %s", path, nodeName, rc, stderr)
+	}
+}
+
 // deployAntrea deploys the Antrea DaemonSet using kubectl through an SSH session to the master node.
+// If an Antrea image was provided with --antrea-image, it is substituted in the manifest before
+// applying it. The manifest must be present on the master Node; "kubectl apply" is retried a few
+// times in case of transient failures.
 func (data *TestData) deployAntrea() error {
 	// TODO: use the K8s apiserver when server side apply is available?
 	// See https://kubernetes.io/docs/reference/using-api/api-concepts/#server-side-apply
-	host, config, err := provider.GetSSHConfig(masterNodeName())
+	if exists, err := fileExistsOnNode(masterNodeName(), antreaManifestPath); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("file %s not found on master Node '%s', it must be copied there before running the tests", antreaManifestPath, masterNodeName())
+	}
+	cmd := fmt.Sprintf("kubectl apply -f %s", antreaManifestPath)
+	if testOptions.antreaImage != "" {
+		cmd = fmt.Sprintf("sed 's|%s|%s|g' %s | kubectl apply -f -", defaultAntreaImage, testOptions.antreaImage, antreaManifestPath)
+	}
+	var rc int
+	var stderr string
+	var err error
+	for i := 0; i < deployAntreaRetries; i++ {
+		if i > 0 {
+			time.Sleep(1 * time.Second)
+		}
+		rc, _, stderr, err = RunSSHCommandOnNode(masterNodeName(), cmd)
+		if err == nil && rc == 0 {
+			return nil
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("error when retrieving SSH config for master: %v", err)
+		return fmt.Errorf("error when deploying Antrea: %v", err)
 	}
-	cmd := fmt.Sprintf("kubectl apply -f ~/antrea.yml")
-	rc, _, _, err := RunSSHCommand(host, config, cmd)
-	if err != nil || rc != 0 {
-		return fmt.Errorf("error when deploying Antrea; is antrea.yml available on the master Node?")
+	return fmt.Errorf("error when deploying Antrea, rc: %d, stderr: %s", rc, stderr)
+}
+
+// applyManifest creates or updates the resources defined in the provided YAML manifest, by piping
+// it to "kubectl apply" through an SSH session to the master Node.
+func (data *TestData) applyManifest(yaml string) error {
+	return runKubectlWithManifest("apply -f -", yaml)
+}
+
+// deleteManifest deletes the resources defined in the provided YAML manifest, by piping it to
+// "kubectl delete" through an SSH session to the master Node. Resources which do not exist are
+// ignored.
+func (data *TestData) deleteManifest(yaml string) error {
+	return runKubectlWithManifest("delete --ignore-not-found -f -", yaml)
+}
+
+func runKubectlWithManifest(args string, yaml string) error {
+	cmd := fmt.Sprintf("kubectl %s", args)
+	rc, _, stderr, err := RunSSHCommandOnNodeWithStdin(masterNodeName(), cmd, yaml)
+	if err != nil {
+		return fmt.Errorf("error when running '%s' on master Node '%s': %v", cmd, masterNodeName(), err)
+	}
+	if rc != 0 {
+		return fmt.Errorf("error when running '%s' on master Node '%s', rc: %d, stderr: %s", cmd, masterNodeName(), rc, stderr)
 	}
 	return nil
 }
 
 // waitForAntreaDaemonSetPods waits for the K8s apiserver to report that all the Antrea Pods are
 // available, i.e. all the Nodes have one or more of the Antrea daemon Pod running and available.
+// The rollout of the latest DaemonSet spec must be complete, and if an Antrea image was provided
+// with --antrea-image, all the DaemonSet containers must use that image.
 func (data *TestData) waitForAntreaDaemonSetPods(timeout time.Duration) error {
 	err := wait.Poll(1*time.Second, timeout, func() (bool, error) {
 		daemonSet, err := data.clientset.AppsV1().DaemonSets(AntreaNamespace).Get(AntreaDaemonSet, metav1.GetOptions{})
@@ -274,7 +437,22 @@ func (data *TestData) waitForAntreaDaemonSetPods(timeout time.Duration) error {
 			return false, fmt.Errorf("error when getting Antrea daemonset: %v", err)
 		}
 
-		if daemonSet.Status.NumberAvailable == daemonSet.Status.DesiredNumberScheduled {
+		if testOptions.antreaImage != "" {
+			podSpec := daemonSet.Spec.Template.Spec
+			for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+				if container.Image != testOptions.antreaImage {
+					return false, fmt.Errorf("container '%s' of Antrea daemonset uses image '%s' instead of '%s'", container.Name, container.Image, testOptions.antreaImage)
+				}
+			}
+		}
+
+		if daemonSet.Status.ObservedGeneration < daemonSet.Generation {
+			// The DaemonSet controller has not processed the latest spec yet.
+			return false, nil
+		}
+
+		if daemonSet.Status.NumberAvailable == daemonSet.Status.DesiredNumberScheduled &&
+			daemonSet.Status.UpdatedNumberScheduled == daemonSet.Status.DesiredNumberScheduled {
 			// Success
 			return true, nil
 		}
@@ -349,8 +527,13 @@ func (data *TestData) createClient() error {
 	if err != nil {
 		return fmt.Errorf("error when creating kubernetes client: %v", err)
 	}
+	crdClient, err := crdclientset.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error when creating Antrea CRD client: %v", err)
+	}
 	data.kubeConfig = kubeConfig
 	data.clientset = clientset
+	data.crdClient = crdClient
 	return nil
 }
 
@@ -392,6 +575,21 @@ func (data *TestData) deleteAntrea(timeout time.Duration) error {
 // createBusyboxPodOnNode creates a Pod in the test namespace with a single busybox container. The
 // Pod will be scheduled on the specified Node (if nodeName is not empty).
 func (data *TestData) createBusyboxPodOnNode(name string, nodeName string) error {
+	var nodeSelector map[string]string
+	if nodeName != "" {
+		nodeSelector = map[string]string{
+			"kubernetes.io/hostname": nodeName,
+		}
+	}
+	return data.createBusyboxPodWithNodeSelector(name, nodeSelector)
+}
+
+// createBusyboxPodWithNodeSelector creates a Pod in the test namespace with a single busybox
+// container, which can only be scheduled on Nodes with all the labels in nodeSelector (e.g.
+// "topology.kubernetes.io/zone"). If nodeSelector is empty, the Pod can be scheduled on any Node.
+// The Pod tolerates the NoSchedule taint of the master Node if nodeSelector targets it, either by
+// hostname or by role.
+func (data *TestData) createBusyboxPodWithNodeSelector(name string, nodeSelector map[string]string) error {
 	sleepDuration := 3600 // seconds
 	podSpec := v1.PodSpec{
 		Containers: []v1.Container{
@@ -403,13 +601,11 @@ func (data *TestData) createBusyboxPodOnNode(name string, nodeName string) error
 			},
 		},
 		RestartPolicy: v1.RestartPolicyNever,
+		NodeSelector:  nodeSelector,
 	}
-	if nodeName != "" {
-		podSpec.NodeSelector = map[string]string{
-			"kubernetes.io/hostname": nodeName,
-		}
-	}
-	if nodeName == masterNodeName() {
+	_, masterRoleSelected := nodeSelector["node-role.kubernetes.io/master"]
+	hostname := nodeSelector["kubernetes.io/hostname"]
+	if masterRoleSelected || (hostname != "" && hostname == masterNodeName()) {
 		// tolerate NoSchedule taint if we want Pod to run on master node
 		noScheduleToleration := v1.Toleration{
 			Key:      "node-role.kubernetes.io/master",
@@ -419,10 +615,13 @@ func (data *TestData) createBusyboxPodOnNode(name string, nodeName string) error
 		podSpec.Tolerations = []v1.Toleration{noScheduleToleration}
 	}
 	pod := &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{Name: name},
-		Spec:       podSpec,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{testPodNameLabel: name},
+		},
+		Spec: podSpec,
 	}
-	if _, err := data.clientset.CoreV1().Pods(testNamespace).Create(pod); err != nil {
+	if _, err := data.clientset.CoreV1().Pods(data.testNamespace).Create(pod); err != nil {
 		return err
 	}
 	return nil
@@ -433,13 +632,49 @@ func (data *TestData) createBusyboxPod(name string) error {
 	return data.createBusyboxPodOnNode(name, "")
 }
 
+// PodDeleteOptions are the options used when deleting a test Pod.
+type PodDeleteOptions struct {
+	// GracePeriodSeconds is the duration given to the Pod to terminate gracefully. Use 0 to
+	// simulate an abrupt termination. If nil, the default grace period of the Pod is used.
+	GracePeriodSeconds *int64
+	// PropagationPolicy determines how the dependents of the Pod are deleted, e.g. use
+	// metav1.DeletePropagationForeground to ensure that they are gone before the Pod. If nil,
+	// the default policy is used.
+	PropagationPolicy *metav1.DeletionPropagation
+}
+
+// defaultPodDeleteGracePeriodSeconds is the grace period used by deletePod and
+// deletePodInNamespace.
+const defaultPodDeleteGracePeriodSeconds int64 = 5
+
+func defaultPodDeleteOptions() PodDeleteOptions {
+	gracePeriodSeconds := defaultPodDeleteGracePeriodSeconds
+	return PodDeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}
+}
+
 // deletePod deletes a Pod in the test namespace.
 func (data *TestData) deletePod(name string) error {
-	var gracePeriodSeconds int64 = 5
+	return data.deletePodInNamespace(data.testNamespace, name)
+}
+
+// deletePodWithOptions deletes a Pod in the test namespace with the provided options.
+func (data *TestData) deletePodWithOptions(name string, opts PodDeleteOptions) error {
+	return data.deletePodInNamespaceWithOptions(data.testNamespace, name, opts)
+}
+
+// deletePodInNamespace deletes a Pod in the provided namespace.
+func (data *TestData) deletePodInNamespace(namespace string, name string) error {
+	return data.deletePodInNamespaceWithOptions(namespace, name, defaultPodDeleteOptions())
+}
+
+// deletePodInNamespaceWithOptions deletes a Pod in the provided namespace with the provided options.
+// It is not an error if the Pod does not exist.
+func (data *TestData) deletePodInNamespaceWithOptions(namespace string, name string, opts PodDeleteOptions) error {
 	deleteOptions := &metav1.DeleteOptions{
-		GracePeriodSeconds: &gracePeriodSeconds,
+		GracePeriodSeconds: opts.GracePeriodSeconds,
+		PropagationPolicy:  opts.PropagationPolicy,
 	}
-	if err := data.clientset.CoreV1().Pods(testNamespace).Delete(name, deleteOptions); err != nil {
+	if err := data.clientset.CoreV1().Pods(namespace).Delete(name, deleteOptions); err != nil {
 		if !errors.IsNotFound(err) {
 			return err
 		}
@@ -450,12 +685,24 @@ func (data *TestData) deletePod(name string) error {
 // Deletes a Pod in the test namespace then waits us to timeout for the Pod not to be visible to the
 // client any more.
 func (data *TestData) deletePodAndWait(timeout time.Duration, name string) error {
-	if err := data.deletePod(name); err != nil {
+	return data.deletePodInNamespaceAndWait(data.testNamespace, name, timeout)
+}
+
+// deletePodInNamespaceAndWait deletes a Pod in the provided namespace then waits up to timeout for
+// the Pod not to be visible to the client any more. It can be used to clean up Pods created outside
+// of the test namespace, which are not deleted along with it.
+func (data *TestData) deletePodInNamespaceAndWait(namespace string, name string, timeout time.Duration) error {
+	if err := data.deletePodInNamespace(namespace, name); err != nil {
 		return err
 	}
+	return data.podWaitForDeletion(namespace, name, timeout)
+}
 
+// podWaitForDeletion waits up to timeout for the Pod in the provided namespace not to be visible to
+// the client any more.
+func (data *TestData) podWaitForDeletion(namespace string, name string, timeout time.Duration) error {
 	if err := wait.Poll(1*time.Second, timeout, func() (bool, error) {
-		if _, err := data.clientset.CoreV1().Pods(testNamespace).Get(name, metav1.GetOptions{}); err != nil {
+		if _, err := data.clientset.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{}); err != nil {
 			if errors.IsNotFound(err) {
 				return true, nil
 			}
@@ -464,7 +711,7 @@ func (data *TestData) deletePodAndWait(timeout time.Duration, name string) error
 		// Keep trying
 		return false, nil
 	}); err == wait.ErrWaitTimeout {
-		return fmt.Errorf("Pod '%s' still visible to client after %v", name, timeout)
+		return fmt.Errorf("Pod '%s/%s' still visible to client after %v", namespace, name, timeout)
 	} else {
 		return err
 	}
@@ -476,7 +723,7 @@ type PodCondition func(*v1.Pod) (bool, error)
 // the condition predicate is met (or until the provided timeout expires).
 func (data *TestData) podWaitFor(timeout time.Duration, name string, condition PodCondition) (*v1.Pod, error) {
 	err := wait.Poll(1*time.Second, timeout, func() (bool, error) {
-		if pod, err := data.clientset.CoreV1().Pods(testNamespace).Get(name, metav1.GetOptions{}); err != nil {
+		if pod, err := data.clientset.CoreV1().Pods(data.testNamespace).Get(name, metav1.GetOptions{}); err != nil {
 			if errors.IsNotFound(err) {
 				return false, nil
 			}
@@ -488,7 +735,7 @@ func (data *TestData) podWaitFor(timeout time.Duration, name string, condition P
 	if err != nil {
 		return nil, err
 	}
-	return data.clientset.CoreV1().Pods(testNamespace).Get(name, metav1.GetOptions{})
+	return data.clientset.CoreV1().Pods(data.testNamespace).Get(name, metav1.GetOptions{})
 }
 
 // podWaitForRunning polls the k8s apiserver until the specified Pod is in the "running" state (or
@@ -500,18 +747,54 @@ func (data *TestData) podWaitForRunning(timeout time.Duration, name string) erro
 	return err
 }
 
-// podWaitForIP polls the K8s apiserver until the specified Pod is in the "running" state (or until
-// the provided timeout expires). The function then returns the IP address assigned to the Pod.
+// podsWaitForRunning waits concurrently for all the specified Pods to be in the "running" state (or
+// until the provided timeout expires). If some Pods fail to reach the "running" state, the returned
+// error lists all of them, along with the reason why waiting for each one failed.
+func (data *TestData) podsWaitForRunning(timeout time.Duration, names []string) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failures := make(map[string]error)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := data.podWaitForRunning(timeout, name); err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				failures[name] = err
+			}
+		}(name)
+	}
+	wg.Wait()
+	if len(failures) == 0 {
+		return nil
+	}
+	failedNames := make([]string, 0, len(failures))
+	for name := range failures {
+		failedNames = append(failedNames, name)
+	}
+	sort.Strings(failedNames)
+	msgs := make([]string, 0, len(failedNames))
+	for _, name := range failedNames {
+		msgs = append(msgs, fmt.Sprintf("'%s': %v", name, failures[name]))
+	}
+	return fmt.Errorf("%d Pod(s) not running: %s", len(failedNames), strings.Join(msgs, "; "))
+}
+
+// podWaitForIP polls the K8s apiserver until the specified Pod is in the "running" state and has
+// an assigned IP address (or until the provided timeout expires). The function then returns the IP
+// address assigned to the Pod.
 func (data *TestData) podWaitForIP(timeout time.Duration, name string) (string, error) {
+	// According to the K8s API documentation (https://godoc.org/k8s.io/api/core/v1#PodStatus),
+	// the PodIP field should only be empty if the Pod has not yet been scheduled, and "running"
+	// implies scheduled. However, the PodIP may be briefly missing from the status observed
+	// through the apiserver cache for a Pod which is already running, so we keep polling.
 	pod, err := data.podWaitFor(timeout, name, func(pod *v1.Pod) (bool, error) {
-		return pod.Status.Phase == v1.PodRunning, nil
+		return pod.Status.Phase == v1.PodRunning && pod.Status.PodIP != "", nil
 	})
 	if err != nil {
 		return "", err
 	}
-	// According to the K8s API documentation (https://godoc.org/k8s.io/api/core/v1#PodStatus),
-	// the PodIP field should only be empty if the Pod has not yet been scheduled, and "running"
-	// implies scheduled.
 	if pod.Status.PodIP == "" {
 		return "", fmt.Errorf("pod is running but has no assigned IP, which should never happen")
 	}
@@ -602,6 +885,103 @@ func (data *TestData) getAntreaPodOnNode(nodeName string) (podName string, err e
 	return pods.Items[0].Name, nil
 }
 
+// getAntreaAgentVersion retrieves the version of the antrea-agent running on a specific Node, by
+// running "antrea-agent --version" in the agent container of the Antrea Pod for that Node.
+func (data *TestData) getAntreaAgentVersion(nodeName string) (string, error) {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return "", fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	cmd := []string{"antrea-agent", "--version"}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, agentContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when running '%s' in Pod '%s': %v - stdout: %s - stderr: %s", strings.Join(cmd, " "), antreaPodName, err, stdout, stderr)
+	}
+	return parseAntreaAgentVersion(stdout)
+}
+
+// agentHeartbeatTimeout is the maximum age of the last heartbeat of a healthy antrea-agent. The
+// agent monitor updates the heartbeat every 60 seconds.
+const agentHeartbeatTimeout = 2 * time.Minute
+
+// getAntreaAgentHealthz checks that the antrea-agent running on a specific Node is ready, which is a
+// stronger signal than the Antrea Pod being Running: the CNI server must be listening on its
+// socket in the agent container, and the agent must report itself healthy in its AntreaAgentInfo
+// with a recent heartbeat. An error is returned only if the status cannot be retrieved.
+func (data *TestData) getAntreaAgentHealthz(nodeName string) (bool, error) {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return false, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	cmd := []string{"sh", "-c", fmt.Sprintf("if [ -S %s ]; then echo ready; fi", cni.AntreaCNISocketAddr)}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, agentContainerName, cmd)
+	if err != nil {
+		return false, fmt.Errorf("error when checking CNI socket in Pod '%s': %v - stderr: %s", antreaPodName, err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "ready" {
+		return false, nil
+	}
+
+	// The AntreaAgentInfo is named after the Antrea Pod and is created once the agent is running.
+	agentInfo, err := data.crdClient.ClusterinformationV1beta1().AntreaAgentInfos().Get(antreaPodName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error when getting AntreaAgentInfo '%s': %v", antreaPodName, err)
+	}
+	for _, condition := range agentInfo.AgentConditions {
+		if condition.Type == crdv1beta1.AgentHealthy {
+			return condition.Status == v1.ConditionTrue && time.Since(condition.LastHeartbeatTime.Time) < agentHeartbeatTimeout, nil
+		}
+	}
+	return false, nil
+}
+
+// parseAntreaAgentVersion extracts the version from the output of "antrea-agent --version", which
+// looks like "antrea-agent version <version> <GOOS>/<GOARCH>".
+func parseAntreaAgentVersion(output string) (string, error) {
+	fields := strings.Fields(output)
+	for idx := 0; idx < len(fields)-1; idx++ {
+		if fields[idx] == "version" {
+			return fields[idx+1], nil
+		}
+	}
+	return "", fmt.Errorf("cannot parse antrea-agent version from '%s'", output)
+}
+
+// getNodePodCIDRs retrieves the Pod CIDR(s) allocated to the Node with the provided name, by reading
+// the Node's spec from the K8s apiserver. The K8s API version we use only exposes a single CIDR
+// (Spec.PodCIDR), but we return a slice so that callers do not need to change when multiple CIDRs
+// are supported.
+func (data *TestData) getNodePodCIDRs(nodeName string) ([]string, error) {
+	node, err := data.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error when getting Node '%s': %v", nodeName, err)
+	}
+	if node.Spec.PodCIDR == "" {
+		return nil, fmt.Errorf("Node '%s' has no Pod CIDR allocated", nodeName)
+	}
+	return []string{node.Spec.PodCIDR}, nil
+}
+
+// validatePodIPForNode checks that the provided IP address is in one of the Pod CIDRs allocated to
+// the specified Node. This is more precise than validatePodIP, which only checks the IP address
+// against the Pod Network CIDR for the cluster.
+func (data *TestData) validatePodIPForNode(nodeName, podIP string) (bool, error) {
+	podCIDRs, err := data.getNodePodCIDRs(nodeName)
+	if err != nil {
+		return false, err
+	}
+	for _, podCIDR := range podCIDRs {
+		if isValid, err := validatePodIP(podCIDR, podIP); err != nil {
+			return false, err
+		} else if isValid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // validatePodIP checks that the provided IP address is in the Pod Network CIDR for the cluster.
 func validatePodIP(podNetworkCIDR, podIP string) (bool, error) {
 	ip := net.ParseIP(podIP)
@@ -615,6 +995,58 @@ func validatePodIP(podNetworkCIDR, podIP string) (bool, error) {
 	return cidr.Contains(ip), nil
 }
 
+// getNodeGatewayIP returns the IP address of the antrea-gw0 interface of the specified Node, which
+// is the first IP address in the Node's Pod CIDR, and which Pods on the Node use as their default
+// gateway.
+func (data *TestData) getNodeGatewayIP(nodeName string) (string, error) {
+	podCIDRs, err := data.getNodePodCIDRs(nodeName)
+	if err != nil {
+		return "", err
+	}
+	_, cidr, err := net.ParseCIDR(podCIDRs[0])
+	if err != nil {
+		return "", fmt.Errorf("Pod CIDR '%s' of Node '%s' is not a valid CIDR", podCIDRs[0], nodeName)
+	}
+	gatewayIP := make(net.IP, len(cidr.IP))
+	copy(gatewayIP, cidr.IP)
+	gatewayIP[len(gatewayIP)-1]++
+	return gatewayIP.String(), nil
+}
+
+// getPodDefaultRoute returns the gateway of the default route in the specified test Pod. The
+// routes are read with "ip route show default" and, if the ip applet is not available in the
+// container, with "route -n".
+func (data *TestData) getPodDefaultRoute(podName string) (gatewayIP string, err error) {
+	cmd := []string{"sh", "-c", "ip route show default 2>/dev/null || route -n"}
+	stdout, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when reading routes in Pod '%s': %v (%s)", podName, err, stderr)
+	}
+	return parseDefaultRouteGateway(stdout)
+}
+
+// parseDefaultRouteGateway parses the gateway of the default route from the output of either "ip
+// route show default", e.g. "default via 10.10.1.1 dev eth0", or "route -n", in which the default
+// route is the one with destination 0.0.0.0, e.g. "0.0.0.0 10.10.1.1 0.0.0.0 UG 0 0 0 eth0".
+func parseDefaultRouteGateway(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		var gateway string
+		if len(fields) >= 3 && fields[0] == "default" && fields[1] == "via" {
+			gateway = fields[2]
+		} else if len(fields) >= 2 && fields[0] == "0.0.0.0" {
+			gateway = fields[1]
+		} else {
+			continue
+		}
+		if net.ParseIP(gateway) == nil {
+			return "", fmt.Errorf("invalid gateway '%s' for default route: %s", gateway, line)
+		}
+		return gateway, nil
+	}
+	return "", fmt.Errorf("no default route in output: %s", output)
+}
+
 // A DNS-1123 subdomain must consist of lower case alphanumeric characters
 var lettersAndDigits = []rune("abcdefghijklmnopqrstuvwxyz0123456789")
 
@@ -627,6 +1059,15 @@ func randSeq(n int) string {
 	return string(b)
 }
 
+// testNamespaceName returns the name of the Namespace to use for a new test: defaultTestNamespace,
+// or defaultTestNamespace with a random suffix if --random-namespace is set.
+func testNamespaceName() string {
+	if !testOptions.randomNamespace {
+		return defaultTestNamespace
+	}
+	return fmt.Sprintf("%s-%s", defaultTestNamespace, randSeq(podNameSuffixLength))
+}
+
 func randPodName(prefix string) string {
 	return prefix + randSeq(podNameSuffixLength)
 }
@@ -695,8 +1136,1177 @@ func (data *TestData) forAllAntreaPods(fn func(nodeName, podName string) error)
 	return nil
 }
 
+// getPodInterfaceMTU returns the MTU of the network interface with name ifName in the specified test
+// Pod. The MTU is read from sysfs, which is always available in the busybox container (unlike some
+// iproute2 options).
+func (data *TestData) getPodInterfaceMTU(podName string, ifName string) (int, error) {
+	cmd := []string{"cat", fmt.Sprintf("/sys/class/net/%s/mtu", ifName)}
+	stdout, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+	if err != nil {
+		return 0, fmt.Errorf("error when reading MTU of interface '%s' in Pod '%s': %v (%s)", ifName, podName, err, stderr)
+	}
+	mtu, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected MTU value for interface '%s' in Pod '%s': %s", ifName, podName, stdout)
+	}
+	return mtu, nil
+}
+
+// createNginxDeploymentAndService creates a Deployment with the provided number of nginx replicas in
+// the test namespace, as well as a ClusterIP Service with the same name, which selects the replicas
+// and exposes nginx on the provided port. It then waits for all the replicas to be available and
+// returns the created Service.
+func (data *TestData) createNginxDeploymentAndService(name string, replicas int32, port int) (*v1.Service, error) {
+	labels := map[string]string{"app": name}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:            "nginx",
+							Image:           "nginx",
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Ports:           []v1.ContainerPort{{ContainerPort: 80}},
+						},
+					},
+				},
+			},
+		},
+	}
+	if _, err := data.clientset.AppsV1().Deployments(data.testNamespace).Create(deployment); err != nil {
+		return nil, fmt.Errorf("error when creating Deployment '%s': %v", name, err)
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: labels,
+			Ports: []v1.ServicePort{{
+				Protocol:   v1.ProtocolTCP,
+				Port:       int32(port),
+				TargetPort: intstr.FromInt(80),
+			}},
+		},
+	}
+	service, err := data.clientset.CoreV1().Services(data.testNamespace).Create(service)
+	if err != nil {
+		return nil, fmt.Errorf("error when creating Service '%s': %v", name, err)
+	}
+
+	if err := data.deploymentWaitForAvailable(defaultTimeout, name); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// deleteDeploymentAndService deletes the Deployment and the Service with the provided name in the
+// test namespace.
+func (data *TestData) deleteDeploymentAndService(name string) error {
+	if err := data.clientset.CoreV1().Services(data.testNamespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error when deleting Service '%s': %v", name, err)
+	}
+	propagationPolicy := metav1.DeletePropagationForeground
+	deleteOptions := &metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	if err := data.clientset.AppsV1().Deployments(data.testNamespace).Delete(name, deleteOptions); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error when deleting Deployment '%s': %v", name, err)
+	}
+	return nil
+}
+
+// deploymentWaitForAvailable polls the K8s apiserver until all the replicas of the specified
+// Deployment (in the test Namespace) are available (or until the provided timeout expires).
+func (data *TestData) deploymentWaitForAvailable(timeout time.Duration, name string) error {
+	err := wait.Poll(1*time.Second, timeout, func() (bool, error) {
+		deployment, err := data.clientset.AppsV1().Deployments(data.testNamespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("error when getting Deployment '%s': %v", name, err)
+		}
+		if deployment.Spec.Replicas == nil {
+			return false, nil
+		}
+		return deployment.Status.AvailableReplicas == *deployment.Spec.Replicas, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Deployment '%s' not available after %v", name, timeout)
+	}
+	return err
+}
+
+// curlServiceFromPod sends an HTTP GET request to the provided Service IP and port from the
+// specified test Pod, and returns the body of the response. The busybox container does not include
+// curl, so we use the busybox implementation of wget instead, which prints the body to stdout and
+// reports errors (e.g. timeouts or non-2xx status codes) on stderr with a non-zero exit code.
+func (data *TestData) curlServiceFromPod(podName, serviceIP string, port int) (string, error) {
+	url := fmt.Sprintf("http://%s", net.JoinHostPort(serviceIP, strconv.Itoa(port)))
+	cmd := []string{"wget", "-q", "-O", "-", "-T", "5", url}
+	stdout, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when accessing '%s' from Pod '%s': %v (%s)", url, podName, err, strings.TrimSpace(stderr))
+	}
+	if stdout == "" {
+		return "", fmt.Errorf("empty response when accessing '%s' from Pod '%s'", url, podName)
+	}
+	return stdout, nil
+}
+
+// runCurlToExternalFromPod sends an HTTP GET request to the provided URL, which should be outside of
+// the cluster, from the specified test Pod. Traffic to external destinations is SNATed to the Node
+// IP address, so this validates the egress datapath of the Pod. Like in curlServiceFromPod, the
+// busybox implementation of wget is used.
+func (data *TestData) runCurlToExternalFromPod(podName, url string) error {
+	cmd := []string{"wget", "-q", "-O", "-", "-T", "5", url}
+	_, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+	if err != nil {
+		return fmt.Errorf("error when accessing external URL '%s' from Pod '%s': %v (%s)", url, podName, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
 func (data *TestData) runPingCommandFromTestPod(podName string, targetIP string, count int) error {
 	cmd := []string{"ping", "-c", strconv.Itoa(count), targetIP}
-	_, _, err := data.runCommandFromPod(testNamespace, podName, defaultContainerName, cmd)
+	_, _, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+	return err
+}
+
+// waitForPodConnectivity sends echo requests from the specified test Pod to targetIP until the
+// result matches the expected connectivity, which is useful when the datapath is updated
+// asynchronously (e.g. after creating a NetworkPolicy). It returns an error if the expected
+// connectivity is not observed before the timeout.
+func (data *TestData) waitForPodConnectivity(podName string, targetIP string, expectConnected bool, timeout time.Duration) error {
+	cmd := []string{"ping", "-c", "1", "-W", "1", targetIP}
+	err := wait.Poll(time.Second, timeout, func() (bool, error) {
+		_, _, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+		return (err == nil) == expectConnected, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		if expectConnected {
+			return fmt.Errorf("Pod '%s' cannot reach '%s'", podName, targetIP)
+		}
+		return fmt.Errorf("Pod '%s' can still reach '%s'", podName, targetIP)
+	}
 	return err
 }
+
+// runDNSLookupFromPod resolves name from the specified test Pod, using the cluster DNS, and returns
+// the first IP address it resolves to. It uses nslookup, which is provided by busybox, and falls
+// back to getent for images which do not include nslookup.
+func (data *TestData) runDNSLookupFromPod(podName string, name string) (string, error) {
+	stdout, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, []string{"nslookup", name})
+	// Some versions of busybox nslookup exit with an error when there is no answer for one of
+	// the address families, so the output is parsed even if the command fails.
+	if ip, parseErr := parseNslookupOutput(stdout); parseErr == nil {
+		return ip, nil
+	} else if err == nil {
+		return "", fmt.Errorf("error when parsing nslookup output for '%s' from Pod '%s': %v", name, podName, parseErr)
+	}
+	nslookupErr := fmt.Errorf("%v (%s)", err, strings.TrimSpace(stderr))
+	stdout, stderr, err = data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, []string{"getent", "hosts", name})
+	if err != nil {
+		return "", fmt.Errorf("error when resolving '%s' from Pod '%s': nslookup failed: %v, getent failed: %v (%s)", name, podName, nslookupErr, err, strings.TrimSpace(stderr))
+	}
+	// getent outputs "<IP> <canonical name> [<aliases>]" for each address.
+	fields := strings.Fields(stdout)
+	if len(fields) == 0 || net.ParseIP(fields[0]) == nil {
+		return "", fmt.Errorf("unexpected getent output for '%s' from Pod '%s': %s", name, podName, stdout)
+	}
+	return fields[0], nil
+}
+
+// parseNslookupOutput returns the first address listed after the "Name:" line in the output of
+// busybox nslookup. Older versions of busybox list addresses as "Address 1: <IP> <name>", while
+// newer ones use "Address: <IP>". The address of the DNS server, which comes before the "Name:"
+// line, is ignored.
+func parseNslookupOutput(output string) (string, error) {
+	nameFound := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Name:") {
+			nameFound = true
+			continue
+		}
+		if !nameFound || !strings.HasPrefix(line, "Address") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			continue
+		}
+		fields := strings.Fields(line[idx+1:])
+		if len(fields) > 0 && net.ParseIP(fields[0]) != nil {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no address found in output: %s", output)
+}
+
+// createNetworkPolicy creates a NetworkPolicy with the provided spec in the test namespace.
+func (data *TestData) createNetworkPolicy(name string, spec *networkingv1.NetworkPolicySpec) (*networkingv1.NetworkPolicy, error) {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       *spec,
+	}
+	return data.clientset.NetworkingV1().NetworkPolicies(data.testNamespace).Create(policy)
+}
+
+// deleteNetworkPolicy deletes the NetworkPolicy with the provided name in the test namespace.
+func (data *TestData) deleteNetworkPolicy(name string) error {
+	if err := data.clientset.NetworkingV1().NetworkPolicies(data.testNamespace).Delete(name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("error when deleting NetworkPolicy '%s': %v", name, err)
+	}
+	return nil
+}
+
+// podSelectorForTestPod returns a label selector which only selects the test Pod with the provided
+// name.
+func podSelectorForTestPod(podName string) metav1.LabelSelector {
+	return metav1.LabelSelector{MatchLabels: map[string]string{testPodNameLabel: podName}}
+}
+
+// createIngressDenyNetworkPolicy creates a NetworkPolicy which denies all ingress traffic to the
+// specified test Pod.
+func (data *TestData) createIngressDenyNetworkPolicy(name string, podName string) (*networkingv1.NetworkPolicy, error) {
+	return data.createNetworkPolicy(name, &networkingv1.NetworkPolicySpec{
+		PodSelector: podSelectorForTestPod(podName),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	})
+}
+
+// createEgressDenyNetworkPolicy creates a NetworkPolicy which denies all egress traffic from the
+// specified test Pod.
+func (data *TestData) createEgressDenyNetworkPolicy(name string, podName string) (*networkingv1.NetworkPolicy, error) {
+	return data.createNetworkPolicy(name, &networkingv1.NetworkPolicySpec{
+		PodSelector: podSelectorForTestPod(podName),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+	})
+}
+
+// createIngressAllowNetworkPolicy creates a NetworkPolicy which only allows ingress traffic to the
+// specified test Pod from the test Pod fromPodName.
+func (data *TestData) createIngressAllowNetworkPolicy(name string, podName string, fromPodName string) (*networkingv1.NetworkPolicy, error) {
+	fromSelector := podSelectorForTestPod(fromPodName)
+	return data.createNetworkPolicy(name, &networkingv1.NetworkPolicySpec{
+		PodSelector: podSelectorForTestPod(podName),
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{
+			{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &fromSelector}}},
+		},
+	})
+}
+
+// pingInterval is the interval between two successive echo requests sent by ping, when no interval
+// is provided. It determines the granularity of the downtime measured from the ping statistics.
+const pingInterval time.Duration = 1 * time.Second
+
+// pingStatsRegex matches the statistics printed by ping when it exits, e.g. "10 packets
+// transmitted, 8 packets received, 20% packet loss" (busybox) or "10 packets transmitted, 8
+// received, 20% packet loss, time 9012ms" (iputils).
+var pingStatsRegex = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+
+// parsePingDowntime parses the statistics printed by ping and returns the downtime, computed as the
+// number of lost echo requests multiplied by interval.
+func parsePingDowntime(output string, interval time.Duration) (time.Duration, error) {
+	matches := pingStatsRegex.FindStringSubmatch(output)
+	if matches == nil {
+		return 0, fmt.Errorf("no ping statistics in output: %s", output)
+	}
+	// The regex ensures that both values are valid integers.
+	transmitted, _ := strconv.Atoi(matches[1])
+	received, _ := strconv.Atoi(matches[2])
+	return time.Duration(transmitted-received) * interval, nil
+}
+
+// measureDowntimeDuringAgentRestart starts a continuous ping from the specified test Pod to
+// targetIP, restarts the antrea-agent Pod on Node nodeName and stops the ping once the new
+// antrea-agent Pod is running. It returns the data-plane downtime measured from the number of lost
+// echo requests, which has a granularity of pingInterval.
+func (data *TestData) measureDowntimeDuringAgentRestart(podName string, targetIP string, nodeName string, timeout time.Duration) (time.Duration, error) {
+	type pingResult struct {
+		stdout string
+		stderr string
+		err    error
+	}
+	resultCh := make(chan pingResult, 1)
+	// The ping is stopped with SIGINT once the agent has restarted; the deadline only ensures that
+	// it exits eventually if this fails.
+	deadline := int((2*timeout + 10*pingInterval).Seconds())
+	go func() {
+		cmd := []string{"ping", "-w", strconv.Itoa(deadline), targetIP}
+		stdout, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, cmd)
+		resultCh <- pingResult{stdout, stderr, err}
+	}()
+
+	// Make sure that the ping is running and that there is connectivity before the restart.
+	time.Sleep(3 * pingInterval)
+	_, restartErr := data.deleteAntreaAgentOnNode(nodeName, 30 /* grace period in seconds */, timeout)
+	// Leave time for the new antrea-agent to restore connectivity before stopping the ping.
+	time.Sleep(5 * pingInterval)
+	if _, stderr, err := data.runCommandFromPod(data.testNamespace, podName, defaultContainerName, []string{"pkill", "-INT", "ping"}); err != nil {
+		return 0, fmt.Errorf("error when stopping ping in Pod '%s': %v (%s)", podName, err, strings.TrimSpace(stderr))
+	}
+
+	var result pingResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("ping in Pod '%s' did not exit after %v", podName, timeout)
+	}
+	if restartErr != nil {
+		return 0, fmt.Errorf("error when restarting antrea-agent on Node '%s': %v", nodeName, restartErr)
+	}
+	// ping exits with a non-zero code if no reply was received, in which case the statistics are
+	// still printed.
+	downtime, err := parsePingDowntime(result.stdout, pingInterval)
+	if err != nil {
+		return 0, fmt.Errorf("error when running ping in Pod '%s': %v (%s)", podName, result.err, strings.TrimSpace(result.stderr))
+	}
+	return downtime, nil
+}
+
+// doesOVSPortExist returns whether the OVS port with name portName exists, by running ovs-vsctl in
+// the OVS container of the specified Antrea Pod.
+func (data *TestData) doesOVSPortExist(antreaPodName string, portName string) (bool, error) {
+	cmd := []string{"ovs-vsctl", "port-to-br", portName}
+	_, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err == nil {
+		return true, nil
+	} else if strings.Contains(stderr, "no port named") {
+		return false, nil
+	}
+	return false, fmt.Errorf("error when running ovs-vsctl command on Pod '%s': %v", antreaPodName, err)
+}
+
+// ovsCtlPath is the path of the ovs-ctl script used to start OVS in the antrea-ovs container.
+const ovsCtlPath = "/usr/share/openvswitch/scripts/ovs-ctl"
+
+// restartOVSOnNode restarts ovsdb-server and ovs-vswitchd in the OVS container of the Antrea Pod
+// running on the specified Node, with the same options as the container start script. ovs-ctl
+// saves the OpenFlow flows before stopping ovs-vswitchd and restores them after starting it.
+func (data *TestData) restartOVSOnNode(nodeName string) error {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	cmd := []string{ovsCtlPath, "--system-id=random", "restart", "--db-file=/var/run/openvswitch/conf.db"}
+	if _, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd); err != nil {
+		return fmt.Errorf("error when restarting OVS on Pod '%s': %v (%s)", antreaPodName, err, stderr)
+	}
+	return nil
+}
+
+// measureRecoveryAfterOVSRestart restarts the OVS processes on Node nodeName and returns the time
+// it takes for the specified test Pod to reach targetIP again. It then checks that antrea-agent has
+// re-established its OVSDB connection, by creating a new Pod on the Node and waiting for its OVS
+// port to be created, which requires the agent to issue OVSDB transactions.
+func (data *TestData) measureRecoveryAfterOVSRestart(podName string, targetIP string, nodeName string, timeout time.Duration) (time.Duration, error) {
+	if err := data.runPingCommandFromTestPod(podName, targetIP, 1); err != nil {
+		return 0, fmt.Errorf("Pod '%s' cannot reach '%s' before restarting OVS: %v", podName, targetIP, err)
+	}
+	start := time.Now()
+	if err := data.restartOVSOnNode(nodeName); err != nil {
+		return 0, err
+	}
+	if err := data.waitForPodConnectivity(podName, targetIP, true, timeout); err != nil {
+		return 0, fmt.Errorf("data-plane connectivity did not recover after restarting OVS: %v", err)
+	}
+	recoveryTime := time.Since(start)
+
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return 0, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	newPodName := randPodName("test-pod-ovs-restart-")
+	if err := data.createBusyboxPodOnNode(newPodName, nodeName); err != nil {
+		return 0, fmt.Errorf("error when creating busybox test Pod '%s': %v", newPodName, err)
+	}
+	defer data.deletePod(newPodName)
+	if _, err := data.podWaitForIP(timeout, newPodName); err != nil {
+		return 0, fmt.Errorf("error when waiting for IP for Pod '%s' after restarting OVS: %v", newPodName, err)
+	}
+	portName, err := data.getOVSPortNameForPod(antreaPodName, newPodName)
+	if err != nil {
+		return 0, err
+	}
+	if portName == "" {
+		return 0, fmt.Errorf("no OVS port for Pod '%s' created after restarting OVS", newPodName)
+	}
+	return recoveryTime, nil
+}
+
+// getOVSPortNames returns the names of the OVS ports on the bridge, by running "ovs-vsctl
+// list-ports" in the OVS container of the specified Antrea Pod.
+func (data *TestData) getOVSPortNames(antreaPodName string) ([]string, error) {
+	cmd := []string{"ovs-vsctl", "list-ports", defaultBridgeName}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error when listing OVS ports on Pod '%s': %v (%s)", antreaPodName, err, stderr)
+	}
+	return strings.Fields(stdout), nil
+}
+
+// getOVSPortNameForPod returns the name of the OVS port created for the Pod with the provided name in
+// the test Namespace, by looking up the Pod in the external IDs of the OVS ports in the OVS container
+// of the specified Antrea Pod. An empty string is returned if there is no such port. The port name is
+// not computed from the Pod name, as it depends on the antrea-agent configuration.
+func (data *TestData) getOVSPortNameForPod(antreaPodName string, podName string) (string, error) {
+	cmd := []string{
+		"ovs-vsctl", "--no-headings", "--bare", "--columns=name", "find", "Port",
+		fmt.Sprintf("external_ids:pod-name=%s", podName),
+		fmt.Sprintf("external_ids:pod-namespace=%s", data.testNamespace),
+	}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when looking up OVS port for Pod '%s' on Pod '%s': %v (%s)", podName, antreaPodName, err, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// getOVSPortExternalID returns the value of the external ID with the provided key of the OVS port
+// portName, by running "ovs-vsctl get" in the OVS container of the specified Antrea Pod.
+func (data *TestData) getOVSPortExternalID(antreaPodName string, portName string, key string) (string, error) {
+	cmd := []string{"ovs-vsctl", "get", "Port", portName, fmt.Sprintf("external_ids:%s", key)}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when getting external ID '%s' of port '%s' on Pod '%s': %v (%s)", key, portName, antreaPodName, err, stderr)
+	}
+	// String values are quoted by ovs-vsctl when they include special characters.
+	value := strings.TrimSpace(stdout)
+	if strings.HasPrefix(value, `"`) {
+		return strconv.Unquote(value)
+	}
+	return value, nil
+}
+
+const (
+	// cniBinDir is the directory of the CNI plugin binaries on the Nodes.
+	cniBinDir     = "/opt/cni/bin"
+	antreaCNIPath = cniBinDir + "/antrea"
+)
+
+// runCNICheckForPod sends a CNI CHECK request for the specified test Pod, running on Node
+// nodeName, by invoking the Antrea CNI plugin over SSH, the same way the container runtime does.
+// The parameters of the request (container ID, network namespace, interface name and network
+// configuration) are retrieved from the external IDs of the OVS port of the Pod, and the saved CNI
+// result is provided as prevResult. checkErr is the error reported by the CNI plugin if the CHECK
+// failed, while err is returned if the request could not be sent.
+func (data *TestData) runCNICheckForPod(podName string, nodeName string) (checkErr error, err error) {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	portName, err := data.getOVSPortNameForPod(antreaPodName, podName)
+	if err != nil {
+		return nil, err
+	}
+	if portName == "" {
+		return nil, fmt.Errorf("no OVS port found for Pod '%s'", podName)
+	}
+	containerID, err := data.getOVSPortExternalID(antreaPodName, portName, "container-id")
+	if err != nil {
+		return nil, err
+	}
+	ipamArgsStr, err := data.getOVSPortExternalID(antreaPodName, portName, "ipam-args")
+	if err != nil {
+		return nil, err
+	}
+	cniResultStr, err := data.getOVSPortExternalID(antreaPodName, portName, "cni-result")
+	if err != nil {
+		return nil, err
+	}
+
+	var ipamArgs struct {
+		IfName        string          `json:"ifName"`
+		NetworkConfig json.RawMessage `json:"networkConfig"`
+	}
+	if err := json.Unmarshal([]byte(ipamArgsStr), &ipamArgs); err != nil {
+		return nil, fmt.Errorf("error when parsing IPAM arguments of port '%s': %v", portName, err)
+	}
+	var cniResult struct {
+		Interfaces []struct {
+			Name    string `json:"name"`
+			Sandbox string `json:"sandbox"`
+		} `json:"interfaces"`
+	}
+	if err := json.Unmarshal([]byte(cniResultStr), &cniResult); err != nil {
+		return nil, fmt.Errorf("error when parsing CNI result of port '%s': %v", portName, err)
+	}
+	netNS := ""
+	for _, iface := range cniResult.Interfaces {
+		if iface.Name == ipamArgs.IfName {
+			netNS = iface.Sandbox
+		}
+	}
+	if netNS == "" {
+		return nil, fmt.Errorf("no network namespace found in CNI result of port '%s'", portName)
+	}
+	var networkConfig map[string]interface{}
+	if err := json.Unmarshal(ipamArgs.NetworkConfig, &networkConfig); err != nil {
+		return nil, fmt.Errorf("error when parsing network configuration of port '%s': %v", portName, err)
+	}
+	networkConfig["prevResult"] = json.RawMessage(cniResultStr)
+	stdin, err := json.Marshal(networkConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := fmt.Sprintf("sudo CNI_COMMAND=CHECK CNI_CONTAINERID=%s CNI_NETNS=%s CNI_IFNAME=%s CNI_PATH=%s "+
+		"CNI_ARGS='IgnoreUnknown=1;K8S_POD_NAMESPACE=%s;K8S_POD_NAME=%s;K8S_POD_INFRA_CONTAINER_ID=%s' %s",
+		containerID, netNS, ipamArgs.IfName, cniBinDir, data.testNamespace, podName, containerID, antreaCNIPath)
+	rc, stdout, stderr, err := RunSSHCommandOnNodeWithStdin(nodeName, cmd, string(stdin))
+	if err != nil {
+		return nil, fmt.Errorf("error when running CNI plugin on Node '%s': %v", nodeName, err)
+	}
+	if rc != 0 {
+		// The CNI plugin writes the error to stdout, as a JSON object.
+		return fmt.Errorf("CNI CHECK exited with code %d: %s%s", rc, stdout, stderr), nil
+	}
+	return nil, nil
+}
+
+// checkCNICheckAfterHostVethDeletion validates that a CNI CHECK request fails when the networking
+// of a Pod is broken. It first checks that a CHECK request succeeds for the specified test Pod,
+// running on Node nodeName, then deletes the host interface of the Pod over SSH (which also deletes
+// the container interface), and sends another CHECK request. The error reported for the second
+// request is returned, and is nil if the CHECK silently passed. The test Pod should be deleted
+// afterwards, as its networking cannot be repaired.
+func (data *TestData) checkCNICheckAfterHostVethDeletion(podName string, nodeName string) (checkErr error, err error) {
+	if checkErr, err := data.runCNICheckForPod(podName, nodeName); err != nil {
+		return nil, err
+	} else if checkErr != nil {
+		return nil, fmt.Errorf("CNI CHECK failed for Pod '%s' before deleting its interface: %v", podName, checkErr)
+	}
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	portName, err := data.getOVSPortNameForPod(antreaPodName, podName)
+	if err != nil {
+		return nil, err
+	}
+	// The OVS port and the host interface have the same name.
+	rc, _, stderr, err := RunSSHCommandOnNode(nodeName, fmt.Sprintf("sudo ip link delete %s", portName))
+	if err != nil || rc != 0 {
+		return nil, fmt.Errorf("error when deleting interface '%s' on Node '%s': %v (%s)", portName, nodeName, err, stderr)
+	}
+	return data.runCNICheckForPod(podName, nodeName)
+}
+
+// checkOVSPortRemovedAfterPodDeletion creates a Pod on the specified Node, records the name of its
+// OVS port, then deletes the Pod and polls the OVS ports of the Node until the port is removed. An
+// error is returned if the port is still present after timeout, which indicates that the CNI DEL
+// request did not clean up the Pod interface.
+func (data *TestData) checkOVSPortRemovedAfterPodDeletion(nodeName string, timeout time.Duration) error {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return err
+	}
+	podName := randPodName("test-pod-del-")
+	if err := data.createBusyboxPodOnNode(podName, nodeName); err != nil {
+		return fmt.Errorf("error when creating busybox test Pod '%s': %v", podName, err)
+	}
+	deletePod := func() error {
+		return data.deletePodAndWait(defaultTimeout, podName)
+	}
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		deletePod()
+		return fmt.Errorf("error when waiting for Pod '%s' to be in the Running state: %v", podName, err)
+	}
+	portName, err := data.getOVSPortNameForPod(antreaPodName, podName)
+	if err != nil {
+		deletePod()
+		return err
+	}
+	if portName == "" {
+		deletePod()
+		return fmt.Errorf("no OVS port found for Pod '%s' on Node '%s'", podName, nodeName)
+	}
+
+	if err := deletePod(); err != nil {
+		return fmt.Errorf("error when deleting Pod '%s': %v", podName, err)
+	}
+	err = wait.PollImmediate(1*time.Second, timeout, func() (bool, error) {
+		portNames, err := data.getOVSPortNames(antreaPodName)
+		if err != nil {
+			return false, err
+		}
+		for _, name := range portNames {
+			if name == portName {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("OVS port '%s' of deleted Pod '%s' still present on Node '%s' after %v", portName, podName, nodeName, timeout)
+	}
+	return err
+}
+
+var (
+	portPodNameRe      = regexp.MustCompile(`\bpod-name="?([^",}\s]+)`)
+	portPodNamespaceRe = regexp.MustCompile(`\bpod-namespace="?([^",}\s]+)`)
+)
+
+// getPodsWithOVSPort returns the Pods, in the form "<namespace>/<name>", for which an OVS port
+// exists on the bridge, by listing the external IDs of the OVS ports in the OVS container of the
+// specified Antrea Pod. antrea-agent persists the interface store in these external IDs, and
+// restores it from them after a restart.
+func (data *TestData) getPodsWithOVSPort(antreaPodName string) ([]string, error) {
+	cmd := []string{"ovs-vsctl", "--no-headings", "--columns=external_ids", "list", "Port"}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error when listing OVS ports on Pod '%s': %v (%s)", antreaPodName, err, stderr)
+	}
+	var pods []string
+	for _, line := range strings.Split(stdout, "\n") {
+		nameMatches := portPodNameRe.FindStringSubmatch(line)
+		namespaceMatches := portPodNamespaceRe.FindStringSubmatch(line)
+		// The gateway and tunnel ports are not attached to a Pod.
+		if nameMatches == nil || namespaceMatches == nil {
+			continue
+		}
+		pods = append(pods, namespaceMatches[1]+"/"+nameMatches[1])
+	}
+	return pods, nil
+}
+
+// checkPodInterfaces compares the Pods running on the specified Node with the Pods for which
+// antrea-agent has created an OVS port. It returns the running Pods without an OVS port (missing),
+// as well as the OVS ports for Pods which no longer exist or have terminated (orphaned), in the form
+// "<namespace>/<name>". hostNetwork Pods and Pods being deleted are ignored.
+func (data *TestData) checkPodInterfaces(nodeName string) (missing []string, orphaned []string, err error) {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	podsWithPort, err := data.getPodsWithOVSPort(antreaPodName)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods, err := data.clientset.CoreV1().Pods("").List(metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error when listing Pods on Node '%s': %v", nodeName, err)
+	}
+
+	// A Pod which is still Pending may already have an OVS port, so it is not reported as
+	// orphaned, but it is not expected to have one yet.
+	activePods := make(map[string]bool)
+	var runningPods []string
+	for _, pod := range pods.Items {
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		if pod.DeletionTimestamp != nil {
+			// The OVS port may or may not have been deleted yet.
+			activePods[key] = true
+			continue
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			runningPods = append(runningPods, key)
+			activePods[key] = true
+		case v1.PodPending:
+			activePods[key] = true
+		}
+	}
+
+	hasPort := make(map[string]bool)
+	for _, key := range podsWithPort {
+		hasPort[key] = true
+		if !activePods[key] {
+			orphaned = append(orphaned, key)
+		}
+	}
+	for _, key := range runningPods {
+		if !hasPort[key] {
+			missing = append(missing, key)
+		}
+	}
+	return missing, orphaned, nil
+}
+
+// getDatapathFlows returns the datapath flows of the OVS bridge, by running "ovs-appctl
+// dpif/dump-flows" in the OVS container of the specified Antrea Pod. Unlike OpenFlow flows, the
+// datapath flows show how the recent traffic was actually forwarded.
+func (data *TestData) getDatapathFlows(antreaPodName string) ([]string, error) {
+	cmd := []string{"ovs-appctl", "dpif/dump-flows", defaultBridgeName}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error when dumping datapath flows on Pod '%s': %v (%s)", antreaPodName, err, stderr)
+	}
+	return openflow.ParseDatapathFlows(stdout), nil
+}
+
+// tracePacket traces a packet matching flowSpec through the flow tables of the OVS bridge, by
+// running "ovs-appctl ofproto/trace" in the OVS container of the specified Antrea Pod, and returns
+// the trace output.
+func (data *TestData) tracePacket(antreaPodName string, flowSpec string) (string, error) {
+	cmd := []string{"ovs-appctl", "ofproto/trace", defaultBridgeName, flowSpec}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when tracing packet '%s' on Pod '%s': %v (%s)", flowSpec, antreaPodName, err, stderr)
+	}
+	return stdout, nil
+}
+
+// addPacketTrace registers a flow (in the format accepted by "ovs-appctl ofproto/trace", e.g.
+// "ip,nw_dst=10.10.1.2") to trace on each Node when exporting the logs of the test, which helps
+// diagnose why a packet was not forwarded as expected.
+func (data *TestData) addPacketTrace(flowSpec string) {
+	data.packetTraceFlows = append(data.packetTraceFlows, flowSpec)
+}
+
+// tunnelUDPPorts are the default UDP destination ports of the supported tunnel types.
+var tunnelUDPPorts = map[string]int{
+	"vxlan":  4789,
+	"geneve": 6081,
+}
+
+// getTunnelType returns the type of the tunnel port of the OVS bridge, by running "ovs-vsctl" in
+// the OVS container of the specified Antrea Pod.
+func (data *TestData) getTunnelType(antreaPodName string) (string, error) {
+	cmd := []string{"ovs-vsctl", "get", "Interface", tunnelPortName, "type"}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return "", fmt.Errorf("error when getting type of port '%s' on Pod '%s': %v (%s)", tunnelPortName, antreaPodName, err, stderr)
+	}
+	return strings.Trim(strings.TrimSpace(stdout), `"`), nil
+}
+
+// getNodeInternalIP returns the InternalIP address of the specified Node.
+func (data *TestData) getNodeInternalIP(nodeName string) (string, error) {
+	node, err := data.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error when retrieving Node '%s': %v", nodeName, err)
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP {
+			return address.Address, nil
+		}
+	}
+	return "", fmt.Errorf("Node '%s' has no InternalIP address", nodeName)
+}
+
+// setNodeInternalIP replaces the InternalIP address in the status of the specified Node with ip.
+func (data *TestData) setNodeInternalIP(nodeName string, ip string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := data.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		found := false
+		for i := range node.Status.Addresses {
+			if node.Status.Addresses[i].Type == v1.NodeInternalIP {
+				node.Status.Addresses[i].Address = ip
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Node '%s' has no InternalIP address", nodeName)
+		}
+		_, err = data.clientset.CoreV1().Nodes().UpdateStatus(node)
+		return err
+	})
+}
+
+var tunnelDstRe = regexp.MustCompile(`set_field:([0-9a-fA-F.:]+)->tun_dst`)
+
+// getTunnelPeerIPs returns the tunnel destination addresses set by the OpenFlow flows of the OVS
+// bridge, by running "ovs-ofctl dump-flows" in the OVS container of the specified Antrea Pod.
+func (data *TestData) getTunnelPeerIPs(antreaPodName string) (map[string]bool, error) {
+	cmd := []string{"ovs-ofctl", "dump-flows", defaultBridgeName}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, OVSContainerName, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error when dumping flows on Pod '%s': %v (%s)", antreaPodName, err, stderr)
+	}
+	peerIPs := make(map[string]bool)
+	for _, matches := range tunnelDstRe.FindAllStringSubmatch(stdout, -1) {
+		peerIPs[matches[1]] = true
+	}
+	return peerIPs, nil
+}
+
+// getNodeIPPrefix returns the name of the interface with address ip on the specified Node, as well
+// as the prefix length of that address.
+func getNodeIPPrefix(nodeName string, ip string) (iface string, prefixLen string, err error) {
+	rc, stdout, stderr, err := RunSSHCommandOnNode(nodeName, "ip -o addr show")
+	if err != nil || rc != 0 {
+		return "", "", fmt.Errorf("error when listing addresses on Node '%s': %v (%s)", nodeName, err, stderr)
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		// Each line looks like "2: eth0    inet 192.168.10.10/24 brd ...".
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		addr := strings.SplitN(fields[3], "/", 2)
+		if len(addr) == 2 && addr[0] == ip {
+			return fields[1], addr[1], nil
+		}
+	}
+	return "", "", fmt.Errorf("no interface with address '%s' on Node '%s'", ip, nodeName)
+}
+
+// checkConnectivityAfterNodeIPChange simulates a change of the IP address of Node nodeName: newIP
+// is added to the interface of the Node which has the current InternalIP address (newIP must
+// therefore be an unused address in the same subnet), and the InternalIP address in the Node status
+// is replaced with newIP. It then waits for the Antrea Pod running on Node peerNodeName to update
+// its tunnel flows with the new remote IP, and checks that test Pod podName, which runs on
+// peerNodeName, can reach targetIP on nodeName again. It returns whether both happened within
+// timeout. Since kubelet resets the addresses in the Node status periodically, the update is applied
+// again while waiting. The original IP configuration is restored before returning.
+func (data *TestData) checkConnectivityAfterNodeIPChange(podName, targetIP, peerNodeName, nodeName, newIP string, timeout time.Duration) (recovered bool, err error) {
+	oldIP, err := data.getNodeInternalIP(nodeName)
+	if err != nil {
+		return false, err
+	}
+	iface, prefixLen, err := getNodeIPPrefix(nodeName, oldIP)
+	if err != nil {
+		return false, err
+	}
+	peerAntreaPodName, err := data.getAntreaPodOnNode(peerNodeName)
+	if err != nil {
+		return false, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", peerNodeName, err)
+	}
+
+	addrCmd := fmt.Sprintf("sudo ip addr %%s %s/%s dev %s", newIP, prefixLen, iface)
+	rc, _, stderr, err := RunSSHCommandOnNode(nodeName, fmt.Sprintf(addrCmd, "add"))
+	if err != nil || rc != 0 {
+		return false, fmt.Errorf("error when adding address '%s' on Node '%s': %v (%s)", newIP, nodeName, err, stderr)
+	}
+	// The original configuration is restored even if the test failed, and the function waits for
+	// the tunnel flows to use oldIP again, so that subsequent tests are not affected.
+	restore := func() error {
+		if err := data.setNodeInternalIP(nodeName, oldIP); err != nil {
+			return fmt.Errorf("error when restoring InternalIP address of Node '%s': %v", nodeName, err)
+		}
+		if rc, _, stderr, err := RunSSHCommandOnNode(nodeName, fmt.Sprintf(addrCmd, "del")); err != nil || rc != 0 {
+			return fmt.Errorf("error when deleting address '%s' on Node '%s': %v (%s)", newIP, nodeName, err, stderr)
+		}
+		if err := wait.Poll(time.Second, timeout, func() (bool, error) {
+			peerIPs, err := data.getTunnelPeerIPs(peerAntreaPodName)
+			if err != nil {
+				return false, err
+			}
+			return peerIPs[oldIP] && !peerIPs[newIP], nil
+		}); err != nil {
+			return fmt.Errorf("error when waiting for tunnel flows to Node '%s' to be restored: %v", nodeName, err)
+		}
+		return nil
+	}
+	defer func() {
+		if restoreErr := restore(); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}()
+
+	startTime := time.Now()
+	err = wait.Poll(time.Second, timeout, func() (bool, error) {
+		currentIP, err := data.getNodeInternalIP(nodeName)
+		if err != nil {
+			return false, err
+		}
+		if currentIP != newIP {
+			if err := data.setNodeInternalIP(nodeName, newIP); err != nil {
+				return false, fmt.Errorf("error when updating InternalIP address of Node '%s': %v", nodeName, err)
+			}
+		}
+		peerIPs, err := data.getTunnelPeerIPs(peerAntreaPodName)
+		if err != nil {
+			return false, err
+		}
+		return peerIPs[newIP] && !peerIPs[oldIP], nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// Pinging may fail transiently while the flows are being replaced.
+	if err := data.waitForPodConnectivity(podName, targetIP, true, timeout-time.Since(startTime)); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+var (
+	routeDeviceRe     = regexp.MustCompile(`\bdev\s+(\S+)`)
+	packetsCapturedRe = regexp.MustCompile(`(\d+) packets? captured`)
+)
+
+// captureEncapsulatedPackets checks that the traffic sent from a test Pod running on Node srcNodeName
+// to a test Pod running on Node dstNodeName is encapsulated, as configured. It starts tcpdump (over
+// SSH) on the underlay interface of the source Node, filtering for packets sent to the destination
+// Node on the UDP port of the configured tunnel type, sends echo requests from srcPodName to
+// dstPodIP and returns the number of packets captured. An error is returned if no encapsulated
+// packet was captured.
+func (data *TestData) captureEncapsulatedPackets(srcPodName, srcNodeName, dstPodIP, dstNodeName string, count int) (int, error) {
+	antreaPodName, err := data.getAntreaPodOnNode(srcNodeName)
+	if err != nil {
+		return 0, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", srcNodeName, err)
+	}
+	tunnelType, err := data.getTunnelType(antreaPodName)
+	if err != nil {
+		return 0, err
+	}
+	tunnelPort, ok := tunnelUDPPorts[tunnelType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tunnel type '%s'", tunnelType)
+	}
+	dstNodeIP, err := data.getNodeInternalIP(dstNodeName)
+	if err != nil {
+		return 0, err
+	}
+	// The underlay interface is the one used to reach the destination Node.
+	rc, stdout, stderr, err := RunSSHCommandOnNode(srcNodeName, fmt.Sprintf("ip -o route get %s", dstNodeIP))
+	if err != nil || rc != 0 {
+		return 0, fmt.Errorf("error when getting route to '%s' on Node '%s': %v (%s)", dstNodeIP, srcNodeName, err, stderr)
+	}
+	matches := routeDeviceRe.FindStringSubmatch(stdout)
+	if matches == nil {
+		return 0, fmt.Errorf("no device in route to '%s' on Node '%s': %s", dstNodeIP, srcNodeName, stdout)
+	}
+	underlayIface := matches[1]
+
+	// tcpdump exits after capturing the expected number of packets, or when the timeout expires,
+	// and reports the number of packets captured in both cases.
+	captureCmd := fmt.Sprintf("sudo timeout %d tcpdump -i %s -nn -c %d udp and dst port %d and dst host %s 2>&1",
+		int(defaultTimeout.Seconds()), underlayIface, count, tunnelPort, dstNodeIP)
+	type captureResult struct {
+		output string
+		err    error
+	}
+	resultCh := make(chan captureResult, 1)
+	go func() {
+		rc, stdout, _, err := RunSSHCommandOnNode(srcNodeName, captureCmd)
+		// timeout exits with code 124 when the command times out.
+		if err == nil && rc != 0 && rc != 124 {
+			err = fmt.Errorf("tcpdump exited with code %d: %s", rc, stdout)
+		}
+		resultCh <- captureResult{stdout, err}
+	}()
+	// Give tcpdump some time to start listening before generating traffic.
+	time.Sleep(2 * time.Second)
+	if err := data.runPingCommandFromTestPod(srcPodName, dstPodIP, count); err != nil {
+		return 0, fmt.Errorf("error when pinging '%s' from Pod '%s': %v", dstPodIP, srcPodName, err)
+	}
+
+	result := <-resultCh
+	if result.err != nil {
+		return 0, fmt.Errorf("error when capturing packets on Node '%s': %v", srcNodeName, result.err)
+	}
+	matches = packetsCapturedRe.FindStringSubmatch(result.output)
+	if matches == nil {
+		return 0, fmt.Errorf("cannot find number of packets captured in tcpdump output: %s", result.output)
+	}
+	numPackets, _ := strconv.Atoi(matches[1])
+	if numPackets == 0 {
+		return 0, fmt.Errorf("no %s packet captured on interface '%s' of Node '%s'", tunnelType, underlayIface, srcNodeName)
+	}
+	return numPackets, nil
+}
+
+// errConntrackNotAvailable is returned by getConntrackEntries when the conntrack entries cannot be
+// listed on the Node, because neither the conntrack tool nor /proc/net/nf_conntrack is available.
+// Tests should be skipped in this case.
+var errConntrackNotAvailable = fmt.Errorf("conntrack entries cannot be listed")
+
+// conntrackNotAvailableMsg is written to stderr by the shell command used to list conntrack entries
+// when no listing method is available.
+const conntrackNotAvailableMsg = "conntrack not available"
+
+// getConntrackEntries returns the conntrack entries of the Node with name nodeName which match the
+// provided filter, by running "conntrack -L" (or reading /proc/net/nf_conntrack when the conntrack
+// tool is not installed) in the agent container of the Antrea Pod for that Node. The agent container
+// runs in the host network namespace, so it has access to the Node's conntrack table. filter is a
+// space-separated list of fragments of the connection tuple (e.g. "dst=10.96.0.10 dport=53"), and
+// an entry matches if it includes all of them.
+func (data *TestData) getConntrackEntries(nodeName string, filter string) ([]string, error) {
+	antreaPodName, err := data.getAntreaPodOnNode(nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("error when retrieving the name of the Antrea Pod running on Node '%s': %v", nodeName, err)
+	}
+	script := fmt.Sprintf(`if command -v conntrack >/dev/null 2>&1; then conntrack -L; `+
+		`elif [ -r /proc/net/nf_conntrack ]; then cat /proc/net/nf_conntrack; `+
+		`else echo "%s" >&2; exit 1; fi`, conntrackNotAvailableMsg)
+	cmd := []string{"sh", "-c", script}
+	stdout, stderr, err := data.runCommandFromPod(AntreaNamespace, antreaPodName, agentContainerName, cmd)
+	if err != nil {
+		if strings.Contains(stderr, conntrackNotAvailableMsg) {
+			return nil, errConntrackNotAvailable
+		}
+		return nil, fmt.Errorf("error when listing conntrack entries in Pod '%s': %v - stderr: %s", antreaPodName, err, stderr)
+	}
+	return filterConntrackEntries(stdout, filter), nil
+}
+
+// filterConntrackEntries returns the lines of output which include all the space-separated
+// fragments of filter.
+func filterConntrackEntries(output string, filter string) []string {
+	fragments := strings.Fields(filter)
+	var entries []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		matches := true
+		for _, fragment := range fragments {
+			if !strings.Contains(line, fragment) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			entries = append(entries, line)
+		}
+	}
+	return entries
+}
+
+// setNodeUnschedulable updates the Unschedulable field of the specified Node.
+func (data *TestData) setNodeUnschedulable(nodeName string, unschedulable bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := data.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		node.Spec.Unschedulable = unschedulable
+		_, err = data.clientset.CoreV1().Nodes().Update(node)
+		return err
+	})
+}
+
+// cordonNode marks the specified Node as unschedulable, so that new Pods cannot be scheduled on it.
+func (data *TestData) cordonNode(nodeName string) error {
+	if err := data.setNodeUnschedulable(nodeName, true); err != nil {
+		return fmt.Errorf("error when cordoning Node '%s': %v", nodeName, err)
+	}
+	return nil
+}
+
+// uncordonNode marks the specified Node as schedulable again.
+func (data *TestData) uncordonNode(nodeName string) error {
+	if err := data.setNodeUnschedulable(nodeName, false); err != nil {
+		return fmt.Errorf("error when uncordoning Node '%s': %v", nodeName, err)
+	}
+	return nil
+}
+
+// drainTestPodsFromNode evicts all the Pods in the test namespace which are running on the
+// specified Node, then waits up to timeout for them to be deleted. Only the test namespace is
+// drained: the Antrea Pods in particular keep running on the Node, so that the removal of the
+// OVS ports and flows for the evicted Pods can be checked. The Node should be cordoned first if the
+// evicted Pods are managed by a controller, otherwise they may be re-scheduled on the same Node.
+// Note that Pods created with createBusyboxPodOnNode for the master Node tolerate its NoSchedule
+// taint but not the taint added when cordoning a Node, so they cannot be re-scheduled on a
+// cordoned master either.
+func (data *TestData) drainTestPodsFromNode(nodeName string, timeout time.Duration) error {
+	listOptions := metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+	}
+	pods, err := data.clientset.CoreV1().Pods(data.testNamespace).List(listOptions)
+	if err != nil {
+		return fmt.Errorf("error when listing test Pods on Node '%s': %v", nodeName, err)
+	}
+	for _, pod := range pods.Items {
+		eviction := &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		}
+		if err := data.clientset.CoreV1().Pods(data.testNamespace).Evict(eviction); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error when evicting Pod '%s': %v", pod.Name, err)
+		}
+	}
+	err = wait.Poll(1*time.Second, timeout, func() (bool, error) {
+		pods, err := data.clientset.CoreV1().Pods(data.testNamespace).List(listOptions)
+		if err != nil {
+			return false, fmt.Errorf("error when listing test Pods on Node '%s': %v", nodeName, err)
+		}
+		return len(pods.Items) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("test Pods still running on Node '%s' after %v", nodeName, timeout)
+	}
+	return err
+}
+
+// hostLocalIPAMDataDir is the directory in which the host-local IPAM plugin, which Antrea uses to
+// allocate Pod IP addresses, records the addresses allocated on a Node, with one file per address.
+const hostLocalIPAMDataDir string = "/var/lib/cni/networks/antrea"
+
+// getAllocatedPodIPs returns the Pod IP addresses currently allocated by the IPAM plugin on the
+// specified Node, by listing hostLocalIPAMDataDir through an SSH session. The other files in the
+// directory (e.g. the last reserved address for each range) are ignored.
+func (data *TestData) getAllocatedPodIPs(nodeName string) (map[string]bool, error) {
+	rc, stdout, stderr, err := RunSSHCommandOnNode(nodeName, fmt.Sprintf("sudo ls -1 %s", hostLocalIPAMDataDir))
+	if err != nil || rc != 0 {
+		return nil, fmt.Errorf("error when listing allocated IP addresses on Node '%s': %v (%s)", nodeName, err, stderr)
+	}
+	allocatedIPs := make(map[string]bool)
+	for _, name := range strings.Fields(stdout) {
+		if net.ParseIP(name) != nil {
+			allocatedIPs[name] = true
+		}
+	}
+	return allocatedIPs, nil
+}
+
+// runPodChurn creates numPods busybox Pods on the specified Node, waits for all of them to be
+// assigned an IP address, then deletes them, and repeats this numRounds times. It checks that each
+// IP address belongs to the Pod CIDR of the Node and that no address is assigned to 2 Pods of the
+// same round. The distinct IP addresses assigned during the churn are returned, along with the
+// number of rounds in which each of them was assigned.
+func (data *TestData) runPodChurn(nodeName string, numPods int, numRounds int) (map[string]int, error) {
+	seenIPs := make(map[string]int)
+	for round := 0; round < numRounds; round++ {
+		podNames := make([]string, 0, numPods)
+		deletePods := func() error {
+			for _, podName := range podNames {
+				if err := data.deletePodAndWait(defaultTimeout, podName); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		roundIPs := make(map[string]string)
+		for idx := 0; idx < numPods; idx++ {
+			podName := randPodName(fmt.Sprintf("test-churn-%d-%d-", round, idx))
+			if err := data.createBusyboxPodOnNode(podName, nodeName); err != nil {
+				deletePods()
+				return nil, fmt.Errorf("error when creating busybox test Pod '%s': %v", podName, err)
+			}
+			podNames = append(podNames, podName)
+		}
+		for _, podName := range podNames {
+			podIP, err := data.podWaitForIP(defaultTimeout, podName)
+			if err != nil {
+				deletePods()
+				return nil, fmt.Errorf("error when waiting for IP address of Pod '%s' in round %d: %v", podName, round, err)
+			}
+			if isValid, err := data.validatePodIPForNode(nodeName, podIP); err != nil || !isValid {
+				deletePods()
+				return nil, fmt.Errorf("IP address '%s' of Pod '%s' is not in the Pod CIDR of Node '%s' (%v)", podIP, podName, nodeName, err)
+			}
+			if otherPodName, found := roundIPs[podIP]; found {
+				deletePods()
+				return nil, fmt.Errorf("IP address '%s' assigned to both Pod '%s' and Pod '%s'", podIP, otherPodName, podName)
+			}
+			roundIPs[podIP] = podName
+			seenIPs[podIP]++
+		}
+		if err := deletePods(); err != nil {
+			return nil, fmt.Errorf("error when deleting test Pods in round %d: %v", round, err)
+		}
+	}
+	return seenIPs, nil
+}
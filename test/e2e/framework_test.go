@@ -0,0 +1,62 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestPodWaitForIPDelayed checks that podWaitForIP keeps polling when a Pod is observed in the
+// "running" state before its IP address is populated. It only uses a fake clientset.
+func TestPodWaitForIPDelayed(t *testing.T) {
+	const namespace = "antrea-test"
+	const podIP = "10.10.1.2"
+	runningPod := func(name string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Status:     v1.PodStatus{Phase: v1.PodRunning},
+		}
+	}
+	pod := runningPod("test-pod")
+	podNoIP := runningPod("test-pod-no-ip")
+	data := &TestData{clientset: fake.NewSimpleClientset(pod, podNoIP), testNamespace: namespace}
+
+	go func() {
+		time.Sleep(2 * time.Second)
+		pod := pod.DeepCopy()
+		pod.Status.PodIP = podIP
+		if _, err := data.clientset.CoreV1().Pods(namespace).UpdateStatus(pod); err != nil {
+			t.Errorf("Error when updating Pod status: %v", err)
+		}
+	}()
+
+	ip, err := data.podWaitForIP(10*time.Second, pod.Name)
+	if err != nil {
+		t.Fatalf("Error when waiting for Pod IP: %v", err)
+	}
+	if ip != podIP {
+		t.Errorf("Expected Pod IP %s, got %s", podIP, ip)
+	}
+
+	// The timeout still applies if the IP address is never populated.
+	if _, err := data.podWaitForIP(3*time.Second, podNoIP.Name); err == nil {
+		t.Errorf("Expected error when waiting for the IP of a Pod which has none")
+	}
+}
@@ -62,6 +62,10 @@ func testMain(m *testing.M) int {
 	flag.StringVar(&testOptions.providerConfigPath, "provider-cfg-path", "", "Optional config file for provider")
 	flag.StringVar(&testOptions.logsExportDir, "logs-export-dir", "", "Export directory for test logs")
 	flag.BoolVar(&testOptions.logsExportOnSuccess, "logs-export-on-success", false, "Export logs even when a test is successful")
+	flag.StringVar(&testOptions.antreaImage, "antrea-image", "", "Antrea image to deploy instead of the one in antrea.yml")
+	flag.BoolVar(&testOptions.keepNamespaceOnFailure, "keep-namespace-on-failure", false, "Do not delete the test Namespace when a test fails, for debugging")
+	flag.BoolVar(&testOptions.randomNamespace, "random-namespace", false, "Use a Namespace with a random suffix for each test, to run test suites concurrently against the same cluster")
+	flag.StringVar(&testOptions.externalURL, "external-url", defaultExternalURL, "URL outside of the cluster used to check Pod egress connectivity, or empty to skip these checks (e.g. for air-gapped clusters)")
 	flag.Parse()
 
 	if err := initProvider(); err != nil {
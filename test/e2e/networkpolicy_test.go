@@ -0,0 +1,86 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"testing"
+)
+
+// TestNetworkPolicy checks that K8s NetworkPolicies are enforced by Antrea. It creates three test
+// Pods (a server and two clients) and verifies connectivity from the clients to the server after
+// creating an ingress-deny policy, a policy allowing ingress from a single client, and an
+// egress-deny policy for that client.
+func TestNetworkPolicy(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	serverName := randPodName("test-server-")
+	allowedClientName := randPodName("test-client-")
+	deniedClientName := randPodName("test-client-")
+	for _, podName := range []string{serverName, allowedClientName, deniedClientName} {
+		t.Logf("Creating busybox test Pod '%s'", podName)
+		if err := data.createBusyboxPod(podName); err != nil {
+			t.Fatalf("Error when creating busybox test Pod '%s': %v", podName, err)
+		}
+		defer deletePodWrapper(t, data, podName)
+	}
+	serverIP, err := data.podWaitForIP(defaultTimeout, serverName)
+	if err != nil {
+		t.Fatalf("Error when waiting for IP of Pod '%s': %v", serverName, err)
+	}
+	for _, podName := range []string{allowedClientName, deniedClientName} {
+		if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+			t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podName, err)
+		}
+		if err := data.waitForPodConnectivity(podName, serverIP, true, defaultTimeout); err != nil {
+			t.Fatalf("Error when checking connectivity before creating NetworkPolicies: %v", err)
+		}
+	}
+
+	t.Logf("Creating ingress-deny NetworkPolicy for Pod '%s'", serverName)
+	if _, err := data.createIngressDenyNetworkPolicy("test-ingress-deny", serverName); err != nil {
+		t.Fatalf("Error when creating NetworkPolicy: %v", err)
+	}
+	for _, podName := range []string{allowedClientName, deniedClientName} {
+		if err := data.waitForPodConnectivity(podName, serverIP, false, defaultTimeout); err != nil {
+			t.Errorf("Ingress-deny NetworkPolicy not enforced: %v", err)
+		}
+	}
+	if err := data.deleteNetworkPolicy("test-ingress-deny"); err != nil {
+		t.Fatalf("Error when deleting NetworkPolicy: %v", err)
+	}
+
+	t.Logf("Creating NetworkPolicy allowing ingress to Pod '%s' from Pod '%s'", serverName, allowedClientName)
+	if _, err := data.createIngressAllowNetworkPolicy("test-ingress-allow", serverName, allowedClientName); err != nil {
+		t.Fatalf("Error when creating NetworkPolicy: %v", err)
+	}
+	if err := data.waitForPodConnectivity(allowedClientName, serverIP, true, defaultTimeout); err != nil {
+		t.Errorf("Ingress-allow NetworkPolicy not enforced: %v", err)
+	}
+	if err := data.waitForPodConnectivity(deniedClientName, serverIP, false, defaultTimeout); err != nil {
+		t.Errorf("Ingress-allow NetworkPolicy not enforced: %v", err)
+	}
+
+	t.Logf("Creating egress-deny NetworkPolicy for Pod '%s'", allowedClientName)
+	if _, err := data.createEgressDenyNetworkPolicy("test-egress-deny", allowedClientName); err != nil {
+		t.Fatalf("Error when creating NetworkPolicy: %v", err)
+	}
+	if err := data.waitForPodConnectivity(allowedClientName, serverIP, false, defaultTimeout); err != nil {
+		t.Errorf("Egress-deny NetworkPolicy not enforced: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestClusterIPService checks that a ClusterIP Service backed by nginx Pods can be accessed from
+// a client Pod on every Node, through kube-proxy and the Antrea datapath.
+func TestClusterIPService(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	serviceName := "nginx"
+	servicePort := 8080
+	t.Logf("Creating nginx Deployment and ClusterIP Service")
+	service, err := data.createNginxDeploymentAndService(serviceName, 2, servicePort)
+	if err != nil {
+		t.Fatalf("Error when creating nginx Deployment and Service: %v", err)
+	}
+	defer func() {
+		if err := data.deleteDeploymentAndService(serviceName); err != nil {
+			t.Logf("Error when deleting nginx Deployment and Service: %v", err)
+		}
+	}()
+	serviceIP := service.Spec.ClusterIP
+
+	podNames, cleanupFn := createPodsOnDifferentNodes(t, data, clusterInfo.numNodes)
+	defer cleanupFn()
+	if err := data.podsWaitForRunning(defaultTimeout, podNames); err != nil {
+		t.Fatalf("Error when waiting for Pods to be running: %v", err)
+	}
+
+	for _, podName := range podNames {
+		response, err := data.curlServiceFromPod(podName, serviceIP, servicePort)
+		if err != nil {
+			t.Errorf("Pod '%s' -> Service '%s': ERROR (%v)", podName, serviceIP, err)
+			continue
+		}
+		if !strings.Contains(response, "Welcome to nginx") {
+			t.Errorf("Pod '%s' -> Service '%s': unexpected response: %s", podName, serviceIP, response)
+			continue
+		}
+		t.Logf("Pod '%s' -> Service '%s': OK", podName, serviceIP)
+	}
+
+	// The first client Pod runs on the first Node: the connection to the Service must have been
+	// tracked there, as kube-proxy DNATs it in the Node's network namespace.
+	filter := fmt.Sprintf("dst=%s dport=%d", serviceIP, servicePort)
+	entries, err := data.getConntrackEntries(nodeName(0), filter)
+	if err == errConntrackNotAvailable {
+		t.Logf("Skipping conntrack check: %v", err)
+	} else if err != nil {
+		t.Errorf("Error when retrieving conntrack entries on Node '%s': %v", nodeName(0), err)
+	} else if len(entries) == 0 {
+		t.Errorf("No conntrack entry matching '%s' on Node '%s'", filter, nodeName(0))
+	}
+}
+
+// TestClusterDNS checks that the cluster DNS can be used from a Pod to resolve the name of a Service,
+// which requires connectivity to the CoreDNS Pods through the Antrea datapath.
+func TestClusterDNS(t *testing.T) {
+	data, err := setupTest(t)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer teardownTest(t, data)
+
+	if err := data.checkCoreDNSPods(defaultTimeout); err != nil {
+		t.Fatalf("Error when checking CoreDNS Pods: %v", err)
+	}
+	service, err := data.clientset.CoreV1().Services("default").Get("kubernetes", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error when getting the kubernetes Service: %v", err)
+	}
+
+	podName := randPodName("test-pod-dns-")
+	if err := data.createBusyboxPod(podName); err != nil {
+		t.Fatalf("Error when creating busybox test Pod: %v", err)
+	}
+	defer deletePodWrapper(t, data, podName)
+	if err := data.podWaitForRunning(defaultTimeout, podName); err != nil {
+		t.Fatalf("Error when waiting for Pod '%s' to be running: %v", podName, err)
+	}
+
+	name := "kubernetes.default.svc.cluster.local"
+	ip, err := data.runDNSLookupFromPod(podName, name)
+	if err != nil {
+		t.Fatalf("Error when resolving '%s': %v", name, err)
+	}
+	if ip != service.Spec.ClusterIP {
+		t.Errorf("'%s' resolved to %s instead of %s", name, ip, service.Spec.ClusterIP)
+	}
+}
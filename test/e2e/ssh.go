@@ -17,6 +17,7 @@ package e2e
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -25,6 +26,12 @@ import (
 // with the contents of stdout and stderr as strings. Note that if the command returns a non-zero
 // error code, this function does not report it as an error.
 func RunSSHCommand(host string, config *ssh.ClientConfig, cmd string) (code int, stdout string, stderr string, err error) {
+	return RunSSHCommandWithStdin(host, config, cmd, "")
+}
+
+// RunSSHCommandWithStdin is like RunSSHCommand, but the provided string is written to the standard
+// input of the command.
+func RunSSHCommandWithStdin(host string, config *ssh.ClientConfig, cmd string, stdin string) (code int, stdout string, stderr string, err error) {
 	client, err := ssh.Dial("tcp", host, config)
 	if err != nil {
 		return 0, "", "", fmt.Errorf("cannot establish SSH connection to host: %v", err)
@@ -38,6 +45,9 @@ func RunSSHCommand(host string, config *ssh.ClientConfig, cmd string) (code int,
 	var stdoutB, stderrB bytes.Buffer
 	session.Stdout = &stdoutB
 	session.Stderr = &stderrB
+	if stdin != "" {
+		session.Stdin = strings.NewReader(stdin)
+	}
 	if err := session.Run(cmd); err != nil {
 		switch e := err.(type) {
 		case *ssh.ExitMissingError:
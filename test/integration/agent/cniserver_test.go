@@ -21,10 +21,14 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
@@ -33,6 +37,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vishvananda/netlink"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sFake "k8s.io/client-go/kubernetes/fake"
 
 	"github.com/vmware-tanzu/antrea/pkg/agent"
@@ -41,6 +47,7 @@ import (
 	ipamtest "github.com/vmware-tanzu/antrea/pkg/agent/cniserver/ipam/testing"
 	cniservertest "github.com/vmware-tanzu/antrea/pkg/agent/cniserver/testing"
 	openflowtest "github.com/vmware-tanzu/antrea/pkg/agent/openflow/testing"
+	agenttest "github.com/vmware-tanzu/antrea/pkg/agent/testing"
 	"github.com/vmware-tanzu/antrea/pkg/agent/util"
 	cnimsg "github.com/vmware-tanzu/antrea/pkg/apis/cni/v1beta1"
 	"github.com/vmware-tanzu/antrea/pkg/ovs/ovsconfig"
@@ -69,6 +76,12 @@ const (
 	netDefault = `,
 	"isDefaultGateway": true`
 
+	qdiscConfStr = `,
+	"qdisc": "%s"`
+
+	txQueueLenConfStr = `,
+	"txQueueLen": %d`
+
 	ipamStartStr = `,
     "ipam": {
         "type":    "mock"`
@@ -97,6 +110,16 @@ const (
 	rangesEndStr = `
         ]`
 
+	// Routes configuration
+	ipamRoutesStartStr = `,
+        "routes": [`
+	ipamRouteConfStr = `
+            {"dst": "%s"}`
+	ipamRouteGatewayConfStr = `
+            {"dst": "%s", "gw": "%s"}`
+	ipamRoutesEndStr = `
+        ]`
+
 	ipamEndStr = `
     }`
 )
@@ -134,11 +157,41 @@ type testCase struct {
 	addresses       []string
 	routes          []string
 	dns             []string
+	// podRoutes is the value of the PodRoutesAnnotationKey annotation of the test Pod, if not
+	// empty.
+	podRoutes string
+	// expExtraRoutes are the routes expected in the container in addition to the default route,
+	// in the form "<destination CIDR>,<gateway>".
+	expExtraRoutes []string
+	// reassignAddresses are the addresses returned by the IPAM driver when the IP address of the
+	// container is reassigned after CHECK, if not empty.
+	reassignAddresses []string
+	// qdisc is the queueing discipline requested in the network configuration, if not empty.
+	qdisc string
+	// txQueueLen is the transmit queue length requested in the network configuration, if not
+	// zero.
+	txQueueLen int
+	// ipamDelErr is the error returned by the IPAM driver when the IP address of the container
+	// is released, if not nil.
+	ipamDelErr error
+	// repairInterface indicates whether the container interface should be repaired in a new
+	// network namespace after CHECK.
+	repairInterface bool
+	// ipamRoutes are the routes included in the IPAM configuration, in the form
+	// "<destination CIDR>[,<gateway>]". Unlike routes, which are returned by the mock IPAM
+	// driver, they are only part of the network configuration.
+	ipamRoutes []string
 }
 
 func (tc testCase) netConfJSON(dataDir string) string {
 	conf := fmt.Sprintf(netConfStr, tc.cniVersion)
 	conf += netDefault
+	if tc.qdisc != "" {
+		conf += fmt.Sprintf(qdiscConfStr, tc.qdisc)
+	}
+	if tc.txQueueLen != 0 {
+		conf += fmt.Sprintf(txQueueLenConfStr, tc.txQueueLen)
+	}
 	if tc.subnet != "" || tc.ranges != nil {
 		conf += ipamStartStr
 		if dataDir != "" {
@@ -150,6 +203,9 @@ func (tc testCase) netConfJSON(dataDir string) string {
 		if tc.ranges != nil {
 			conf += tc.rangesConfig()
 		}
+		if tc.ipamRoutes != nil {
+			conf += tc.ipamRoutesConfig()
+		}
 		conf += ipamEndStr
 	}
 	return "{" + conf + "\n}"
@@ -178,6 +234,93 @@ func (tc testCase) rangesConfig() string {
 	return conf + rangesEndStr
 }
 
+func (tc testCase) ipamRoutesConfig() string {
+	conf := ipamRoutesStartStr
+	for i, route := range tc.ipamRoutes {
+		if i > 0 {
+			conf += ","
+		}
+		fields := strings.Split(route, ",")
+		if len(fields) > 1 {
+			conf += fmt.Sprintf(ipamRouteGatewayConfStr, fields[0], fields[1])
+		} else {
+			conf += fmt.Sprintf(ipamRouteConfStr, fields[0])
+		}
+	}
+	return conf + ipamRoutesEndStr
+}
+
+// rangesForSubnets returns one range, without an explicit gateway, for each of the provided
+// subnets. IPv4 and IPv6 subnets can be mixed to build a dual-stack configuration.
+func rangesForSubnets(subnets ...string) []rangeInfo {
+	ranges := make([]rangeInfo, 0, len(subnets))
+	for _, subnet := range subnets {
+		ranges = append(ranges, rangeInfo{subnet: subnet})
+	}
+	return ranges
+}
+
+// rangeGateway returns the gateway of the range: the explicit gateway if any, or the first address
+// of the subnet otherwise (like host-local IPAM), as well as the subnet.
+func rangeGateway(r rangeInfo) (net.IP, *net.IPNet) {
+	_, subnet, err := net.ParseCIDR(r.subnet)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid subnet %s in test range: %v", r.subnet, err))
+	}
+	if r.gateway != "" {
+		return net.ParseIP(r.gateway), subnet
+	}
+	return ip.NextIP(subnet.IP), subnet
+}
+
+// gatewayCIDRsForRanges returns the expected gateway addresses, in CIDR form, for the provided
+// ranges (see expGatewayCIDRs).
+func gatewayCIDRsForRanges(ranges []rangeInfo) []string {
+	cidrs := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		gw, subnet := rangeGateway(r)
+		cidrs = append(cidrs, (&net.IPNet{IP: gw, Mask: subnet.Mask}).String())
+	}
+	return cidrs
+}
+
+// addressesForRanges returns the address with the provided offset in the subnet of each range, in
+// the form expected for the addresses returned by the mock IPAM driver (see addresses).
+func addressesForRanges(ranges []rangeInfo, offset int) []string {
+	addresses := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		gw, subnet := rangeGateway(r)
+		addr := ip.NextIP(subnet.IP)
+		for i := 1; i < offset; i++ {
+			addr = ip.NextIP(addr)
+		}
+		addrNet := &net.IPNet{IP: addr, Mask: subnet.Mask}
+		addresses = append(addresses, fmt.Sprintf("%s,%s,%s", addrNet.String(), gw.String(), ipVersion(addr)))
+	}
+	return addresses
+}
+
+// defaultRoutesForRanges returns a default route through the gateway of the range for each IP
+// family of the provided ranges, in the form expected for routes.
+func defaultRoutesForRanges(ranges []rangeInfo) []string {
+	var routes []string
+	families := make(map[string]bool)
+	for _, r := range ranges {
+		gw, _ := rangeGateway(r)
+		family := ipVersion(gw)
+		if families[family] {
+			continue
+		}
+		families[family] = true
+		if family == "4" {
+			routes = append(routes, fmt.Sprintf("0.0.0.0/0,%s", gw.String()))
+		} else {
+			routes = append(routes, fmt.Sprintf("::/0,%s", gw.String()))
+		}
+	}
+	return routes
+}
+
 func (tc testCase) expectedCIDRs() ([]*net.IPNet, []*net.IPNet) {
 	var cidrsV4, cidrsV6 []*net.IPNet
 	appendSubnet := func(subnet string) {
@@ -322,6 +465,38 @@ func (tester *cmdAddDelTester) checkContainerNetworking(tc testCase) {
 		require.Nil(err)
 		require.NotNil(expectedRoute)
 	}
+	for _, extraRoute := range tc.expExtraRoutes {
+		fields := strings.Split(extraRoute, ",")
+		found := false
+		for _, route := range routes {
+			if route.Dst != nil && route.Dst.String() == fields[0] && route.Gw.Equal(net.ParseIP(fields[1])) {
+				found = true
+				break
+			}
+		}
+		assert.Truef(found, "Route %s not found in container", extraRoute)
+	}
+
+	if tc.qdisc != "" {
+		var qdiscs []netlink.Qdisc
+		err = tester.targetNS.Do(func(ns.NetNS) error {
+			qdiscs, err = netlink.QdiscList(link)
+			return err
+		})
+		require.Nil(err)
+		found := false
+		for _, qdisc := range qdiscs {
+			if qdisc.Attrs().Parent == netlink.HANDLE_ROOT && qdisc.Type() == tc.qdisc {
+				found = true
+				break
+			}
+		}
+		assert.Truef(found, "Root qdisc %s not found on container interface", tc.qdisc)
+	}
+
+	if tc.txQueueLen != 0 {
+		assert.Equal(tc.txQueueLen, link.Attrs().TxQLen, "Unexpected txqueuelen on container interface")
+	}
 }
 
 func (tester *cmdAddDelTester) cmdAddTest(tc testCase, dataDir string) (*current.Result, error) {
@@ -377,6 +552,208 @@ func (tester *cmdAddDelTester) cmdAddTest(tc testCase, dataDir string) (*current
 	return result, nil
 }
 
+// ovsExternalIDsMatcher is a gomock Matcher for the external IDs of the OVS port created for the
+// test container. It matches if the external IDs identify the container and its Pod, and include
+// the expected IP address and a valid MAC address. The last matched external IDs are recorded, so
+// that they can be checked against the CNI result once the ADD request completes.
+type ovsExternalIDsMatcher struct {
+	containerID  string
+	podName      string
+	podNamespace string
+	ip           net.IP
+	externalIDs  map[string]interface{}
+}
+
+func newOVSExternalIDsMatcher(ip net.IP) *ovsExternalIDsMatcher {
+	return &ovsExternalIDsMatcher{containerID: CONTAINERID, podName: testPod, podNamespace: testPodNamespace, ip: ip}
+}
+
+func (m *ovsExternalIDsMatcher) Matches(x interface{}) bool {
+	externalIDs, ok := x.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	expected := map[string]string{
+		agent.OVSExternalIDContainerID:  m.containerID,
+		agent.OVSExternalIDPodName:      m.podName,
+		agent.OVSExternalIDPodNamespace: m.podNamespace,
+		agent.OVSExternalIDIP:           m.ip.String(),
+	}
+	for key, value := range expected {
+		if externalIDs[key] != value {
+			return false
+		}
+	}
+	mac, ok := externalIDs[agent.OVSExternalIDMAC].(string)
+	if !ok {
+		return false
+	}
+	if _, err := net.ParseMAC(mac); err != nil {
+		return false
+	}
+	m.externalIDs = externalIDs
+	return true
+}
+
+func (m *ovsExternalIDsMatcher) String() string {
+	return fmt.Sprintf("external IDs for container %s of Pod %s/%s with IP %s", m.containerID, m.podNamespace, m.podName, m.ip)
+}
+
+// checkOVSPortExternalIDs checks that the external IDs of the OVS port created for the test
+// container are consistent with the CNI result of the ADD request, and include all the information
+// required to restore the container interface from OVSDB on reconciliation.
+func checkOVSPortExternalIDs(t *testing.T, externalIDs map[string]interface{}, result *current.Result) {
+	require.NotNil(t, externalIDs, "OVS port was not created with the expected external IDs")
+	assert.Equal(t, result.Interfaces[1].Mac, externalIDs[agent.OVSExternalIDMAC])
+	ipamArgs, ok := externalIDs[agent.OVSExternalIDIPAMArgs].(string)
+	if assert.True(t, ok, "IPAM arguments missing from external IDs") {
+		args := &agent.IPAMArgs{}
+		if assert.Nil(t, json.Unmarshal([]byte(ipamArgs), args)) {
+			assert.Equal(t, IFNAME, args.IfName)
+		}
+	}
+	assert.NotEmpty(t, externalIDs[agent.OVSExternalIDNetNS], "Network namespace missing from external IDs")
+	cniResult, ok := externalIDs[agent.OVSExternalIDCNIResult].(string)
+	if assert.True(t, ok, "CNI result missing from external IDs") {
+		storedResult := &current.Result{}
+		if assert.Nil(t, json.Unmarshal([]byte(cniResult), storedResult)) {
+			assert.Len(t, storedResult.IPs, len(result.IPs))
+			assert.Len(t, storedResult.Routes, len(result.Routes))
+			assert.Equal(t, result.DNS, storedResult.DNS)
+		}
+	}
+}
+
+// repairInterfaceTest simulates the re-creation of the network namespace of the container: the
+// container interface is repaired in a new network namespace, which replaces the target network
+// namespace of the tester. It checks that the container networking is configured in the new
+// network namespace, that the OVS port is replaced in a single transaction with the same ofport
+// request and that the Pod flows are reinstalled. The new network namespace is returned and must be closed by the caller.
+func (tester *cmdAddDelTester) repairInterfaceTest(tc testCase, ovsPortName string, ovsPortUUID string, ofPort int32) ns.NetNS {
+	require := require.New(tc.t)
+
+	newNS, err := testutils.NewNS()
+	require.Nil(err)
+
+	newPortUUID := uuid.New().String()
+	// The old port is replaced by the new one in a single transaction, after the new veth pair
+	// has been created.
+	replaceCall := ovsServiceMock.EXPECT().ReplacePort(ovsPortUUID, mock.Any()).DoAndReturn(func(oldPortUUID string, spec ovsconfig.PortSpec) (string, ovsconfig.Error) {
+		require.Equal(ovsPortName, spec.Name)
+		require.Equal(ofPort, spec.OFPortRequest)
+		require.Equal(testPod, spec.ExternalIDs[agent.OVSExternalIDPodName])
+		_, err := linkByName(tester.testNS, ovsPortName)
+		require.Nil(err, "The new host interface should be created before the OVS port is replaced")
+		return newPortUUID, nil
+	})
+	uninstallCall := ofServiceMock.EXPECT().UninstallPodFlows(ovsPortName, uint32(ofPort)).Return(nil).After(replaceCall)
+	ofServiceMock.EXPECT().InstallPodFlows(ovsPortName, mock.Any(), mock.Any(), mock.Any(), uint32(ofPort)).Return(nil).After(uninstallCall)
+	// The new port is deleted on DEL.
+	ovsServiceMock.EXPECT().DeletePort(newPortUUID).Return(nil)
+
+	err = tester.testNS.Do(func(ns.NetNS) error {
+		return tester.server.RepairPodInterface(CONTAINERID, newNS.Path())
+	})
+	require.Nil(err)
+
+	tester.targetNS = newNS
+	link, err := linkByName(tester.testNS, ovsPortName)
+	require.Nil(err)
+	require.IsType(&netlink.Veth{}, link)
+	tester.checkContainerNetworking(tc)
+	return newNS
+}
+
+// ipamContainerIDMatcher is a gomock Matcher for the CNI arguments passed to the IPAM driver. It
+// matches if the arguments are for the provided container ID.
+type ipamContainerIDMatcher string
+
+func (m ipamContainerIDMatcher) Matches(x interface{}) bool {
+	args, ok := x.(*invoke.Args)
+	return ok && args.ContainerID == string(m)
+}
+
+func (m ipamContainerIDMatcher) String() string {
+	return fmt.Sprintf("IPAM arguments for container ID %s", string(m))
+}
+
+// reassignIPTest reassigns the IP address of the container and checks that the new address is
+// configured in the container, and that the Pod flows are reinstalled for the new address. The new
+// address is allocated before the old one is released, and a failed reassignment must leave the
+// container with its current address and release the new one.
+func (tester *cmdAddDelTester) reassignIPTest(tc testCase, ovsPortName string, ofPort uint32) {
+	require := require.New(tc.t)
+	assert := assert.New(tc.t)
+
+	reassignedID := CONTAINERID + "-reassigned"
+	newResult := ipamtest.GenerateIPAMResult("0.4.0", tc.reassignAddresses, tc.routes, tc.dns)
+	newIP := newResult.IPs[0].Address.IP
+	checkAddr := func(expectedIP net.IP) {
+		link, err := linkByName(tester.targetNS, IFNAME)
+		require.Nil(err)
+		addrs, err := addrList(tester.targetNS, link, netlink.FAMILY_V4)
+		require.Nil(err)
+		require.Len(addrs, 1, "Unexpected IP addresses configured on the container interface")
+		assert.True(expectedIP.Equal(addrs[0].IP), "IP address %s configured instead of %s", addrs[0].IP, expectedIP)
+		routes, err := routeList(tester.targetNS, link)
+		require.Nil(err)
+		for _, cidr := range tc.expGatewayCIDRs {
+			expectedRoute, err := matchRoute(cidr, routes)
+			require.Nil(err)
+			assert.NotNil(expectedRoute, "Default route missing on the container interface")
+		}
+	}
+	reassign := func() (net.IP, error) {
+		var ip net.IP
+		err := tester.testNS.Do(func(ns.NetNS) error {
+			var err error
+			ip, err = tester.server.ReassignPodIP(tester.ctx, CONTAINERID)
+			return err
+		})
+		return ip, err
+	}
+	link, err := linkByName(tester.targetNS, IFNAME)
+	require.Nil(err)
+	addrs, err := addrList(tester.targetNS, link, netlink.FAMILY_V4)
+	require.Nil(err)
+	require.Len(addrs, 1)
+	oldIP := net.ParseIP(addrs[0].IP.String())
+
+	// The Pod flows cannot be installed for the new address: the old address, external IDs and
+	// flows are restored, and the new address is released.
+	addCall := ipamMock.EXPECT().Add(mock.Any(), ipamContainerIDMatcher(reassignedID), mock.Any()).Return(newResult, nil)
+	updateCall := ovsServiceMock.EXPECT().SetPortExternalIDs(ovsPortName, mock.Any()).Return(nil).After(addCall)
+	uninstallCall := ofServiceMock.EXPECT().UninstallPodFlows(ovsPortName, ofPort).Return(nil).After(updateCall)
+	installCall := ofServiceMock.EXPECT().InstallPodFlows(ovsPortName, newIP, mock.Any(), mock.Any(), ofPort).Return(fmt.Errorf("flow error")).After(uninstallCall)
+	restoreCall := ovsServiceMock.EXPECT().SetPortExternalIDs(ovsPortName, newOVSExternalIDsMatcher(oldIP)).Return(nil).After(installCall)
+	uninstallCall = ofServiceMock.EXPECT().UninstallPodFlows(ovsPortName, ofPort).Return(nil).After(restoreCall)
+	ofServiceMock.EXPECT().InstallPodFlows(ovsPortName, oldIP, mock.Any(), mock.Any(), ofPort).Return(nil).After(uninstallCall)
+	ipamMock.EXPECT().Del(mock.Any(), ipamContainerIDMatcher(reassignedID), mock.Any()).Return(nil).After(installCall)
+	_, err = reassign()
+	require.NotNil(err)
+	checkAddr(oldIP)
+
+	// The old address is only released once the container has been reconfigured.
+	addCall = ipamMock.EXPECT().Add(mock.Any(), ipamContainerIDMatcher(reassignedID), mock.Any()).Return(newResult, nil)
+	ovsServiceMock.EXPECT().SetPortExternalIDs(ovsPortName, newOVSExternalIDsMatcher(newIP)).DoAndReturn(func(name string, externalIDs map[string]interface{}) ovsconfig.Error {
+		args := &agent.IPAMArgs{}
+		require.Nil(json.Unmarshal([]byte(externalIDs[agent.OVSExternalIDIPAMArgs].(string)), args))
+		assert.Equal(reassignedID, args.ContainerID, "The container ID used to allocate the new address should be persisted")
+		return nil
+	}).After(addCall)
+	// The flows for the old IP address must be removed before the new ones are installed.
+	uninstallCall = ofServiceMock.EXPECT().UninstallPodFlows(ovsPortName, ofPort).Return(nil).After(addCall)
+	installCall = ofServiceMock.EXPECT().InstallPodFlows(ovsPortName, newIP, mock.Any(), mock.Any(), ofPort).Return(nil).After(uninstallCall)
+	ipamMock.EXPECT().Del(mock.Any(), ipamContainerIDMatcher(CONTAINERID), mock.Any()).Return(nil).After(installCall)
+	ip, err := reassign()
+	require.Nil(err)
+	assert.True(newIP.Equal(ip), "Unexpected IP address %s returned, expected %s", ip, newIP)
+	checkAddr(newIP)
+
+	// The new address is released on DEL, along with the original container ID.
+	ipamMock.EXPECT().Del(mock.Any(), ipamContainerIDMatcher(reassignedID), mock.Any()).Return(nil)
+}
+
 func buildOneConfig(name, cniVersion string, orig *Net, prevResult types.Result) (*Net, error) {
 	var err error
 
@@ -444,11 +821,20 @@ func (tester *cmdAddDelTester) cmdDelTest(tc testCase, dataDir string) {
 	tester.request = tc.createCmdArgs(tester.targetNS, dataDir)
 
 	// Execute cmdDEL on the plugin.
+	var response *cnimsg.CniCmdResponse
 	err = tester.testNS.Do(func(ns.NetNS) error {
-		_, err := tester.server.CmdDel(tester.ctx, tester.request)
+		response, err = tester.server.CmdDel(tester.ctx, tester.request)
 		return err
 	})
 	require.Nil(err)
+	if tc.ipamDelErr != nil {
+		// The IPAM error is reported, but only after the interfaces have been removed.
+		require.NotNil(response.Error)
+		require.Equal(cnimsg.ErrorCode_IPAM_FAILURE, response.Error.Code)
+		require.Equal(tc.ipamDelErr.Error(), response.Error.Message)
+	} else {
+		require.Nil(response.Error)
+	}
 
 	var link netlink.Link
 
@@ -463,22 +849,61 @@ func (tester *cmdAddDelTester) cmdDelTest(tc testCase, dataDir string) {
 	require.Nil(link)
 }
 
-func newTester() *cmdAddDelTester {
+func newTester(tc testCase) *cmdAddDelTester {
 	tester := &cmdAddDelTester{}
 	ifaceStore := agent.NewInterfaceStore()
-	tester.server = cniserver.New(testSock, "", 1450, testNodeConfig, ovsServiceMock, ofServiceMock, ifaceStore, k8sFake.NewSimpleClientset())
+	k8sClient := k8sFake.NewSimpleClientset()
+	var opts cniserver.Options
+	if tc.podRoutes != "" {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        testPod,
+			Namespace:   testPodNamespace,
+			Annotations: map[string]string{cniserver.PodRoutesAnnotationKey: tc.podRoutes},
+		}}
+		k8sClient = k8sFake.NewSimpleClientset(pod)
+		opts.EnablePodRoutesAnnotation = true
+	}
+	tester.server = cniserver.New(testSock, "", 1450, testNodeConfig, ovsServiceMock, ofServiceMock, ifaceStore, k8sClient, opts)
 	ctx, _ := context.WithCancel(context.Background())
 	tester.ctx = ctx
 	return tester
 }
 
+// isQdiscSupported checks whether the kernel supports the provided queueing discipline, by adding
+// it to a veth interface created in a temporary network namespace.
+func isQdiscSupported(qdisc string) (bool, error) {
+	netNS, err := testutils.NewNS()
+	if err != nil {
+		return false, err
+	}
+	defer netNS.Close()
+	var supported bool
+	err = netNS.Do(func(ns.NetNS) error {
+		veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "qdisc0"}, PeerName: "qdisc1"}
+		if err := netlink.LinkAdd(veth); err != nil {
+			return err
+		}
+		link, err := netlink.LinkByName(veth.Name)
+		if err != nil {
+			return err
+		}
+		attrs := netlink.QdiscAttrs{LinkIndex: link.Attrs().Index, Handle: netlink.MakeHandle(1, 0), Parent: netlink.HANDLE_ROOT}
+		// The qdisc is created without options, which may be rejected with EINVAL. The
+		// kernel returns ENOENT if the qdisc kind is unknown.
+		err = netlink.QdiscAdd(&netlink.GenericQdisc{QdiscAttrs: attrs, QdiscType: qdisc})
+		supported = err != syscall.ENOENT
+		return nil
+	})
+	return supported, err
+}
+
 func cmdAddDelCheckTest(testNS ns.NetNS, tc testCase, dataDir string) {
 	require := require.New(tc.t)
 
 	require.Equal("0.4.0", tc.cniVersion)
 
 	// Get a Add/Del tester based on test case version
-	tester := newTester()
+	tester := newTester(tc)
 
 	targetNS, err := testutils.NewNS()
 	require.Nil(err)
@@ -486,12 +911,14 @@ func cmdAddDelCheckTest(testNS ns.NetNS, tc testCase, dataDir string) {
 	tester.setNS(testNS, targetNS)
 
 	ipamResult := ipamtest.GenerateIPAMResult("0.4.0", tc.addresses, tc.routes, tc.dns)
-	ipamMock.EXPECT().Add(mock.Any(), mock.Any()).Return(ipamResult, nil).AnyTimes()
+	ipamMock.EXPECT().Add(mock.Any(), mock.Any(), mock.Any()).Return(ipamResult, nil)
 
 	// Mock ovs output while get ovs port external configuration
-	ovsPortname := util.GenerateContainerInterfaceName(testPod, testPodNamespace)
+	ovsPortname := util.PortNameForPod(testPod, testPodNamespace)
 	ovsPortUUID := uuid.New().String()
-	ovsServiceMock.EXPECT().CreatePort(ovsPortname, ovsPortname, mock.Any()).Return(ovsPortUUID, nil).AnyTimes()
+	// The IPv4 address is the one persisted in the external IDs for the test cases.
+	externalIDsMatcher := newOVSExternalIDsMatcher(ipamResult.IPs[0].Address.IP)
+	ovsServiceMock.EXPECT().CreatePort(ovsPortname, ovsPortname, externalIDsMatcher).Return(ovsPortUUID, nil).AnyTimes()
 	ovsServiceMock.EXPECT().GetOFPort(ovsPortname).Return(int32(10), nil).AnyTimes()
 	ofServiceMock.EXPECT().InstallPodFlows(ovsPortname, mock.Any(), mock.Any(), mock.Any(), mock.Any()).Return(nil)
 
@@ -500,6 +927,7 @@ func cmdAddDelCheckTest(testNS ns.NetNS, tc testCase, dataDir string) {
 	require.Nil(err)
 
 	require.NotNil(prevResult)
+	checkOVSPortExternalIDs(tc.t, externalIDsMatcher.externalIDs, prevResult)
 
 	confString := tc.netConfJSON(dataDir)
 
@@ -516,9 +944,19 @@ func cmdAddDelCheckTest(testNS ns.NetNS, tc testCase, dataDir string) {
 	// Test CHECK
 	tester.cmdCheckTest(tc, newConf, dataDir)
 
+	if len(tc.reassignAddresses) > 0 {
+		tester.reassignIPTest(tc, ovsPortname, 10)
+	}
+
+	if tc.repairInterface {
+		newNS := tester.repairInterfaceTest(tc, ovsPortname, ovsPortUUID, 10)
+		defer newNS.Close()
+	}
+
 	// Test delete
+	ipamMock.EXPECT().Del(mock.Any(), mock.Any(), mock.Any()).Return(tc.ipamDelErr)
 	ovsServiceMock.EXPECT().DeletePort(ovsPortUUID).Return(nil).AnyTimes()
-	ofServiceMock.EXPECT().UninstallPodFlows(ovsPortname).Return(nil)
+	ofServiceMock.EXPECT().UninstallPodFlows(ovsPortname, mock.Any()).Return(nil)
 	tester.cmdDelTest(tc, dataDir)
 }
 
@@ -539,8 +977,6 @@ func TestAntreaServerFunc(t *testing.T) {
 	defer controller.Finish()
 	ipamMock = ipamtest.NewMockIPAMDriver(controller)
 	_ = ipam.RegisterIPAMDriver("mock", ipamMock)
-	ovsServiceMock = ovsconfigtest.NewMockOVSBridgeClient(controller)
-	ofServiceMock = openflowtest.NewMockClient(controller)
 
 	var originalNS ns.NetNS
 	var dataDir string
@@ -554,8 +990,12 @@ func TestAntreaServerFunc(t *testing.T) {
 		dataDir, err = ioutil.TempDir("", "antrea_server_test")
 		require.Nil(t, err)
 
-		ipamMock.EXPECT().Del(mock.Any(), mock.Any()).Return(nil).AnyTimes()
-		ipamMock.EXPECT().Check(mock.Any(), mock.Any()).Return(nil).AnyTimes()
+		// New mocks are created for each test case, so that expectations set with AnyTimes
+		// by a previous test case are not matched.
+		ovsServiceMock = ovsconfigtest.NewMockOVSBridgeClient(controller)
+		ofServiceMock = openflowtest.NewMockClient(controller)
+
+		ipamMock.EXPECT().Check(mock.Any(), mock.Any(), mock.Any()).Return(nil).AnyTimes()
 
 		ovsServiceMock.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{}, nil).AnyTimes()
 	}
@@ -577,9 +1017,83 @@ func TestAntreaServerFunc(t *testing.T) {
 			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
 			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
 		},
+		{
+			name:       "ADD/DEL/CHECK with routes from Pod annotation",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs: []string{"10.1.2.1/24"},
+			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			podRoutes:       `[{"dst": "172.16.0.0/16", "gw": "10.1.2.254"}]`,
+			expExtraRoutes:  []string{"172.16.0.0/16,10.1.2.254"},
+		},
+		{
+			name:       "ADD/CHECK/reassign IP/DEL for 0.4.0 config",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs:   []string{"10.1.2.1/24"},
+			addresses:         []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:            []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			reassignAddresses: []string{"10.1.2.101/24,10.1.2.1,4"},
+		},
+		{
+			name:       "ADD/DEL/CHECK with fq_codel qdisc",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs: []string{"10.1.2.1/24"},
+			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			qdisc:           "fq_codel",
+		},
+		{
+			name:       "ADD/DEL/CHECK with txQueueLen",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs: []string{"10.1.2.1/24"},
+			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			txQueueLen:      5000,
+		},
+		{
+			name:       "ADD/CHECK/DEL with IPAM DEL failure",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs: []string{"10.1.2.1/24"},
+			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			ipamDelErr:      fmt.Errorf("failed to release IP address"),
+		},
+		{
+			name:       "ADD/CHECK/repair interface/DEL for 0.4.0 config",
+			cniVersion: "0.4.0",
+			ranges: []rangeInfo{{
+				subnet: "10.1.2.0/24",
+			}},
+			expGatewayCIDRs: []string{"10.1.2.1/24"},
+			addresses:       []string{"10.1.2.100/24,10.1.2.1,4"},
+			routes:          []string{"10.0.0.0/8,10.1.2.1", "0.0.0.0/0,10.1.2.1"},
+			repairInterface: true,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			if tc.qdisc != "" {
+				supported, err := isQdiscSupported(tc.qdisc)
+				require.Nil(t, err)
+				if !supported {
+					t.Skipf("Qdisc %s is not supported by the kernel", tc.qdisc)
+				}
+			}
 			setup()
 			defer teardown()
 			tc.t = t
@@ -588,12 +1102,181 @@ func TestAntreaServerFunc(t *testing.T) {
 	}
 }
 
+// TestNetConfJSON checks that the network configurations generated for the test cases are valid
+// and match the test case, in particular for IPv6 and dual-stack ranges.
+func TestNetConfJSON(t *testing.T) {
+	ranges := rangesForSubnets("10.1.2.0/24", "fd00:10:1:2::/64")
+	tc := testCase{
+		cniVersion: "0.4.0",
+		ranges:     ranges,
+		ipamRoutes: []string{"10.0.0.0/8", "fd00::/8,fd00:10:1:2::fe"},
+	}
+	subnetString := func(subnet types.IPNet) string {
+		ipNet := net.IPNet(subnet)
+		return ipNet.String()
+	}
+	conf := &Net{}
+	require.Nil(t, json.Unmarshal([]byte(tc.netConfJSON("/tmp/data")), conf))
+	assert.Equal(t, "0.4.0", conf.CNIVersion)
+	assert.Equal(t, "/tmp/data", conf.IPAM.DataDir)
+	require.Len(t, conf.IPAM.Ranges, 2)
+	assert.Equal(t, "10.1.2.0/24", subnetString(conf.IPAM.Ranges[0][0].Subnet))
+	assert.Equal(t, "fd00:10:1:2::/64", subnetString(conf.IPAM.Ranges[1][0].Subnet))
+	require.Len(t, conf.IPAM.Routes, 2)
+	assert.Equal(t, "10.0.0.0/8", conf.IPAM.Routes[0].Dst.String())
+	assert.Nil(t, conf.IPAM.Routes[0].GW)
+	assert.Equal(t, "fd00::/8", conf.IPAM.Routes[1].Dst.String())
+	assert.Equal(t, "fd00:10:1:2::fe", conf.IPAM.Routes[1].GW.String())
+
+	assert.Equal(t, []string{"10.1.2.1/24", "fd00:10:1:2::1/64"}, gatewayCIDRsForRanges(ranges))
+	assert.Equal(t, []string{"10.1.2.100/24,10.1.2.1,4", "fd00:10:1:2::64/64,fd00:10:1:2::1,6"}, addressesForRanges(ranges, 100))
+	assert.Equal(t, []string{"0.0.0.0/0,10.1.2.1", "::/0,fd00:10:1:2::1"}, defaultRoutesForRanges(ranges))
+
+	// Existing configurations without routes are unchanged.
+	tc = testCase{cniVersion: "0.4.0", subnet: "10.1.2.0/24", gateway: "10.1.2.1"}
+	conf = &Net{}
+	require.Nil(t, json.Unmarshal([]byte(tc.netConfJSON("")), conf))
+	assert.Equal(t, "10.1.2.0/24", subnetString(conf.IPAM.Range.Subnet))
+	assert.Nil(t, conf.IPAM.Routes)
+}
+
+// TestReconcileMissingGatewayPort checks that the gateway port is re-created during the startup
+// reconciliation of the CNI server when it cannot be found in OVSDB, and that the gateway flows
+// are installed for the new port.
+func TestReconcileMissingGatewayPort(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	ovsMock := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	ofMock := openflowtest.NewMockClient(controller)
+
+	hostNS, err := testutils.NewNS()
+	require.Nil(t, err)
+	defer hostNS.Close()
+
+	// The NodeConfig is copied since the gateway MAC address is updated by reconciliation.
+	nodeConfig := *testNodeConfig
+	gateway := *testNodeConfig.Gateway
+	nodeConfig.Gateway = &gateway
+	gwName := gateway.Name
+	gwIPNet := &net.IPNet{IP: gateway.IPv4, Mask: nodeConfig.PodCIDR.Mask}
+
+	ifaceStore := agent.NewInterfaceStore()
+	server := cniserver.New(testSock, "", 1450, &nodeConfig, ovsMock, ofMock, ifaceStore, k8sFake.NewSimpleClientset(), cniserver.Options{})
+
+	gwPortUUID := uuid.New().String()
+	ovsMock.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{}, nil)
+	// OVS creates the host link when the internal port is added to the bridge: a veth link is
+	// used instead.
+	ovsMock.EXPECT().CreateInternalPort(gwName, int32(agent.HostGatewayOFPort), nil).DoAndReturn(
+		func(name string, ofPortRequest int32, externalIDs map[string]interface{}) (string, ovsconfig.Error) {
+			veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: name}, PeerName: name + "-peer"}
+			if err := netlink.LinkAdd(veth); err != nil {
+				return "", ovsconfig.NewTransactionError(err, false)
+			}
+			return gwPortUUID, nil
+		})
+	// The gateway MTU must be set like when the agent is initialized.
+	ovsMock.EXPECT().SetInterfaceMTU(gwName, 1450).Return(nil)
+	ovsMock.EXPECT().WaitForPorts([]string{gwName}, agent.OVSPortsReadyTimeout).Return(nil)
+	var gwMAC net.HardwareAddr
+	ofMock.EXPECT().InstallGatewayFlows(gateway.IPv4, mock.Any(), uint32(agent.HostGatewayOFPort)).DoAndReturn(
+		func(gatewayAddr net.IP, gatewayMAC net.HardwareAddr, gatewayOFPort uint32) error {
+			gwMAC = gatewayMAC
+			return nil
+		})
+
+	err = hostNS.Do(func(ns.NetNS) error {
+		if err := server.Initialize(); err != nil {
+			return err
+		}
+		link, err := netlink.LinkByName(gwName)
+		if err != nil {
+			return err
+		}
+		assert.NotZero(t, link.Attrs().Flags&net.FlagUp, "Gateway link should be up")
+		assert.Equal(t, link.Attrs().HardwareAddr, gwMAC, "Gateway flows should use the MAC address of the new link")
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return err
+		}
+		require.Len(t, addrs, 1)
+		assert.Equal(t, gwIPNet.String(), addrs[0].IPNet.String())
+		return nil
+	})
+	require.Nil(t, err)
+
+	gwConfig, found := ifaceStore.GetInterface(gwName)
+	require.True(t, found, "Gateway interface should have been added to the store")
+	assert.Equal(t, agent.GatewayInterface, gwConfig.Type)
+	assert.Equal(t, gwPortUUID, gwConfig.PortUUID)
+	assert.Equal(t, int32(agent.HostGatewayOFPort), gwConfig.OFPort)
+	assert.Equal(t, gwMAC, nodeConfig.Gateway.MAC)
+}
+
+// TestReconcileMissingGatewayPortWithoutPodCIDR checks that the gateway port is re-created without
+// an IP address or flows if no PodCIDR is assigned to the Node yet.
+func TestReconcileMissingGatewayPortWithoutPodCIDR(t *testing.T) {
+	controller := mock.NewController(t)
+	defer controller.Finish()
+	ovsMock := ovsconfigtest.NewMockOVSBridgeClient(controller)
+	ofMock := openflowtest.NewMockClient(controller)
+
+	hostNS, err := testutils.NewNS()
+	require.Nil(t, err)
+	defer hostNS.Close()
+
+	nodeConfig := *testNodeConfig
+	gateway := *testNodeConfig.Gateway
+	nodeConfig.Gateway = &gateway
+	nodeConfig.PodCIDR = nil
+	gwName := gateway.Name
+
+	ifaceStore := agent.NewInterfaceStore()
+	server := cniserver.New(testSock, "", 1450, &nodeConfig, ovsMock, ofMock, ifaceStore, k8sFake.NewSimpleClientset(), cniserver.Options{})
+
+	ovsMock.EXPECT().GetPortList().Return([]ovsconfig.OVSPortData{}, nil)
+	ovsMock.EXPECT().CreateInternalPort(gwName, int32(agent.HostGatewayOFPort), nil).DoAndReturn(
+		func(name string, ofPortRequest int32, externalIDs map[string]interface{}) (string, ovsconfig.Error) {
+			veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: name}, PeerName: name + "-peer"}
+			if err := netlink.LinkAdd(veth); err != nil {
+				return "", ovsconfig.NewTransactionError(err, false)
+			}
+			return uuid.New().String(), nil
+		})
+	ovsMock.EXPECT().SetInterfaceMTU(gwName, 1450).Return(nil)
+	ovsMock.EXPECT().WaitForPorts([]string{gwName}, agent.OVSPortsReadyTimeout).Return(nil)
+
+	err = hostNS.Do(func(ns.NetNS) error {
+		if err := server.Initialize(); err != nil {
+			return err
+		}
+		link, err := netlink.LinkByName(gwName)
+		if err != nil {
+			return err
+		}
+		assert.NotZero(t, link.Attrs().Flags&net.FlagUp, "Gateway link should be up")
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return err
+		}
+		assert.Empty(t, addrs, "No IP address should be assigned to the gateway without a PodCIDR")
+		return nil
+	})
+	require.Nil(t, err)
+	_, found := ifaceStore.GetInterface(gwName)
+	assert.True(t, found, "Gateway interface should have been added to the store")
+}
+
 func init() {
 	nodeName := "node1"
-	gwIP := net.ParseIP("192.168.1.1")
 	gwMAC, _ := net.ParseMAC("11:11:11:11:11:11")
-	nodeGateway := &agent.Gateway{IP: gwIP, MAC: gwMAC, Name: "gw"}
-	_, nodePodeCIDR, _ := net.ParseCIDR("192.168.1.0/24")
-
-	testNodeConfig = &agent.NodeConfig{bridge, nodeName, nodePodeCIDR, nodeGateway}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec:       v1.NodeSpec{PodCIDR: "192.168.1.0/24"},
+	}
+	var err error
+	testNodeConfig, err = agenttest.NodeConfigForNode(k8sFake.NewSimpleClientset(node), nodeName, bridge, "gw", gwMAC)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to generate test NodeConfig: %v", err))
+	}
 }
@@ -77,7 +77,7 @@ type testConfig struct {
 }
 
 func TestConnectivityFlows(t *testing.T) {
-	c = ofClient.NewClient(br)
+	c = ofClient.NewClient(br, ofClient.DefaultCTZone)
 	err := ofTestUtils.PrepareOVSBridge(br)
 	if err != nil {
 		t.Errorf("failed to prepare OVS bridge: %v", br)
@@ -100,6 +100,7 @@ func TestConnectivityFlows(t *testing.T) {
 		testInstallNodeFlows,
 		testInstallPodFlows,
 		testUninstallPodFlows,
+		testUninstallPodFlowsOFPortChanged,
 		testUninstallNodeFlows,
 	} {
 		f(t, config)
@@ -173,7 +174,7 @@ func testInstallPodFlows(t *testing.T, config *testConfig) {
 
 func testUninstallPodFlows(t *testing.T, config *testConfig) {
 	for _, pod := range config.localPods {
-		err := c.UninstallPodFlows(pod.name)
+		err := c.UninstallPodFlows(pod.name, pod.ofPort)
 		if err != nil {
 			t.Fatalf("Failed to uninstall Openflow entries for pod: %v", err)
 		}
@@ -183,8 +184,35 @@ func testUninstallPodFlows(t *testing.T, config *testConfig) {
 	}
 }
 
+// testUninstallPodFlowsOFPortChanged checks that UninstallPodFlows removes the Pod flows for both
+// the ofport used when installing them and the current ofport, when the latter changed in-between
+// and the new flows were installed by another client (e.g. after an agent restart).
+func testUninstallPodFlowsOFPortChanged(t *testing.T, config *testConfig) {
+	otherClient := ofClient.NewClient(br, ofClient.DefaultCTZone)
+	for _, pod := range config.localPods {
+		err := c.InstallPodFlows(pod.name, pod.ip, pod.mac, config.localGateway.mac, pod.ofPort)
+		if err != nil {
+			t.Fatalf("Failed to install Openflow entries for pod: %v", err)
+		}
+		newOFPort := pod.ofPort + 100
+		err = otherClient.InstallPodFlows(pod.name, pod.ip, pod.mac, config.localGateway.mac, newOFPort)
+		if err != nil {
+			t.Fatalf("Failed to install Openflow entries for pod with new ofport: %v", err)
+		}
+		err = c.UninstallPodFlows(pod.name, newOFPort)
+		if err != nil {
+			t.Fatalf("Failed to uninstall Openflow entries for pod: %v", err)
+		}
+		for _, ofPort := range []uint32{pod.ofPort, newOFPort} {
+			for _, tableFlow := range preparePodFlows(pod.ip, pod.mac, ofPort, config.localGateway.mac, config.globalMAC) {
+				ofTestUtils.CheckFlowExists(t, config.bridge, tableFlow.tableID, false, tableFlow.flows)
+			}
+		}
+	}
+}
+
 func TestNetworkPolicyFlows(t *testing.T) {
-	c = ofClient.NewClient(br)
+	c = ofClient.NewClient(br, ofClient.DefaultCTZone)
 	err := ofTestUtils.PrepareOVSBridge(br)
 	require.Nil(t, err, fmt.Sprintf("Failed to prepare OVS bridge %s", br))
 
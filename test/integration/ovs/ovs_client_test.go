@@ -16,10 +16,13 @@ package ovs
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/dbtransaction"
 	"github.com/TomCodeLV/OVSDB-golang-lib/pkg/ovsdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -46,7 +49,7 @@ func (data *testData) setup(t *testing.T) {
 	// socket.
 	connectErrorCh := make(chan error, 0)
 	connect := func() {
-		data.ovsdb, err = ovsconfig.NewOVSDBConnectionUDS(UDSAddress)
+		data.ovsdb, err = ovsconfig.NewOVSDBConnectionUDS(UDSAddress, nil)
 		connectErrorCh <- err
 	}
 	go connect()
@@ -63,10 +66,10 @@ func (data *testData) setup(t *testing.T) {
 }
 
 func (data *testData) teardown(t *testing.T) {
-	if err := data.br.Delete(); err != nil {
+	if err := data.br.Delete(); err != nil && err != ovsconfig.ErrBridgeNotFound {
 		t.Errorf("Error when deleting bridge: %v", err)
 	}
-	data.ovsdb.Close()
+	ovsconfig.CloseOVSDBConnection(data.ovsdb)
 }
 
 func TestOVSBridge(t *testing.T) {
@@ -123,6 +126,191 @@ func TestOVSDeletePortIdempotent(t *testing.T) {
 	testDeletePort(t, data.br, uuid)
 }
 
+// TestOVSDeletePortsMarkedForGC verifies that DeletePortsMarkedForGC only deletes the ports marked
+// with MarkPortsForGC, and that marking a port preserves its other external IDs.
+func TestOVSDeletePortsMarkedForGC(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	deleteAllPorts(t, data.br)
+
+	uuid1 := testCreatePort(t, data.br, "p1", "internal")
+	uuid2 := testCreatePort(t, data.br, "p2", "internal")
+	require.Nil(t, data.br.MarkPortsForGC([]string{uuid1}), "Error when marking port for GC")
+
+	port, err := data.br.GetPortData(uuid1, "p1")
+	require.Nil(t, err, "Error when getting port data")
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2", ovsconfig.GCExternalIDKey: "true"}, port.ExternalIDs)
+
+	deleted, err := data.br.DeletePortsMarkedForGC()
+	require.Nil(t, err, "Error when deleting ports marked for GC")
+	assert.Equal(t, []string{"p1"}, deleted)
+
+	portList, err := data.br.GetPortUUIDList()
+	require.Nil(t, err, "Error when retrieving port list")
+	assert.Equal(t, []string{uuid2}, portList)
+
+	// Nothing is deleted when no port is marked.
+	deleted, err = data.br.DeletePortsMarkedForGC()
+	require.Nil(t, err, "Error when deleting ports marked for GC")
+	assert.Empty(t, deleted)
+}
+
+// TestOVSCreatePorts verifies that multiple ports can be created in a single transaction with
+// CreatePorts.
+func TestOVSCreatePorts(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	deleteAllPorts(t, data.br)
+
+	specs := []ovsconfig.PortSpec{
+		{Name: "p1", IFName: "p1", IFType: "internal", OFPortRequest: 10, ExternalIDs: map[string]interface{}{"k1": "v1"}},
+		{Name: "p2", IFName: "p2", IFType: "vxlan", OFPortRequest: 11, Options: map[string]interface{}{"key": "flow", "remote_ip": "flow"}},
+	}
+	uuids, err := data.br.CreatePorts(specs)
+	require.Nil(t, err, "Failed to create ports")
+	require.Len(t, uuids, len(specs))
+
+	for i, spec := range specs {
+		ofPort, err := data.br.GetOFPort(spec.IFName)
+		require.Nilf(t, err, "Failed to get ofport for port %s", spec.Name)
+		assert.Equal(t, spec.OFPortRequest, ofPort, "ofport does not match the requested value for port %s", spec.Name)
+
+		port, err := data.br.GetPortData(uuids[i], spec.IFName)
+		require.Nilf(t, err, "Failed to get port (%s, %s)", uuids[i], spec.IFName)
+		require.NotNilf(t, port, "Port (%s, %s) not found", uuids[i], spec.IFName)
+		assert.Equal(t, spec.Name, port.Name)
+		for k, v := range spec.ExternalIDs {
+			assert.Equalf(t, v.(string), port.ExternalIDs[k], "Returned port has an unexpected external id: %s", k)
+		}
+	}
+
+	// The second transaction should fail since the interface names are already in use. No port
+	// should be created.
+	_, err = data.br.CreatePorts([]ovsconfig.PortSpec{
+		{Name: "p3", IFName: "p3", IFType: "internal"},
+		{Name: "p1", IFName: "p1", IFType: "internal"},
+	})
+	assert.NotNil(t, err, "Expected port creation to fail because of duplicate interface name")
+	portList, err := data.br.GetPortUUIDList()
+	require.Nil(t, err, "Error when retrieving port list")
+	assert.Len(t, portList, len(specs), "No port should have been created by the failed transaction")
+
+	deleteAllPorts(t, data.br)
+}
+
+// TestOVSReplacePort verifies that a port can be replaced in a single transaction by a new port with
+// the same name and ofport.
+func TestOVSReplacePort(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	deleteAllPorts(t, data.br)
+
+	oldUUID := testCreatePort(t, data.br, "p1", "internal")
+	spec := ovsconfig.PortSpec{Name: "p1", IFName: "p1", IFType: "internal", OFPortRequest: ofPortRequest, ExternalIDs: map[string]interface{}{"k1": "v3"}}
+	newUUID, err := data.br.ReplacePort(oldUUID, spec)
+	require.Nil(t, err, "Failed to replace port")
+	assert.NotEqual(t, oldUUID, newUUID)
+
+	portList, err := data.br.GetPortUUIDList()
+	require.Nil(t, err, "Error when retrieving port list")
+	assert.Equal(t, []string{newUUID}, portList)
+	ofPort, err := data.br.GetOFPort("p1")
+	require.Nil(t, err, "Failed to get ofport")
+	assert.Equal(t, ofPortRequest, ofPort)
+	port, err := data.br.GetPortData(newUUID, "p1")
+	require.Nil(t, err, "Failed to get port data")
+	assert.Equal(t, map[string]string{"k1": "v3"}, port.ExternalIDs)
+
+	deleteAllPorts(t, data.br)
+}
+
+// TestOVSTunnelPortOFPortRequest verifies that a tunnel port is assigned the requested ofport, and
+// that creating a tunnel port fails if the requested ofport is already in use.
+func TestOVSTunnelPortOFPortRequest(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	deleteAllPorts(t, data.br)
+
+	const tunOFPort int32 = 30
+	uuid, err := data.br.CreateVXLANPort("tun0", tunOFPort, "", nil)
+	require.Nil(t, err, "Failed to create tunnel port with requested ofport")
+	ofPort, err := data.br.GetOFPort("tun0")
+	require.Nil(t, err, "Failed to get ofport for tunnel port")
+	assert.Equal(t, tunOFPort, ofPort)
+	testDeletePort(t, data.br, uuid)
+
+	// Use the ofport for an internal port, so that it cannot be assigned to the tunnel port.
+	_, err = data.br.CreateInternalPort("p1", tunOFPort, nil)
+	require.Nil(t, err, "Failed to create internal port")
+	_, err = data.br.CreateGenevePort("tun1", tunOFPort, "", nil)
+	assert.NotNil(t, err, "Expected tunnel port creation to fail because of ofport collision")
+	portList, err := data.br.GetPortUUIDList()
+	require.Nil(t, err, "Error when retrieving port list")
+	assert.Len(t, portList, 1, "Tunnel port with unexpected ofport should have been deleted")
+
+	deleteAllPorts(t, data.br)
+}
+
+// TestOVSBridgeDeleteWithoutUUID verifies that Delete can be called on an OVSBridge for which the
+// bridge UUID is not known, and that ErrBridgeNotFound is returned when the bridge does not exist.
+func TestOVSBridgeDeleteWithoutUUID(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	// This OVSBridge object has an empty UUID since Create was never called on it.
+	br := ovsconfig.NewOVSBridge(bridgeName, "system", data.ovsdb)
+	require.Nil(t, br.Delete(), "Failed to delete existing bridge with unknown UUID")
+	assert.Equal(t, ovsconfig.ErrBridgeNotFound, br.Delete(), "Expected ErrBridgeNotFound when deleting bridge twice")
+
+	nonExistentBr := ovsconfig.NewOVSBridge("br-non-existent", "system", data.ovsdb)
+	assert.Equal(t, ovsconfig.ErrBridgeNotFound, nonExistentBr.Delete(), "Expected ErrBridgeNotFound for non-existent bridge")
+}
+
+// TestOVSBridgesSharedConnection verifies that two bridges can share a single OVSDB connection, and
+// that ports can be created concurrently on both of them.
+func TestOVSBridgesSharedConnection(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	otherBr := ovsconfig.NewOVSBridge(bridgeName+"-2", "system", data.ovsdb)
+	require.Nil(t, otherBr.Create(), "Failed to create second bridge on shared connection")
+	defer func() {
+		assert.Nil(t, otherBr.Delete(), "Failed to delete second bridge")
+	}()
+	deleteAllPorts(t, data.br)
+
+	const numPorts = 10
+	var wg sync.WaitGroup
+	createPorts := func(br *ovsconfig.OVSBridge, prefix string) {
+		defer wg.Done()
+		for i := 0; i < numPorts; i++ {
+			_, err := br.CreateInternalPort(fmt.Sprintf("%s%d", prefix, i), 0, nil)
+			assert.Nil(t, err, "Failed to create port")
+		}
+	}
+	wg.Add(2)
+	go createPorts(data.br, "p")
+	go createPorts(otherBr, "q")
+	wg.Wait()
+
+	for _, br := range []*ovsconfig.OVSBridge{data.br, otherBr} {
+		portList, err := br.GetPortUUIDList()
+		require.Nil(t, err, "Error when retrieving port list")
+		assert.Len(t, portList, numPorts)
+		deleteAllPorts(t, br)
+	}
+}
+
 // TestOVSBridgeExternalIDs tests getting and setting external IDs of the OVS
 // bridge.
 func TestOVSBridgeExternalIDs(t *testing.T) {
@@ -149,6 +337,123 @@ func TestOVSBridgeExternalIDs(t *testing.T) {
 	}
 }
 
+// TestOVSBridgeSpanningTree tests enabling and disabling STP and RSTP on the OVS bridge.
+func TestOVSBridgeSpanningTree(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	assert.Equal(t, false, getBridgeColumn(t, data, "stp_enable"), "STP should be disabled by default")
+	assert.Equal(t, false, getBridgeColumn(t, data, "rstp_enable"), "RSTP should be disabled by default")
+
+	require.Nil(t, data.br.SetSTPEnable(true), "Failed to enable STP on the bridge")
+	assert.Equal(t, true, getBridgeColumn(t, data, "stp_enable"))
+	require.Nil(t, data.br.SetSTPEnable(false), "Failed to disable STP on the bridge")
+	assert.Equal(t, false, getBridgeColumn(t, data, "stp_enable"))
+
+	require.Nil(t, data.br.SetRSTPEnable(true), "Failed to enable RSTP on the bridge")
+	assert.Equal(t, true, getBridgeColumn(t, data, "rstp_enable"))
+	require.Nil(t, data.br.SetRSTPEnable(false), "Failed to disable RSTP on the bridge")
+	assert.Equal(t, false, getBridgeColumn(t, data, "rstp_enable"))
+}
+
+func TestOVSBridgeMcastSnooping(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	assert.Equal(t, false, getBridgeColumn(t, data, "mcast_snooping_enable"), "Multicast snooping should be disabled by default")
+
+	require.Nil(t, data.br.SetMcastSnoopingEnable(true), "Failed to enable multicast snooping on the bridge")
+	assert.Equal(t, true, getBridgeColumn(t, data, "mcast_snooping_enable"))
+
+	getOtherConfig := func() map[string]string {
+		otherConfig := make(map[string]string)
+		for _, pair := range getBridgeColumn(t, data, "other_config").([]interface{})[1].([]interface{}) {
+			kv := pair.([]interface{})
+			otherConfig[kv[0].(string)] = kv[1].(string)
+		}
+		return otherConfig
+	}
+	floodKey := "mcast-snooping-disable-flood-unregistered"
+	require.Nil(t, data.br.SetMcastSnoopingDisableFloodUnregistered(true))
+	assert.Equal(t, "true", getOtherConfig()[floodKey])
+	require.Nil(t, data.br.SetMcastSnoopingDisableFloodUnregistered(false))
+	assert.Equal(t, "false", getOtherConfig()[floodKey])
+
+	require.Nil(t, data.br.SetMcastSnoopingEnable(false), "Failed to disable multicast snooping on the bridge")
+	assert.Equal(t, false, getBridgeColumn(t, data, "mcast_snooping_enable"))
+}
+
+func TestOVSInterfaceIngressPolicing(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	deleteAllPorts(t, data.br)
+	name := "p1"
+	_, err := data.br.CreateInternalPort(name, 0, nil)
+	require.Nil(t, err, "Failed to create internal port")
+	defer deleteAllPorts(t, data.br)
+
+	assert.Equal(t, float64(0), getInterfaceColumn(t, data, name, "ingress_policing_rate"), "Ingress policing should be disabled by default")
+
+	require.Nil(t, data.br.SetInterfaceIngressPolicing(name, 10000, 1000), "Failed to set ingress policing")
+	assert.Equal(t, float64(10000), getInterfaceColumn(t, data, name, "ingress_policing_rate"))
+	assert.Equal(t, float64(1000), getInterfaceColumn(t, data, name, "ingress_policing_burst"))
+
+	assert.NotNil(t, data.br.SetInterfaceIngressPolicing(name, -1, 0), "Negative rate should be rejected")
+
+	require.Nil(t, data.br.ClearInterfaceIngressPolicing(name), "Failed to clear ingress policing")
+	assert.Equal(t, float64(0), getInterfaceColumn(t, data, name, "ingress_policing_rate"))
+	assert.Equal(t, float64(0), getInterfaceColumn(t, data, name, "ingress_policing_burst"))
+}
+
+// getInterfaceColumn retrieves the value of the provided column in the Interface row with the
+// provided name.
+func TestOVSBridgeProtocols(t *testing.T) {
+	data := &testData{}
+	data.setup(t)
+	defer data.teardown(t)
+
+	expected := []interface{}{"set", []interface{}{ovsconfig.OpenFlow10, ovsconfig.OpenFlow13}}
+	assert.Equal(t, expected, getBridgeColumn(t, data, "protocols"), "Unexpected default protocols")
+
+	require.Nil(t, data.br.SetProtocols([]string{ovsconfig.OpenFlow13, ovsconfig.OpenFlow14}), "Failed to set protocols")
+	expected = []interface{}{"set", []interface{}{ovsconfig.OpenFlow13, ovsconfig.OpenFlow14}}
+	assert.Equal(t, expected, getBridgeColumn(t, data, "protocols"))
+
+	assert.NotNil(t, data.br.SetProtocols([]string{"OpenFlow16"}), "Expected error for unknown version")
+	assert.Equal(t, expected, getBridgeColumn(t, data, "protocols"))
+}
+
+func getInterfaceColumn(t *testing.T, data *testData, ifName string, column string) interface{} {
+	tx := data.ovsdb.Transaction("Open_vSwitch")
+	tx.Select(dbtransaction.Select{
+		Table:   "Interface",
+		Columns: []string{column},
+		Where:   [][]interface{}{{"name", "==", ifName}},
+	})
+	res, err, _ := tx.Commit()
+	require.Nil(t, err, "Transaction failed when selecting column %s", column)
+	require.Len(t, res[0].Rows, 1, "Interface %s not found", ifName)
+	return res[0].Rows[0].(map[string]interface{})[column]
+}
+
+// getBridgeColumn retrieves the value of the provided column in the Bridge row for the test bridge.
+func getBridgeColumn(t *testing.T, data *testData, column string) interface{} {
+	tx := data.ovsdb.Transaction("Open_vSwitch")
+	tx.Select(dbtransaction.Select{
+		Table:   "Bridge",
+		Columns: []string{column},
+		Where:   [][]interface{}{{"name", "==", bridgeName}},
+	})
+	res, err, _ := tx.Commit()
+	require.Nil(t, err, "Transaction failed when selecting column %s", column)
+	require.Len(t, res[0].Rows, 1, "Bridge %s not found", bridgeName)
+	return res[0].Rows[0].(map[string]interface{})[column]
+}
+
 func deleteAllPorts(t *testing.T, br *ovsconfig.OVSBridge) {
 	portList, err := br.GetPortUUIDList()
 	require.Nil(t, err, "Error when retrieving port list")
@@ -173,10 +478,10 @@ func testCreatePort(t *testing.T, br *ovsconfig.OVSBridge, name string, ifType s
 		uuid, err = br.CreateInternalPort(name, ofPortRequest, externalIDs)
 	case "vxlan":
 		externalIDs = map[string]interface{}{}
-		uuid, err = br.CreateVXLANPort(name, ofPortRequest, "")
+		uuid, err = br.CreateVXLANPort(name, ofPortRequest, "", nil)
 	case "geneve":
 		externalIDs = map[string]interface{}{}
-		uuid, err = br.CreateGenevePort(name, ofPortRequest, "")
+		uuid, err = br.CreateGenevePort(name, ofPortRequest, "", nil)
 	}
 
 	require.Nilf(t, err, "Failed to create %s port: %s", ifType, err)